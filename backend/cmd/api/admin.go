@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"habitcashback/internal/challenge"
+	"habitcashback/internal/proof"
+	"habitcashback/internal/store"
+)
+
+const (
+	adminKey          ctxKey = 2
+	minAdminTokenLen         = 32
+	adminRequestLimit        = 1 << 20
+)
+
+// adminCreds maps admin name to sha256(token). Admin tokens are separate from user
+// sessions: an sv1/sv2 session token never grants admin access.
+type adminCreds map[string][32]byte
+
+// parseAdminTokens parses ADMIN_TOKENS ("name:token,name:token").
+func parseAdminTokens(raw string) (adminCreds, error) {
+	creds := adminCreds{}
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, token, ok := strings.Cut(part, ":")
+		name, token = strings.TrimSpace(name), strings.TrimSpace(token)
+		if !ok || name == "" {
+			return nil, errors.New("invalid ADMIN_TOKENS entry (want name:token)")
+		}
+		if len(token) < minAdminTokenLen {
+			return nil, fmt.Errorf("admin token for %q must be at least %d characters", name, minAdminTokenLen)
+		}
+		if _, dup := creds[name]; dup {
+			return nil, fmt.Errorf("duplicate admin %q", name)
+		}
+		creds[name] = sha256.Sum256([]byte(token))
+	}
+	return creds, nil
+}
+
+// lookup returns the admin name for token, comparing against every entry in constant time.
+func (c adminCreds) lookup(token string) (string, bool) {
+	sum := sha256.Sum256([]byte(token))
+	found := ""
+	for name, want := range c {
+		if subtle.ConstantTimeCompare(sum[:], want[:]) == 1 {
+			found = name
+		}
+	}
+	return found, found != ""
+}
+
+func adminAuth(creds adminCreds) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := r.Header.Get("Authorization")
+			if h == "" || !strings.HasPrefix(h, "Bearer ") {
+				writeErr(w, http.StatusUnauthorized, "missing bearer token")
+				return
+			}
+			name, ok := creds.lookup(strings.TrimSpace(strings.TrimPrefix(h, "Bearer ")))
+			if !ok {
+				writeErr(w, http.StatusUnauthorized, "invalid admin token")
+				return
+			}
+			ctx := context.WithValue(r.Context(), adminKey, name)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// adminActor returns the audit actor for the authenticated admin
+func adminActor(ctx context.Context) string {
+	name, _ := ctx.Value(adminKey).(string)
+	return "admin:" + name
+}
+
+// challengeAdminStore is the subset of store.Store used by the admin API
+type challengeAdminStore interface {
+	ListAllChallenges(ctx context.Context) ([]store.Challenge, error)
+	GetChallenge(ctx context.Context, id string) (*store.Challenge, error)
+	CreateChallenge(ctx context.Context, c store.Challenge, actor string) (*store.Challenge, error)
+	UpdateChallenge(ctx context.Context, c store.Challenge, actor string) (*store.Challenge, error)
+	SetChallengeActive(ctx context.Context, id string, active bool, actor string) (*store.Challenge, error)
+}
+
+type challengeRequest struct {
+	ID          string         `json:"id"`
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	Days        int            `json:"days"`
+	Deposit     int64          `json:"deposit"`
+	ProofType   string         `json:"proofType"`
+	IsActive    *bool          `json:"isActive"`
+	StartsAt    *time.Time     `json:"startsAt"`
+	EndsAt      *time.Time     `json:"endsAt"`
+	Tiers       []tierRequest  `json:"tiers"`
+	SuccessRule *ruleRequest   `json:"successRule"`
+	ProofWindow *windowRequest `json:"proofWindow"`
+	MissingExif string         `json:"missingExifPolicy"` // "": accept
+}
+
+type tierRequest struct {
+	Deposit          int64   `json:"deposit"`
+	RequiredProofs   int     `json:"requiredProofs"`   // 0: every day
+	RewardMultiplier float64 `json:"rewardMultiplier"` // 0: 1.00x
+}
+
+type windowRequest struct {
+	Start string `json:"start"` // "05:00", challenge time zone
+	End   string `json:"end"`   // "07:00"
+}
+
+type ruleRequest struct {
+	MinSuccessRatio float64 `json:"minSuccessRatio"` // 0: 1.00 (every required day)
+	RestDays        int     `json:"restDays"`
+	RefundPolicy    string  `json:"refundPolicy"` // "": full
+}
+
+func (req challengeRequest) challenge() store.Challenge {
+	c := store.Challenge{
+		ID:          strings.TrimSpace(req.ID),
+		Title:       strings.TrimSpace(req.Title),
+		Description: strings.TrimSpace(req.Description),
+		Days:        req.Days,
+		Deposit:     req.Deposit,
+		ProofType:   strings.TrimSpace(req.ProofType),
+		IsActive:    true,
+		StartsAt:    req.StartsAt,
+		EndsAt:      req.EndsAt,
+
+		MinSuccessBps: store.MultiplierOne,
+		RefundPolicy:  store.RefundFull,
+
+		MissingExifPolicy: proof.MissingEXIFAccept,
+	}
+	if p := strings.TrimSpace(req.MissingExif); p != "" {
+		c.MissingExifPolicy = p
+	}
+	if req.IsActive != nil {
+		c.IsActive = *req.IsActive
+	}
+	if r := req.SuccessRule; r != nil {
+		if r.MinSuccessRatio != 0 {
+			c.MinSuccessBps = int(math.Round(r.MinSuccessRatio * store.MultiplierOne))
+		}
+		c.RestDays = r.RestDays
+		if p := strings.TrimSpace(r.RefundPolicy); p != "" {
+			c.RefundPolicy = p
+		}
+	}
+	for _, t := range req.Tiers {
+		bps := store.MultiplierOne
+		if t.RewardMultiplier != 0 {
+			bps = int(math.Round(t.RewardMultiplier * store.MultiplierOne))
+		}
+		c.Tiers = append(c.Tiers, store.Tier{Deposit: t.Deposit, RequiredProofs: t.RequiredProofs, RewardMultiplierBps: bps})
+	}
+	return c
+}
+
+func challengeJSON(c *store.Challenge) jsonMap {
+	return jsonMap{
+		"id":          c.ID,
+		"title":       c.Title,
+		"description": c.Description,
+		"days":        c.Days,
+		"deposit":     c.Deposit,
+		"proofType":   c.ProofType,
+		"isActive":    c.IsActive,
+		"startsAt":    c.StartsAt,
+		"endsAt":      c.EndsAt,
+		"updatedAt":   c.UpdatedAt,
+		"tiers":       tiersJSON(c),
+		"successRule": successRuleJSON(c),
+		"proofWindow": proofWindowJSON(c),
+
+		"missingExifPolicy": challenge.MissingEXIFPolicy(c),
+	}
+}
+
+func decodeChallengeRequest(w http.ResponseWriter, r *http.Request) (store.Challenge, bool) {
+	var req challengeRequest
+	dec := json.NewDecoder(io.LimitReader(r.Body, adminRequestLimit))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeErr(w, http.StatusBadRequest, "invalid json body")
+		return store.Challenge{}, false
+	}
+	if id := r.PathValue("id"); id != "" {
+		if req.ID != "" && req.ID != id {
+			writeErr(w, http.StatusBadRequest, "id cannot be changed")
+			return store.Challenge{}, false
+		}
+		req.ID = id
+	}
+	c := req.challenge()
+	if pw := req.ProofWindow; pw != nil {
+		start, errStart := proof.ParseClock(pw.Start)
+		end, errEnd := proof.ParseClock(pw.End)
+		if err := errors.Join(errStart, errEnd); err != nil {
+			writeErr(w, http.StatusUnprocessableEntity, "proofWindow: "+err.Error())
+			return store.Challenge{}, false
+		}
+		c.ProofWindowStart, c.ProofWindowEnd = start, end
+	}
+	if err := challenge.Validate(c); err != nil {
+		writeErr(w, http.StatusUnprocessableEntity, err.Error())
+		return store.Challenge{}, false
+	}
+	return c, true
+}
+
+// registerAdminRoutes mounts the challenge administration API under /admin/v1.
+func registerAdminRoutes(mux *http.ServeMux, creds adminCreds, st challengeAdminStore) {
+	guard := adminAuth(creds)
+
+	mux.Handle("/admin/v1/challenges", guard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		switch r.Method {
+		case http.MethodGet:
+			list, err := st.ListAllChallenges(ctx)
+			if err != nil {
+				log.Printf("[error] admin list challenges: %v", err)
+				writeErr(w, http.StatusInternalServerError, "list failed")
+				return
+			}
+			items := make([]jsonMap, len(list))
+			for i := range list {
+				items[i] = challengeJSON(&list[i])
+			}
+			writeJSON(w, http.StatusOK, jsonMap{"items": items})
+		case http.MethodPost:
+			c, ok := decodeChallengeRequest(w, r)
+			if !ok {
+				return
+			}
+			created, err := st.CreateChallenge(ctx, c, adminActor(r.Context()))
+			if errors.Is(err, store.ErrChallengeExists) {
+				writeErr(w, http.StatusConflict, "challenge already exists")
+				return
+			}
+			if err != nil {
+				log.Printf("[error] admin create challenge: %v", err)
+				writeErr(w, http.StatusInternalServerError, "create failed")
+				return
+			}
+			log.Printf("[admin] %s created challenge %s", adminActor(r.Context()), created.ID)
+			writeJSON(w, http.StatusCreated, challengeJSON(created))
+		default:
+			writeErr(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	})))
+
+	mux.Handle("/admin/v1/challenges/{id}", guard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		var (
+			c   *store.Challenge
+			err error
+		)
+		switch r.Method {
+		case http.MethodGet:
+			c, err = st.GetChallenge(ctx, r.PathValue("id"))
+		case http.MethodPut:
+			edit, ok := decodeChallengeRequest(w, r)
+			if !ok {
+				return
+			}
+			// Activation has its own endpoints so an edit cannot silently re-open a challenge
+			c, err = st.UpdateChallenge(ctx, edit, adminActor(r.Context()))
+		default:
+			writeErr(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if err != nil {
+			log.Printf("[error] admin challenge %s: %v", r.PathValue("id"), err)
+			writeErr(w, http.StatusInternalServerError, "request failed")
+			return
+		}
+		if c == nil {
+			writeErr(w, http.StatusNotFound, "challenge not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, challengeJSON(c))
+	})))
+
+	setActive := func(active bool) http.Handler {
+		return guard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				writeErr(w, http.StatusMethodNotAllowed, "method not allowed")
+				return
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+			defer cancel()
+
+			c, err := st.SetChallengeActive(ctx, r.PathValue("id"), active, adminActor(r.Context()))
+			if err != nil {
+				log.Printf("[error] admin set challenge active: %v", err)
+				writeErr(w, http.StatusInternalServerError, "request failed")
+				return
+			}
+			if c == nil {
+				writeErr(w, http.StatusNotFound, "challenge not found")
+				return
+			}
+			log.Printf("[admin] %s set challenge %s active=%t", adminActor(r.Context()), c.ID, active)
+			writeJSON(w, http.StatusOK, challengeJSON(c))
+		}))
+	}
+	mux.Handle("/admin/v1/challenges/{id}/activate", setActive(true))
+	mux.Handle("/admin/v1/challenges/{id}/deactivate", setActive(false))
+}
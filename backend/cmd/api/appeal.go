@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"habitcashback/internal/proof"
+	"habitcashback/internal/store"
+)
+
+const (
+	maxAppealNoteLen = 1000
+	maxAppealList    = 100
+)
+
+// appealStore is the subset of store.Store used by the user appeal API
+type appealStore interface {
+	GetUserByTossKey(ctx context.Context, tossUserKey string) (*store.User, error)
+	CreateAppeal(ctx context.Context, sub store.AppealSubmission) (*store.Appeal, error)
+	ListAppealsByUser(ctx context.Context, userID int64, limit int) ([]store.Appeal, error)
+}
+
+// appealJSON is the user's view of an appeal; reviewer details stay in the admin API
+func appealJSON(a *store.Appeal) jsonMap {
+	return jsonMap{
+		"id":             a.ID,
+		"challengeId":    a.ChallengeID,
+		"proofDate":      a.ProofDate.Format("2006-01-02"),
+		"status":         a.Status,
+		"decisionReason": a.DecisionReason,
+		"decidedAt":      a.DecidedAt,
+		"createdAt":      a.CreatedAt,
+	}
+}
+
+// appealErrors maps store errors to the status and message shown to the user
+var appealErrors = []struct {
+	err  error
+	code int
+	msg  string
+}{
+	{store.ErrAppealNoParticipation, http.StatusBadRequest, "해당 날짜에 참여 중인 챌린지가 없습니다"},
+	{store.ErrAppealDayOpen, http.StatusBadRequest, "오늘 인증은 이의신청 대신 다시 제출해주세요"},
+	{store.ErrAppealExpired, http.StatusBadRequest, "이의신청 기간(챌린지 종료 후 " + strconv.Itoa(store.AppealWindowDays) + "일)이 지났습니다"},
+	{store.ErrAppealDayCounted, http.StatusConflict, "이미 인정되었거나 검토 중인 날입니다"},
+	{store.ErrAppealExists, http.StatusConflict, "이미 이의신청한 날입니다"},
+}
+
+// registerAppealRoutes mounts /v1/proofs/appeals: a user contests a rejected or missed
+// day (POST) and follows up on their appeals (GET). Appeals are decided in the admin
+// review queue.
+func registerAppealRoutes(mux *http.ServeMux, guard func(http.Handler) http.Handler, allowedOrigins []string, st appealStore, images *proofImages) {
+	mux.Handle("/v1/proofs/appeals", guard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if preflight(w, r, allowedOrigins) {
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			writeErr(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		writeCORS(w, r, allowedOrigins)
+
+		var body struct {
+			ChallengeID string `json:"challengeId"`
+			ProofDate   string `json:"proofDate"`
+			Note        string `json:"note"`
+			ImageBase64 string `json:"imageBase64"`
+		}
+		var sub store.AppealSubmission
+		var photo *proof.ValidationResult
+		if r.Method == http.MethodPost {
+			if err := json.NewDecoder(io.LimitReader(r.Body, 10<<20)).Decode(&body); err != nil {
+				writeErr(w, http.StatusBadRequest, "invalid json body")
+				return
+			}
+			if strings.TrimSpace(body.ChallengeID) == "" {
+				writeErr(w, http.StatusBadRequest, "challengeId is required")
+				return
+			}
+			day, err := time.Parse("2006-01-02", body.ProofDate)
+			if err != nil {
+				writeErr(w, http.StatusBadRequest, "proofDate must be YYYY-MM-DD")
+				return
+			}
+			note := strings.TrimSpace(body.Note)
+			if note == "" {
+				writeErr(w, http.StatusBadRequest, "note is required")
+				return
+			}
+			if utf8.RuneCountInString(note) > maxAppealNoteLen {
+				writeErr(w, http.StatusBadRequest, "note must be at most "+strconv.Itoa(maxAppealNoteLen)+" characters")
+				return
+			}
+			sub = store.AppealSubmission{ChallengeID: body.ChallengeID, ProofDate: day, Note: note}
+			if body.ImageBase64 != "" {
+				// The extra photo only supports the note, so day and window rules do not apply
+				result, err := proof.ValidatePhotoProof(body.ImageBase64, proof.PhotoRules{})
+				if err != nil {
+					writeErr(w, http.StatusBadRequest, "invalid image: "+err.Error())
+					return
+				}
+				if !result.Valid {
+					writeErr(w, http.StatusBadRequest, "invalid image: "+strings.Join(result.Errors, ", "))
+					return
+				}
+				sub.ImageHash, photo = result.ImageHash, result
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		claims := mustClaims(r.Context())
+		user, err := st.GetUserByTossKey(ctx, claims.Sub)
+		if err != nil {
+			log.Printf("[error] get user for appeal: %v", err)
+			writeErr(w, http.StatusInternalServerError, "user lookup failed")
+			return
+		}
+
+		if r.Method == http.MethodGet {
+			items := []jsonMap{}
+			if user != nil {
+				list, err := st.ListAppealsByUser(ctx, user.ID, maxAppealList)
+				if err != nil {
+					log.Printf("[error] list appeals: %v", err)
+					writeErr(w, http.StatusInternalServerError, "appeals lookup failed")
+					return
+				}
+				for i := range list {
+					items = append(items, appealJSON(&list[i]))
+				}
+			}
+			writeJSON(w, http.StatusOK, jsonMap{"items": items})
+			return
+		}
+
+		var a *store.Appeal
+		if user == nil {
+			err = store.ErrAppealNoParticipation
+		} else {
+			sub.UserID = user.ID
+			if photo != nil {
+				sub.ImageURL = images.save(ctx, photo)
+			}
+			a, err = st.CreateAppeal(ctx, sub)
+		}
+		for _, e := range appealErrors {
+			if errors.Is(err, e.err) {
+				writeErr(w, e.code, e.msg)
+				return
+			}
+		}
+		if err != nil {
+			log.Printf("[error] create appeal: %v", err)
+			writeErr(w, http.StatusInternalServerError, "appeal failed")
+			return
+		}
+		writeJSON(w, http.StatusCreated, appealJSON(a))
+	})))
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"habitcashback/internal/clock"
+	"habitcashback/internal/payment"
+	"habitcashback/internal/reconcile"
+	"habitcashback/internal/store"
+)
+
+// paymentCancelStore is the subset of store.Store used by /v1/payments/cancel
+type paymentCancelStore interface {
+	reconcile.CancelStore
+	GetPaymentByID(ctx context.Context, paymentID int64) (*store.Payment, error)
+	GetUserByTossKey(ctx context.Context, tossUserKey string) (*store.User, error)
+	GetParticipationByPaymentID(ctx context.Context, paymentID int64) (*store.Participation, error)
+	ClaimPaymentCancel(ctx context.Context, paymentID int64) (*store.Payment, error)
+}
+
+// registerPaymentCancelRoute mounts /v1/payments/cancel, which refunds a paid participation
+// within the cancellation grace window. The payment is claimed ('cancelling') before the
+// provider is called; when the call fails the provider status decides whether the refund is
+// recorded or the claim released, and an unknown status leaves the claim to the reconcile job.
+// A nil store answers without touching the provider (in-memory mode).
+func registerPaymentCancelRoute(mux *http.ServeMux, guard func(http.Handler) http.Handler, allowedOrigins []string,
+	st paymentCancelStore, paymentSvc payment.Service, clk clock.Clock, cancelGrace time.Duration) {
+	clk = clock.OrSystem(clk)
+	mux.Handle("/v1/payments/cancel", guard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if preflight(w, r, allowedOrigins) {
+			return
+		}
+		if r.Method != http.MethodPost {
+			writeErr(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		writeCORS(w, r, allowedOrigins)
+
+		var body struct {
+			PaymentID int64  `json:"paymentId"`
+			Reason    string `json:"reason"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&body); err != nil {
+			writeErr(w, http.StatusBadRequest, "invalid json body")
+			return
+		}
+		if body.PaymentID <= 0 {
+			writeErr(w, http.StatusBadRequest, "paymentId is required")
+			return
+		}
+		reason := strings.TrimSpace(body.Reason)
+		if reason == "" {
+			reason = "사용자 요청"
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+		defer cancel()
+
+		if st == nil {
+			// Fallback for in-memory mode
+			writeJSON(w, http.StatusOK, jsonMap{"ok": true, "status": "refunded", "paymentId": body.PaymentID})
+			return
+		}
+
+		dbPayment, err := st.GetPaymentByID(ctx, body.PaymentID)
+		if err != nil || dbPayment == nil {
+			log.Printf("[error] get payment: %v", err)
+			writeErr(w, http.StatusBadRequest, "payment not found")
+			return
+		}
+
+		// Verify user owns this payment
+		claims := mustClaims(r.Context())
+		user, err := st.GetUserByTossKey(ctx, claims.Sub)
+		if err != nil || user == nil || user.ID != dbPayment.UserID {
+			writeErr(w, http.StatusForbidden, "not authorized")
+			return
+		}
+
+		if dbPayment.Status != "done" {
+			writeErr(w, http.StatusConflict, "payment is not cancellable")
+			return
+		}
+
+		part, err := st.GetParticipationByPaymentID(ctx, dbPayment.ID)
+		if err != nil {
+			log.Printf("[error] get participation: %v", err)
+			writeErr(w, http.StatusInternalServerError, "payment cancellation failed")
+			return
+		}
+		if err := canCancelParticipation(part, clk.Now(), cancelGrace); err != nil {
+			writeErr(w, http.StatusConflict, err.Error())
+			return
+		}
+
+		// Claim the payment so a concurrent cancel (or the unlink job) cannot refund it twice
+		claimed, err := st.ClaimPaymentCancel(ctx, dbPayment.ID)
+		if err != nil {
+			log.Printf("[error] claim payment cancel: %v", err)
+			writeErr(w, http.StatusInternalServerError, "payment cancellation failed")
+			return
+		}
+		if claimed == nil {
+			writeErr(w, http.StatusConflict, "payment is not cancellable")
+			return
+		}
+		dbPayment = claimed
+
+		var refunded *store.Payment
+		refundNo := ""
+		fully := true
+		if dbPayment.PayToken != "" {
+			cancelResp, err := paymentSvc.CancelPayment(ctx, dbPayment.PayToken, dbPayment.Amount, reason)
+			if err != nil {
+				// A timeout may still have refunded at the provider: settle the claim from its status.
+				log.Printf("[error] payment service cancel: %v", err)
+				sctx, scancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+				defer scancel()
+				refunded, err = reconcile.CompleteCancel(sctx, st, paymentSvc, dbPayment, reason)
+				if err != nil {
+					log.Printf("[error] settle payment cancel payment=%d (left for the reconcile job): %v", dbPayment.ID, err)
+					writeErr(w, http.StatusBadGateway, "payment cancellation pending")
+					return
+				}
+				if refunded == nil {
+					writeErr(w, http.StatusBadGateway, "payment cancellation failed")
+					return
+				}
+			} else {
+				refundNo = cancelResp.RefundNo
+				fully = cancelResp.Status == payment.StatusRefunded
+			}
+		}
+
+		if refunded == nil {
+			refunded, err = st.RefundPayment(ctx, dbPayment.ID, refundNo, dbPayment.Amount, fully, reason)
+			if err != nil {
+				// The PG refund went through; the payment stays 'cancelling' for the reconcile job.
+				log.Printf("[error] record refund payment=%d refundNo=%s: %v", body.PaymentID, refundNo, err)
+				writeErr(w, http.StatusInternalServerError, "refund recorded at PG but not in DB")
+				return
+			}
+		}
+
+		writeJSON(w, http.StatusOK, jsonMap{
+			"ok":        true,
+			"status":    refunded.Status,
+			"paymentId": refunded.ID,
+			"refundNo":  refundNo,
+			"amount":    refunded.Amount,
+		})
+	})))
+}
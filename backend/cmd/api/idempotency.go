@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"habitcashback/internal/store"
+)
+
+const (
+	idemTTL        = 24 * time.Hour // how long a response is replayed for the same key
+	idemMaxKeyLen  = 128
+	idemMaxBodyLen = 10 << 20 // matches the largest handler body (proof images)
+)
+
+// idemBackend stores idempotent responses.
+// Implemented by *store.Store and by idemStore (in-memory fallback without a DB).
+type idemBackend interface {
+	ReserveIdempotency(ctx context.Context, scope, key, userSub, requestHash string, ttl time.Duration) (*store.IdempotencyRecord, bool, error)
+	CompleteIdempotency(ctx context.Context, scope, key, userSub string, statusCode int, responseJSON []byte) error
+	ReleaseIdempotency(ctx context.Context, scope, key, userSub string) error
+}
+
+// idempotent replays the first response for a repeated Idempotency-Key from the same user,
+// so a client retrying after a network blip gets the original result instead of a conflict.
+// Requests without the header are processed normally. 5xx responses are not stored, so the
+// client can retry them. Must run inside auth (it keys records by the session subject).
+func idempotent(backend idemBackend, scope string, allowedOrigins []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := strings.TrimSpace(r.Header.Get("Idempotency-Key"))
+			if r.Method != http.MethodPost || key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			writeCORS(w, r, allowedOrigins)
+			if len(key) > idemMaxKeyLen {
+				writeErr(w, http.StatusBadRequest, "Idempotency-Key too long")
+				return
+			}
+
+			raw, err := io.ReadAll(io.LimitReader(r.Body, idemMaxBodyLen))
+			if err != nil {
+				writeErr(w, http.StatusBadRequest, "invalid body")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(raw))
+			sum := sha256.Sum256(raw)
+			requestHash := hex.EncodeToString(sum[:])
+			sub := mustClaims(r.Context()).Sub
+
+			rec, reserved, err := backend.ReserveIdempotency(r.Context(), scope, key, sub, requestHash, idemTTL)
+			if err != nil {
+				log.Printf("[error] idempotency reserve scope=%s: %v", scope, err)
+				writeErr(w, http.StatusServiceUnavailable, "please retry")
+				return
+			}
+			if !reserved {
+				switch {
+				case rec.RequestHash != requestHash:
+					writeErr(w, http.StatusUnprocessableEntity, "Idempotency-Key reused with a different request")
+				case !rec.Completed():
+					writeErr(w, http.StatusConflict, "request in progress")
+				default:
+					w.Header().Set("Content-Type", "application/json; charset=utf-8")
+					w.Header().Set("Idempotent-Replayed", "true")
+					w.WriteHeader(rec.StatusCode)
+					_, _ = w.Write(rec.Response)
+				}
+				return
+			}
+
+			rw := &responseRecorder{ResponseWriter: w}
+			next.ServeHTTP(rw, r)
+
+			// Persist even if the client went away; that is exactly when it will retry.
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 5*time.Second)
+			defer cancel()
+			status := rw.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			body := rw.body.Bytes()
+			if status >= 500 || !json.Valid(body) {
+				err = backend.ReleaseIdempotency(ctx, scope, key, sub)
+			} else {
+				err = backend.CompleteIdempotency(ctx, scope, key, sub, status, body)
+			}
+			if err != nil {
+				log.Printf("[error] idempotency store scope=%s: %v", scope, err)
+			}
+		})
+	}
+}
+
+// responseRecorder captures the status and body written by a handler while passing them through.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rw *responseRecorder) WriteHeader(code int) {
+	if rw.status == 0 {
+		rw.status = code
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *responseRecorder) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
+
+// idemStore is the in-memory idemBackend used when no database is configured.
+type idemStore struct {
+	mu    sync.Mutex
+	items map[string]*idemEntry
+}
+
+type idemEntry struct {
+	rec        store.IdempotencyRecord
+	reservedAt time.Time
+	expiresAt  time.Time
+}
+
+func newIdemStore() *idemStore {
+	return &idemStore{items: map[string]*idemEntry{}}
+}
+
+func idemStoreKey(scope, key, userSub string) string {
+	return scope + "\x00" + key + "\x00" + userSub
+}
+
+func (s *idemStore) ReserveIdempotency(ctx context.Context, scope, key, userSub, requestHash string, ttl time.Duration) (*store.IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for k, e := range s.items {
+		if now.After(e.expiresAt) {
+			delete(s.items, k)
+		}
+	}
+	k := idemStoreKey(scope, key, userSub)
+	if e, ok := s.items[k]; ok && (e.rec.Completed() || now.Sub(e.reservedAt) < store.IdempotencyLease) {
+		rec := e.rec
+		return &rec, false, nil
+	}
+	s.items[k] = &idemEntry{
+		rec:        store.IdempotencyRecord{RequestHash: requestHash},
+		reservedAt: now,
+		expiresAt:  now.Add(ttl),
+	}
+	return nil, true, nil
+}
+
+func (s *idemStore) CompleteIdempotency(ctx context.Context, scope, key, userSub string, statusCode int, responseJSON []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.items[idemStoreKey(scope, key, userSub)]
+	if !ok {
+		return errors.New("idempotency key not reserved")
+	}
+	e.rec.StatusCode = statusCode
+	e.rec.Response = append([]byte(nil), responseJSON...)
+	return nil
+}
+
+func (s *idemStore) ReleaseIdempotency(ctx context.Context, scope, key, userSub string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := idemStoreKey(scope, key, userSub)
+	if e, ok := s.items[k]; ok && !e.rec.Completed() {
+		delete(s.items, k)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"habitcashback/internal/blobstore"
+	"habitcashback/internal/proof"
+)
+
+// defaultImageBaseURL serves stored photos through the admin API (registerImageRoutes);
+// PROOF_IMAGE_BASE_URL can point at a CDN or bucket domain instead
+const defaultImageBaseURL = "/admin/v1/images"
+
+// imageRecorder is the subset of store.Store used to register stored photos
+type imageRecorder interface {
+	RecordProofImage(ctx context.Context, key, url string, size int64) (string, error)
+}
+
+// proofImages stores proof and appeal photos under content-addressed keys. A nil
+// *proofImages stores nothing.
+type proofImages struct {
+	blobs   blobstore.Store
+	st      imageRecorder
+	baseURL string
+}
+
+// save uploads a validated photo and returns the URL to record on the proof, or "" if it
+// could not be stored: losing the picture must not cost the user their proof.
+func (p *proofImages) save(ctx context.Context, result *proof.ValidationResult) string {
+	if p == nil || len(result.Data) == 0 {
+		return ""
+	}
+	// Uploads may outlast the handler's 5s database budget
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+	defer cancel()
+
+	key := blobstore.ContentKey("proofs", result.Data, "."+result.Format)
+	if err := p.blobs.Put(ctx, key, result.Data, "image/"+result.Format); err != nil {
+		log.Printf("[warn] store proof image %s: %v", key, err)
+		return ""
+	}
+	url, err := p.st.RecordProofImage(ctx, key, p.baseURL+"/"+key, int64(len(result.Data)))
+	if err != nil {
+		log.Printf("[warn] record proof image %s: %v", key, err)
+		return ""
+	}
+	return url
+}
+
+// registerImageRoutes mounts GET /admin/v1/images/{key...} so reviewers can view stored
+// proof and appeal photos
+func registerImageRoutes(mux *http.ServeMux, creds adminCreds, blobs blobstore.Store) {
+	mux.Handle("GET "+defaultImageBaseURL+"/{key...}", adminAuth(creds)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.PathValue("key")
+		if !blobstore.ValidKey(key) {
+			writeErr(w, http.StatusNotFound, "image not found")
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+		defer cancel()
+		data, err := blobs.Get(ctx, key)
+		if errors.Is(err, blobstore.ErrNotFound) {
+			writeErr(w, http.StatusNotFound, "image not found")
+			return
+		}
+		if err != nil {
+			log.Printf("[error] admin get image %s: %v", key, err)
+			writeErr(w, http.StatusInternalServerError, "image lookup failed")
+			return
+		}
+		w.Header().Set("Content-Type", http.DetectContentType(data))
+		w.Header().Set("Cache-Control", "private, max-age=86400, immutable")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Write(data)
+	})))
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const minSessionKeyLen = 32
+
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// keyring holds the HMAC keys for session tokens.
+// New tokens are signed as sv2 with the active key; every other key is verify-only, so a
+// rotated-out key keeps existing sessions valid until it is removed. The legacy secret
+// (SESSION_SECRET) only verifies sv1 tokens, and signs them when no keyring is configured.
+type keyring struct {
+	active string
+	keys   map[string]string
+	legacy string
+}
+
+func newKeyring(legacy, active string, keys map[string]string) (*keyring, error) {
+	kr := &keyring{active: active, keys: map[string]string{}, legacy: legacy}
+	for id, secret := range keys {
+		if !keyIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("invalid session key id %q", id)
+		}
+		if len(secret) < minSessionKeyLen {
+			return nil, fmt.Errorf("session key %q must be at least %d characters", id, minSessionKeyLen)
+		}
+		kr.keys[id] = secret
+	}
+	if active == "" && len(kr.keys) > 0 {
+		return nil, errors.New("active session key id is required")
+	}
+	if active != "" {
+		if _, ok := kr.keys[active]; !ok {
+			return nil, fmt.Errorf("active session key %q not in keyring", active)
+		}
+	}
+	if active == "" && legacy == "" {
+		return nil, errors.New("no session signing key configured")
+	}
+	return kr, nil
+}
+
+// sessionKeyFile is the SESSION_KEYS_FILE format:
+//
+//	{"active": "2025b", "keys": {"2025b": "...", "2025a": "..."}}
+type sessionKeyFile struct {
+	Active string            `json:"active"`
+	Keys   map[string]string `json:"keys"`
+}
+
+// loadKeyring builds the keyring from SESSION_KEYS_FILE, or from SESSION_KEYS
+// ("id:secret,id:secret") with SESSION_ACTIVE_KEY_ID defaulting to the first entry.
+// Without either, tokens keep being signed as sv1 with the legacy secret.
+func loadKeyring(legacy string) (*keyring, error) {
+	if path := strings.TrimSpace(os.Getenv("SESSION_KEYS_FILE")); path != "" {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read SESSION_KEYS_FILE: %w", err)
+		}
+		var f sessionKeyFile
+		if err := json.Unmarshal(raw, &f); err != nil {
+			return nil, fmt.Errorf("parse SESSION_KEYS_FILE: %w", err)
+		}
+		return newKeyring(legacy, strings.TrimSpace(f.Active), f.Keys)
+	}
+
+	active := strings.TrimSpace(os.Getenv("SESSION_ACTIVE_KEY_ID"))
+	keys, first, err := parseSessionKeys(os.Getenv("SESSION_KEYS"))
+	if err != nil {
+		return nil, err
+	}
+	if active == "" {
+		active = first
+	}
+	return newKeyring(legacy, active, keys)
+}
+
+func parseSessionKeys(raw string) (map[string]string, string, error) {
+	keys := map[string]string{}
+	first := ""
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, secret, ok := strings.Cut(part, ":")
+		id = strings.TrimSpace(id)
+		if !ok || id == "" {
+			return nil, "", fmt.Errorf("invalid SESSION_KEYS entry (want id:secret)")
+		}
+		if _, dup := keys[id]; dup {
+			return nil, "", fmt.Errorf("duplicate session key id %q", id)
+		}
+		keys[id] = strings.TrimSpace(secret)
+		if first == "" {
+			first = id
+		}
+	}
+	return keys, first, nil
+}
+
+// IDs returns the configured key ids, for startup logging (never log the secrets).
+func (kr *keyring) IDs() []string {
+	ids := make([]string, 0, len(kr.keys))
+	for id := range kr.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
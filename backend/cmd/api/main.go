@@ -13,14 +13,19 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"habitcashback/internal/blobstore"
+	"habitcashback/internal/challenge"
+	"habitcashback/internal/clock"
 	"habitcashback/internal/payment"
 	"habitcashback/internal/proof"
+	"habitcashback/internal/reconcile"
 	"habitcashback/internal/store"
 	"habitcashback/internal/toss"
 )
@@ -38,20 +43,39 @@ func main() {
 	// Example: "https://habitcashback.apps.tossmini.com,https://habitcashback.private-apps.tossmini.com"
 	allowedOrigins := parseAllowedOrigins(allowOriginsRaw)
 
+	// SESSION_SECRET verifies legacy sv1 tokens; SESSION_KEYS / SESSION_KEYS_FILE sign sv2 tokens
 	secret := strings.TrimSpace(os.Getenv("SESSION_SECRET"))
-	if secret == "" {
+	keysConfigured := strings.TrimSpace(os.Getenv("SESSION_KEYS")) != "" || strings.TrimSpace(os.Getenv("SESSION_KEYS_FILE")) != ""
+	if secret == "" && !keysConfigured {
 		if appEnv == "local" {
 			secret = mustRandomHex(32) // dev convenience
 			log.Printf("[warn] SESSION_SECRET not set. Using ephemeral local secret: %s...", secret[:8])
 		} else {
-			log.Fatal("SESSION_SECRET is required in non-local environments")
+			log.Fatal("SESSION_SECRET or SESSION_KEYS is required in non-local environments")
 		}
 	}
+	keys, err := loadKeyring(secret)
+	if err != nil {
+		log.Fatalf("invalid session keys: %v", err)
+	}
+	if keys.active != "" {
+		log.Printf("[info] session keyring: active=%s keys=%s legacy_sv1=%t", keys.active, strings.Join(keys.IDs(), ","), secret != "")
+	}
 
-	// Idempotency and simple rate limiting (MVP hardening)
-	idem := newIdemStore()
+	// Simple rate limiting (MVP hardening)
 	rl := newRateLimiter(120, time.Minute) // 120 req/min per IP
-	revoked := newRevokedStore()
+
+	// Participants may cancel and get a full refund shortly after paying, before any proof
+	cancelGrace, err := time.ParseDuration(getenv("PAYMENT_CANCEL_GRACE", "1h"))
+	if err != nil {
+		log.Fatalf("invalid PAYMENT_CANCEL_GRACE: %v", err)
+	}
+
+	// A photo must be taken on the day it proves, give or take this much around midnight
+	exifTolerance, err := time.ParseDuration(getenv("PROOF_EXIF_TOLERANCE", proof.DefaultDayTolerance.String()))
+	if err != nil || exifTolerance < 0 {
+		log.Fatalf("invalid PROOF_EXIF_TOLERANCE: %q", os.Getenv("PROOF_EXIF_TOLERANCE"))
+	}
 
 	// Apps in Toss mTLS client (optional in local; required in staging/prod)
 	var tossClient *toss.Client
@@ -79,6 +103,17 @@ func main() {
 		log.Printf("[info] DATABASE_URL not set, using in-memory mode")
 	}
 
+	// Proof photos are kept for reviewers and appeals when BLOB_BACKEND is set (disk or s3)
+	var images *proofImages
+	var blobs blobstore.Store
+	if strings.TrimSpace(os.Getenv("BLOB_BACKEND")) == "" {
+		log.Printf("[info] BLOB_BACKEND not set, proof images are not stored")
+	} else if blobs, err = blobstore.NewFromEnv(); err != nil {
+		log.Fatalf("invalid proof image storage: %v", err)
+	} else if db != nil {
+		images = &proofImages{blobs: blobs, st: db, baseURL: strings.TrimRight(getenv("PROOF_IMAGE_BASE_URL", defaultImageBaseURL), "/")}
+	}
+
 	// Payment service (Mock for local/test, TossPay for staging/prod)
 	var paymentSvc payment.Service
 	if payment.IsMockEnvironment() {
@@ -95,6 +130,41 @@ func main() {
 		}
 	}
 
+	// Business time (enrollment windows, cancellation grace, refresh token expiry) comes from
+	// the store's clock so tests can move it; session token signing stays on the wall clock.
+	var clk clock.Clock = clock.System{}
+	if db != nil {
+		clk = db.Clock()
+	}
+
+	// Unlink revocations are persisted so they survive restarts and reach every replica
+	revoked := newRevokedStore()
+	if db != nil {
+		revoked = newRevokedStoreWithDB(db, 30*time.Second)
+	}
+
+	// Idempotent responses are stored in the DB so retries replay across replicas
+	var idem idemBackend = newIdemStore()
+	if db != nil {
+		idem = db
+	}
+
+	// Refresh tokens are stored hashed in the DB so rotation and reuse detection work across replicas
+	var refreshTokens refreshBackend = newRefreshStore()
+	if db != nil {
+		refreshTokens = db
+	}
+	sess := newSessions(keys, refreshTokens, clk)
+
+	reconciler := &reconcile.Reconciler{Store: db, Payments: paymentSvc, Clock: clk}
+
+	// TossPay server-to-server result callback (PAYMENT_CALLBACK_URL points at /v1/payments/callback)
+	callbackSecret := strings.TrimSpace(os.Getenv("PAYMENT_CALLBACK_SECRET"))
+	resultURL := callbackURL(strings.TrimSpace(os.Getenv("PAYMENT_CALLBACK_URL")), callbackSecret)
+	if resultURL != "" && callbackSecret == "" && appEnv != "local" {
+		log.Printf("[warn] PAYMENT_CALLBACK_SECRET not set; payment callbacks are verified by status lookup only")
+	}
+
 	mux := http.NewServeMux()
 
 	// ---- Health/meta
@@ -126,14 +196,14 @@ func main() {
 
 		// Accept any body (provider swap later)
 		userID := "stub-user"
-		sess := signSession(secret, userID, 24*time.Hour)
-
-		writeJSON(w, http.StatusOK, jsonMap{
-			"sessionToken": sess,
-			"accessToken":  sess, // compatibility alias
-			"mode":         "stub",
-			"expiresIn":    24 * 3600,
-		})
+		resp, err := sess.Issue(r.Context(), userID, requestDeviceID(r, ""))
+		if err != nil {
+			log.Printf("[error] issue session: %v", err)
+			writeErr(w, http.StatusInternalServerError, "session issue failed")
+			return
+		}
+		resp["mode"] = "stub"
+		writeJSON(w, http.StatusOK, resp)
 	})
 
 	// ---- Auth (Apps in Toss mTLS)
@@ -150,6 +220,7 @@ func main() {
 		var body struct {
 			AuthorizationCode string `json:"authorizationCode"`
 			Referrer          string `json:"referrer"`
+			DeviceID          string `json:"deviceId"`
 		}
 		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&body); err != nil {
 			writeErr(w, http.StatusBadRequest, "invalid json body")
@@ -163,13 +234,14 @@ func main() {
 		// local fallback (no mTLS)
 		if tossClient == nil && appEnv == "local" {
 			userID := "stub-user"
-			sess := signSession(secret, userID, 24*time.Hour)
-			writeJSON(w, http.StatusOK, jsonMap{
-				"sessionToken": sess,
-				"accessToken":  sess,
-				"mode":         "stub",
-				"expiresIn":    24 * 3600,
-			})
+			resp, err := sess.Issue(r.Context(), userID, requestDeviceID(r, body.DeviceID))
+			if err != nil {
+				log.Printf("[error] issue session: %v", err)
+				writeErr(w, http.StatusInternalServerError, "session issue failed")
+				return
+			}
+			resp["mode"] = "stub"
+			writeJSON(w, http.StatusOK, resp)
 			return
 		}
 		if tossClient == nil {
@@ -191,16 +263,93 @@ func main() {
 		if me, err := tossClient.LoginMe(ctx, success.AccessToken); err == nil && me != nil && me.UserKey > 0 {
 			uid = fmt.Sprintf("toss:%d", me.UserKey)
 		}
-		sess := signSession(secret, uid, 24*time.Hour)
+		resp, err := sess.Issue(r.Context(), uid, requestDeviceID(r, body.DeviceID))
+		if err != nil {
+			log.Printf("[error] issue session: %v", err)
+			writeErr(w, http.StatusInternalServerError, "session issue failed")
+			return
+		}
+		resp["mode"] = "toss"
+		writeJSON(w, http.StatusOK, resp)
+	})
 
-		writeJSON(w, http.StatusOK, jsonMap{
-			"sessionToken": sess,
-			"accessToken":  sess,
-			"mode":         "toss",
-			"expiresIn":    24 * 3600,
-		})
+	// ---- Auth (refresh token rotation)
+	mux.HandleFunc("/v1/auth/refresh", func(w http.ResponseWriter, r *http.Request) {
+		if preflight(w, r, allowedOrigins) {
+			return
+		}
+		if r.Method != http.MethodPost {
+			writeErr(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		writeCORS(w, r, allowedOrigins)
+
+		var body struct {
+			RefreshToken string `json:"refreshToken"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&body); err != nil {
+			writeErr(w, http.StatusBadRequest, "invalid json body")
+			return
+		}
+		if strings.TrimSpace(body.RefreshToken) == "" {
+			writeErr(w, http.StatusBadRequest, "refreshToken is required")
+			return
+		}
+
+		resp, err := sess.Refresh(r.Context(), body.RefreshToken)
+		switch {
+		case errors.Is(err, store.ErrRefreshTokenReused):
+			log.Printf("[warn] refresh token reuse detected; family revoked")
+			writeErr(w, http.StatusUnauthorized, "refresh token reused")
+			return
+		case errors.Is(err, store.ErrRefreshTokenInvalid):
+			writeErr(w, http.StatusUnauthorized, "invalid refresh token")
+			return
+		case err != nil:
+			log.Printf("[error] refresh session: %v", err)
+			writeErr(w, http.StatusInternalServerError, "refresh failed")
+			return
+		}
+		writeJSON(w, http.StatusOK, resp)
 	})
 
+	// ---- Auth (logout: revoke refresh tokens for one device, or all devices)
+	mux.Handle("/v1/auth/logout", auth(keys, revoked)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r, allowedOrigins)
+		if r.Method != http.MethodPost {
+			writeErr(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		claims := mustClaims(r.Context())
+
+		var body struct {
+			DeviceID   string `json:"deviceId"`
+			AllDevices bool   `json:"allDevices"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&body); err != nil {
+				writeErr(w, http.StatusBadRequest, "invalid json body")
+				return
+			}
+		}
+		device := requestDeviceID(r, body.DeviceID)
+		if device == "" && !body.AllDevices {
+			writeErr(w, http.StatusBadRequest, "deviceId or allDevices is required")
+			return
+		}
+		if body.AllDevices {
+			device = ""
+		}
+
+		n, err := sess.Revoke(r.Context(), claims.Sub, device, "logout")
+		if err != nil {
+			log.Printf("[error] logout: %v", err)
+			writeErr(w, http.StatusInternalServerError, "logout failed")
+			return
+		}
+		writeJSON(w, http.StatusOK, jsonMap{"ok": true, "revoked": n})
+	})))
+
 
 
 // ---- Auth (unlink callback configured in Toss console)
@@ -265,7 +414,26 @@ mux.HandleFunc("/v1/auth/toss/unlink-callback", func(w http.ResponseWriter, r *h
 	}
 
 	sub := fmt.Sprintf("toss:%d", userKey)
-	revoked.Revoke(sub)
+	if err := revoked.Revoke(r.Context(), sub, "unlink"); err != nil {
+		log.Printf("[error] revoke session: %v", err)
+		writeErr(w, http.StatusInternalServerError, "revoke failed")
+		return
+	}
+
+	if _, err := sess.Revoke(r.Context(), sub, "", "unlink"); err != nil {
+		log.Printf("[error] revoke refresh tokens: %v", err)
+		writeErr(w, http.StatusInternalServerError, "revoke failed")
+		return
+	}
+
+	// Participations, refunds and proof retention are handled by the worker (process-unlinks)
+	if db != nil {
+		if _, err := db.UnlinkUser(r.Context(), sub, referrer); err != nil {
+			log.Printf("[error] unlink user: %v", err)
+			writeErr(w, http.StatusInternalServerError, "unlink failed")
+			return
+		}
+	}
 
 	writeJSON(w, http.StatusOK, jsonMap{
 		"ok":       true,
@@ -275,13 +443,13 @@ mux.HandleFunc("/v1/auth/toss/unlink-callback", func(w http.ResponseWriter, r *h
 })
 
 	// ---- Protected endpoints
-	mux.Handle("/v1/me", auth(secret, revoked)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	mux.Handle("/v1/me", auth(keys, revoked)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		writeCORS(w, r, allowedOrigins)
 		claims := mustClaims(r.Context())
 		writeJSON(w, http.StatusOK, jsonMap{"userId": claims.Sub, "exp": claims.Exp})
 	})))
 
-	mux.Handle("/v1/challenges", auth(secret, revoked)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	mux.Handle("/v1/challenges", auth(keys, revoked)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if preflight(w, r, allowedOrigins) {
 			return
 		}
@@ -291,32 +459,33 @@ mux.HandleFunc("/v1/auth/toss/unlink-callback", func(w http.ResponseWriter, r *h
 		}
 		writeCORS(w, r, allowedOrigins)
 
-		// Try DB first, fallback to hardcoded
+		// Challenges are managed through the admin API; an empty list means none are open
 		if db != nil {
 			ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 			defer cancel()
 			challenges, err := db.ListChallenges(ctx)
-			if err == nil && len(challenges) > 0 {
-				items := make([]jsonMap, len(challenges))
-				for i, c := range challenges {
-					items[i] = jsonMap{"id": c.ID, "title": c.Title, "days": c.Days, "deposit": c.Deposit, "proofType": c.ProofType}
-				}
-				writeJSON(w, http.StatusOK, jsonMap{"items": items})
+			if err != nil {
+				log.Printf("[error] list challenges: %v", err)
+				writeErr(w, http.StatusServiceUnavailable, "please retry")
 				return
 			}
+			items := make([]jsonMap, len(challenges))
+			for i, c := range challenges {
+				items[i] = jsonMap{"id": c.ID, "title": c.Title, "days": c.Days, "deposit": c.Deposit, "proofType": c.ProofType, "tiers": tiersJSON(&c), "successRule": successRuleJSON(&c), "proofWindow": proofWindowJSON(&c)}
+			}
+			writeJSON(w, http.StatusOK, jsonMap{"items": items})
+			return
 		}
 
-		// Fallback to hardcoded
-		writeJSON(w, http.StatusOK, jsonMap{
-			"items": []jsonMap{
-				{"id": "walk-7000", "title": "매일 7,000보 걷기", "days": 3, "deposit": 10000, "proofType": "steps"},
-				{"id": "bed-0700", "title": "아침 7시 이불 개기", "days": 3, "deposit": 10000, "proofType": "photo"},
-				{"id": "lunch-proof", "title": "점심 도시락/샐러드 인증", "days": 3, "deposit": 10000, "proofType": "photo"},
-			},
-		})
+		// No DB (local dev): hardcoded seed list
+		items := make([]jsonMap, len(localChallenges))
+		for i, c := range localChallenges {
+			items[i] = jsonMap{"id": c.ID, "title": c.Title, "days": c.Days, "deposit": c.Deposit, "proofType": c.ProofType, "tiers": tiersJSON(&c), "successRule": successRuleJSON(&c), "proofWindow": proofWindowJSON(&c)}
+		}
+		writeJSON(w, http.StatusOK, jsonMap{"items": items})
 	})))
 
-	mux.Handle("/v1/payments/create", auth(secret, revoked)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	mux.Handle("/v1/payments/create", auth(keys, revoked)(idempotent(idem, "paycreate", allowedOrigins)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if preflight(w, r, allowedOrigins) {
 			return
 		}
@@ -326,41 +495,50 @@ mux.HandleFunc("/v1/auth/toss/unlink-callback", func(w http.ResponseWriter, r *h
 		}
 		writeCORS(w, r, allowedOrigins)
 
-		idk := strings.TrimSpace(r.Header.Get("Idempotency-Key"))
-		if idk == "" {
-			idk = "auto-" + mustRandomHex(8)
-		}
-		if !idem.TryUse("paycreate:"+idk, 2*time.Minute) {
-			writeErr(w, http.StatusConflict, "duplicate request")
-			return
-		}
-
+		// amount is optional: the charged amount always comes from the challenge
 		var body struct {
 			ChallengeID string `json:"challengeId"`
-			Amount      int    `json:"amount"`
+			Amount      int64  `json:"amount"`
 		}
 		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&body); err != nil {
 			writeErr(w, http.StatusBadRequest, "invalid json body")
 			return
 		}
-		if strings.TrimSpace(body.ChallengeID) == "" || body.Amount <= 0 {
-			writeErr(w, http.StatusBadRequest, "challengeId and amount are required")
+		body.ChallengeID = strings.TrimSpace(body.ChallengeID)
+		if body.ChallengeID == "" || body.Amount < 0 {
+			writeErr(w, http.StatusBadRequest, "challengeId is required")
 			return
 		}
 
 		ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
 		defer cancel()
 
-		// Get challenge info for product description
-		var productDesc string
+		var ch *store.Challenge
 		if db != nil {
-			if ch, err := db.GetChallenge(ctx, body.ChallengeID); err == nil && ch != nil {
-				productDesc = ch.Title + " 참가비"
+			var err error
+			if ch, err = db.GetChallenge(ctx, body.ChallengeID); err != nil {
+				log.Printf("[error] get challenge: %v", err)
+				writeErr(w, http.StatusServiceUnavailable, "please retry")
+				return
 			}
+		} else {
+			ch = findLocalChallenge(body.ChallengeID)
 		}
-		if productDesc == "" {
-			productDesc = "습관환급 " + body.ChallengeID + " 참가비"
+		if ch == nil {
+			writeErr(w, http.StatusNotFound, "challenge not found")
+			return
 		}
+		tier, err := challenge.ResolveTier(ch, body.Amount, clk.Now())
+		switch {
+		case errors.Is(err, challenge.ErrNotOpen):
+			writeErr(w, http.StatusConflict, err.Error())
+			return
+		case err != nil:
+			writeErr(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		amount := tier.Deposit
+		productDesc := ch.Title + " 참가비"
 
 		// Generate order number
 		orderNo := "pay_" + mustRandomHex(8)
@@ -376,7 +554,36 @@ mux.HandleFunc("/v1/auth/toss/unlink-callback", func(w http.ResponseWriter, r *h
 				return
 			}
 
-			dbPayment, err := db.CreatePayment(ctx, user.ID, body.ChallengeID, orderNo, int64(body.Amount))
+			dbPayment, err := db.CreatePayment(ctx, user.ID, body.ChallengeID, orderNo, amount, tier.ID)
+			if errors.Is(err, store.ErrActiveParticipation) {
+				writeErr(w, http.StatusConflict, "already participating in this challenge")
+				return
+			}
+			if errors.Is(err, store.ErrParticipationToday) {
+				writeErr(w, http.StatusConflict, "already joined this challenge today")
+				return
+			}
+			if errors.Is(err, store.ErrCheckoutInProgress) {
+				// Hand the unfinished checkout back so the client can resume it
+				pending, perr := db.GetPendingCheckout(ctx, user.ID, body.ChallengeID)
+				if perr != nil || pending == nil {
+					if perr != nil {
+						log.Printf("[error] get pending checkout: %v", perr)
+					}
+					writeErr(w, http.StatusConflict, "another checkout for this challenge is in progress")
+					return
+				}
+				writeJSON(w, http.StatusConflict, jsonMap{
+					"error":       "another checkout for this challenge is in progress",
+					"paymentId":   pending.ID,
+					"orderNo":     pending.OrderNo,
+					"payToken":    pending.PayToken,
+					"status":      pending.Status,
+					"challengeId": pending.ChallengeID,
+					"amount":      pending.Amount,
+				})
+				return
+			}
 			if err != nil {
 				log.Printf("[error] create payment: %v", err)
 				writeErr(w, http.StatusInternalServerError, "payment creation failed")
@@ -389,10 +596,18 @@ mux.HandleFunc("/v1/auth/toss/unlink-callback", func(w http.ResponseWriter, r *h
 		payResp, err := paymentSvc.CreatePayment(ctx, payment.CreateRequest{
 			OrderNo:     orderNo,
 			ProductDesc: productDesc,
-			Amount:      int64(body.Amount),
+			Amount:      amount,
+			ResultURL:   resultURL,
 		})
 		if err != nil {
 			log.Printf("[error] payment service create: %v", err)
+			// The client never got a payToken, so the order cannot be paid: close it so it
+			// does not hold the checkout for CheckoutHold.
+			if db != nil && dbPaymentID > 0 {
+				if cerr := db.ClosePayment(context.WithoutCancel(ctx), dbPaymentID, "failed", "payment provider create failed"); cerr != nil {
+					log.Printf("[error] close payment %d: %v", dbPaymentID, cerr)
+				}
+			}
 			writeErr(w, http.StatusInternalServerError, "payment creation failed")
 			return
 		}
@@ -410,12 +625,12 @@ mux.HandleFunc("/v1/auth/toss/unlink-callback", func(w http.ResponseWriter, r *h
 			"payToken":    payResp.PayToken,
 			"status":      "created",
 			"challengeId": body.ChallengeID,
-			"amount":      body.Amount,
+			"amount":      amount,
 			"mode":        payResp.Mode,
 		})
-	})))
+	}))))
 
-	mux.Handle("/v1/payments/execute", auth(secret, revoked)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	mux.Handle("/v1/payments/execute", auth(keys, revoked)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if preflight(w, r, allowedOrigins) {
 			return
 		}
@@ -462,10 +677,36 @@ mux.HandleFunc("/v1/auth/toss/unlink-callback", func(w http.ResponseWriter, r *h
 			return
 		}
 
+		// Already completed (e.g. by the TossPay result callback)
+		if dbPayment.Status == "done" {
+			writeJSON(w, http.StatusOK, jsonMap{
+				"ok":        true,
+				"status":    dbPayment.Status,
+				"paymentId": dbPayment.ID,
+				"orderNo":   dbPayment.OrderNo,
+			})
+			return
+		}
+
 		// Execute payment via payment service (if not mock mode or has payToken)
 		if dbPayment.PayToken != "" {
 			execResp, err := paymentSvc.ExecutePayment(ctx, dbPayment.PayToken)
 			if err != nil {
+				// The callback may have executed it at TossPay already; trust the provider status.
+				outcome, serr := reconciler.Sync(ctx, dbPayment)
+				if serr == nil && outcome == payment.OutcomePaid {
+					writeJSON(w, http.StatusOK, jsonMap{
+						"ok":        true,
+						"status":    "done",
+						"paymentId": dbPayment.ID,
+						"orderNo":   dbPayment.OrderNo,
+					})
+					return
+				}
+				if serr == nil && outcome == reconcile.OutcomeRefunded {
+					writeErr(w, http.StatusConflict, "already participating in this challenge; payment refunded")
+					return
+				}
 				log.Printf("[error] payment service execute: %v", err)
 				writeErr(w, http.StatusBadRequest, "payment execution failed")
 				return
@@ -481,12 +722,26 @@ mux.HandleFunc("/v1/auth/toss/unlink-callback", func(w http.ResponseWriter, r *h
 		}
 
 		// Update DB payment status and create participation
-		dbPayment, err = db.ExecutePaymentByID(ctx, body.PaymentID)
-		if err != nil {
-			log.Printf("[error] execute payment in DB: %v", err)
-			writeErr(w, http.StatusBadRequest, "payment execution failed")
+		executed, err := db.ExecutePaymentByID(ctx, body.PaymentID)
+		if errors.Is(err, store.ErrActiveParticipation) || errors.Is(err, store.ErrParticipationToday) {
+			// Charged but the participation cannot start: refund instead of keeping the money.
+			if rerr := reconciler.RefundUnfulfilled(ctx, dbPayment); rerr != nil {
+				log.Printf("[error] refund duplicate payment %d: %v", dbPayment.ID, rerr)
+			}
+			writeErr(w, http.StatusConflict, "already participating in this challenge; payment refunded")
 			return
 		}
+		dbPayment = executed
+		if err != nil {
+			// Lost a race with the result callback
+			if cur, gerr := db.GetPaymentByID(ctx, body.PaymentID); gerr == nil && cur != nil && cur.Status == "done" {
+				dbPayment = cur
+			} else {
+				log.Printf("[error] execute payment in DB: %v", err)
+				writeErr(w, http.StatusBadRequest, "payment execution failed")
+				return
+			}
+		}
 
 		writeJSON(w, http.StatusOK, jsonMap{
 			"ok":        true,
@@ -496,25 +751,82 @@ mux.HandleFunc("/v1/auth/toss/unlink-callback", func(w http.ResponseWriter, r *h
 		})
 	})))
 
-	mux.Handle("/v1/proofs/submit", auth(secret, revoked)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if preflight(w, r, allowedOrigins) {
-			return
-		}
+	// ---- TossPay result callback (server-to-server, no session)
+	mux.HandleFunc("/v1/payments/callback", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			writeErr(w, http.StatusMethodNotAllowed, "method not allowed")
 			return
 		}
-		writeCORS(w, r, allowedOrigins)
+		if callbackSecret != "" && !hmac.Equal([]byte(r.URL.Query().Get("token")), []byte(callbackSecret)) {
+			writeErr(w, http.StatusUnauthorized, "invalid callback token")
+			return
+		}
 
-		idk := strings.TrimSpace(r.Header.Get("Idempotency-Key"))
-		if idk == "" {
-			idk = "auto-" + mustRandomHex(8)
+		cb, err := parsePaymentCallback(r)
+		if err != nil {
+			writeErr(w, http.StatusBadRequest, err.Error())
+			return
 		}
-		if !idem.TryUse("proof:"+idk, 2*time.Minute) {
-			writeErr(w, http.StatusConflict, "duplicate request")
+
+		if db == nil {
+			// Fallback for in-memory mode
+			writeJSON(w, http.StatusOK, jsonMap{"code": 0})
 			return
 		}
 
+		ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+		defer cancel()
+
+		dbPayment, err := db.GetPaymentByOrderNo(ctx, cb.OrderNo)
+		if err != nil {
+			log.Printf("[error] callback get payment: %v", err)
+			writeErr(w, http.StatusInternalServerError, "payment lookup failed")
+			return
+		}
+		if dbPayment == nil {
+			writeErr(w, http.StatusNotFound, "payment not found")
+			return
+		}
+		if cb.PayToken != "" && dbPayment.PayToken != "" && cb.PayToken != dbPayment.PayToken {
+			log.Printf("[warn] callback payToken mismatch orderNo=%s", cb.OrderNo)
+			writeErr(w, http.StatusBadRequest, "payToken mismatch")
+			return
+		}
+		if dbPayment.Status != "created" {
+			// Already handled by /v1/payments/execute or an earlier callback
+			writeJSON(w, http.StatusOK, jsonMap{"code": 0, "status": dbPayment.Status})
+			return
+		}
+
+		// The callback body is not signed, so the provider status is the source of truth.
+		outcome, err := reconciler.Sync(ctx, dbPayment)
+		if err != nil {
+			log.Printf("[error] callback sync orderNo=%s: %v", cb.OrderNo, err)
+			writeErr(w, http.StatusInternalServerError, "payment sync failed")
+			return
+		}
+		log.Printf("[info] payment callback orderNo=%s status=%s outcome=%s", cb.OrderNo, cb.Status, outcome)
+		writeJSON(w, http.StatusOK, jsonMap{"code": 0, "status": outcome})
+	})
+
+	var cancelStore paymentCancelStore
+	if db != nil {
+		cancelStore = db
+	}
+	registerPaymentCancelRoute(mux, func(h http.Handler) http.Handler {
+		return auth(keys, revoked)(idempotent(idem, "paycancel", allowedOrigins)(h))
+	}, allowedOrigins, cancelStore, paymentSvc, clk, cancelGrace)
+
+	mux.Handle("/v1/proofs/submit", auth(keys, revoked)(idempotent(idem, "proof", allowedOrigins)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if preflight(w, r, allowedOrigins) {
+			return
+		}
+		if r.Method != http.MethodPost {
+			writeErr(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		writeCORS(w, r, allowedOrigins)
+
 		var body struct {
 			ChallengeID string `json:"challengeId"`
 			ImageBase64 string `json:"imageBase64"`
@@ -547,8 +859,28 @@ mux.HandleFunc("/v1/auth/toss/unlink-callback", func(w http.ResponseWriter, r *h
 				return
 			}
 
+			ch, err := db.GetChallenge(ctx, body.ChallengeID)
+			if err != nil {
+				log.Printf("[error] get challenge for proof: %v", err)
+				writeErr(w, http.StatusInternalServerError, "challenge lookup failed")
+				return
+			}
+			if ch == nil {
+				writeErr(w, http.StatusBadRequest, "존재하지 않는 챌린지입니다")
+				return
+			}
+			// Proof windows are checked against the server receive time, not the client's clock
+			window := challenge.ProofWindow(ch)
+			receivedAt := clk.Now()
+			loc := db.Calendar().Location()
+			proofDate := db.Calendar().Date(receivedAt)
+
 			proofType := "photo"
 			var imageHash string
+			var takenAt *time.Time
+			var exifStatus, reviewReason string
+			var phash *uint64
+			var imageURL string
 			var validationWarnings []string
 
 			if body.ImageHash != "" && body.ImageBase64 == "" {
@@ -559,6 +891,10 @@ mux.HandleFunc("/v1/auth/toss/unlink-callback", func(w http.ResponseWriter, r *h
 					writeErr(w, http.StatusBadRequest, "invalid steps proof: "+err.Error())
 					return
 				}
+				if reason := window.CheckReceived(receivedAt, loc); reason != "" {
+					writeErr(w, http.StatusBadRequest, "인증 실패: "+reason)
+					return
+				}
 				imageHash = result.ImageHash
 			} else {
 				// Photo proof - validate EXIF and generate hash
@@ -573,8 +909,15 @@ mux.HandleFunc("/v1/auth/toss/unlink-callback", func(w http.ResponseWriter, r *h
 					return
 				}
 
-				// Validate photo with EXIF check
-				result, err := proof.ValidatePhotoProof(body.ImageBase64, participation.StartDate, participation.EndDate)
+				// Validate photo with EXIF and proof window checks
+				result, err := proof.ValidatePhotoProof(body.ImageBase64, proof.PhotoRules{
+					ProofDate:    proofDate,
+					DayTolerance: exifTolerance,
+					Window:       window,
+					Location:     loc,
+					ReceivedAt:   receivedAt,
+					MissingEXIF:  challenge.MissingEXIFPolicy(ch),
+				})
 				if err != nil {
 					writeErr(w, http.StatusBadRequest, "invalid image: "+err.Error())
 					return
@@ -587,6 +930,9 @@ mux.HandleFunc("/v1/auth/toss/unlink-callback", func(w http.ResponseWriter, r *h
 				}
 
 				imageHash = result.ImageHash
+				takenAt = result.TakenAt
+				exifStatus = result.EXIFStatus
+				reviewReason = result.ReviewReason
 				validationWarnings = result.Warnings
 
 				// Check for duplicate hash (same image used by another user)
@@ -612,16 +958,61 @@ mux.HandleFunc("/v1/auth/toss/unlink-callback", func(w http.ResponseWriter, r *h
 					writeErr(w, http.StatusBadRequest, "동일한 사진으로 이미 인증하셨습니다")
 					return
 				}
+
+				// Near duplicates: re-compressed, resized or slightly cropped copies
+				if phash = result.PerceptualHash; phash != nil {
+					similar, err := db.CheckSimilarProofHash(ctx, *phash, user.ID, proof.NearDuplicateDistance)
+					if err != nil {
+						log.Printf("[error] check similar: %v", err)
+						writeErr(w, http.StatusInternalServerError, "duplicate check failed")
+						return
+					}
+					if similar != nil {
+						writeErr(w, http.StatusBadRequest, "다른 사용자가 제출한 사진과 거의 같은 이미지입니다")
+						return
+					}
+					// The same spot photographed daily can look alike, so a reviewer decides
+					own, err := db.CheckSameUserSimilarHash(ctx, *phash, user.ID, proof.NearDuplicateDistance)
+					if err != nil {
+						log.Printf("[error] check same user similar: %v", err)
+						writeErr(w, http.StatusInternalServerError, "duplicate check failed")
+						return
+					}
+					if own != nil && reviewReason == "" {
+						reviewReason = proof.ReviewNearDuplicate
+						validationWarnings = append(validationWarnings, "이전 인증 사진과 매우 비슷해 검토 후 인정됩니다")
+					}
+				}
+
+				imageURL = images.save(ctx, result)
 			}
 
-			_, err = db.SubmitProof(ctx, user.ID, body.ChallengeID, proofType, imageHash)
+			saved, err := db.SubmitProof(ctx, store.ProofSubmission{
+				UserID:         user.ID,
+				ChallengeID:    body.ChallengeID,
+				ProofType:      proofType,
+				ImageHash:      imageHash,
+				ImageURL:       imageURL,
+				ProofDate:      proofDate,
+				ExifTimestamp:  takenAt,
+				PerceptualHash: phash,
+				ReviewReason:   reviewReason,
+			})
+			if errors.Is(err, store.ErrProofAlreadyAccepted) {
+				writeErr(w, http.StatusConflict, "오늘 인증이 이미 인정되었습니다")
+				return
+			}
 			if err != nil {
 				log.Printf("[error] submit proof: %v", err)
 				writeErr(w, http.StatusBadRequest, "proof submission failed: "+err.Error())
 				return
 			}
 
-			response := jsonMap{"ok": true, "status": "accepted"}
+			// pending: counted only once a reviewer accepts it
+			response := jsonMap{"ok": true, "status": saved.Status, "proofDate": proofDate.Format("2006-01-02")}
+			if exifStatus != "" {
+				response["exif"] = exifStatus
+			}
 			if len(validationWarnings) > 0 {
 				response["warnings"] = validationWarnings
 			}
@@ -631,10 +1022,15 @@ mux.HandleFunc("/v1/auth/toss/unlink-callback", func(w http.ResponseWriter, r *h
 
 		// Fallback (in-memory mode)
 		writeJSON(w, http.StatusOK, jsonMap{"ok": true, "status": "accepted"})
-	})))
+	}))))
+
+	// ---- Proof appeals (rejected or missed days, decided in the admin review queue)
+	if db != nil {
+		registerAppealRoutes(mux, auth(keys, revoked), allowedOrigins, db, images)
+	}
 
 	// ---- Settlements (list all for current user)
-	mux.Handle("/v1/settlements", auth(secret, revoked)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	mux.Handle("/v1/settlements", auth(keys, revoked)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if preflight(w, r, allowedOrigins) {
 			return
 		}
@@ -672,10 +1068,13 @@ mux.HandleFunc("/v1/auth/toss/unlink-callback", func(w http.ResponseWriter, r *h
 			items := make([]jsonMap, len(settlements))
 			for i, s := range settlements {
 				items[i] = jsonMap{
-					"challengeId": s.ChallengeID,
-					"status":      s.Status,
-					"refundable":  s.Refundable,
-					"message":     s.Message,
+					"challengeId":   s.ChallengeID,
+					"status":        s.Status,
+					"refundable":    s.Refundable,
+					"depositAmount": s.DepositAmount,
+					"refundAmount":  s.RefundAmount,
+					"rewardAmount":  s.RewardAmount,
+					"message":       s.Message,
 				}
 			}
 			writeJSON(w, http.StatusOK, jsonMap{"items": items})
@@ -686,6 +1085,26 @@ mux.HandleFunc("/v1/auth/toss/unlink-callback", func(w http.ResponseWriter, r *h
 		writeJSON(w, http.StatusOK, jsonMap{"items": []jsonMap{}})
 	})))
 
+	// ---- Admin (separate ADMIN_TOKENS credentials, not user sessions)
+	adminTokens, err := parseAdminTokens(os.Getenv("ADMIN_TOKENS"))
+	if err != nil {
+		log.Fatalf("invalid ADMIN_TOKENS: %v", err)
+	}
+	switch {
+	case len(adminTokens) == 0:
+		log.Printf("[info] ADMIN_TOKENS not set; admin API disabled")
+	case db == nil:
+		log.Printf("[warn] admin API requires DATABASE_URL; disabled")
+	default:
+		registerAdminRoutes(mux, adminTokens, db)
+		registerReviewRoutes(mux, adminTokens, db)
+		registerPayoutRoutes(mux, adminTokens, db)
+		if blobs != nil {
+			registerImageRoutes(mux, adminTokens, blobs)
+		}
+		log.Printf("[info] admin API enabled for %d admin(s)", len(adminTokens))
+	}
+
 	// Global wrapper (security headers + req id + rate limit + log)
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// preflight short-circuit
@@ -740,11 +1159,125 @@ type Claims struct {
 	Exp int64  `json:"exp"`
 }
 
+// localChallenges mirrors the 001_init.sql seed for running without a database
+var localChallenges = []store.Challenge{
+	{ID: "walk-7000", Title: "매일 7,000보 걷기", Days: 3, Deposit: 10000, ProofType: "steps", IsActive: true},
+	{ID: "bed-0700", Title: "아침 7시 이불 개기", Days: 3, Deposit: 10000, ProofType: "photo", IsActive: true, ProofWindowStart: 300, ProofWindowEnd: 420},
+	{ID: "lunch-proof", Title: "점심 도시락/샐러드 인증", Days: 3, Deposit: 10000, ProofType: "photo", IsActive: true},
+}
+
+// tiersJSON lists the stake levels offered for c (a single default tier if none are configured)
+func tiersJSON(c *store.Challenge) []jsonMap {
+	tiers := challenge.Tiers(c)
+	items := make([]jsonMap, len(tiers))
+	for i, t := range tiers {
+		items[i] = jsonMap{
+			"deposit":          t.Deposit,
+			"requiredProofs":   challenge.RequiredProofs(c, t),
+			"rewardMultiplier": float64(t.RewardMultiplierBps) / store.MultiplierOne,
+			"default":          t.Deposit == c.Deposit,
+		}
+	}
+	return items
+}
+
+// successRuleJSON describes how a finished participation in c is judged
+func successRuleJSON(c *store.Challenge) jsonMap {
+	r := challenge.Rule(c, store.Tier{})
+	return jsonMap{
+		"minSuccessRatio": float64(r.MinSuccessBps) / store.MultiplierOne,
+		"restDays":        r.RestDays,
+		"refundPolicy":    r.RefundPolicy,
+	}
+}
+
+// proofWindowJSON describes the time of day proofs for c are accepted in (nil: any time)
+func proofWindowJSON(c *store.Challenge) jsonMap {
+	w := challenge.ProofWindow(c)
+	if w.AnyTime() {
+		return nil
+	}
+	return jsonMap{"start": proof.FormatClock(w.Start), "end": proof.FormatClock(w.End)}
+}
+
+func findLocalChallenge(id string) *store.Challenge {
+	for i := range localChallenges {
+		if localChallenges[i].ID == id {
+			c := localChallenges[i]
+			return &c
+		}
+	}
+	return nil
+}
+
 type ctxKey int
 
 const claimsKey ctxKey = 1
 
-func auth(secret string, revoked *revokedStore) func(http.Handler) http.Handler {
+// paymentCallback is the TossPay result callback payload.
+type paymentCallback struct {
+	OrderNo  string `json:"orderNo"`
+	PayToken string `json:"payToken"`
+	Status   string `json:"status"`
+}
+
+// parsePaymentCallback reads a result callback sent as JSON or as a form post.
+func parsePaymentCallback(r *http.Request) (paymentCallback, error) {
+	var cb paymentCallback
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		r.Body = http.MaxBytesReader(nil, r.Body, 1<<20)
+		if err := r.ParseForm(); err != nil {
+			return cb, errors.New("invalid form body")
+		}
+		cb.OrderNo = r.PostForm.Get("orderNo")
+		cb.PayToken = r.PostForm.Get("payToken")
+		cb.Status = r.PostForm.Get("status")
+	} else if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&cb); err != nil {
+		return cb, errors.New("invalid json body")
+	}
+
+	cb.OrderNo = strings.TrimSpace(cb.OrderNo)
+	cb.PayToken = strings.TrimSpace(cb.PayToken)
+	if cb.OrderNo == "" {
+		return cb, errors.New("orderNo is required")
+	}
+	return cb, nil
+}
+
+// callbackURL appends the shared callback token to the configured result URL.
+func callbackURL(base, token string) string {
+	if base == "" || token == "" {
+		return base
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return base
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// canCancelParticipation reports why a paid participation can no longer be cancelled.
+// Cancellation is only allowed within the grace window and before any proof was accepted.
+func canCancelParticipation(p *store.Participation, now time.Time, grace time.Duration) error {
+	if p == nil {
+		return errors.New("participation not found")
+	}
+	if p.Status != "active" {
+		return errors.New("participation is not active")
+	}
+	if p.ProofCount > 0 {
+		return errors.New("cannot cancel after submitting a proof")
+	}
+	if now.Sub(p.CreatedAt) > grace {
+		return errors.New("cancellation window has passed")
+	}
+	return nil
+}
+
+func auth(keys *keyring, revoked *revokedStore) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			h := r.Header.Get("Authorization")
@@ -753,14 +1286,22 @@ func auth(secret string, revoked *revokedStore) func(http.Handler) http.Handler
 				return
 			}
 			tok := strings.TrimSpace(strings.TrimPrefix(h, "Bearer "))
-			c, err := verifySession(secret, tok)
+			c, err := verifySession(keys, tok)
 			if err != nil {
 				writeErr(w, http.StatusUnauthorized, "invalid token")
 				return
 			}
-			if revoked != nil && revoked.IsRevoked(c.Sub) {
-				writeErr(w, http.StatusUnauthorized, "session revoked (unlinked)")
-				return
+			if revoked != nil {
+				isRevoked, err := revoked.IsRevoked(r.Context(), c.Sub, c.Iat)
+				if err != nil {
+					log.Printf("[error] revoked session lookup failed: %v", err)
+					writeErr(w, http.StatusServiceUnavailable, "session check unavailable")
+					return
+				}
+				if isRevoked {
+					writeErr(w, http.StatusUnauthorized, "session revoked (unlinked)")
+					return
+				}
 			}
 			ctx := context.WithValue(r.Context(), claimsKey, c)
 			next.ServeHTTP(w, r.WithContext(ctx))
@@ -776,7 +1317,9 @@ func mustClaims(ctx context.Context) Claims {
 	return v.(Claims)
 }
 
-func signSession(secret, userID string, ttl time.Duration) string {
+// signSession issues an sv2 token signed with the active key, or a legacy sv1 token
+// when no keyring is configured.
+func signSession(keys *keyring, userID string, ttl time.Duration) string {
 	now := time.Now().UTC()
 	c := Claims{
 		Sub: userID,
@@ -789,20 +1332,36 @@ func signSession(secret, userID string, ttl time.Duration) string {
 		return ""
 	}
 	payload := base64.RawURLEncoding.EncodeToString(b)
-	sig := hmacSHA256(secret, payload)
-	return "sv1." + payload + "." + sig
+	if keys.active == "" {
+		return "sv1." + payload + "." + hmacSHA256(keys.legacy, payload)
+	}
+	signed := "sv2." + keys.active + "." + payload
+	return signed + "." + hmacSHA256(keys.keys[keys.active], signed)
 }
 
-func verifySession(secret, token string) (Claims, error) {
+// verifySession accepts sv1 tokens (legacy secret) and sv2 tokens signed by any key in the keyring.
+func verifySession(keys *keyring, token string) (Claims, error) {
 	parts := strings.Split(token, ".")
-	if len(parts) != 3 || parts[0] != "sv1" {
+	var payload string
+	switch {
+	case len(parts) == 3 && parts[0] == "sv1":
+		payload = parts[1]
+		if keys.legacy == "" || !hmac.Equal([]byte(parts[2]), []byte(hmacSHA256(keys.legacy, payload))) {
+			return Claims{}, errors.New("bad signature")
+		}
+	case len(parts) == 4 && parts[0] == "sv2":
+		secret, ok := keys.keys[parts[1]]
+		if !ok {
+			return Claims{}, errors.New("unknown key id")
+		}
+		payload = parts[2]
+		signed := strings.Join(parts[:3], ".")
+		if !hmac.Equal([]byte(parts[3]), []byte(hmacSHA256(secret, signed))) {
+			return Claims{}, errors.New("bad signature")
+		}
+	default:
 		return Claims{}, errors.New("bad token format")
 	}
-	payload := parts[1]
-	sig := parts[2]
-	if !hmac.Equal([]byte(sig), []byte(hmacSHA256(secret, payload))) {
-		return Claims{}, errors.New("bad signature")
-	}
 	raw, err := base64.RawURLEncoding.DecodeString(payload)
 	if err != nil {
 		return Claims{}, err
@@ -865,63 +1424,102 @@ func (r *rateLimiter) Allow(key string) bool {
 	return true
 }
 
-// ===== Idempotency store =====
-
+// revocationBackend persists session revocations; implemented by *store.Store
+type revocationBackend interface {
+	RevokeSession(ctx context.Context, userSub, reason string) error
+	GetSessionRevokedAt(ctx context.Context, userSub string) (*time.Time, error)
+}
 
+// revokedStore tracks unlinked users. Sessions issued at or before a user's revocation
+// are rejected; logging in again afterwards issues a valid session. With a backend,
+// revocations are persisted and lookups are cached for ttl so a revocation made on
+// another replica takes effect within ttl.
 type revokedStore struct {
 	mu      sync.RWMutex
-	revoked map[string]time.Time
+	revoked map[string]revokedEntry
+	db      revocationBackend
+	ttl     time.Duration
+}
+
+type revokedEntry struct {
+	revokedAt time.Time // zero if not revoked
+	checkedAt time.Time
 }
 
+const revokedCacheMax = 10000
+
 func newRevokedStore() *revokedStore {
-	return &revokedStore{revoked: map[string]time.Time{}}
+	return &revokedStore{revoked: map[string]revokedEntry{}}
+}
+
+func newRevokedStoreWithDB(db revocationBackend, ttl time.Duration) *revokedStore {
+	return &revokedStore{revoked: map[string]revokedEntry{}, db: db, ttl: ttl}
 }
 
-func (s *revokedStore) Revoke(sub string) {
+func (s *revokedStore) Revoke(ctx context.Context, sub, reason string) error {
 	sub = strings.TrimSpace(sub)
 	if sub == "" {
-		return
+		return nil
 	}
+	if s.db != nil {
+		if err := s.db.RevokeSession(ctx, sub, reason); err != nil {
+			return err
+		}
+	}
+	now := time.Now().UTC()
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.revoked[sub] = time.Now().UTC()
+	s.revoked[sub] = revokedEntry{revokedAt: now, checkedAt: now}
+	return nil
 }
 
-func (s *revokedStore) IsRevoked(sub string) bool {
+// IsRevoked reports whether a session for sub issued at issuedAt (unix seconds) was revoked.
+// If the backend lookup fails and no revocation is cached, the error is returned so the
+// caller can fail closed; failed lookups are never cached.
+func (s *revokedStore) IsRevoked(ctx context.Context, sub string, issuedAt int64) (bool, error) {
 	sub = strings.TrimSpace(sub)
 	if sub == "" {
-		return false
+		return false, nil
 	}
+
 	s.mu.RLock()
-	defer s.mu.RUnlock()
-	_, ok := s.revoked[sub]
-	return ok
-}
+	e, ok := s.revoked[sub]
+	s.mu.RUnlock()
+	revokedBy := func(e revokedEntry) bool {
+		return !e.revokedAt.IsZero() && issuedAt <= e.revokedAt.Unix()
+	}
 
-type idemStore struct {
-	mu    sync.Mutex
-	items map[string]time.Time
-}
+	if s.db != nil && (!ok || time.Since(e.checkedAt) > s.ttl) {
+		at, err := s.db.GetSessionRevokedAt(ctx, sub)
+		if err != nil {
+			if ok && revokedBy(e) {
+				return true, nil
+			}
+			return false, fmt.Errorf("lookup session revocation: %w", err)
+		}
+		e = revokedEntry{checkedAt: time.Now()}
+		if at != nil {
+			e.revokedAt = *at
+		}
+		ok = true
+		s.mu.Lock()
+		if len(s.revoked) >= revokedCacheMax {
+			s.pruneLocked()
+		}
+		s.revoked[sub] = e
+		s.mu.Unlock()
+	}
 
-func newIdemStore() *idemStore {
-	return &idemStore{items: map[string]time.Time{}}
+	return ok && revokedBy(e), nil
 }
 
-func (s *idemStore) TryUse(key string, ttl time.Duration) bool {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	now := time.Now()
-	for k, exp := range s.items {
-		if now.After(exp) {
-			delete(s.items, k)
+// pruneLocked drops cache entries that would be re-read from the backend anyway.
+func (s *revokedStore) pruneLocked() {
+	for sub, e := range s.revoked {
+		if time.Since(e.checkedAt) > s.ttl {
+			delete(s.revoked, sub)
 		}
 	}
-	if exp, ok := s.items[key]; ok && now.Before(exp) {
-		return false
-	}
-	s.items[key] = now.Add(ttl)
-	return true
 }
 
 // ===== HTTP helpers =====
@@ -980,7 +1578,7 @@ func writeCORS(w http.ResponseWriter, r *http.Request, allowedOrigins []string)
 	origin := matchOrigin(r, allowedOrigins)
 	w.Header().Set("Access-Control-Allow-Origin", origin)
 	w.Header().Set("Access-Control-Allow-Methods", "GET,POST,OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-Request-Id, Idempotency-Key")
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-Request-Id, Idempotency-Key, X-Device-Id")
 	w.Header().Set("Access-Control-Expose-Headers", "X-Request-Id")
 	// Vary header for proper caching when using dynamic origin
 	if origin != "*" {
@@ -1,18 +1,33 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"habitcashback/internal/blobstore"
+	"habitcashback/internal/clock"
+	"habitcashback/internal/payment"
+	"habitcashback/internal/proof"
+	"habitcashback/internal/store"
 )
 
 // ===== Session Tests =====
 
 func TestSignAndVerifySession(t *testing.T) {
-	secret := "test-secret-key-12345"
+	secret := mustKeyring(t, "test-secret-key-12345", "", nil)
 
 	t.Run("Valid session", func(t *testing.T) {
 		userID := "test-user-123"
@@ -56,7 +71,7 @@ func TestSignAndVerifySession(t *testing.T) {
 	t.Run("Wrong secret", func(t *testing.T) {
 		token := signSession(secret, "user", 1*time.Hour)
 
-		_, err := verifySession("wrong-secret", token)
+		_, err := verifySession(mustKeyring(t, "wrong-secret", "", nil), token)
 		if err == nil {
 			t.Fatal("expected error for wrong secret")
 		}
@@ -90,6 +105,926 @@ func TestSignAndVerifySession(t *testing.T) {
 	})
 }
 
+// ===== Refresh Token Tests =====
+
+func TestSessionsRefresh(t *testing.T) {
+	ctx := context.Background()
+	secret := mustKeyring(t, "test-secret", "", nil)
+
+	issue := func(t *testing.T, s *sessions, device string) string {
+		t.Helper()
+		resp, err := s.Issue(ctx, "user-1", device)
+		if err != nil {
+			t.Fatalf("Issue: %v", err)
+		}
+		if _, err := verifySession(secret, resp["sessionToken"].(string)); err != nil {
+			t.Fatalf("expected valid sv1 session, got %v", err)
+		}
+		return resp["refreshToken"].(string)
+	}
+
+	t.Run("Rotation returns a new pair", func(t *testing.T) {
+		s := newSessions(secret, newRefreshStore(), clock.System{})
+		rt := issue(t, s, "phone")
+
+		resp, err := s.Refresh(ctx, rt)
+		if err != nil {
+			t.Fatalf("Refresh: %v", err)
+		}
+		next := resp["refreshToken"].(string)
+		if next == rt || !strings.HasPrefix(next, refreshPrefix) {
+			t.Errorf("expected a new refresh token, got %q", next)
+		}
+		c, err := verifySession(secret, resp["sessionToken"].(string))
+		if err != nil || c.Sub != "user-1" {
+			t.Errorf("expected session for user-1, got %+v (%v)", c, err)
+		}
+		if _, err := s.Refresh(ctx, next); err != nil {
+			t.Errorf("expected rotated token to be usable, got %v", err)
+		}
+	})
+
+	t.Run("Reuse revokes the family", func(t *testing.T) {
+		s := newSessions(secret, newRefreshStore(), clock.System{})
+		rt := issue(t, s, "phone")
+		resp, err := s.Refresh(ctx, rt)
+		if err != nil {
+			t.Fatalf("Refresh: %v", err)
+		}
+
+		if _, err := s.Refresh(ctx, rt); !errors.Is(err, store.ErrRefreshTokenReused) {
+			t.Fatalf("expected reuse error, got %v", err)
+		}
+		if _, err := s.Refresh(ctx, resp["refreshToken"].(string)); !errors.Is(err, store.ErrRefreshTokenInvalid) {
+			t.Errorf("expected descendant token to be revoked, got %v", err)
+		}
+	})
+
+	t.Run("Revoke is per device", func(t *testing.T) {
+		s := newSessions(secret, newRefreshStore(), clock.System{})
+		phone := issue(t, s, "phone")
+		tablet := issue(t, s, "tablet")
+
+		n, err := s.Revoke(ctx, "user-1", "phone", "logout")
+		if err != nil || n != 1 {
+			t.Fatalf("expected 1 revoked, got %d (%v)", n, err)
+		}
+		if _, err := s.Refresh(ctx, phone); !errors.Is(err, store.ErrRefreshTokenInvalid) {
+			t.Errorf("expected phone token revoked, got %v", err)
+		}
+		if _, err := s.Refresh(ctx, tablet); err != nil {
+			t.Errorf("expected tablet token to still work, got %v", err)
+		}
+	})
+
+	t.Run("Unknown or malformed token", func(t *testing.T) {
+		s := newSessions(secret, newRefreshStore(), clock.System{})
+		for _, tok := range []string{"", "garbage", refreshPrefix + "unknown"} {
+			if _, err := s.Refresh(ctx, tok); !errors.Is(err, store.ErrRefreshTokenInvalid) {
+				t.Errorf("Refresh(%q): expected invalid, got %v", tok, err)
+			}
+		}
+	})
+}
+
+func TestRequestDeviceID(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/v1/auth/exchange", nil)
+	req.Header.Set("X-Device-Id", " header-device ")
+	if got := requestDeviceID(req, "body-device"); got != "body-device" {
+		t.Errorf("expected body value to win, got %q", got)
+	}
+	if got := requestDeviceID(req, ""); got != "header-device" {
+		t.Errorf("expected header fallback, got %q", got)
+	}
+	if got := requestDeviceID(req, strings.Repeat("x", 200)); len(got) != maxDeviceIDLen {
+		t.Errorf("expected device id truncated to %d, got %d", maxDeviceIDLen, len(got))
+	}
+}
+
+func mustKeyring(t *testing.T, legacy, active string, keys map[string]string) *keyring {
+	t.Helper()
+	kr, err := newKeyring(legacy, active, keys)
+	if err != nil {
+		t.Fatalf("newKeyring: %v", err)
+	}
+	return kr
+}
+
+func TestKeyringRotation(t *testing.T) {
+	keyA := strings.Repeat("a", minSessionKeyLen)
+	keyB := strings.Repeat("b", minSessionKeyLen)
+	legacy := "legacy-secret"
+
+	t.Run("Signs sv2 with the active key id", func(t *testing.T) {
+		kr := mustKeyring(t, legacy, "2025a", map[string]string{"2025a": keyA})
+		token := signSession(kr, "user", time.Hour)
+		if !strings.HasPrefix(token, "sv2.2025a.") || len(strings.Split(token, ".")) != 4 {
+			t.Fatalf("unexpected sv2 token: %s", token)
+		}
+		c, err := verifySession(kr, token)
+		if err != nil || c.Sub != "user" {
+			t.Fatalf("expected valid session, got %+v (%v)", c, err)
+		}
+	})
+
+	t.Run("Rotated-out key still verifies", func(t *testing.T) {
+		before := mustKeyring(t, legacy, "2025a", map[string]string{"2025a": keyA})
+		after := mustKeyring(t, legacy, "2025b", map[string]string{"2025a": keyA, "2025b": keyB})
+
+		old := signSession(before, "user", time.Hour)
+		if _, err := verifySession(after, old); err != nil {
+			t.Errorf("expected token from verify-only key to be accepted, got %v", err)
+		}
+		if !strings.HasPrefix(signSession(after, "user", time.Hour), "sv2.2025b.") {
+			t.Error("expected new tokens to use the new active key")
+		}
+
+		removed := mustKeyring(t, legacy, "2025b", map[string]string{"2025b": keyB})
+		if _, err := verifySession(removed, old); err == nil {
+			t.Error("expected token from removed key to be rejected")
+		}
+	})
+
+	t.Run("Legacy sv1 accepted alongside sv2", func(t *testing.T) {
+		sv1 := signSession(mustKeyring(t, legacy, "", nil), "user", time.Hour)
+		kr := mustKeyring(t, legacy, "2025a", map[string]string{"2025a": keyA})
+		if _, err := verifySession(kr, sv1); err != nil {
+			t.Errorf("expected sv1 token to verify with legacy secret, got %v", err)
+		}
+
+		noLegacy := mustKeyring(t, "", "2025a", map[string]string{"2025a": keyA})
+		if _, err := verifySession(noLegacy, sv1); err == nil {
+			t.Error("expected sv1 token to be rejected once the legacy secret is removed")
+		}
+	})
+
+	t.Run("Key id cannot be swapped", func(t *testing.T) {
+		kr := mustKeyring(t, legacy, "2025a", map[string]string{"2025a": keyA, "2025b": keyB})
+		parts := strings.Split(signSession(kr, "user", time.Hour), ".")
+		parts[1] = "2025b"
+		if _, err := verifySession(kr, strings.Join(parts, ".")); err == nil {
+			t.Error("expected token with swapped key id to be rejected")
+		}
+	})
+
+	t.Run("Invalid configuration", func(t *testing.T) {
+		cases := []struct {
+			name   string
+			active string
+			keys   map[string]string
+		}{
+			{"Active key missing", "2025c", map[string]string{"2025a": keyA}},
+			{"No active key", "", map[string]string{"2025a": keyA}},
+			{"Short secret", "2025a", map[string]string{"2025a": "short"}},
+			{"Bad key id", "a.b", map[string]string{"a.b": keyA}},
+		}
+		for _, tc := range cases {
+			if _, err := newKeyring(legacy, tc.active, tc.keys); err == nil {
+				t.Errorf("%s: expected error", tc.name)
+			}
+		}
+		if _, err := newKeyring("", "", nil); err == nil {
+			t.Error("expected error without any signing key")
+		}
+	})
+}
+
+func TestLoadKeyring(t *testing.T) {
+	keyA := strings.Repeat("a", minSessionKeyLen)
+	keyB := strings.Repeat("b", minSessionKeyLen)
+
+	t.Run("From env", func(t *testing.T) {
+		t.Setenv("SESSION_KEYS_FILE", "")
+		t.Setenv("SESSION_KEYS", "2025b:"+keyB+", 2025a:"+keyA)
+		t.Setenv("SESSION_ACTIVE_KEY_ID", "")
+		kr, err := loadKeyring("")
+		if err != nil {
+			t.Fatalf("loadKeyring: %v", err)
+		}
+		if kr.active != "2025b" || len(kr.IDs()) != 2 {
+			t.Errorf("expected active=2025b with 2 keys, got %s %v", kr.active, kr.IDs())
+		}
+
+		t.Setenv("SESSION_ACTIVE_KEY_ID", "2025a")
+		kr, err = loadKeyring("")
+		if err != nil || kr.active != "2025a" {
+			t.Errorf("expected explicit active key, got %+v (%v)", kr, err)
+		}
+	})
+
+	t.Run("From file", func(t *testing.T) {
+		path := t.TempDir() + "/keys.json"
+		raw, _ := json.Marshal(sessionKeyFile{Active: "2025a", Keys: map[string]string{"2025a": keyA, "2025b": keyB}})
+		if err := os.WriteFile(path, raw, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("SESSION_KEYS_FILE", path)
+		t.Setenv("SESSION_KEYS", "ignored:"+keyA)
+		kr, err := loadKeyring("legacy")
+		if err != nil {
+			t.Fatalf("loadKeyring: %v", err)
+		}
+		if kr.active != "2025a" || kr.legacy != "legacy" {
+			t.Errorf("unexpected keyring: active=%s legacy=%s", kr.active, kr.legacy)
+		}
+	})
+
+	t.Run("Legacy only", func(t *testing.T) {
+		t.Setenv("SESSION_KEYS_FILE", "")
+		t.Setenv("SESSION_KEYS", "")
+		kr, err := loadKeyring("legacy")
+		if err != nil {
+			t.Fatalf("loadKeyring: %v", err)
+		}
+		if !strings.HasPrefix(signSession(kr, "user", time.Hour), "sv1.") {
+			t.Error("expected sv1 tokens without a keyring")
+		}
+	})
+
+	t.Run("Malformed entry", func(t *testing.T) {
+		t.Setenv("SESSION_KEYS_FILE", "")
+		t.Setenv("SESSION_KEYS", "no-secret")
+		if _, err := loadKeyring("legacy"); err == nil {
+			t.Error("expected error for malformed SESSION_KEYS")
+		}
+	})
+}
+
+// ===== Challenge Tests =====
+
+func TestFindLocalChallenge(t *testing.T) {
+	c := findLocalChallenge("walk-7000")
+	if c == nil || c.Deposit != 10000 || !c.IsActive {
+		t.Fatalf("expected seeded walk-7000, got %+v", c)
+	}
+	c.Deposit = 1
+	if findLocalChallenge("walk-7000").Deposit != 10000 {
+		t.Error("expected a copy, not the shared seed entry")
+	}
+	if findLocalChallenge("unknown") != nil {
+		t.Error("expected nil for unknown challenge")
+	}
+}
+
+func TestTiersJSON(t *testing.T) {
+	untiered := &store.Challenge{ID: "walk-7000", Days: 3, Deposit: 10000}
+	items := tiersJSON(untiered)
+	if len(items) != 1 || items[0]["deposit"] != int64(10000) || items[0]["requiredProofs"] != 3 || items[0]["default"] != true {
+		t.Errorf("expected single default tier, got %v", items)
+	}
+
+	tiered := &store.Challenge{ID: "walk-7000", Days: 3, Deposit: 10000, Tiers: []store.Tier{
+		{Deposit: 10000, RewardMultiplierBps: store.MultiplierOne},
+		{Deposit: 30000, RequiredProofs: 2, RewardMultiplierBps: 10500},
+	}}
+	items = tiersJSON(tiered)
+	if len(items) != 2 {
+		t.Fatalf("expected 2 tiers, got %d", len(items))
+	}
+	if items[1]["requiredProofs"] != 2 || items[1]["rewardMultiplier"] != 1.05 || items[1]["default"] != false {
+		t.Errorf("unexpected high-stakes tier: %v", items[1])
+	}
+}
+
+// ===== Admin Tests =====
+
+func TestParseAdminTokens(t *testing.T) {
+	token := strings.Repeat("t", minAdminTokenLen)
+
+	creds, err := parseAdminTokens("alice:" + token + ", bob:" + token + "x")
+	if err != nil {
+		t.Fatalf("parseAdminTokens: %v", err)
+	}
+	if name, ok := creds.lookup(token); !ok || name != "alice" {
+		t.Errorf("expected alice, got %q %v", name, ok)
+	}
+	if _, ok := creds.lookup("wrong"); ok {
+		t.Error("expected unknown token to be rejected")
+	}
+
+	for _, raw := range []string{"alice", "alice:short", ":" + token, "a:" + token + ",a:" + token} {
+		if _, err := parseAdminTokens(raw); err == nil {
+			t.Errorf("parseAdminTokens(%q): expected error", raw)
+		}
+	}
+	if creds, err := parseAdminTokens(""); err != nil || len(creds) != 0 {
+		t.Errorf("expected empty creds, got %v (%v)", creds, err)
+	}
+}
+
+// fakeChallengeStore is an in-memory challengeAdminStore
+type fakeChallengeStore struct {
+	items  map[string]store.Challenge
+	actors []string
+}
+
+func (f *fakeChallengeStore) ListAllChallenges(ctx context.Context) ([]store.Challenge, error) {
+	var list []store.Challenge
+	for _, c := range f.items {
+		list = append(list, c)
+	}
+	return list, nil
+}
+
+func (f *fakeChallengeStore) GetChallenge(ctx context.Context, id string) (*store.Challenge, error) {
+	c, ok := f.items[id]
+	if !ok {
+		return nil, nil
+	}
+	return &c, nil
+}
+
+func (f *fakeChallengeStore) CreateChallenge(ctx context.Context, c store.Challenge, actor string) (*store.Challenge, error) {
+	if _, ok := f.items[c.ID]; ok {
+		return nil, store.ErrChallengeExists
+	}
+	f.items[c.ID] = c
+	f.actors = append(f.actors, actor)
+	return &c, nil
+}
+
+func (f *fakeChallengeStore) UpdateChallenge(ctx context.Context, c store.Challenge, actor string) (*store.Challenge, error) {
+	old, ok := f.items[c.ID]
+	if !ok {
+		return nil, nil
+	}
+	c.IsActive = old.IsActive
+	f.items[c.ID] = c
+	f.actors = append(f.actors, actor)
+	return &c, nil
+}
+
+func (f *fakeChallengeStore) SetChallengeActive(ctx context.Context, id string, active bool, actor string) (*store.Challenge, error) {
+	c, ok := f.items[id]
+	if !ok {
+		return nil, nil
+	}
+	c.IsActive = active
+	f.items[id] = c
+	f.actors = append(f.actors, actor)
+	return &c, nil
+}
+
+func TestAdminChallengeAPI(t *testing.T) {
+	token := strings.Repeat("a", minAdminTokenLen)
+	creds, err := parseAdminTokens("ops:" + token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := &fakeChallengeStore{items: map[string]store.Challenge{
+		"walk-7000": {ID: "walk-7000", Title: "걷기", Days: 3, Deposit: 10000, ProofType: "steps", IsActive: true},
+	}}
+	mux := http.NewServeMux()
+	registerAdminRoutes(mux, creds, fs)
+
+	do := func(method, path, bearer, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Rejects user sessions", func(t *testing.T) {
+		userToken := signSession(mustKeyring(t, "test-secret", "", nil), "toss:1", time.Hour)
+		if rec := do(http.MethodGet, "/admin/v1/challenges", userToken, ""); rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected 401, got %d", rec.Code)
+		}
+		if rec := do(http.MethodGet, "/admin/v1/challenges", "", ""); rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected 401 without token, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Create validates and records actor", func(t *testing.T) {
+		rec := do(http.MethodPost, "/admin/v1/challenges", token, `{"id":"water-2l","title":"물 2L 마시기","days":7,"deposit":5000,"proofType":"photo","startsAt":"2025-03-01T00:00:00+09:00"}`)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+		}
+		c := fs.items["water-2l"]
+		if c.Days != 7 || c.StartsAt == nil || !c.IsActive {
+			t.Errorf("unexpected stored challenge: %+v", c)
+		}
+		if got := fs.actors[len(fs.actors)-1]; got != "admin:ops" {
+			t.Errorf("expected actor admin:ops, got %s", got)
+		}
+
+		if rec := do(http.MethodPost, "/admin/v1/challenges", token, `{"id":"water-2l","title":"dup","days":7,"deposit":5000,"proofType":"photo"}`); rec.Code != http.StatusConflict {
+			t.Errorf("expected 409 for duplicate id, got %d", rec.Code)
+		}
+		if rec := do(http.MethodPost, "/admin/v1/challenges", token, `{"id":"bad","title":"x","days":0,"deposit":5000,"proofType":"photo"}`); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("expected 422 for invalid days, got %d", rec.Code)
+		}
+		if rec := do(http.MethodPost, "/admin/v1/challenges", token, `{"id":"bad","title":"x","days":3,"deposit":5000,"proofType":"video"}`); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("expected 422 for invalid proof type, got %d", rec.Code)
+		}
+		rec = do(http.MethodPost, "/admin/v1/challenges", token, `{"id":"run-5k","title":"5km 달리기","days":3,"deposit":10000,"proofType":"photo","tiers":[{"deposit":5000},{"deposit":10000},{"deposit":30000,"requiredProofs":2,"rewardMultiplier":1.05}]}`)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("expected 201 for tiered challenge, got %d: %s", rec.Code, rec.Body.String())
+		}
+		tiers := fs.items["run-5k"].Tiers
+		if len(tiers) != 3 || tiers[0].RewardMultiplierBps != store.MultiplierOne || tiers[2].RewardMultiplierBps != 10500 || tiers[2].RequiredProofs != 2 {
+			t.Errorf("unexpected tiers: %+v", tiers)
+		}
+		if rec := do(http.MethodPost, "/admin/v1/challenges", token, `{"id":"bad","title":"x","days":3,"deposit":10000,"proofType":"photo","tiers":[{"deposit":5000}]}`); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("expected 422 when default deposit is not a tier, got %d", rec.Code)
+		}
+		rec = do(http.MethodPost, "/admin/v1/challenges", token, `{"id":"read-30","title":"30일 독서","days":30,"deposit":10000,"proofType":"photo","successRule":{"minSuccessRatio":0.8,"restDays":2,"refundPolicy":"proportional"}}`)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("expected 201 with success rule, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if c := fs.items["read-30"]; c.MinSuccessBps != 8000 || c.RestDays != 2 || c.RefundPolicy != store.RefundProportional {
+			t.Errorf("unexpected success rule: %+v", c)
+		}
+		if c := fs.items["run-5k"]; c.MinSuccessBps != store.MultiplierOne || c.RefundPolicy != store.RefundFull {
+			t.Errorf("expected all-or-nothing default, got %d %q", c.MinSuccessBps, c.RefundPolicy)
+		}
+		if rec := do(http.MethodPost, "/admin/v1/challenges", token, `{"id":"bad","title":"x","days":3,"deposit":10000,"proofType":"photo","successRule":{"restDays":3}}`); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("expected 422 when rest days cover the challenge, got %d", rec.Code)
+		}
+		rec = do(http.MethodPost, "/admin/v1/challenges", token, `{"id":"wake-0600","title":"6시 기상","days":7,"deposit":10000,"proofType":"photo","proofWindow":{"start":"05:00","end":"06:30"}}`)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("expected 201 with proof window, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if c := fs.items["wake-0600"]; c.ProofWindowStart != 300 || c.ProofWindowEnd != 390 {
+			t.Errorf("unexpected proof window: %d~%d", c.ProofWindowStart, c.ProofWindowEnd)
+		}
+		if !strings.Contains(rec.Body.String(), `"proofWindow":{"end":"06:30","start":"05:00"}`) {
+			t.Errorf("expected proof window in response, got %s", rec.Body.String())
+		}
+		if c := fs.items["wake-0600"]; c.MissingExifPolicy != proof.MissingEXIFAccept {
+			t.Errorf("expected missing EXIF policy to default to accept, got %q", c.MissingExifPolicy)
+		}
+		rec = do(http.MethodPost, "/admin/v1/challenges", token, `{"id":"desk-tidy","title":"책상 정리","days":7,"deposit":10000,"proofType":"photo","missingExifPolicy":"accept_flagged_for_review"}`)
+		if rec.Code != http.StatusCreated || fs.items["desk-tidy"].MissingExifPolicy != proof.MissingEXIFFlag {
+			t.Errorf("expected flagged policy to be stored, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if rec := do(http.MethodPost, "/admin/v1/challenges", token, `{"id":"bad","title":"x","days":3,"deposit":10000,"proofType":"photo","missingExifPolicy":"maybe"}`); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("expected 422 for unknown missing EXIF policy, got %d", rec.Code)
+		}
+		for _, pw := range []string{`{"start":"7:00","end":"08:00"}`, `{"start":"08:00","end":"07:00"}`, `{"start":"23:00","end":"24:30"}`} {
+			body := `{"id":"bad","title":"x","days":3,"deposit":10000,"proofType":"photo","proofWindow":` + pw + `}`
+			if rec := do(http.MethodPost, "/admin/v1/challenges", token, body); rec.Code != http.StatusUnprocessableEntity {
+				t.Errorf("expected 422 for proof window %s, got %d", pw, rec.Code)
+			}
+		}
+		if rec := do(http.MethodPost, "/admin/v1/challenges", token, `{"id":"bad","unknown":1}`); rec.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for unknown field, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Edit and schedule", func(t *testing.T) {
+		rec := do(http.MethodPut, "/admin/v1/challenges/walk-7000", token, `{"title":"매일 8,000보","days":5,"deposit":10000,"proofType":"steps","endsAt":"2025-12-31T15:00:00Z"}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		c := fs.items["walk-7000"]
+		if c.Days != 5 || c.EndsAt == nil || !c.IsActive {
+			t.Errorf("unexpected edited challenge: %+v", c)
+		}
+
+		if rec := do(http.MethodPut, "/admin/v1/challenges/walk-7000", token, `{"id":"other","title":"x","days":5,"deposit":10000,"proofType":"steps"}`); rec.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 when changing id, got %d", rec.Code)
+		}
+		if rec := do(http.MethodPut, "/admin/v1/challenges/missing", token, `{"title":"x","days":5,"deposit":10000,"proofType":"steps"}`); rec.Code != http.StatusNotFound {
+			t.Errorf("expected 404, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Deactivate and activate", func(t *testing.T) {
+		if rec := do(http.MethodPost, "/admin/v1/challenges/walk-7000/deactivate", token, ""); rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+		if fs.items["walk-7000"].IsActive {
+			t.Error("expected challenge to be inactive")
+		}
+		if rec := do(http.MethodPost, "/admin/v1/challenges/walk-7000/activate", token, ""); rec.Code != http.StatusOK || !fs.items["walk-7000"].IsActive {
+			t.Errorf("expected reactivation, got %d", rec.Code)
+		}
+		if rec := do(http.MethodGet, "/admin/v1/challenges/walk-7000/deactivate", token, ""); rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("expected 405, got %d", rec.Code)
+		}
+		if rec := do(http.MethodPost, "/admin/v1/challenges/missing/deactivate", token, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("expected 404, got %d", rec.Code)
+		}
+	})
+}
+
+type fakeReviewStore struct {
+	items   map[int64]store.Proof
+	appeals map[int64]store.Appeal
+	actors  []string
+}
+
+func (f *fakeReviewStore) ListPendingProofs(ctx context.Context, afterID int64, limit int) ([]store.PendingProof, error) {
+	var list []store.PendingProof
+	for id := afterID + 1; len(list) < limit && id <= int64(len(f.items)); id++ {
+		if p := f.items[id]; p.Status == store.ProofPending {
+			list = append(list, store.PendingProof{Proof: p, ChallengeTitle: "책상 정리", RequiredProofs: 7})
+		}
+	}
+	return list, nil
+}
+
+func (f *fakeReviewStore) ReviewProof(ctx context.Context, proofID int64, accept bool, reason, actor string) (*store.Proof, error) {
+	p, ok := f.items[proofID]
+	if !ok {
+		return nil, nil
+	}
+	if p.Status != store.ProofPending {
+		return nil, store.ErrProofNotPending
+	}
+	p.Status, p.ReviewedBy = store.ProofAccepted, actor
+	if !accept {
+		p.Status, p.RejectReason = store.ProofRejected, reason
+	}
+	f.items[proofID] = p
+	f.actors = append(f.actors, actor)
+	return &p, nil
+}
+
+func (f *fakeReviewStore) ListPendingAppeals(ctx context.Context, afterID int64, limit int) ([]store.PendingAppeal, error) {
+	var list []store.PendingAppeal
+	for id := afterID + 1; len(list) < limit && id <= int64(len(f.appeals)); id++ {
+		if a := f.appeals[id]; a.Status == store.AppealPending {
+			list = append(list, store.PendingAppeal{Appeal: a, ChallengeTitle: "책상 정리", ParticipationStatus: "failed"})
+		}
+	}
+	return list, nil
+}
+
+func (f *fakeReviewStore) ReviewAppeal(ctx context.Context, appealID int64, accept bool, reason, actor string) (*store.AppealDecision, error) {
+	a, ok := f.appeals[appealID]
+	if !ok {
+		return nil, nil
+	}
+	if a.Status != store.AppealPending {
+		return nil, store.ErrAppealNotPending
+	}
+	a.Status, a.DecisionReason, a.ReviewedBy = store.AppealRejected, reason, actor
+	d := &store.AppealDecision{}
+	if accept {
+		a.Status, d.ParticipationStatus, d.Settlement = store.AppealAccepted, "success", store.SettlementRecompute
+	}
+	f.appeals[appealID] = a
+	f.actors = append(f.actors, actor)
+	d.Appeal = a
+	return d, nil
+}
+
+func TestAdminReviewAPI(t *testing.T) {
+	token := strings.Repeat("r", minAdminTokenLen)
+	creds, err := parseAdminTokens("reviewer:" + token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC)
+	fs := &fakeReviewStore{items: map[int64]store.Proof{}, appeals: map[int64]store.Appeal{}}
+	for id := int64(1); id <= 3; id++ {
+		fs.items[id] = store.Proof{ID: id, ParticipationID: 10 + id, ProofDate: day, ProofType: "photo", Status: store.ProofPending, ReviewReason: proof.ReviewMissingEXIF}
+		fs.appeals[id] = store.Appeal{ID: id, ParticipationID: 10 + id, ProofDate: day, Note: "사진이 어두웠습니다", Status: store.AppealPending}
+	}
+	mux := http.NewServeMux()
+	registerReviewRoutes(mux, creds, fs)
+
+	do := func(method, path, bearer, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Requires admin token", func(t *testing.T) {
+		if rec := do(http.MethodGet, "/admin/v1/proofs/pending", "", ""); rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected 401, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Lists pending with cursor", func(t *testing.T) {
+		rec := do(http.MethodGet, "/admin/v1/proofs/pending?limit=2", token, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp struct {
+			Items []struct {
+				ID             int64  `json:"id"`
+				ReviewReason   string `json:"reviewReason"`
+				ChallengeTitle string `json:"challengeTitle"`
+			} `json:"items"`
+			NextAfter int64 `json:"nextAfter"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Items) != 2 || resp.NextAfter != 2 || resp.Items[0].ReviewReason != proof.ReviewMissingEXIF || resp.Items[0].ChallengeTitle == "" {
+			t.Errorf("unexpected page: %s", rec.Body.String())
+		}
+		if rec := do(http.MethodGet, "/admin/v1/proofs/pending?after=2", token, ""); !strings.Contains(rec.Body.String(), `"id":3`) || strings.Contains(rec.Body.String(), "nextAfter") {
+			t.Errorf("unexpected last page: %s", rec.Body.String())
+		}
+		if rec := do(http.MethodGet, "/admin/v1/proofs/pending?limit=0", token, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for invalid limit, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Accept and reject", func(t *testing.T) {
+		if rec := do(http.MethodPost, "/admin/v1/proofs/1/accept", token, ""); rec.Code != http.StatusOK || fs.items[1].Status != store.ProofAccepted {
+			t.Fatalf("expected accept, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if got := fs.actors[len(fs.actors)-1]; got != "admin:reviewer" {
+			t.Errorf("expected actor admin:reviewer, got %s", got)
+		}
+		if rec := do(http.MethodPost, "/admin/v1/proofs/2/reject", token, `{"reason":"  "}`); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("expected 422 without reason, got %d", rec.Code)
+		}
+		rec := do(http.MethodPost, "/admin/v1/proofs/2/reject", token, `{"reason":"인증 대상이 보이지 않습니다"}`)
+		if rec.Code != http.StatusOK || fs.items[2].Status != store.ProofRejected || fs.items[2].RejectReason != "인증 대상이 보이지 않습니다" {
+			t.Fatalf("expected reject, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if rec := do(http.MethodPost, "/admin/v1/proofs/1/reject", token, `{"reason":"x"}`); rec.Code != http.StatusConflict {
+			t.Errorf("expected 409 for decided proof, got %d", rec.Code)
+		}
+		if rec := do(http.MethodPost, "/admin/v1/proofs/99/accept", token, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("expected 404, got %d", rec.Code)
+		}
+		if rec := do(http.MethodGet, "/admin/v1/proofs/3/accept", token, ""); rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("expected 405, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Appeals", func(t *testing.T) {
+		rec := do(http.MethodGet, "/admin/v1/appeals/pending?limit=5", token, "")
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"note":"사진이 어두웠습니다"`) || strings.Contains(rec.Body.String(), "nextAfter") {
+			t.Fatalf("unexpected appeal list %d: %s", rec.Code, rec.Body.String())
+		}
+		rec = do(http.MethodPost, "/admin/v1/appeals/1/accept", token, "")
+		if rec.Code != http.StatusOK || fs.appeals[1].Status != store.AppealAccepted {
+			t.Fatalf("expected accept, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if !strings.Contains(rec.Body.String(), `"settlement":"cohort_recompute"`) || !strings.Contains(rec.Body.String(), `"participationStatus":"success"`) {
+			t.Errorf("expected re-decided settlement in response, got %s", rec.Body.String())
+		}
+		if rec := do(http.MethodPost, "/admin/v1/appeals/2/reject", token, `{}`); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("expected 422 without reason, got %d", rec.Code)
+		}
+		if rec := do(http.MethodPost, "/admin/v1/appeals/2/reject", token, `{"reason":"인증 기준 미충족"}`); rec.Code != http.StatusOK || fs.appeals[2].DecisionReason != "인증 기준 미충족" {
+			t.Errorf("expected reject, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if rec := do(http.MethodPost, "/admin/v1/appeals/1/reject", token, `{"reason":"x"}`); rec.Code != http.StatusConflict {
+			t.Errorf("expected 409 for decided appeal, got %d", rec.Code)
+		}
+		if rec := do(http.MethodPost, "/admin/v1/appeals/abc/accept", token, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for invalid id, got %d", rec.Code)
+		}
+	})
+}
+
+type fakeAppealStore struct {
+	users   map[string]int64
+	appeals []store.Appeal
+	err     error
+}
+
+func (f *fakeAppealStore) GetUserByTossKey(ctx context.Context, tossUserKey string) (*store.User, error) {
+	id, ok := f.users[tossUserKey]
+	if !ok {
+		return nil, nil
+	}
+	return &store.User{ID: id, TossUserKey: tossUserKey}, nil
+}
+
+func (f *fakeAppealStore) CreateAppeal(ctx context.Context, sub store.AppealSubmission) (*store.Appeal, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	a := store.Appeal{ID: int64(len(f.appeals) + 1), UserID: sub.UserID, ChallengeID: sub.ChallengeID, ProofDate: sub.ProofDate,
+		Note: sub.Note, ImageHash: sub.ImageHash, ImageURL: sub.ImageURL, Status: store.AppealPending}
+	f.appeals = append(f.appeals, a)
+	return &a, nil
+}
+
+func (f *fakeAppealStore) ListAppealsByUser(ctx context.Context, userID int64, limit int) ([]store.Appeal, error) {
+	var list []store.Appeal
+	for _, a := range f.appeals {
+		if a.UserID == userID {
+			list = append(list, a)
+		}
+	}
+	return list, nil
+}
+
+// fakeImageRecorder maps recorded image keys to URLs
+type fakeImageRecorder map[string]string
+
+func (f fakeImageRecorder) RecordProofImage(ctx context.Context, key, url string, size int64) (string, error) {
+	if prev, ok := f[key]; ok {
+		return prev, nil
+	}
+	f[key] = url
+	return url, nil
+}
+
+func TestAdminImageAPI(t *testing.T) {
+	token := strings.Repeat("i", minAdminTokenLen)
+	creds, err := parseAdminTokens("reviewer:" + token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobs, err := blobstore.NewDisk(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	photo, err := base64.StdEncoding.DecodeString(testPhotoBase64(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := blobstore.ContentKey("proofs", photo, ".png")
+	if err := blobs.Put(context.Background(), key, photo, "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	registerImageRoutes(mux, creds, blobs)
+
+	get := func(path, bearer string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get(defaultImageBaseURL+"/"+key, token)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/png" || !bytes.Equal(rec.Body.Bytes(), photo) {
+		t.Errorf("expected the stored photo, got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if rec := get(defaultImageBaseURL+"/"+key, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without admin token, got %d", rec.Code)
+	}
+	for _, path := range []string{defaultImageBaseURL + "/proofs/00/missing.png", defaultImageBaseURL + "/proofs/..%2F..%2Fetc/passwd"} {
+		if rec := get(path, token); rec.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", path, rec.Code)
+		}
+	}
+}
+
+// fakePayoutStore requeues settlements listed as failed
+type fakePayoutStore map[int64]string
+
+func (f fakePayoutStore) RequeuePayout(ctx context.Context, settlementID int64, actor string) (bool, error) {
+	if f[settlementID] != "failed" {
+		return false, nil
+	}
+	f[settlementID] = "requeued by " + actor
+	return true, nil
+}
+
+func TestAdminPayoutRequeueAPI(t *testing.T) {
+	token := strings.Repeat("p", minAdminTokenLen)
+	creds, err := parseAdminTokens("ops:" + token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := fakePayoutStore{1: "failed", 2: "done"}
+	mux := http.NewServeMux()
+	registerPayoutRoutes(mux, creds, fs)
+
+	post := func(path, bearer string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := post("/admin/v1/settlements/1/payout/requeue", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without admin token, got %d", rec.Code)
+	}
+	if rec := post("/admin/v1/settlements/1/payout/requeue", token); rec.Code != http.StatusOK || fs[1] != "requeued by admin:ops" {
+		t.Errorf("expected requeue, got %d %q", rec.Code, fs[1])
+	}
+	for path, want := range map[string]int{
+		"/admin/v1/settlements/2/payout/requeue": http.StatusConflict,
+		"/admin/v1/settlements/x/payout/requeue": http.StatusBadRequest,
+	} {
+		if rec := post(path, token); rec.Code != want {
+			t.Errorf("%s: expected %d, got %d", path, want, rec.Code)
+		}
+	}
+}
+
+// testPhotoBase64 returns a base64 PNG that passes the photo content checks
+func testPhotoBase64(t *testing.T) string {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 256, 256))
+	for y := 0; y < 256; y++ {
+		for x := 0; x < 256; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestAppealAPI(t *testing.T) {
+	keys := mustKeyring(t, "test-secret", "", nil)
+	fs := &fakeAppealStore{users: map[string]int64{"toss:1": 7}}
+	mux := http.NewServeMux()
+	blobs, err := blobstore.NewDisk(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded := fakeImageRecorder{}
+	registerAppealRoutes(mux, auth(keys, nil), nil, fs, &proofImages{blobs: blobs, st: recorded, baseURL: defaultImageBaseURL})
+
+	token := signSession(keys, "toss:1", time.Hour)
+	do := func(method, bearer, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/v1/proofs/appeals", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+bearer)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Create", func(t *testing.T) {
+		rec := do(http.MethodPost, token, `{"challengeId":"desk-tidy","proofDate":"2025-03-02","note":" 정리한 책상 사진을 추가로 올립니다 ","imageBase64":"`+testPhotoBase64(t)+`"}`)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+		}
+		a := fs.appeals[0]
+		if a.UserID != 7 || a.Note != "정리한 책상 사진을 추가로 올립니다" || a.ImageHash == "" || a.ProofDate.Format("2006-01-02") != "2025-03-02" {
+			t.Errorf("unexpected appeal: %+v", a)
+		}
+		if strings.Contains(rec.Body.String(), "reviewedBy") {
+			t.Errorf("reviewer should not be shown to users: %s", rec.Body.String())
+		}
+		key := strings.TrimPrefix(a.ImageURL, defaultImageBaseURL+"/")
+		if !strings.HasPrefix(key, "proofs/") || !strings.HasSuffix(key, ".png") || recorded[key] != a.ImageURL {
+			t.Errorf("expected the photo to be stored and recorded, got url %q (recorded %v)", a.ImageURL, recorded)
+		}
+		if _, err := blobs.Get(context.Background(), key); err != nil {
+			t.Errorf("stored photo: %v", err)
+		}
+	})
+
+	t.Run("Validates input", func(t *testing.T) {
+		for _, body := range []string{
+			`{"challengeId":"desk-tidy","proofDate":"2025-03-02"}`,
+			`{"challengeId":"desk-tidy","proofDate":"03/02","note":"x"}`,
+			`{"proofDate":"2025-03-02","note":"x"}`,
+			`{"challengeId":"desk-tidy","proofDate":"2025-03-02","note":"` + strings.Repeat("가", maxAppealNoteLen+1) + `"}`,
+			`{"challengeId":"desk-tidy","proofDate":"2025-03-02","note":"x","imageBase64":"!!"}`,
+			`{"challengeId":"desk-tidy","proofDate":"2025-03-02","note":"x","imageBase64":"aGVsbG8="}`,
+		} {
+			if rec := do(http.MethodPost, token, body); rec.Code != http.StatusBadRequest {
+				t.Errorf("expected 400 for %.80s, got %d", body, rec.Code)
+			}
+		}
+	})
+
+	t.Run("Maps store errors", func(t *testing.T) {
+		tests := []struct {
+			err  error
+			code int
+		}{
+			{store.ErrAppealExists, http.StatusConflict},
+			{store.ErrAppealDayCounted, http.StatusConflict},
+			{store.ErrAppealExpired, http.StatusBadRequest},
+			{errors.New("db down"), http.StatusInternalServerError},
+		}
+		for _, tt := range tests {
+			fs.err = tt.err
+			if rec := do(http.MethodPost, token, `{"challengeId":"desk-tidy","proofDate":"2025-03-02","note":"x"}`); rec.Code != tt.code {
+				t.Errorf("%v: expected %d, got %d", tt.err, tt.code, rec.Code)
+			}
+		}
+		fs.err = nil
+		if rec := do(http.MethodPost, signSession(keys, "toss:unknown", time.Hour), `{"challengeId":"desk-tidy","proofDate":"2025-03-02","note":"x"}`); rec.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for user without participation, got %d", rec.Code)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		rec := do(http.MethodGet, token, "")
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"status":"pending"`) {
+			t.Errorf("unexpected list %d: %s", rec.Code, rec.Body.String())
+		}
+		if rec := do(http.MethodGet, signSession(keys, "toss:unknown", time.Hour), ""); rec.Body.String() != `{"items":[]}`+"\n" {
+			t.Errorf("expected empty list, got %q", rec.Body.String())
+		}
+	})
+}
+
 // ===== Rate Limiter Tests =====
 
 func TestRateLimiter(t *testing.T) {
@@ -150,54 +1085,162 @@ func TestRateLimiter(t *testing.T) {
 // ===== Idempotency Store Tests =====
 
 func TestIdemStore(t *testing.T) {
-	t.Run("First use succeeds", func(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("First use reserves", func(t *testing.T) {
+		store := newIdemStore()
+
+		if _, reserved, _ := store.ReserveIdempotency(ctx, "s", "key1", "u", "h", time.Minute); !reserved {
+			t.Error("expected first use to reserve")
+		}
+	})
+
+	t.Run("Duplicate in flight is not reserved", func(t *testing.T) {
+		store := newIdemStore()
+
+		store.ReserveIdempotency(ctx, "s", "key1", "u", "h", time.Minute)
+
+		rec, reserved, _ := store.ReserveIdempotency(ctx, "s", "key1", "u", "h", time.Minute)
+		if reserved || rec.Completed() {
+			t.Errorf("expected in-flight duplicate, got reserved=%v rec=%+v", reserved, rec)
+		}
+	})
+
+	t.Run("Completed response is returned", func(t *testing.T) {
 		store := newIdemStore()
 
-		if !store.TryUse("key1", time.Minute) {
-			t.Error("expected first use to succeed")
+		store.ReserveIdempotency(ctx, "s", "key1", "u", "h", time.Minute)
+		store.CompleteIdempotency(ctx, "s", "key1", "u", 200, []byte(`{"ok":true}`))
+
+		rec, reserved, _ := store.ReserveIdempotency(ctx, "s", "key1", "u", "h", time.Minute)
+		if reserved || rec.StatusCode != 200 || string(rec.Response) != `{"ok":true}` {
+			t.Errorf("expected stored response, got reserved=%v rec=%+v", reserved, rec)
 		}
 	})
 
-	t.Run("Duplicate blocked", func(t *testing.T) {
+	t.Run("Keys are scoped per user and scope", func(t *testing.T) {
 		store := newIdemStore()
 
-		store.TryUse("key1", time.Minute)
+		store.ReserveIdempotency(ctx, "s", "key1", "u", "h", time.Minute)
 
-		if store.TryUse("key1", time.Minute) {
-			t.Error("expected duplicate to be blocked")
+		if _, reserved, _ := store.ReserveIdempotency(ctx, "s", "key1", "other", "h", time.Minute); !reserved {
+			t.Error("expected different user to reserve")
+		}
+		if _, reserved, _ := store.ReserveIdempotency(ctx, "other", "key1", "u", "h", time.Minute); !reserved {
+			t.Error("expected different scope to reserve")
 		}
 	})
 
-	t.Run("Different keys independent", func(t *testing.T) {
+	t.Run("Released key can be reused", func(t *testing.T) {
 		store := newIdemStore()
 
-		store.TryUse("key1", time.Minute)
+		store.ReserveIdempotency(ctx, "s", "key1", "u", "h", time.Minute)
+		store.ReleaseIdempotency(ctx, "s", "key1", "u")
 
-		if !store.TryUse("key2", time.Minute) {
-			t.Error("expected different key to succeed")
+		if _, reserved, _ := store.ReserveIdempotency(ctx, "s", "key1", "u", "h", time.Minute); !reserved {
+			t.Error("expected released key to be reusable")
 		}
 	})
 
 	t.Run("Expired key can be reused", func(t *testing.T) {
 		store := newIdemStore()
 
-		store.TryUse("key1", 10*time.Millisecond)
+		store.ReserveIdempotency(ctx, "s", "key1", "u", "h", 10*time.Millisecond)
+		store.CompleteIdempotency(ctx, "s", "key1", "u", 200, []byte(`{}`))
 
 		time.Sleep(15 * time.Millisecond)
 
-		if !store.TryUse("key1", time.Minute) {
+		if _, reserved, _ := store.ReserveIdempotency(ctx, "s", "key1", "u", "h", time.Minute); !reserved {
 			t.Error("expected expired key to be reusable")
 		}
 	})
 }
 
+func TestIdempotentMiddleware(t *testing.T) {
+	calls := 0
+	handler := idempotent(newIdemStore(), "paycreate", []string{"*"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		var body struct {
+			Fail bool `json:"fail"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.Fail {
+			writeErr(w, http.StatusInternalServerError, "boom")
+			return
+		}
+		writeJSON(w, http.StatusOK, jsonMap{"paymentId": calls})
+	}))
+
+	do := func(sub, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/payments/create", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), claimsKey, Claims{Sub: sub}))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Retry replays the original response", func(t *testing.T) {
+		first := do("user-1", "k1", `{"challengeId":"walk"}`)
+		second := do("user-1", "k1", `{"challengeId":"walk"}`)
+
+		if first.Code != http.StatusOK || second.Code != http.StatusOK {
+			t.Fatalf("expected 200/200, got %d/%d", first.Code, second.Code)
+		}
+		if first.Body.String() != second.Body.String() {
+			t.Errorf("expected replayed body %s, got %s", first.Body.String(), second.Body.String())
+		}
+		if second.Header().Get("Idempotent-Replayed") != "true" {
+			t.Error("expected Idempotent-Replayed header on replay")
+		}
+	})
+
+	t.Run("Same key from another user is independent", func(t *testing.T) {
+		before := calls
+		do("user-2", "k1", `{"challengeId":"walk"}`)
+		if calls != before+1 {
+			t.Error("expected handler to run for a different user")
+		}
+	})
+
+	t.Run("Different body with same key is rejected", func(t *testing.T) {
+		rr := do("user-1", "k1", `{"challengeId":"other"}`)
+		if rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("expected 422, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Server errors are not stored", func(t *testing.T) {
+		do("user-1", "k2", `{"fail":true}`)
+		before := calls
+		do("user-1", "k2", `{"fail":true}`)
+		if calls != before+1 {
+			t.Error("expected handler to run again after a 5xx")
+		}
+	})
+
+	t.Run("Requests without a key are not deduplicated", func(t *testing.T) {
+		before := calls
+		do("user-1", "", `{}`)
+		do("user-1", "", `{}`)
+		if calls != before+2 {
+			t.Errorf("expected 2 handler calls, got %d", calls-before)
+		}
+	})
+}
+
 // ===== Revoked Store Tests =====
 
 func TestRevokedStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
 	t.Run("Not revoked initially", func(t *testing.T) {
 		store := newRevokedStore()
 
-		if store.IsRevoked("user1") {
+		if mustRevoked(t, store, "user1", now) {
 			t.Error("expected user to not be revoked initially")
 		}
 	})
@@ -205,19 +1248,29 @@ func TestRevokedStore(t *testing.T) {
 	t.Run("Revoked after calling Revoke", func(t *testing.T) {
 		store := newRevokedStore()
 
-		store.Revoke("user1")
+		store.Revoke(ctx, "user1", "unlink")
 
-		if !store.IsRevoked("user1") {
+		if !mustRevoked(t, store, "user1", now) {
 			t.Error("expected user to be revoked")
 		}
 	})
 
+	t.Run("Sessions issued after revocation are valid", func(t *testing.T) {
+		store := newRevokedStore()
+
+		store.Revoke(ctx, "user1", "unlink")
+
+		if mustRevoked(t, store, "user1", time.Now().Add(time.Minute).Unix()) {
+			t.Error("expected a later login to be accepted")
+		}
+	})
+
 	t.Run("Different users independent", func(t *testing.T) {
 		store := newRevokedStore()
 
-		store.Revoke("user1")
+		store.Revoke(ctx, "user1", "unlink")
 
-		if store.IsRevoked("user2") {
+		if mustRevoked(t, store, "user2", now) {
 			t.Error("expected user2 to not be revoked")
 		}
 	})
@@ -225,16 +1278,242 @@ func TestRevokedStore(t *testing.T) {
 	t.Run("Empty string not revoked", func(t *testing.T) {
 		store := newRevokedStore()
 
-		store.Revoke("")
+		store.Revoke(ctx, "", "unlink")
 
-		if store.IsRevoked("") {
+		if mustRevoked(t, store, "", now) {
 			t.Error("expected empty string to not be considered revoked")
 		}
 	})
 }
 
+// fakeRevocations is an in-memory revocationBackend shared by several revokedStores
+type fakeRevocations struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time
+	lookups int
+	fail    bool
+}
+
+func (f *fakeRevocations) RevokeSession(ctx context.Context, userSub, reason string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail {
+		return errors.New("db down")
+	}
+	f.revoked[userSub] = time.Now()
+	return nil
+}
+
+func (f *fakeRevocations) GetSessionRevokedAt(ctx context.Context, userSub string) (*time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lookups++
+	if f.fail {
+		return nil, errors.New("db down")
+	}
+	if at, ok := f.revoked[userSub]; ok {
+		return &at, nil
+	}
+	return nil, nil
+}
+
+func TestRevokedStoreWithDB(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	t.Run("Revocation is shared across instances", func(t *testing.T) {
+		db := &fakeRevocations{revoked: map[string]time.Time{}}
+		a := newRevokedStoreWithDB(db, 0)
+		b := newRevokedStoreWithDB(db, 0)
+
+		if err := a.Revoke(ctx, "toss:1", "unlink"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !mustRevoked(t, b, "toss:1", now) {
+			t.Error("expected revocation to be visible to another instance")
+		}
+	})
+
+	t.Run("Revocation survives a restart", func(t *testing.T) {
+		db := &fakeRevocations{revoked: map[string]time.Time{}}
+		newRevokedStoreWithDB(db, time.Minute).Revoke(ctx, "toss:1", "unlink")
+
+		restarted := newRevokedStoreWithDB(db, time.Minute)
+		if !mustRevoked(t, restarted, "toss:1", now) {
+			t.Error("expected revocation to survive a restart")
+		}
+	})
+
+	t.Run("Lookups are cached", func(t *testing.T) {
+		db := &fakeRevocations{revoked: map[string]time.Time{}}
+		s := newRevokedStoreWithDB(db, time.Minute)
+
+		mustRevoked(t, s, "toss:1", now)
+		mustRevoked(t, s, "toss:1", now)
+		if db.lookups != 1 {
+			t.Errorf("expected 1 lookup, got %d", db.lookups)
+		}
+	})
+
+	t.Run("Revoke fails when the backend fails", func(t *testing.T) {
+		db := &fakeRevocations{revoked: map[string]time.Time{}, fail: true}
+		s := newRevokedStoreWithDB(db, time.Minute)
+
+		if err := s.Revoke(ctx, "toss:1", "unlink"); err == nil {
+			t.Error("expected error so the unlink callback is retried")
+		}
+		if _, err := s.IsRevoked(ctx, "toss:2", now); err == nil {
+			t.Error("expected lookup error for an unknown user when the backend is down")
+		}
+	})
+
+	t.Run("Failed lookups fail closed and are not cached", func(t *testing.T) {
+		db := &fakeRevocations{revoked: map[string]time.Time{"toss:1": time.Now()}}
+		s := newRevokedStoreWithDB(db, 0)
+
+		db.fail = true
+		if _, err := s.IsRevoked(ctx, "toss:2", now); err == nil {
+			t.Error("expected lookup error")
+		}
+		db.fail = false
+		mustRevoked(t, s, "toss:1", now)
+		db.fail = true
+		if !mustRevoked(t, s, "toss:1", now) {
+			t.Error("expected a cached revocation to hold while the backend is down")
+		}
+		db.fail = false
+		db.revoked["toss:2"] = time.Now()
+		if !mustRevoked(t, s, "toss:2", now) {
+			t.Error("expected the failed lookup not to be cached as valid")
+		}
+	})
+
+	t.Run("Auth rejects requests while the backend is down", func(t *testing.T) {
+		db := &fakeRevocations{revoked: map[string]time.Time{}, fail: true}
+		keys := mustKeyring(t, "test-secret-key-12345", "", nil)
+		tok := signSession(keys, "toss:3", time.Hour)
+
+		h := auth(keys, newRevokedStoreWithDB(db, time.Minute))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/v1/me", nil)
+		req.Header.Set("Authorization", "Bearer "+tok)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("expected 503, got %d", rec.Code)
+		}
+	})
+}
+
+// mustRevoked calls IsRevoked and fails the test on a lookup error
+func mustRevoked(t *testing.T, s *revokedStore, sub string, issuedAt int64) bool {
+	t.Helper()
+	revoked, err := s.IsRevoked(context.Background(), sub, issuedAt)
+	if err != nil {
+		t.Fatalf("unexpected lookup error: %v", err)
+	}
+	return revoked
+}
+
 // ===== CORS Tests =====
 
+// ===== Payment Callback Tests =====
+
+func TestParsePaymentCallback(t *testing.T) {
+	t.Run("JSON body", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/v1/payments/callback",
+			strings.NewReader(`{"orderNo":" pay_1 ","payToken":"tok","status":"PAY_COMPLETE"}`))
+		req.Header.Set("Content-Type", "application/json")
+
+		cb, err := parsePaymentCallback(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if cb.OrderNo != "pay_1" || cb.PayToken != "tok" || cb.Status != "PAY_COMPLETE" {
+			t.Errorf("unexpected callback: %+v", cb)
+		}
+	})
+
+	t.Run("Form body", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/v1/payments/callback",
+			strings.NewReader("orderNo=pay_2&payToken=tok&status=PAY_COMPLETE"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		cb, err := parsePaymentCallback(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if cb.OrderNo != "pay_2" || cb.PayToken != "tok" {
+			t.Errorf("unexpected callback: %+v", cb)
+		}
+	})
+
+	t.Run("Missing orderNo", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/v1/payments/callback", strings.NewReader(`{"payToken":"tok"}`))
+		if _, err := parsePaymentCallback(req); err == nil {
+			t.Error("expected error for missing orderNo")
+		}
+	})
+
+	t.Run("Invalid JSON", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/v1/payments/callback", strings.NewReader(`{`))
+		if _, err := parsePaymentCallback(req); err == nil {
+			t.Error("expected error for invalid json")
+		}
+	})
+}
+
+func TestCallbackURL(t *testing.T) {
+	tests := []struct {
+		name  string
+		base  string
+		token string
+		want  string
+	}{
+		{"No token", "https://api.example.com/v1/payments/callback", "", "https://api.example.com/v1/payments/callback"},
+		{"With token", "https://api.example.com/v1/payments/callback", "s3cret", "https://api.example.com/v1/payments/callback?token=s3cret"},
+		{"Existing query", "https://api.example.com/cb?env=stg", "s3cret", "https://api.example.com/cb?env=stg&token=s3cret"},
+		{"Not configured", "", "s3cret", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := callbackURL(tt.base, tt.token); got != tt.want {
+				t.Errorf("callbackURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// ===== Payment Cancellation Tests =====
+
+func TestCanCancelParticipation(t *testing.T) {
+	now := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+	grace := time.Hour
+
+	tests := []struct {
+		name    string
+		p       *store.Participation
+		wantErr bool
+	}{
+		{"Within grace", &store.Participation{Status: "active", CreatedAt: now.Add(-30 * time.Minute)}, false},
+		{"Grace expired", &store.Participation{Status: "active", CreatedAt: now.Add(-2 * time.Hour)}, true},
+		{"Proof already submitted", &store.Participation{Status: "active", ProofCount: 1, CreatedAt: now}, true},
+		{"Not active", &store.Participation{Status: "cancelled", CreatedAt: now}, true},
+		{"Missing participation", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := canCancelParticipation(tt.p, now, grace)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("canCancelParticipation() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestParseAllowedOrigins(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -370,7 +1649,7 @@ func TestPreflightHandling(t *testing.T) {
 }
 
 func TestAuthMiddleware(t *testing.T) {
-	secret := "test-secret"
+	secret := mustKeyring(t, "test-secret", "", nil)
 	revoked := newRevokedStore()
 
 	protectedHandler := auth(secret, revoked)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -421,7 +1700,7 @@ func TestAuthMiddleware(t *testing.T) {
 	})
 
 	t.Run("Revoked session", func(t *testing.T) {
-		revoked.Revoke("revoked-user")
+		revoked.Revoke(context.Background(), "revoked-user", "unlink")
 		token := signSession(secret, "revoked-user", time.Hour)
 
 		req := httptest.NewRequest(http.MethodGet, "/protected", nil)
@@ -516,3 +1795,162 @@ func TestShortHash(t *testing.T) {
 		t.Errorf("expected hash length 12, got %d", len(hash1))
 	}
 }
+
+// ===== Payment Cancel Tests =====
+
+// fakeCancelStore is an in-memory paymentCancelStore for one user's payments
+type fakeCancelStore struct {
+	userID   int64
+	payments map[int64]*store.Payment
+	parts    map[int64]*store.Participation
+}
+
+func (f *fakeCancelStore) GetPaymentByID(ctx context.Context, paymentID int64) (*store.Payment, error) {
+	if p := f.payments[paymentID]; p != nil {
+		cp := *p
+		return &cp, nil
+	}
+	return nil, nil
+}
+
+func (f *fakeCancelStore) GetUserByTossKey(ctx context.Context, tossUserKey string) (*store.User, error) {
+	return &store.User{ID: f.userID}, nil
+}
+
+func (f *fakeCancelStore) GetParticipationByPaymentID(ctx context.Context, paymentID int64) (*store.Participation, error) {
+	return f.parts[paymentID], nil
+}
+
+func (f *fakeCancelStore) ClaimPaymentCancel(ctx context.Context, paymentID int64) (*store.Payment, error) {
+	p := f.payments[paymentID]
+	if p == nil || p.Status != "done" {
+		return nil, nil
+	}
+	p.Status = "cancelling"
+	cp := *p
+	return &cp, nil
+}
+
+func (f *fakeCancelStore) ReleasePaymentCancel(ctx context.Context, paymentID int64) error {
+	if p := f.payments[paymentID]; p != nil && p.Status == "cancelling" {
+		p.Status = "done"
+	}
+	return nil
+}
+
+func (f *fakeCancelStore) RefundPayment(ctx context.Context, paymentID int64, refundNo string, refundedAmount int64, fullyRefunded bool, reason string) (*store.Payment, error) {
+	p := f.payments[paymentID]
+	if p == nil || (p.Status != "done" && p.Status != "cancelling") {
+		return nil, errors.New("payment not found or not refundable")
+	}
+	p.Status = "refunded"
+	if part := f.parts[paymentID]; part != nil {
+		part.Status = "cancelled"
+	}
+	cp := *p
+	return &cp, nil
+}
+
+// flakyCancelService fails CancelPayment, optionally after refunding at the provider
+// (a timeout on the way back), and can fail the follow-up status lookup too.
+type flakyCancelService struct {
+	*payment.MockService
+	refundBeforeFailing bool
+	statusErr           error
+}
+
+func (s *flakyCancelService) CancelPayment(ctx context.Context, payToken string, amount int64, reason string) (*payment.CancelResponse, error) {
+	if s.refundBeforeFailing {
+		if _, err := s.MockService.CancelPayment(ctx, payToken, amount, reason); err != nil {
+			return nil, err
+		}
+	}
+	return nil, errors.New("context deadline exceeded")
+}
+
+func (s *flakyCancelService) GetStatus(ctx context.Context, payToken string) (*payment.StatusResponse, error) {
+	if s.statusErr != nil {
+		return nil, s.statusErr
+	}
+	return s.MockService.GetStatus(ctx, payToken)
+}
+
+func TestPaymentCancelAPI(t *testing.T) {
+	keys := mustKeyring(t, "test-secret", "", nil)
+	token := signSession(keys, "toss:1", time.Hour)
+
+	setup := func(t *testing.T, newSvc func(*payment.MockService) payment.Service) (*fakeCancelStore, *http.ServeMux) {
+		t.Helper()
+		ctx := context.Background()
+		mock := payment.NewMockServiceWithDelay(0)
+		created, err := mock.CreatePayment(ctx, payment.CreateRequest{OrderNo: "ORDER", Amount: 10000})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := mock.ExecutePayment(ctx, created.PayToken); err != nil {
+			t.Fatal(err)
+		}
+		fs := &fakeCancelStore{
+			userID:   7,
+			payments: map[int64]*store.Payment{1: {ID: 1, UserID: 7, PayToken: created.PayToken, Amount: 10000, Status: "done"}},
+			parts:    map[int64]*store.Participation{1: {ID: 3, UserID: 7, PaymentID: 1, Status: "active", CreatedAt: time.Now()}},
+		}
+		mux := http.NewServeMux()
+		registerPaymentCancelRoute(mux, auth(keys, nil), nil, fs, newSvc(mock), nil, time.Hour)
+		return fs, mux
+	}
+	cancelPayment := func(mux *http.ServeMux) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/payments/cancel", strings.NewReader(`{"paymentId":1}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Refund is recorded", func(t *testing.T) {
+		fs, mux := setup(t, func(m *payment.MockService) payment.Service { return m })
+		if rec := cancelPayment(mux); rec.Code != http.StatusOK || fs.payments[1].Status != "refunded" {
+			t.Fatalf("expected refund, got %d %s (payment %s)", rec.Code, rec.Body.String(), fs.payments[1].Status)
+		}
+		if rec := cancelPayment(mux); rec.Code != http.StatusConflict {
+			t.Errorf("expected a second cancel to be refused, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Provider refusal releases the claim", func(t *testing.T) {
+		fs, mux := setup(t, func(m *payment.MockService) payment.Service { return &flakyCancelService{MockService: m} })
+		if rec := cancelPayment(mux); rec.Code != http.StatusBadGateway {
+			t.Fatalf("expected 502, got %d %s", rec.Code, rec.Body.String())
+		}
+		if fs.payments[1].Status != "done" || fs.parts[1].Status != "active" {
+			t.Errorf("expected payment released, got %s/%s", fs.payments[1].Status, fs.parts[1].Status)
+		}
+	})
+
+	t.Run("Timeout after the provider refunded records the refund", func(t *testing.T) {
+		fs, mux := setup(t, func(m *payment.MockService) payment.Service {
+			return &flakyCancelService{MockService: m, refundBeforeFailing: true}
+		})
+		if rec := cancelPayment(mux); rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d %s", rec.Code, rec.Body.String())
+		}
+		if fs.payments[1].Status != "refunded" || fs.parts[1].Status != "cancelled" {
+			t.Errorf("expected refund recorded, got %s/%s", fs.payments[1].Status, fs.parts[1].Status)
+		}
+	})
+
+	t.Run("Unknown provider status keeps the claim", func(t *testing.T) {
+		fs, mux := setup(t, func(m *payment.MockService) payment.Service {
+			return &flakyCancelService{MockService: m, refundBeforeFailing: true, statusErr: errors.New("timeout")}
+		})
+		if rec := cancelPayment(mux); rec.Code != http.StatusBadGateway || !strings.Contains(rec.Body.String(), "pending") {
+			t.Fatalf("expected 502 pending, got %d %s", rec.Code, rec.Body.String())
+		}
+		if fs.payments[1].Status != "cancelling" {
+			t.Errorf("expected payment to stay cancelling for the reconcile job, got %s", fs.payments[1].Status)
+		}
+		if rec := cancelPayment(mux); rec.Code != http.StatusConflict {
+			t.Errorf("expected a retry to be refused while claimed, got %d", rec.Code)
+		}
+	})
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// payoutAdminStore is the subset of store.Store used to requeue failed payouts
+type payoutAdminStore interface {
+	RequeuePayout(ctx context.Context, settlementID int64, actor string) (bool, error)
+}
+
+// registerPayoutRoutes mounts POST /admin/v1/settlements/{id}/payout/requeue, which lets
+// payout-settlements retry a settlement after its payouts failed too many times (e.g. once
+// the promotion budget is topped up).
+func registerPayoutRoutes(mux *http.ServeMux, creds adminCreds, st payoutAdminStore) {
+	mux.Handle("POST /admin/v1/settlements/{id}/payout/requeue", adminAuth(creds)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id <= 0 {
+			writeErr(w, http.StatusBadRequest, "invalid settlement id")
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+		ok, err := st.RequeuePayout(ctx, id, adminActor(r.Context()))
+		if err != nil {
+			log.Printf("[error] admin requeue payout for settlement %d: %v", id, err)
+			writeErr(w, http.StatusInternalServerError, "requeue failed")
+			return
+		}
+		if !ok {
+			writeErr(w, http.StatusConflict, "settlement is not waiting on a failed payout")
+			return
+		}
+		log.Printf("[admin] %s requeued payout for settlement %d", adminActor(r.Context()), id)
+		writeJSON(w, http.StatusOK, jsonMap{"ok": true, "settlementId": id})
+	})))
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"habitcashback/internal/store"
+)
+
+const (
+	defaultReviewPageSize = 50
+	maxReviewPageSize     = 200
+	maxReviewReasonLen    = 500
+)
+
+// proofReviewStore is the subset of store.Store used by the review queue
+type proofReviewStore interface {
+	ListPendingProofs(ctx context.Context, afterID int64, limit int) ([]store.PendingProof, error)
+	ReviewProof(ctx context.Context, proofID int64, accept bool, reason, actor string) (*store.Proof, error)
+	ListPendingAppeals(ctx context.Context, afterID int64, limit int) ([]store.PendingAppeal, error)
+	ReviewAppeal(ctx context.Context, appealID int64, accept bool, reason, actor string) (*store.AppealDecision, error)
+}
+
+func proofJSON(p *store.Proof) jsonMap {
+	return jsonMap{
+		"id":              p.ID,
+		"participationId": p.ParticipationID,
+		"userId":          p.UserID,
+		"challengeId":     p.ChallengeID,
+		"proofDate":       p.ProofDate.Format("2006-01-02"),
+		"proofType":       p.ProofType,
+		"imageHash":       p.ImageHash,
+		"imageUrl":        p.ImageURL,
+		"exifTimestamp":   p.ExifTimestamp,
+		"status":          p.Status,
+		"reviewReason":    p.ReviewReason,
+		"rejectReason":    p.RejectReason,
+		"reviewedBy":      p.ReviewedBy,
+		"verifiedAt":      p.VerifiedAt,
+		"createdAt":       p.CreatedAt,
+	}
+}
+
+func pendingProofJSON(p *store.PendingProof) jsonMap {
+	m := proofJSON(&p.Proof)
+	m["challengeTitle"] = p.ChallengeTitle
+	m["participation"] = jsonMap{
+		"status":         p.ParticipationStatus,
+		"startDate":      p.StartDate.Format("2006-01-02"),
+		"endDate":        p.EndDate.Format("2006-01-02"),
+		"proofCount":     p.ProofCount,
+		"requiredProofs": p.RequiredProofs,
+	}
+	return m
+}
+
+func adminAppealJSON(a *store.Appeal) jsonMap {
+	m := appealJSON(a)
+	m["participationId"] = a.ParticipationID
+	m["userId"] = a.UserID
+	m["proofId"] = a.ProofID
+	m["note"] = a.Note
+	m["imageHash"] = a.ImageHash
+	m["imageUrl"] = a.ImageURL
+	m["reviewedBy"] = a.ReviewedBy
+	return m
+}
+
+func pendingAppealJSON(a *store.PendingAppeal) jsonMap {
+	m := adminAppealJSON(&a.Appeal)
+	m["rejectReason"] = a.RejectReason
+	m["proofImageUrl"] = a.ProofImageURL
+	m["challengeTitle"] = a.ChallengeTitle
+	m["participation"] = jsonMap{
+		"status":         a.ParticipationStatus,
+		"startDate":      a.StartDate.Format("2006-01-02"),
+		"endDate":        a.EndDate.Format("2006-01-02"),
+		"proofCount":     a.ProofCount,
+		"requiredProofs": a.RequiredProofs,
+	}
+	return m
+}
+
+// registerReviewRoutes mounts the review queues for pending proofs (/admin/v1/proofs)
+// and appeals (/admin/v1/appeals).
+func registerReviewRoutes(mux *http.ServeMux, creds adminCreds, st proofReviewStore) {
+	guard := adminAuth(creds)
+
+	mux.Handle("/admin/v1/proofs/pending", guard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		after, limit, ok := parseReviewPage(w, r)
+		if !ok {
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+		list, err := st.ListPendingProofs(ctx, after, limit)
+		if err != nil {
+			log.Printf("[error] admin list pending proofs: %v", err)
+			writeErr(w, http.StatusInternalServerError, "list failed")
+			return
+		}
+		items := make([]jsonMap, len(list))
+		for i := range list {
+			items[i] = pendingProofJSON(&list[i])
+		}
+		resp := jsonMap{"items": items}
+		if len(list) == limit {
+			resp["nextAfter"] = list[len(list)-1].ID
+		}
+		writeJSON(w, http.StatusOK, resp)
+	})))
+
+	decide := func(accept bool) http.Handler {
+		return guard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, reason, ok := decodeReviewDecision(w, r, accept, "proof")
+			if !ok {
+				return
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+			defer cancel()
+			p, err := st.ReviewProof(ctx, id, accept, reason, adminActor(r.Context()))
+			if errors.Is(err, store.ErrProofNotPending) {
+				writeErr(w, http.StatusConflict, "proof is not pending review")
+				return
+			}
+			if err != nil {
+				log.Printf("[error] admin review proof %d: %v", id, err)
+				writeErr(w, http.StatusInternalServerError, "review failed")
+				return
+			}
+			if p == nil {
+				writeErr(w, http.StatusNotFound, "proof not found")
+				return
+			}
+			log.Printf("[admin] %s %s proof %d", adminActor(r.Context()), p.Status, p.ID)
+			writeJSON(w, http.StatusOK, proofJSON(p))
+		}))
+	}
+	mux.Handle("/admin/v1/proofs/{id}/accept", decide(true))
+	mux.Handle("/admin/v1/proofs/{id}/reject", decide(false))
+
+	mux.Handle("/admin/v1/appeals/pending", guard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		after, limit, ok := parseReviewPage(w, r)
+		if !ok {
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+		list, err := st.ListPendingAppeals(ctx, after, limit)
+		if err != nil {
+			log.Printf("[error] admin list pending appeals: %v", err)
+			writeErr(w, http.StatusInternalServerError, "list failed")
+			return
+		}
+		items := make([]jsonMap, len(list))
+		for i := range list {
+			items[i] = pendingAppealJSON(&list[i])
+		}
+		resp := jsonMap{"items": items}
+		if len(list) == limit {
+			resp["nextAfter"] = list[len(list)-1].ID
+		}
+		writeJSON(w, http.StatusOK, resp)
+	})))
+
+	decideAppeal := func(accept bool) http.Handler {
+		return guard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, reason, ok := decodeReviewDecision(w, r, accept, "appeal")
+			if !ok {
+				return
+			}
+			// Re-deciding a closed participation can touch the whole cohort
+			ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+			defer cancel()
+			d, err := st.ReviewAppeal(ctx, id, accept, reason, adminActor(r.Context()))
+			if errors.Is(err, store.ErrAppealNotPending) {
+				writeErr(w, http.StatusConflict, "appeal is not pending review")
+				return
+			}
+			if err != nil {
+				log.Printf("[error] admin review appeal %d: %v", id, err)
+				writeErr(w, http.StatusInternalServerError, "review failed")
+				return
+			}
+			if d == nil {
+				writeErr(w, http.StatusNotFound, "appeal not found")
+				return
+			}
+			log.Printf("[admin] %s %s appeal %d (participation=%s, settlement=%s)",
+				adminActor(r.Context()), d.Appeal.Status, d.Appeal.ID, d.ParticipationStatus, d.Settlement)
+			resp := adminAppealJSON(&d.Appeal)
+			if accept {
+				resp["participationStatus"] = d.ParticipationStatus
+				resp["settlement"] = d.Settlement
+			}
+			writeJSON(w, http.StatusOK, resp)
+		}))
+	}
+	mux.Handle("/admin/v1/appeals/{id}/accept", decideAppeal(true))
+	mux.Handle("/admin/v1/appeals/{id}/reject", decideAppeal(false))
+}
+
+// parseReviewPage reads the after/limit cursor of a review queue listing
+func parseReviewPage(w http.ResponseWriter, r *http.Request) (int64, int, bool) {
+	if r.Method != http.MethodGet {
+		writeErr(w, http.StatusMethodNotAllowed, "method not allowed")
+		return 0, 0, false
+	}
+	q := r.URL.Query()
+	var after int64
+	if v := q.Get("after"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			writeErr(w, http.StatusBadRequest, "invalid after")
+			return 0, 0, false
+		}
+		after = n
+	}
+	limit := defaultReviewPageSize
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxReviewPageSize {
+			writeErr(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxReviewPageSize))
+			return 0, 0, false
+		}
+		limit = n
+	}
+	return after, limit, true
+}
+
+// decodeReviewDecision reads the id and {"reason"} of an accept/reject request.
+// A reason is required to reject.
+func decodeReviewDecision(w http.ResponseWriter, r *http.Request, accept bool, kind string) (int64, string, bool) {
+	if r.Method != http.MethodPost {
+		writeErr(w, http.StatusMethodNotAllowed, "method not allowed")
+		return 0, "", false
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeErr(w, http.StatusBadRequest, "invalid "+kind+" id")
+		return 0, "", false
+	}
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, adminRequestLimit)).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		writeErr(w, http.StatusBadRequest, "invalid json body")
+		return 0, "", false
+	}
+	reason := strings.TrimSpace(body.Reason)
+	if !accept && reason == "" {
+		writeErr(w, http.StatusUnprocessableEntity, "reason is required to reject a "+kind)
+		return 0, "", false
+	}
+	if utf8.RuneCountInString(reason) > maxReviewReasonLen {
+		writeErr(w, http.StatusUnprocessableEntity, "reason must be at most "+strconv.Itoa(maxReviewReasonLen)+" characters")
+		return 0, "", false
+	}
+	return id, reason, true
+}
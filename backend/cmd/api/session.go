@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"habitcashback/internal/clock"
+	"habitcashback/internal/store"
+)
+
+const (
+	sessionTTL      = 24 * time.Hour
+	refreshTTL      = 30 * 24 * time.Hour
+	refreshPrefix   = "rt1."
+	maxDeviceIDLen  = 128
+	refreshTokenLen = 32 // random bytes
+)
+
+// refreshBackend stores hashed refresh tokens.
+// Implemented by *store.Store and by refreshStore (in-memory fallback without a DB).
+type refreshBackend interface {
+	CreateRefreshToken(ctx context.Context, tokenHash, familyID, userSub, deviceID string, expiresAt time.Time) (*store.RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, oldHash, newHash string, expiresAt time.Time) (*store.RefreshToken, error)
+	RevokeRefreshTokens(ctx context.Context, userSub, deviceID, reason string) (int64, error)
+}
+
+// sessions mints session tokens paired with rotating refresh tokens.
+// Only the sha256 of a refresh token is stored; the raw value goes to the client once.
+type sessions struct {
+	keys    *keyring
+	refresh refreshBackend
+	clock   clock.Clock
+}
+
+func newSessions(keys *keyring, refresh refreshBackend, clk clock.Clock) *sessions {
+	return &sessions{keys: keys, refresh: refresh, clock: clock.OrSystem(clk)}
+}
+
+// Issue starts a new refresh family for a fresh login on deviceID.
+func (s *sessions) Issue(ctx context.Context, userID, deviceID string) (jsonMap, error) {
+	raw, hash, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	family, _, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	family = strings.TrimPrefix(family, refreshPrefix)
+	if _, err := s.refresh.CreateRefreshToken(ctx, hash, family, userID, cleanDeviceID(deviceID), s.clock.Now().Add(refreshTTL)); err != nil {
+		return nil, err
+	}
+	return s.response(userID, raw), nil
+}
+
+// Refresh rotates a refresh token and returns a new session.
+// Replaying an already rotated token revokes its whole family (store.ErrRefreshTokenReused).
+func (s *sessions) Refresh(ctx context.Context, refreshToken string) (jsonMap, error) {
+	refreshToken = strings.TrimSpace(refreshToken)
+	if !strings.HasPrefix(refreshToken, refreshPrefix) {
+		return nil, store.ErrRefreshTokenInvalid
+	}
+	raw, hash, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	t, err := s.refresh.RotateRefreshToken(ctx, hashRefreshToken(refreshToken), hash, s.clock.Now().Add(refreshTTL))
+	if err != nil {
+		return nil, err
+	}
+	return s.response(t.UserSub, raw), nil
+}
+
+// Revoke logs out one device, or every device if deviceID is empty.
+func (s *sessions) Revoke(ctx context.Context, userID, deviceID, reason string) (int64, error) {
+	return s.refresh.RevokeRefreshTokens(ctx, userID, cleanDeviceID(deviceID), reason)
+}
+
+func (s *sessions) response(userID, refreshToken string) jsonMap {
+	sess := signSession(s.keys, userID, sessionTTL)
+	return jsonMap{
+		"sessionToken":     sess,
+		"accessToken":      sess, // compatibility alias
+		"expiresIn":        int(sessionTTL.Seconds()),
+		"refreshToken":     refreshToken,
+		"refreshExpiresIn": int(refreshTTL.Seconds()),
+	}
+}
+
+func newRefreshToken() (raw, hash string, err error) {
+	b := make([]byte, refreshTokenLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	raw = refreshPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return raw, hashRefreshToken(raw), nil
+}
+
+func hashRefreshToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+func cleanDeviceID(deviceID string) string {
+	deviceID = strings.TrimSpace(deviceID)
+	if len(deviceID) > maxDeviceIDLen {
+		deviceID = deviceID[:maxDeviceIDLen]
+	}
+	return deviceID
+}
+
+// refreshStore is the in-memory refreshBackend used when no database is configured.
+type refreshStore struct {
+	mu     sync.Mutex
+	nextID int64
+	items  map[string]*refreshEntry // by token hash
+}
+
+type refreshEntry struct {
+	tok     store.RefreshToken
+	used    bool
+	revoked bool
+}
+
+func newRefreshStore() *refreshStore {
+	return &refreshStore{items: map[string]*refreshEntry{}}
+}
+
+func (s *refreshStore) CreateRefreshToken(ctx context.Context, tokenHash, familyID, userSub, deviceID string, expiresAt time.Time) (*store.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.insertLocked(tokenHash, familyID, userSub, deviceID, expiresAt)
+}
+
+func (s *refreshStore) insertLocked(tokenHash, familyID, userSub, deviceID string, expiresAt time.Time) (*store.RefreshToken, error) {
+	if _, ok := s.items[tokenHash]; ok {
+		return nil, errors.New("duplicate refresh token")
+	}
+	now := time.Now()
+	for k, e := range s.items {
+		if now.After(e.tok.ExpiresAt) {
+			delete(s.items, k)
+		}
+	}
+	s.nextID++
+	t := store.RefreshToken{ID: s.nextID, FamilyID: familyID, UserSub: userSub, DeviceID: deviceID, ExpiresAt: expiresAt, CreatedAt: now}
+	s.items[tokenHash] = &refreshEntry{tok: t}
+	return &t, nil
+}
+
+func (s *refreshStore) RotateRefreshToken(ctx context.Context, oldHash, newHash string, expiresAt time.Time) (*store.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.items[oldHash]
+	if !ok || e.revoked || time.Now().After(e.tok.ExpiresAt) {
+		return nil, store.ErrRefreshTokenInvalid
+	}
+	if e.used {
+		for _, other := range s.items {
+			if other.tok.FamilyID == e.tok.FamilyID {
+				other.revoked = true
+			}
+		}
+		return nil, store.ErrRefreshTokenReused
+	}
+	e.used = true
+	return s.insertLocked(newHash, e.tok.FamilyID, e.tok.UserSub, e.tok.DeviceID, expiresAt)
+}
+
+func (s *refreshStore) RevokeRefreshTokens(ctx context.Context, userSub, deviceID, reason string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	for _, e := range s.items {
+		if e.tok.UserSub == userSub && (deviceID == "" || e.tok.DeviceID == deviceID) && !e.revoked {
+			e.revoked = true
+			n++
+		}
+	}
+	return n, nil
+}
+
+// requestDeviceID returns the client's device id from the body, falling back to the X-Device-Id header.
+func requestDeviceID(r *http.Request, fromBody string) string {
+	if d := cleanDeviceID(fromBody); d != "" {
+		return d
+	}
+	return cleanDeviceID(r.Header.Get("X-Device-Id"))
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"habitcashback/internal/clock"
+	"habitcashback/internal/payout"
+	"habitcashback/internal/store"
+	"habitcashback/internal/toss/tossfake"
+)
+
+// lifecycle drives one challenge cohort end to end against a real database, moving a
+// fake clock instead of waiting for days to pass.
+type lifecycle struct {
+	t           *testing.T
+	ctx         context.Context
+	db          *store.Store
+	clk         *clock.Fake
+	challengeID string
+	proofs      int
+}
+
+// newLifecycle creates challenge c under a fresh id with the store clock stopped at start.
+// It skips the test without DATABASE_URL.
+func newLifecycle(t *testing.T, c store.Challenge, start time.Time) *lifecycle {
+	t.Helper()
+	if os.Getenv("DATABASE_URL") == "" {
+		t.Skip("DATABASE_URL not set, skipping lifecycle test")
+	}
+	ctx := context.Background()
+	db, err := store.New(ctx)
+	if err != nil {
+		t.Skipf("database not available: %v", err)
+	}
+	t.Cleanup(db.Close)
+
+	h := &lifecycle{t: t, ctx: ctx, db: db, clk: clock.NewFake(start)}
+	db.SetClock(h.clk)
+
+	c.ID = fmt.Sprintf("lc-%d", time.Now().UnixNano())
+	c.IsActive = true
+	if _, err := db.CreateChallenge(ctx, c, "test"); err != nil {
+		t.Fatalf("create challenge: %v", err)
+	}
+	h.challengeID = c.ID
+	t.Cleanup(func() { db.SetChallengeActive(context.Background(), c.ID, false, "test") })
+	return h
+}
+
+// join pays the challenge deposit for a new user and returns the user id.
+func (h *lifecycle) join(name string, deposit int64) int64 {
+	h.t.Helper()
+	return h.joinAs(name, h.challengeID+"-"+name, deposit)
+}
+
+// joinAs is join for a user logged in under sub (e.g. a "toss:<userKey>" that can be paid out).
+func (h *lifecycle) joinAs(name, sub string, deposit int64) int64 {
+	h.t.Helper()
+	u, err := h.db.GetOrCreateUser(h.ctx, sub)
+	if err != nil {
+		h.t.Fatalf("create user %s: %v", name, err)
+	}
+	p, err := h.db.CreatePayment(h.ctx, u.ID, h.challengeID, "ord-"+h.challengeID+"-"+name, deposit, 0)
+	if err != nil {
+		h.t.Fatalf("create payment for %s: %v", name, err)
+	}
+	if _, err := h.db.ExecutePaymentByID(h.ctx, p.ID); err != nil {
+		h.t.Fatalf("execute payment for %s: %v", name, err)
+	}
+	return u.ID
+}
+
+// prove submits today's proof for each user.
+func (h *lifecycle) prove(userIDs ...int64) {
+	h.t.Helper()
+	for _, id := range userIDs {
+		h.proofs++
+		hash := fmt.Sprintf("%s-%d", h.challengeID, h.proofs)
+		sub := store.ProofSubmission{UserID: id, ChallengeID: h.challengeID, ProofType: "photo", ImageHash: hash}
+		if _, err := h.db.SubmitProof(h.ctx, sub); err != nil {
+			h.t.Fatalf("submit proof for user %d: %v", id, err)
+		}
+	}
+}
+
+func (h *lifecycle) advanceDays(n int) {
+	h.clk.AdvanceDays(n)
+}
+
+// run executes worker jobs in order, as the scheduler would after midnight.
+func (h *lifecycle) run(jobs ...jobFunc) {
+	for _, job := range jobs {
+		job(h.ctx, h.db)
+	}
+}
+
+// settlement returns the user's settlement for the challenge.
+func (h *lifecycle) settlement(userID int64) store.Settlement {
+	h.t.Helper()
+	list, err := h.db.ListSettlementsByUser(h.ctx, userID)
+	if err != nil {
+		h.t.Fatalf("list settlements: %v", err)
+	}
+	for _, s := range list {
+		if s.ChallengeID == h.challengeID {
+			return s
+		}
+	}
+	h.t.Fatalf("no settlement for user %d", userID)
+	return store.Settlement{}
+}
+
+func TestLifecycle_PartialSuccessAndBonusPool(t *testing.T) {
+	t.Setenv("SETTLEMENT_FEE_BPS", "1000")
+	seoul, err := time.LoadLocation("Asia/Seoul")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 23:50 KST: still the first day in Seoul although it is already 14:50 UTC
+	start := time.Date(2030, 3, 1, 23, 50, 0, 0, seoul)
+	h := newLifecycle(t, store.Challenge{
+		Title: "lifecycle", Days: 3, Deposit: 10000, ProofType: "photo",
+		MinSuccessBps: 5000, RefundPolicy: store.RefundProportional,
+	}, start)
+	jobs := []jobFunc{closeParticipations, updateSettlements, newRewardJob()}
+
+	alice := h.join("alice", 10000)
+	bob := h.join("bob", 10000)
+	carol := h.join("carol", 10000)
+
+	h.prove(alice, bob, carol) // day 1
+	h.advanceDays(1)
+	h.prove(alice, bob) // day 2
+	h.advanceDays(1)
+	h.prove(alice) // day 3
+
+	// The last day is not over yet: nothing closes
+	h.run(jobs...)
+	if s := h.settlement(alice); s.Status != "running" {
+		t.Fatalf("expected running on the last day, got %s", s.Status)
+	}
+
+	h.advanceDays(1)
+	h.run(jobs...)
+
+	a, b, c := h.settlement(alice), h.settlement(bob), h.settlement(carol)
+	if a.Status != "success" || a.RefundAmount != 10000 {
+		t.Errorf("alice = %s refund %d, want success 10000", a.Status, a.RefundAmount)
+	}
+	if b.Status != "success" || b.RefundAmount != 6666 {
+		t.Errorf("bob = %s refund %d, want success 6666 (2 of 3 days)", b.Status, b.RefundAmount)
+	}
+	if c.Status != "failed" || c.RefundAmount != 0 {
+		t.Errorf("carol = %s refund %d, want failed 0", c.Status, c.RefundAmount)
+	}
+	// forfeited 10000 + 3334, fee 1333, pool 12001 split 10000:6666
+	if a.RewardAmount != 7201 || b.RewardAmount != 4800 || c.RewardAmount != 0 {
+		t.Errorf("rewards = %d/%d/%d, want 7201/4800/0", a.RewardAmount, b.RewardAmount, c.RewardAmount)
+	}
+}
+
+func TestLifecycle_AcceptedAppealRedecidesSettlement(t *testing.T) {
+	t.Setenv("SETTLEMENT_FEE_BPS", "1000")
+	start := time.Date(2030, 4, 1, 9, 0, 0, 0, time.UTC)
+	h := newLifecycle(t, store.Challenge{Title: "appeal", Days: 2, Deposit: 10000, ProofType: "photo"}, start)
+	jobs := []jobFunc{closeParticipations, updateSettlements, newRewardJob()}
+
+	alice := h.join("alice", 10000)
+	bob := h.join("bob", 10000)
+
+	h.prove(alice, bob) // day 1
+	h.advanceDays(1)
+	missed := h.db.Calendar().Date(h.clk.Now())
+	h.prove(alice) // day 2: bob misses it
+	h.advanceDays(1)
+	h.run(jobs...)
+
+	if b := h.settlement(bob); b.Status != "failed" {
+		t.Fatalf("bob = %s, want failed before the appeal", b.Status)
+	}
+	if a := h.settlement(alice); a.RewardAmount != 9000 {
+		t.Fatalf("alice reward = %d, want 9000 before the appeal", a.RewardAmount)
+	}
+
+	appeal, err := h.db.CreateAppeal(h.ctx, store.AppealSubmission{UserID: bob, ChallengeID: h.challengeID, ProofDate: missed, Note: "앱 오류로 업로드하지 못했습니다"})
+	if err != nil {
+		t.Fatalf("create appeal: %v", err)
+	}
+	if _, err := h.db.CreateAppeal(h.ctx, store.AppealSubmission{UserID: bob, ChallengeID: h.challengeID, ProofDate: missed, Note: "again"}); err != store.ErrAppealExists {
+		t.Errorf("second appeal: got %v, want ErrAppealExists", err)
+	}
+	d, err := h.db.ReviewAppeal(h.ctx, appeal.ID, true, "", "admin:test")
+	if err != nil {
+		t.Fatalf("accept appeal: %v", err)
+	}
+	if d.ParticipationStatus != "success" || d.Settlement != store.SettlementRecompute {
+		t.Errorf("decision = %s/%s, want success/%s", d.ParticipationStatus, d.Settlement, store.SettlementRecompute)
+	}
+	if _, err := h.db.CreatePayout(h.ctx, h.settlement(alice).ID, alice, "TEST", "test-stale", 19000); err == nil {
+		t.Error("expected payout of the reset reward to be refused")
+	}
+
+	h.run(jobs...)
+	a, b := h.settlement(alice), h.settlement(bob)
+	if b.Status != "success" || b.RefundAmount != 10000 {
+		t.Errorf("bob = %s refund %d, want success 10000 after the appeal", b.Status, b.RefundAmount)
+	}
+	if a.RewardAmount != 0 || b.RewardAmount != 0 {
+		t.Errorf("rewards = %d/%d, want 0/0 once nobody forfeits", a.RewardAmount, b.RewardAmount)
+	}
+}
+
+func TestLifecycle_AppealAfterCohortPayoutNeedsManualAdjustment(t *testing.T) {
+	t.Setenv("SETTLEMENT_FEE_BPS", "1000")
+	start := time.Date(2030, 5, 1, 9, 0, 0, 0, time.UTC)
+	h := newLifecycle(t, store.Challenge{Title: "appeal after payout", Days: 2, Deposit: 10000, ProofType: "photo"}, start)
+	jobs := []jobFunc{closeParticipations, updateSettlements, newRewardJob()}
+
+	alice := h.join("alice", 10000)
+	bob := h.join("bob", 10000)
+
+	h.prove(alice, bob) // day 1
+	h.advanceDays(1)
+	missed := h.db.Calendar().Date(h.clk.Now())
+	h.prove(alice) // day 2: bob misses it
+	h.advanceDays(1)
+	h.run(jobs...)
+
+	// Alice is paid her deposit plus bob's forfeited deposit minus the fee
+	a := h.settlement(alice)
+	if _, err := h.db.CreatePayout(h.ctx, a.ID, alice, "TEST", fmt.Sprintf("test-%d", a.ID), a.RefundAmount+a.RewardAmount); err != nil {
+		t.Fatalf("create payout: %v", err)
+	}
+
+	appeal, err := h.db.CreateAppeal(h.ctx, store.AppealSubmission{UserID: bob, ChallengeID: h.challengeID, ProofDate: missed, Note: "앱 오류로 업로드하지 못했습니다"})
+	if err != nil {
+		t.Fatalf("create appeal: %v", err)
+	}
+	d, err := h.db.ReviewAppeal(h.ctx, appeal.ID, true, "", "admin:test")
+	if err != nil {
+		t.Fatalf("accept appeal: %v", err)
+	}
+	if d.Settlement != store.SettlementCohortPaid {
+		t.Errorf("settlement decision = %s, want %s", d.Settlement, store.SettlementCohortPaid)
+	}
+
+	// Bob's deposit was already distributed, so it is not refunded a second time
+	h.run(jobs...)
+	if b := h.settlement(bob); b.Status != "failed" || b.RefundAmount != 0 {
+		t.Errorf("bob = %s refund %d, want failed 0 pending manual adjustment", b.Status, b.RefundAmount)
+	}
+}
+
+func TestLifecycle_RequeuedPayoutUsesNewPromotionKey(t *testing.T) {
+	start := time.Date(2030, 6, 1, 9, 0, 0, 0, time.UTC)
+	h := newLifecycle(t, store.Challenge{Title: "payout requeue", Days: 1, Deposit: 10000, ProofType: "photo"}, start)
+	alice := h.joinAs("alice", fmt.Sprintf("toss:%d", time.Now().UnixNano()%1e12), 10000)
+	h.prove(alice)
+	h.advanceDays(1)
+	h.run(closeParticipations, updateSettlements, newRewardJob())
+	sid := h.settlement(alice).ID
+
+	srv := tossfake.NewServer()
+	runner := &payout.Runner{Store: h.db, Promoter: srv.Client(), PromotionCode: "TEST", MaxAttempts: 1, RetryDelay: time.Nanosecond}
+	candidate := func() *store.PayoutCandidate {
+		list, err := h.db.ListPayoutCandidates(h.ctx, 1000, 1, time.Nanosecond)
+		if err != nil {
+			t.Fatalf("list payout candidates: %v", err)
+		}
+		for i := range list {
+			if list[i].SettlementID == sid {
+				return &list[i]
+			}
+		}
+		return nil
+	}
+
+	srv.FailNextExecute("BUDGET_EXCEEDED", "promotion budget exhausted")
+	if _, err := runner.Run(h.ctx); err != nil {
+		t.Fatalf("first payout run: %v", err)
+	}
+	if c := candidate(); c != nil {
+		t.Fatalf("expected the settlement to wait for a requeue after its only attempt, got %+v", c)
+	}
+
+	if ok, err := h.db.RequeuePayout(h.ctx, sid, "admin:test"); err != nil || !ok {
+		t.Fatalf("requeue payout: %v %v", ok, err)
+	}
+	c := candidate()
+	if c == nil || c.PayoutStatus != "failed" || c.Attempts != 1 {
+		t.Fatalf("expected the requeued settlement with 1 attempt, got %+v", c)
+	}
+	failedID := c.PayoutID
+
+	if _, err := runner.Run(h.ctx); err != nil {
+		t.Fatalf("payout run after requeue: %v", err)
+	}
+	if s := h.settlement(alice); s.SettledAt == nil {
+		t.Fatal("expected the requeued payout to be granted")
+	}
+	if grants := srv.Grants(); len(grants) != 1 {
+		t.Errorf("expected 1 grant, got %d", len(grants))
+	}
+	// The same key returns the payout already created for it
+	p, err := h.db.CreatePayout(h.ctx, sid, alice, "TEST", payout.PromotionKey(sid, 2), 10000)
+	if err != nil {
+		t.Fatalf("look up second payout: %v", err)
+	}
+	if p.ID == failedID || p.Status != "done" {
+		t.Errorf("expected a fresh payout under %s, got id %d (failed %d) status %s", p.PromotionKey, p.ID, failedID, p.Status)
+	}
+}
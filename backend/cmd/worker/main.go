@@ -2,21 +2,67 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
+	"habitcashback/internal/blobstore"
+	"habitcashback/internal/payment"
+	"habitcashback/internal/payout"
+	"habitcashback/internal/reconcile"
+	"habitcashback/internal/settlement"
 	"habitcashback/internal/store"
+	"habitcashback/internal/toss"
+	"habitcashback/internal/toss/tossfake"
+	"habitcashback/internal/unlink"
 )
 
+// jobFunc is a batch job run against the database
+type jobFunc func(context.Context, *store.Store)
+
+// jobOrder is the order in which jobs run with -once
+var jobOrder = []string{
+	"close-participations",
+	"update-settlements",
+	"distribute-rewards",
+	"reconcile-payments",
+	"payout-settlements",
+	"process-unlinks",
+	"purge-proofs",
+	"purge-images",
+	"cleanup-idempotency",
+	"cleanup-sessions",
+	"stats",
+}
+
+// buildJobs returns all jobs by name; jobs that need external clients are built here
+func buildJobs() map[string]jobFunc {
+	return map[string]jobFunc{
+		"close-participations": closeParticipations,
+		"update-settlements":   updateSettlements,
+		"distribute-rewards":   newRewardJob(),
+		"reconcile-payments":   newReconcileJob(),
+		"payout-settlements":   newPayoutJob(),
+		"process-unlinks":      newUnlinkJob(),
+		"purge-proofs":         purgeProofs,
+		"purge-images":         newImageRetentionJob(),
+		"cleanup-idempotency":  cleanupIdempotency,
+		"cleanup-sessions":     cleanupSessions,
+		"stats":                showStats,
+	}
+}
+
 func main() {
 	// Parse command line flags
 	runOnce := flag.Bool("once", false, "Run all jobs once and exit")
-	jobName := flag.String("job", "", "Run specific job: close-participations, update-settlements, cleanup-idempotency, cleanup-sessions, stats")
+	jobName := flag.String("job", "", "Run specific job: "+strings.Join(jobOrder, ", "))
 	flag.Parse()
 
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
@@ -28,6 +74,12 @@ func main() {
 		log.Fatal("[worker] DATABASE_URL is required")
 	}
 
+	// Unlike the API, the worker has no APP_ENV default: jobs that move money must never
+	// fall back to mock services because the variable was forgotten
+	if strings.TrimSpace(os.Getenv("APP_ENV")) == "" {
+		log.Fatal("[worker] APP_ENV is required (local, test, staging, prod)")
+	}
+
 	// Connect to database
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	db, err := store.New(ctx)
@@ -36,17 +88,19 @@ func main() {
 		log.Fatalf("[worker] database connection failed: %v", err)
 	}
 	defer db.Close()
-	log.Println("[worker] database connected")
+	log.Printf("[worker] database connected (challenge days in %s)", db.Calendar().Location())
+
+	jobs := buildJobs()
 
 	// Run specific job if requested
 	if *jobName != "" {
-		runJob(db, *jobName)
+		runJob(db, jobs, *jobName)
 		return
 	}
 
 	// Run all jobs once if requested
 	if *runOnce {
-		runAllJobs(db)
+		runAllJobs(db, jobs)
 		return
 	}
 
@@ -54,6 +108,12 @@ func main() {
 	log.Println("[worker] starting scheduled jobs")
 	log.Println("[worker] - close-participations: every day at 00:05")
 	log.Println("[worker] - update-settlements: every day at 00:10")
+	log.Println("[worker] - distribute-rewards: every day at 00:15")
+	log.Println("[worker] - reconcile-payments: every 10 minutes")
+	log.Println("[worker] - payout-settlements: every hour")
+	log.Println("[worker] - process-unlinks: every 10 minutes")
+	log.Println("[worker] - purge-proofs: every day at 04:00")
+	log.Println("[worker] - purge-images: every day at 04:30")
 	log.Println("[worker] - cleanup-idempotency: every hour")
 	log.Println("[worker] - cleanup-sessions: every day at 03:00")
 
@@ -62,56 +122,51 @@ func main() {
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 
 	// Start job runners
-	go runDailyJob(db, "close-participations", 0, 5, closeParticipations)
-	go runDailyJob(db, "update-settlements", 0, 10, updateSettlements)
-	go runHourlyJob(db, "cleanup-idempotency", cleanupIdempotency)
-	go runDailyJob(db, "cleanup-sessions", 3, 0, cleanupSessions)
+	go runDailyJob(db, "close-participations", 0, 5, jobs["close-participations"])
+	go runDailyJob(db, "update-settlements", 0, 10, jobs["update-settlements"])
+	go runDailyJob(db, "distribute-rewards", 0, 15, jobs["distribute-rewards"])
+	go runIntervalJob(db, "reconcile-payments", 10*time.Minute, jobs["reconcile-payments"])
+	go runHourlyJob(db, "payout-settlements", jobs["payout-settlements"])
+	go runIntervalJob(db, "process-unlinks", 10*time.Minute, jobs["process-unlinks"])
+	go runDailyJob(db, "purge-proofs", 4, 0, jobs["purge-proofs"])
+	go runDailyJob(db, "purge-images", 4, 30, jobs["purge-images"])
+	go runHourlyJob(db, "cleanup-idempotency", jobs["cleanup-idempotency"])
+	go runDailyJob(db, "cleanup-sessions", 3, 0, jobs["cleanup-sessions"])
 
 	// Wait for shutdown signal
 	<-stop
 	log.Println("[worker] shutting down...")
 }
 
-func runJob(db *store.Store, jobName string) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-	defer cancel()
-
-	switch jobName {
-	case "close-participations":
-		closeParticipations(ctx, db)
-	case "update-settlements":
-		updateSettlements(ctx, db)
-	case "cleanup-idempotency":
-		cleanupIdempotency(ctx, db)
-	case "cleanup-sessions":
-		cleanupSessions(ctx, db)
-	case "stats":
-		showStats(ctx, db)
-	default:
+func runJob(db *store.Store, jobs map[string]jobFunc, jobName string) {
+	fn, ok := jobs[jobName]
+	if !ok {
 		log.Fatalf("[worker] unknown job: %s", jobName)
 	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	fn(ctx, db)
 }
 
-func runAllJobs(db *store.Store) {
+func runAllJobs(db *store.Store, jobs map[string]jobFunc) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
 	defer cancel()
 
 	log.Println("[worker] running all jobs once")
-	closeParticipations(ctx, db)
-	updateSettlements(ctx, db)
-	cleanupIdempotency(ctx, db)
-	cleanupSessions(ctx, db)
-	showStats(ctx, db)
+	for _, name := range jobOrder {
+		jobs[name](ctx, db)
+	}
 	log.Println("[worker] all jobs completed")
 }
 
-func runDailyJob(db *store.Store, name string, hour, minute int, fn func(context.Context, *store.Store)) {
+func runDailyJob(db *store.Store, name string, hour, minute int, fn jobFunc) {
+	// hour:minute is in the challenge time zone, so closing runs right after the challenge day ends.
+	// Scheduling always follows the wall clock; jobs read the store's clock.
+	cal := db.Calendar()
 	for {
 		now := time.Now()
-		next := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
-		if next.Before(now) {
-			next = next.Add(24 * time.Hour)
-		}
+		next := cal.NextAt(now, hour, minute)
 		wait := next.Sub(now)
 		log.Printf("[worker] %s: next run at %s (in %s)", name, next.Format("2006-01-02 15:04:05"), wait.Round(time.Second))
 
@@ -123,13 +178,17 @@ func runDailyJob(db *store.Store, name string, hour, minute int, fn func(context
 	}
 }
 
-func runHourlyJob(db *store.Store, name string, fn func(context.Context, *store.Store)) {
+func runHourlyJob(db *store.Store, name string, fn jobFunc) {
+	runIntervalJob(db, name, time.Hour, fn)
+}
+
+func runIntervalJob(db *store.Store, name string, every time.Duration, fn jobFunc) {
 	// Run immediately on startup
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 	fn(ctx, db)
 	cancel()
 
-	ticker := time.NewTicker(1 * time.Hour)
+	ticker := time.NewTicker(every)
 	defer ticker.Stop()
 
 	for range ticker.C {
@@ -164,6 +223,242 @@ func updateSettlements(ctx context.Context, db *store.Store) {
 	log.Printf("[job:update-settlements] completed: processed=%d", result.Processed)
 }
 
+// newRewardJob builds the bonus pool job. SETTLEMENT_FEE_BPS is the platform fee taken
+// from forfeited deposits, in basis points (default 1000 = 10%).
+func newRewardJob() jobFunc {
+	feeBps := settlement.DefaultFeeBps
+	if v := strings.TrimSpace(os.Getenv("SETTLEMENT_FEE_BPS")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > settlement.MaxFeeBps {
+			log.Fatalf("[worker] invalid SETTLEMENT_FEE_BPS: %q", v)
+		}
+		feeBps = n
+	}
+
+	return func(ctx context.Context, db *store.Store) {
+		log.Println("[job:distribute-rewards] starting")
+		e := &settlement.Engine{Store: db, FeeBps: feeBps}
+		result, err := e.Run(ctx)
+		if err != nil {
+			log.Printf("[job:distribute-rewards] error: %v", err)
+			return
+		}
+		log.Printf("[job:distribute-rewards] completed: processed=%d, failed=%d", result.Processed, result.Failed)
+		for _, e := range result.Errors {
+			log.Printf("[job:distribute-rewards] error detail: %s", e)
+		}
+	}
+}
+
+// mockServicesAllowed reports whether APP_ENV explicitly selects local or test, the only
+// environments where jobs may run against the mock payment service. An empty APP_ENV is
+// not mock here, unlike payment.IsMockEnvironment.
+func mockServicesAllowed() bool {
+	env := strings.ToLower(strings.TrimSpace(os.Getenv("APP_ENV")))
+	return env == "local" || env == "test"
+}
+
+// newPaymentService selects the payment service for worker jobs:
+// mock in local/test, TossPay (TOSSPAY_API_KEY + mTLS) elsewhere.
+func newPaymentService() (payment.Service, error) {
+	if mockServicesAllowed() {
+		return payment.NewMockService(), nil
+	}
+	return toss.NewTossPayClientFromEnv()
+}
+
+// newReconcileJob builds the payment reconciliation job.
+// Without TossPay config it logs and does nothing.
+func newReconcileJob() jobFunc {
+	svc, err := newPaymentService()
+	if err != nil {
+		return func(ctx context.Context, db *store.Store) {
+			log.Printf("[job:reconcile-payments] skipped: %v", err)
+		}
+	}
+
+	return func(ctx context.Context, db *store.Store) {
+		log.Println("[job:reconcile-payments] starting")
+		r := &reconcile.Reconciler{Store: db, Payments: svc, Clock: db.Clock()}
+		result, err := r.Run(ctx)
+		if err != nil {
+			log.Printf("[job:reconcile-payments] error: %v", err)
+			return
+		}
+		log.Printf("[job:reconcile-payments] completed: processed=%d, failed=%d", result.Processed, result.Failed)
+		for _, e := range result.Errors {
+			log.Printf("[job:reconcile-payments] error detail: %s", e)
+		}
+	}
+}
+
+// newPayoutPromoter selects the point grant client and promotion code for payouts.
+// Required (staging/prod): AIT_MTLS_CERT_FILE, AIT_MTLS_KEY_FILE, AIT_PROMOTION_CODE
+// Only with APP_ENV=local/test and no mTLS is an in-process fake Toss server used;
+// elsewhere missing config is an error, since the fake would mark real settlements paid
+// without granting anything.
+func newPayoutPromoter() (payout.Promoter, string, error) {
+	promotionCode := strings.TrimSpace(os.Getenv("AIT_PROMOTION_CODE"))
+	client, err := toss.NewFromEnv()
+	if err != nil && mockServicesAllowed() {
+		log.Printf("[warn] payout-settlements: toss mTLS not configured (%v), using fake toss server", err)
+		client, err = tossfake.NewServer().Client(), nil
+		if promotionCode == "" {
+			promotionCode = "LOCAL-PROMOTION"
+		}
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("toss client: %w", err)
+	}
+	if promotionCode == "" {
+		return nil, "", errors.New("AIT_PROMOTION_CODE is required")
+	}
+	return client, promotionCode, nil
+}
+
+// newPayoutJob builds the payout job from env (see newPayoutPromoter).
+// Without payout config the job logs and pays nothing, so the other jobs still run.
+func newPayoutJob() jobFunc {
+	client, promotionCode, err := newPayoutPromoter()
+	if err != nil {
+		return func(ctx context.Context, db *store.Store) {
+			log.Printf("[job:payout-settlements] skipped: %v", err)
+		}
+	}
+
+	return func(ctx context.Context, db *store.Store) {
+		log.Println("[job:payout-settlements] starting")
+		runner := &payout.Runner{Store: db, Promoter: client, PromotionCode: promotionCode}
+		result, err := runner.Run(ctx)
+		if err != nil {
+			log.Printf("[job:payout-settlements] error: %v", err)
+			return
+		}
+		log.Printf("[job:payout-settlements] completed: processed=%d, failed=%d", result.Processed, result.Failed)
+		for _, e := range result.Errors {
+			log.Printf("[job:payout-settlements] error detail: %s", e)
+		}
+	}
+}
+
+// newUnlinkJob builds the job that refunds or forfeits participations of unlinked users
+// and schedules their proofs for purge after PROOF_RETENTION_DAYS (default 30).
+// Refunds go through newPaymentService; without TossPay config outside local/test the job
+// logs and does nothing, leaving unlinks queued.
+func newUnlinkJob() jobFunc {
+	svc, err := newPaymentService()
+	if err != nil {
+		return func(ctx context.Context, db *store.Store) {
+			log.Printf("[job:process-unlinks] skipped: %v", err)
+		}
+	}
+	retention := unlink.DefaultRetention
+	if v := strings.TrimSpace(os.Getenv("PROOF_RETENTION_DAYS")); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 0 {
+			log.Fatalf("[worker] invalid PROOF_RETENTION_DAYS: %q", v)
+		}
+		retention = time.Duration(days) * 24 * time.Hour
+	}
+
+	return func(ctx context.Context, db *store.Store) {
+		log.Println("[job:process-unlinks] starting")
+		p := &unlink.Processor{Store: db, Payments: svc, Retention: retention, Clock: db.Clock()}
+		result, err := p.Run(ctx)
+		if err != nil {
+			log.Printf("[job:process-unlinks] error: %v", err)
+			return
+		}
+		log.Printf("[job:process-unlinks] completed: processed=%d, failed=%d", result.Processed, result.Failed)
+		for _, e := range result.Errors {
+			log.Printf("[job:process-unlinks] error detail: %s", e)
+		}
+	}
+}
+
+func purgeProofs(ctx context.Context, db *store.Store) {
+	log.Println("[job:purge-proofs] starting")
+	result, err := db.PurgeExpiredProofs(ctx)
+	if err != nil {
+		log.Printf("[job:purge-proofs] error: %v", err)
+		return
+	}
+	log.Printf("[job:purge-proofs] completed: anonymized=%d", result.Processed)
+}
+
+// Stored proof photos are deleted once unused for PROOF_IMAGE_RETENTION_DAYS, or as soon
+// as nothing references them after imageOrphanGrace (uploads are recorded just before
+// the proof that uses them).
+const (
+	defaultImageRetentionDays = 90
+	imageOrphanGrace          = 24 * time.Hour
+	imagePurgeBatch           = 200
+)
+
+// newImageRetentionJob builds the purge-images job from env: the blob store (BLOB_BACKEND,
+// see blobstore.NewFromEnv) and PROOF_IMAGE_RETENTION_DAYS. Without image storage it does nothing.
+func newImageRetentionJob() jobFunc {
+	blobs, err := blobstore.NewFromEnv()
+	if err != nil {
+		return func(ctx context.Context, db *store.Store) {
+			log.Printf("[job:purge-images] skipped: %v", err)
+		}
+	}
+	days := defaultImageRetentionDays
+	if v := strings.TrimSpace(os.Getenv("PROOF_IMAGE_RETENTION_DAYS")); v != "" {
+		if days, err = strconv.Atoi(v); err != nil || days < 1 {
+			log.Fatalf("[worker] invalid PROOF_IMAGE_RETENTION_DAYS: %q", v)
+		}
+	}
+	retention := time.Duration(days) * 24 * time.Hour
+
+	return func(ctx context.Context, db *store.Store) {
+		log.Println("[job:purge-images] starting")
+		result, err := purgeImages(ctx, db, blobs, db.Clock().Now(), retention)
+		if err != nil {
+			log.Printf("[job:purge-images] error: %v", err)
+			return
+		}
+		log.Printf("[job:purge-images] completed: deleted=%d, failed=%d", result.Processed, result.Failed)
+		for _, e := range result.Errors {
+			log.Printf("[job:purge-images] error detail: %s", e)
+		}
+	}
+}
+
+// imageStore is the subset of store.Store used by purgeImages
+type imageStore interface {
+	ListExpiredProofImages(ctx context.Context, usedBefore, orphanedBefore time.Time, limit int) ([]store.ProofImage, error)
+	DeleteProofImage(ctx context.Context, img store.ProofImage) error
+}
+
+// purgeImages deletes expired photos from the blob store, then forgets them in the
+// database. It stops after a batch with failures so they are retried on the next run.
+func purgeImages(ctx context.Context, st imageStore, blobs blobstore.Store, now time.Time, retention time.Duration) (*store.BatchResult, error) {
+	result := &store.BatchResult{Errors: []string{}}
+	for {
+		list, err := st.ListExpiredProofImages(ctx, now.Add(-retention), now.Add(-imageOrphanGrace), imagePurgeBatch)
+		if err != nil {
+			return nil, err
+		}
+		for _, img := range list {
+			err := blobs.Delete(ctx, img.Key)
+			if err == nil {
+				err = st.DeleteProofImage(ctx, img)
+			}
+			if err != nil {
+				result.Failed++
+				result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", img.Key, err))
+				continue
+			}
+			result.Processed++
+		}
+		if len(list) < imagePurgeBatch || result.Failed > 0 {
+			return result, nil
+		}
+	}
+}
+
 func cleanupIdempotency(ctx context.Context, db *store.Store) {
 	log.Println("[job:cleanup-idempotency] starting")
 	result, err := db.CleanupExpiredIdempotencyKeys(ctx)
@@ -182,6 +477,13 @@ func cleanupSessions(ctx context.Context, db *store.Store) {
 		return
 	}
 	log.Printf("[job:cleanup-sessions] completed: deleted=%d", result.Processed)
+
+	result, err = db.CleanupExpiredRefreshTokens(ctx)
+	if err != nil {
+		log.Printf("[job:cleanup-sessions] refresh tokens error: %v", err)
+		return
+	}
+	log.Printf("[job:cleanup-sessions] refresh tokens deleted=%d", result.Processed)
 }
 
 func showStats(ctx context.Context, db *store.Store) {
@@ -191,6 +493,6 @@ func showStats(ctx context.Context, db *store.Store) {
 		log.Printf("[job:stats] error: %v", err)
 		return
 	}
-	log.Printf("[job:stats] active_participations=%d, running_settlements=%d, idempotency_keys=%d, revoked_sessions=%d",
-		stats.ActiveParticipations, stats.RunningSettlements, stats.PendingIdempotencyKeys, stats.RevokedSessions)
+	log.Printf("[job:stats] active_participations=%d, running_settlements=%d, idempotency_keys=%d, revoked_sessions=%d, pending_proofs=%d, pending_appeals=%d",
+		stats.ActiveParticipations, stats.RunningSettlements, stats.PendingIdempotencyKeys, stats.RevokedSessions, stats.PendingProofs, stats.PendingAppeals)
 }
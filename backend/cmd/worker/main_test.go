@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"habitcashback/internal/blobstore"
+	"habitcashback/internal/payment"
+	"habitcashback/internal/store"
+)
+
+// fakeImageStore is an in-memory imageStore; images whose LastUsedAt is before usedBefore
+// are expired (reference tracking is covered by the store)
+type fakeImageStore struct {
+	images  map[string]store.ProofImage
+	limits  []int
+	failKey string
+}
+
+func (f *fakeImageStore) ListExpiredProofImages(ctx context.Context, usedBefore, orphanedBefore time.Time, limit int) ([]store.ProofImage, error) {
+	f.limits = append(f.limits, limit)
+	var list []store.ProofImage
+	for _, img := range f.images {
+		if img.LastUsedAt.Before(usedBefore) && len(list) < limit {
+			list = append(list, img)
+		}
+	}
+	return list, nil
+}
+
+func (f *fakeImageStore) DeleteProofImage(ctx context.Context, img store.ProofImage) error {
+	if img.Key == f.failKey {
+		return errors.New("db down")
+	}
+	delete(f.images, img.Key)
+	return nil
+}
+
+func TestPurgeImages(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 6, 1, 4, 30, 0, 0, time.UTC)
+	retention := 90 * 24 * time.Hour
+
+	setup := func(t *testing.T, old, recent int) (*fakeImageStore, blobstore.Store) {
+		blobs, err := blobstore.NewDisk(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		st := &fakeImageStore{images: map[string]store.ProofImage{}}
+		add := func(i int, usedAt time.Time) {
+			data := []byte(fmt.Sprintf("photo %d used %d", i, usedAt.Unix()))
+			key := blobstore.ContentKey("proofs", data, ".jpg")
+			if err := blobs.Put(ctx, key, data, "image/jpeg"); err != nil {
+				t.Fatal(err)
+			}
+			st.images[key] = store.ProofImage{Key: key, URL: "/admin/v1/images/" + key, LastUsedAt: usedAt}
+		}
+		for i := 0; i < old; i++ {
+			add(i, now.Add(-retention-time.Hour))
+		}
+		for i := 0; i < recent; i++ {
+			add(i, now.Add(-time.Hour))
+		}
+		return st, blobs
+	}
+
+	t.Run("Deletes expired images in batches", func(t *testing.T) {
+		st, blobs := setup(t, imagePurgeBatch+5, 3)
+		var keep []string
+		for key := range st.images {
+			keep = append(keep, key)
+		}
+		result, err := purgeImages(ctx, st, blobs, now, retention)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Processed != imagePurgeBatch+5 || result.Failed != 0 || len(st.images) != 3 {
+			t.Errorf("processed=%d failed=%d remaining=%d", result.Processed, result.Failed, len(st.images))
+		}
+		if len(st.limits) != 2 {
+			t.Errorf("expected 2 batches, got %d", len(st.limits))
+		}
+		for _, key := range keep {
+			_, err := blobs.Get(ctx, key)
+			if _, kept := st.images[key]; kept != (err == nil) {
+				t.Errorf("%s: blob present=%v, recorded=%v", key, err == nil, kept)
+			}
+		}
+	})
+
+	t.Run("Stops after failures and keeps the record", func(t *testing.T) {
+		st, blobs := setup(t, imagePurgeBatch, 0)
+		for key := range st.images {
+			st.failKey = key
+			break
+		}
+		result, err := purgeImages(ctx, st, blobs, now, retention)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Failed != 1 || result.Processed != imagePurgeBatch-1 || len(st.limits) != 1 {
+			t.Errorf("processed=%d failed=%d batches=%d", result.Processed, result.Failed, len(st.limits))
+		}
+		if _, ok := st.images[st.failKey]; !ok {
+			t.Error("failed image should stay recorded for the next run")
+		}
+	})
+}
+
+// Reconcile and unlink refunds must never reach the mock outside an explicit local/test
+// APP_ENV: it reports every real pay_token as not found.
+func TestNewPaymentService(t *testing.T) {
+	for env, wantMock := range map[string]bool{"local": true, "TEST": true, "": false, "staging": false, "prod": false} {
+		t.Run("APP_ENV="+env, func(t *testing.T) {
+			t.Setenv("APP_ENV", env)
+			t.Setenv("AIT_MTLS_CERT_FILE", "")
+			t.Setenv("AIT_MTLS_KEY_FILE", "")
+			t.Setenv("TOSSPAY_API_KEY", "")
+			svc, err := newPaymentService()
+			_, isMock := svc.(*payment.MockService)
+			if isMock != wantMock {
+				t.Errorf("mock=%v, want %v", isMock, wantMock)
+			}
+			if !wantMock && err == nil {
+				t.Error("expected an error without TossPay config")
+			}
+		})
+	}
+}
+
+func TestNewPayoutPromoter(t *testing.T) {
+	for env, wantFake := range map[string]bool{"local": true, "test": true, "": false, "staging": false, "prod": false} {
+		t.Run("APP_ENV="+env, func(t *testing.T) {
+			t.Setenv("APP_ENV", env)
+			t.Setenv("AIT_MTLS_CERT_FILE", "")
+			t.Setenv("AIT_MTLS_KEY_FILE", "")
+			t.Setenv("AIT_PROMOTION_CODE", "")
+			client, code, err := newPayoutPromoter()
+			if wantFake && (err != nil || client == nil || code == "") {
+				t.Errorf("expected the fake toss server, got %v %q (%v)", client, code, err)
+			}
+			if !wantFake && (err == nil || client != nil) {
+				t.Errorf("expected an error without AIT config, got %v (%v)", client, err)
+			}
+		})
+	}
+}
+
+// Jobs that need no external service must stay runnable from an ops shell without AIT or
+// TossPay config (e.g. -job stats)
+func TestBuildJobsWithoutExternalConfig(t *testing.T) {
+	t.Setenv("APP_ENV", "prod")
+	t.Setenv("AIT_MTLS_CERT_FILE", "")
+	t.Setenv("AIT_MTLS_KEY_FILE", "")
+	t.Setenv("AIT_PROMOTION_CODE", "")
+	t.Setenv("TOSSPAY_API_KEY", "")
+	jobs := buildJobs()
+	for _, name := range jobOrder {
+		if jobs[name] == nil {
+			t.Errorf("job %s not built", name)
+		}
+	}
+}
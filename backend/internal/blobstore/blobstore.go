@@ -0,0 +1,89 @@
+// Package blobstore stores binary objects such as proof photos under string keys, on
+// local disk or in an S3-compatible bucket (AWS S3, MinIO, Cloudflare R2, NCP Object Storage).
+package blobstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrNotFound is returned by Get when no object is stored under the key
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps objects under keys. Keys are slash-separated paths (see ValidKey).
+type Store interface {
+	// Put stores data under key, replacing any existing object
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get returns the object stored under key, or ErrNotFound
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Delete removes the object under key; deleting a missing key is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// ContentKey returns the content-addressed key for data: prefix/<sha256[:2]>/<sha256><ext>.
+// Identical uploads map to the same key, so storing one twice is harmless.
+func ContentKey(prefix string, data []byte, ext string) string {
+	sum := sha256.Sum256(data)
+	h := hex.EncodeToString(sum[:])
+	return prefix + "/" + h[:2] + "/" + h + ext
+}
+
+// ValidKey reports whether key is safe to use as an object key and file path: non-empty
+// segments of lowercase letters, digits, '.', '_' and '-', none of them "." or "..".
+func ValidKey(key string) bool {
+	if key == "" || len(key) > 512 {
+		return false
+	}
+	for _, seg := range strings.Split(key, "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			return false
+		}
+		for _, c := range seg {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// NewFromEnv builds the store selected by BLOB_BACKEND:
+//   - "disk": files under BLOB_DIR
+//   - "s3": S3_ENDPOINT, S3_REGION (default us-east-1), S3_BUCKET, S3_ACCESS_KEY_ID, S3_SECRET_ACCESS_KEY
+//
+// It returns an error if BLOB_BACKEND is unset, so callers can run without image storage.
+func NewFromEnv() (Store, error) {
+	switch backend := strings.TrimSpace(os.Getenv("BLOB_BACKEND")); backend {
+	case "":
+		return nil, errors.New("BLOB_BACKEND not set")
+	case "disk":
+		d, err := NewDisk(strings.TrimSpace(os.Getenv("BLOB_DIR")))
+		if err != nil {
+			return nil, err
+		}
+		return d, nil
+	case "s3":
+		region := strings.TrimSpace(os.Getenv("S3_REGION"))
+		if region == "" {
+			region = "us-east-1"
+		}
+		s, err := NewS3(S3Config{
+			Endpoint:        strings.TrimSpace(os.Getenv("S3_ENDPOINT")),
+			Region:          region,
+			Bucket:          strings.TrimSpace(os.Getenv("S3_BUCKET")),
+			AccessKeyID:     strings.TrimSpace(os.Getenv("S3_ACCESS_KEY_ID")),
+			SecretAccessKey: strings.TrimSpace(os.Getenv("S3_SECRET_ACCESS_KEY")),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unknown BLOB_BACKEND %q (disk, s3)", backend)
+	}
+}
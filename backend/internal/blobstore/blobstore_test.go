@@ -0,0 +1,112 @@
+package blobstore_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"habitcashback/internal/blobstore"
+	"habitcashback/internal/blobstore/s3fake"
+)
+
+// exercise runs the behaviour every Store must share
+func exercise(t *testing.T, st blobstore.Store) {
+	t.Helper()
+	ctx := context.Background()
+	data := []byte("\xFF\xD8\xFF fake jpeg")
+	key := blobstore.ContentKey("proofs", data, ".jpg")
+
+	if _, err := st.Get(ctx, key); !errors.Is(err, blobstore.ErrNotFound) {
+		t.Fatalf("Get before Put: got %v, want ErrNotFound", err)
+	}
+	// Content-addressed keys make a repeated upload harmless
+	for i := 0; i < 2; i++ {
+		if err := st.Put(ctx, key, data, "image/jpeg"); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+	got, err := st.Get(ctx, key)
+	if err != nil || string(got) != string(data) {
+		t.Fatalf("Get = %q, %v; want %q", got, err, data)
+	}
+	if err := st.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := st.Get(ctx, key); !errors.Is(err, blobstore.ErrNotFound) {
+		t.Errorf("Get after Delete: got %v, want ErrNotFound", err)
+	}
+	if err := st.Delete(ctx, key); err != nil {
+		t.Errorf("Delete of a missing key: %v", err)
+	}
+	if err := st.Put(ctx, "../escape", data, ""); err == nil {
+		t.Error("expected error for an invalid key")
+	}
+}
+
+func TestDisk(t *testing.T) {
+	dir := t.TempDir()
+	st, err := blobstore.NewDisk(filepath.Join(dir, "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exercise(t, st)
+
+	if err := st.Put(context.Background(), "proofs/ab/x.png", []byte("png"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "blobs", "proofs", "ab", "x.png")); err != nil {
+		t.Errorf("expected object file on disk: %v", err)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(dir, "blobs", "proofs", "ab", ".put-*")); len(leftovers) > 0 {
+		t.Errorf("temporary files left behind: %v", leftovers)
+	}
+}
+
+func TestS3(t *testing.T) {
+	srv := s3fake.NewServer()
+	defer srv.Close()
+
+	st, err := blobstore.NewS3(srv.Config("proof-images"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exercise(t, st)
+
+	ctx := context.Background()
+	if err := st.Put(ctx, "proofs/ab/x.png", []byte("png"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	if data, contentType, ok := srv.Object("proof-images", "proofs/ab/x.png"); !ok || string(data) != "png" || contentType != "image/png" {
+		t.Errorf("stored object = %q %q %v", data, contentType, ok)
+	}
+
+	t.Run("Wrong secret", func(t *testing.T) {
+		cfg := srv.Config("proof-images")
+		cfg.SecretAccessKey = "wrong"
+		bad, err := blobstore.NewS3(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := bad.Put(ctx, "proofs/ab/y.png", []byte("png"), "image/png"); err == nil {
+			t.Error("expected signature error")
+		}
+		if srv.Len() != 1 {
+			t.Errorf("expected rejected upload not to be stored, have %d objects", srv.Len())
+		}
+	})
+}
+
+func TestNewS3_RequiresConfig(t *testing.T) {
+	for _, cfg := range []blobstore.S3Config{
+		{Region: "us-east-1", Bucket: "b", AccessKeyID: "k", SecretAccessKey: "s"},
+		{Endpoint: "http://minio:9000", Region: "us-east-1", AccessKeyID: "k", SecretAccessKey: "s"},
+		{Endpoint: "http://minio:9000", Region: "us-east-1", Bucket: "b"},
+		{Endpoint: "minio:9000", Region: "us-east-1", Bucket: "b", AccessKeyID: "k", SecretAccessKey: "s"},
+	} {
+		if _, err := blobstore.NewS3(cfg); err == nil {
+			t.Errorf("expected error for %+v", cfg)
+		}
+	}
+}
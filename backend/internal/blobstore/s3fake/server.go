@@ -0,0 +1,174 @@
+// Package s3fake provides an in-process stand-in for an S3-compatible object store
+// (such as MinIO). It serves path-style PUT, GET and DELETE on objects and checks each
+// request's AWS Signature Version 4, so blobstore.S3 can be tested offline.
+package s3fake
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+
+	"habitcashback/internal/blobstore"
+)
+
+// Credentials accepted by the fake server
+const (
+	AccessKeyID     = "fake-access-key"
+	SecretAccessKey = "fake-secret-key"
+	Region          = "us-east-1"
+)
+
+type object struct {
+	data        []byte
+	contentType string
+}
+
+// Server is a fake S3 endpoint backed by httptest. Buckets are created on first use.
+type Server struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	objects map[string]object // "bucket/key"
+}
+
+// NewServer starts a fake server. Call Close when done.
+func NewServer() *Server {
+	s := &Server{objects: map[string]object{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Config returns a blobstore.S3Config for bucket on the fake server
+func (s *Server) Config(bucket string) blobstore.S3Config {
+	return blobstore.S3Config{
+		Endpoint:        s.URL,
+		Region:          Region,
+		Bucket:          bucket,
+		AccessKeyID:     AccessKeyID,
+		SecretAccessKey: SecretAccessKey,
+		HTTPClient:      s.Server.Client(),
+	}
+}
+
+// Object returns a stored object and its content type
+func (s *Server) Object(bucket, key string) ([]byte, string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.objects[bucket+"/"+key]
+	return o.data, o.contentType, ok
+}
+
+// Len returns the number of stored objects
+func (s *Server) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.objects)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	if i := strings.IndexByte(path, '/'); i <= 0 || i == len(path)-1 {
+		writeError(w, http.StatusBadRequest, "InvalidRequest")
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "IncompleteBody")
+		return
+	}
+	sum := sha256.Sum256(body)
+	if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+		writeError(w, http.StatusBadRequest, "XAmzContentSHA256Mismatch")
+		return
+	}
+	if !validSignature(r) {
+		writeError(w, http.StatusForbidden, "SignatureDoesNotMatch")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		s.objects[path] = object{data: body, contentType: r.Header.Get("Content-Type")}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		o, ok := s.objects[path]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Type", o.contentType)
+		w.Write(o.data)
+	case http.MethodDelete:
+		delete(s.objects, path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	io.WriteString(w, "<Error><Code>"+code+"</Code></Error>")
+}
+
+// validSignature recomputes the SigV4 signature over the headers the client signed
+func validSignature(r *http.Request) bool {
+	auth, ok := strings.CutPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ")
+	if !ok {
+		return false
+	}
+	fields := map[string]string{}
+	for _, f := range strings.Split(auth, ",") {
+		if k, v, ok := strings.Cut(strings.TrimSpace(f), "="); ok {
+			fields[k] = v
+		}
+	}
+	cred := strings.Split(fields["Credential"], "/")
+	if len(cred) != 5 || cred[0] != AccessKeyID || cred[2] != Region || cred[3] != "s3" || cred[4] != "aws4_request" {
+		return false
+	}
+	amzDate := r.Header.Get("X-Amz-Date")
+	if len(amzDate) < 8 || amzDate[:8] != cred[1] {
+		return false
+	}
+
+	signed := strings.Split(fields["SignedHeaders"], ";")
+	if !sort.StringsAreSorted(signed) {
+		return false
+	}
+	var canonicalHeaders strings.Builder
+	for _, name := range signed {
+		v := r.Header.Get(name)
+		if name == "host" {
+			v = r.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(v) + "\n")
+	}
+	canonicalRequest := r.Method + "\n" + r.URL.EscapedPath() + "\n" + r.URL.RawQuery + "\n" +
+		canonicalHeaders.String() + "\n" + fields["SignedHeaders"] + "\n" + r.Header.Get("X-Amz-Content-Sha256")
+	crHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := strings.Join(cred[1:], "/")
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(crHash[:])
+
+	key := []byte("AWS4" + SecretAccessKey)
+	for _, part := range cred[1:] {
+		key = mac(key, part)
+	}
+	want := hex.EncodeToString(mac(key, stringToSign))
+	return hmac.Equal([]byte(want), []byte(fields["Signature"]))
+}
+
+func mac(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
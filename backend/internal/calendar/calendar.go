@@ -0,0 +1,82 @@
+// Package calendar maps instants to challenge days.
+//
+// A challenge day is a civil date in the service time zone (Asia/Seoul by default), not
+// a UTC day: time.Truncate(24*time.Hour) rounds to UTC midnight, which is 09:00 in Seoul.
+// Dates are returned as midnight UTC of that civil date, the same shape pgx uses for DATE
+// columns, so they compare and round-trip without zone surprises.
+package calendar
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	_ "time/tzdata" // the zone must resolve even in images without system tzdata
+)
+
+// DefaultZone is the zone challenge days follow unless CHALLENGE_TIMEZONE is set.
+const DefaultZone = "Asia/Seoul"
+
+// Calendar converts instants to challenge dates in one time zone.
+type Calendar struct {
+	loc *time.Location
+}
+
+// New returns a calendar for the IANA zone name (e.g. "Asia/Seoul").
+func New(zone string) (*Calendar, error) {
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return nil, fmt.Errorf("load time zone %q: %w", zone, err)
+	}
+	return &Calendar{loc: loc}, nil
+}
+
+// FromEnv returns the calendar for CHALLENGE_TIMEZONE, defaulting to DefaultZone.
+func FromEnv() (*Calendar, error) {
+	zone := strings.TrimSpace(os.Getenv("CHALLENGE_TIMEZONE"))
+	if zone == "" {
+		zone = DefaultZone
+	}
+	return New(zone)
+}
+
+// Default returns the Asia/Seoul calendar.
+func Default() *Calendar {
+	c, err := New(DefaultZone)
+	if err != nil {
+		panic(err) // embedded tzdata always has the default zone
+	}
+	return c
+}
+
+// Location returns the calendar's time zone.
+func (c *Calendar) Location() *time.Location {
+	return c.loc
+}
+
+// Date returns the challenge date t falls on.
+func (c *Calendar) Date(t time.Time) time.Time {
+	y, m, d := t.In(c.loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// AddDays returns the date n days after date.
+func (c *Calendar) AddDays(date time.Time, n int) time.Time {
+	return date.AddDate(0, 0, n)
+}
+
+// StartOfDay returns the instant the given challenge date begins in the calendar zone.
+func (c *Calendar) StartOfDay(date time.Time) time.Time {
+	y, m, d := date.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, c.loc)
+}
+
+// NextAt returns the first instant strictly after now at hour:minute local time.
+func (c *Calendar) NextAt(now time.Time, hour, minute int) time.Time {
+	local := now.In(c.loc)
+	next := time.Date(local.Year(), local.Month(), local.Day(), hour, minute, 0, 0, c.loc)
+	if !next.After(now) {
+		next = time.Date(local.Year(), local.Month(), local.Day()+1, hour, minute, 0, 0, c.loc)
+	}
+	return next
+}
@@ -0,0 +1,94 @@
+package calendar
+
+import (
+	"testing"
+	"time"
+)
+
+func mustSeoul(t *testing.T) *Calendar {
+	t.Helper()
+	c, err := New("Asia/Seoul")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestDate_MidnightBoundary(t *testing.T) {
+	c := mustSeoul(t)
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want time.Time
+	}{
+		// 2025-03-01 23:59:59 KST is 14:59:59 UTC on the same date
+		{"Last second of the KST day", time.Date(2025, 3, 1, 14, 59, 59, 0, time.UTC), day(2025, 3, 1)},
+		{"KST midnight", time.Date(2025, 3, 1, 15, 0, 0, 0, time.UTC), day(2025, 3, 2)},
+		// The old UTC truncation flipped the day here (09:00 KST)
+		{"UTC midnight is 09:00 KST", time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC), day(2025, 3, 2)},
+		{"Just before UTC midnight", time.Date(2025, 3, 1, 23, 59, 59, 0, time.UTC), day(2025, 3, 2)},
+		{"Year boundary", time.Date(2025, 12, 31, 15, 0, 0, 0, time.UTC), day(2026, 1, 1)},
+		{"Local input", time.Date(2025, 3, 2, 0, 0, 1, 0, c.Location()), day(2025, 3, 2)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.Date(tt.at); !got.Equal(tt.want) {
+				t.Errorf("Date(%s) = %s, want %s", tt.at, got.Format("2006-01-02"), tt.want.Format("2006-01-02"))
+			}
+		})
+	}
+}
+
+func TestStartOfDay(t *testing.T) {
+	c := mustSeoul(t)
+	start := c.StartOfDay(time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC))
+	if want := time.Date(2025, 3, 1, 15, 0, 0, 0, time.UTC); !start.Equal(want) {
+		t.Errorf("StartOfDay = %s, want %s", start.UTC(), want)
+	}
+	if d := c.Date(start); d.Day() != 2 {
+		t.Errorf("start of day falls on %s", d)
+	}
+	if d := c.Date(start.Add(-time.Nanosecond)); d.Day() != 1 {
+		t.Errorf("instant before start falls on %s", d)
+	}
+}
+
+func TestAddDays(t *testing.T) {
+	c := mustSeoul(t)
+	start := c.Date(time.Date(2025, 2, 27, 16, 0, 0, 0, time.UTC)) // 2025-02-28 KST
+	if end := c.AddDays(start, 2); end.Format("2006-01-02") != "2025-03-02" {
+		t.Errorf("end = %s", end.Format("2006-01-02"))
+	}
+}
+
+func TestNextAt(t *testing.T) {
+	c := mustSeoul(t)
+	// 23:00 KST on 2025-03-01; next 00:05 KST is 2025-03-01 15:05 UTC
+	now := time.Date(2025, 3, 1, 14, 0, 0, 0, time.UTC)
+	if got, want := c.NextAt(now, 0, 5), time.Date(2025, 3, 1, 15, 5, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("NextAt = %s, want %s", got.UTC(), want)
+	}
+	// Exactly at the scheduled time runs tomorrow
+	at := time.Date(2025, 3, 1, 15, 5, 0, 0, time.UTC)
+	if got, want := c.NextAt(at, 0, 5), at.Add(24*time.Hour); !got.Equal(want) {
+		t.Errorf("NextAt = %s, want %s", got.UTC(), want)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("CHALLENGE_TIMEZONE", "")
+	c, err := FromEnv()
+	if err != nil || c.Location().String() != DefaultZone {
+		t.Fatalf("default zone = %v, %v", c, err)
+	}
+	t.Setenv("CHALLENGE_TIMEZONE", "UTC")
+	if c, err := FromEnv(); err != nil || c.Location().String() != "UTC" {
+		t.Errorf("UTC zone = %v, %v", c, err)
+	}
+	t.Setenv("CHALLENGE_TIMEZONE", "Mars/Olympus")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected error for unknown zone")
+	}
+}
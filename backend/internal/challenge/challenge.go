@@ -0,0 +1,204 @@
+// Package challenge holds the rules a challenge definition must satisfy.
+package challenge
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"habitcashback/internal/proof"
+	"habitcashback/internal/store"
+)
+
+// Limits for admin-edited challenges
+const (
+	MinDays        = 1
+	MaxDays        = 30
+	MinDeposit     = 1000
+	MaxDeposit     = 100000
+	DepositUnit    = 1000 // deposits are whole thousands of KRW
+	MaxTitleLen    = 100
+	MaxDescription = 1000
+	MaxTiers       = 5
+	MinMultiplier  = store.MultiplierOne     // 1.00x: success never pays back less than the deposit
+	MaxMultiplier  = 2 * store.MultiplierOne // 2.00x
+	MinSuccessBps  = store.MultiplierOne / 2 // a challenge must ask for at least half the days
+)
+
+// Proof types
+const (
+	ProofPhoto = "photo"
+	ProofSteps = "steps"
+)
+
+var idPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,47}$`)
+
+// ValidProofType reports whether t is a supported proof type
+func ValidProofType(t string) bool {
+	return t == ProofPhoto || t == ProofSteps
+}
+
+// Validate checks a challenge definition and returns every problem found.
+func Validate(c store.Challenge) error {
+	var errs []error
+	if !idPattern.MatchString(c.ID) {
+		errs = append(errs, errors.New("id must be 2-48 lowercase letters, digits or '-'"))
+	}
+	if n := utf8.RuneCountInString(strings.TrimSpace(c.Title)); n == 0 || n > MaxTitleLen {
+		errs = append(errs, fmt.Errorf("title must be 1-%d characters", MaxTitleLen))
+	}
+	if utf8.RuneCountInString(c.Description) > MaxDescription {
+		errs = append(errs, fmt.Errorf("description must be at most %d characters", MaxDescription))
+	}
+	if c.Days < MinDays || c.Days > MaxDays {
+		errs = append(errs, fmt.Errorf("days must be between %d and %d", MinDays, MaxDays))
+	}
+	if c.Deposit < MinDeposit || c.Deposit > MaxDeposit || c.Deposit%DepositUnit != 0 {
+		errs = append(errs, fmt.Errorf("deposit must be a multiple of %d between %d and %d", DepositUnit, MinDeposit, MaxDeposit))
+	}
+	if !ValidProofType(c.ProofType) {
+		errs = append(errs, fmt.Errorf("proof_type must be %q or %q", ProofPhoto, ProofSteps))
+	}
+	if c.StartsAt != nil && c.EndsAt != nil && !c.EndsAt.After(*c.StartsAt) {
+		errs = append(errs, errors.New("endsAt must be after startsAt"))
+	}
+	errs = append(errs, validateTiers(c)...)
+	errs = append(errs, validateSuccessRule(c)...)
+	errs = append(errs, validateProofWindow(c)...)
+	if c.MissingExifPolicy != "" && !proof.ValidMissingEXIFPolicy(c.MissingExifPolicy) {
+		errs = append(errs, fmt.Errorf("missingExifPolicy must be %q, %q or %q", proof.MissingEXIFAccept, proof.MissingEXIFFlag, proof.MissingEXIFReject))
+	}
+	return errors.Join(errs...)
+}
+
+// validateSuccessRule checks the partial success rule; zero values mean all-or-nothing.
+func validateSuccessRule(c store.Challenge) []error {
+	var errs []error
+	if c.MinSuccessBps != 0 && (c.MinSuccessBps < MinSuccessBps || c.MinSuccessBps > store.MultiplierOne) {
+		errs = append(errs, errors.New("minSuccessRatio must be between 0.50 and 1.00"))
+	}
+	if c.RestDays < 0 || (c.Days > 0 && c.RestDays >= c.Days) {
+		errs = append(errs, errors.New("restDays must be between 0 and days-1"))
+	}
+	if c.RefundPolicy != "" && c.RefundPolicy != store.RefundFull && c.RefundPolicy != store.RefundProportional {
+		errs = append(errs, fmt.Errorf("refundPolicy must be %q or %q", store.RefundFull, store.RefundProportional))
+	}
+	return errs
+}
+
+// validateProofWindow checks the time of day proofs are accepted in; 0/0 means any time.
+func validateProofWindow(c store.Challenge) []error {
+	start, end := c.ProofWindowStart, c.ProofWindowEnd
+	if start == 0 && end == 0 {
+		return nil
+	}
+	if start < 0 || end > proof.MinutesPerDay || start >= end {
+		return []error{errors.New("proofWindow must be within 00:00~24:00 with end after start")}
+	}
+	return nil
+}
+
+// MissingEXIFPolicy returns how c treats photos without EXIF (accept if unset)
+func MissingEXIFPolicy(c *store.Challenge) string {
+	if c.MissingExifPolicy == "" {
+		return proof.MissingEXIFAccept
+	}
+	return c.MissingExifPolicy
+}
+
+// ProofWindow returns the time of day proofs for c are accepted in
+func ProofWindow(c *store.Challenge) proof.Window {
+	return proof.Window{Start: c.ProofWindowStart, End: c.ProofWindowEnd}
+}
+
+func validateTiers(c store.Challenge) []error {
+	if len(c.Tiers) == 0 {
+		return nil
+	}
+	var errs []error
+	if len(c.Tiers) > MaxTiers {
+		errs = append(errs, fmt.Errorf("at most %d tiers", MaxTiers))
+	}
+	seen := map[int64]bool{}
+	for i, t := range c.Tiers {
+		if t.Deposit < MinDeposit || t.Deposit > MaxDeposit || t.Deposit%DepositUnit != 0 {
+			errs = append(errs, fmt.Errorf("tiers[%d]: deposit must be a multiple of %d between %d and %d", i, DepositUnit, MinDeposit, MaxDeposit))
+		}
+		if seen[t.Deposit] {
+			errs = append(errs, fmt.Errorf("tiers[%d]: duplicate deposit %d", i, t.Deposit))
+		}
+		seen[t.Deposit] = true
+		if t.RequiredProofs < 0 || t.RequiredProofs > c.Days {
+			errs = append(errs, fmt.Errorf("tiers[%d]: requiredProofs must be between 1 and days (0 for all days)", i))
+		}
+		if t.RewardMultiplierBps < MinMultiplier || t.RewardMultiplierBps > MaxMultiplier {
+			errs = append(errs, fmt.Errorf("tiers[%d]: rewardMultiplier must be between 1.00 and 2.00", i))
+		}
+	}
+	if !seen[c.Deposit] {
+		errs = append(errs, errors.New("deposit (the default stake) must match one of the tiers"))
+	}
+	return errs
+}
+
+// Enrollment errors
+var (
+	ErrNotOpen           = errors.New("challenge is not open for enrollment")
+	ErrDepositNotAllowed = errors.New("deposit amount not allowed for this challenge")
+)
+
+// Tiers returns the stake levels a user may choose for c. A challenge without configured
+// tiers has a single implicit tier (ID 0) at its Deposit that needs every day proven.
+func Tiers(c *store.Challenge) []store.Tier {
+	if len(c.Tiers) > 0 {
+		return c.Tiers
+	}
+	return []store.Tier{{ChallengeID: c.ID, Deposit: c.Deposit, RewardMultiplierBps: store.MultiplierOne}}
+}
+
+// RequiredProofs returns how many proofs tier t needs to succeed in c
+func RequiredProofs(c *store.Challenge, t store.Tier) int {
+	if t.RequiredProofs > 0 {
+		return t.RequiredProofs
+	}
+	return c.Days
+}
+
+// Rule returns the success rule a participation in tier t of c is closed with.
+// Unset fields (challenges not loaded from the database) default to all-or-nothing.
+func Rule(c *store.Challenge, t store.Tier) store.SuccessRule {
+	r := store.SuccessRule{
+		Required:      RequiredProofs(c, t),
+		MinSuccessBps: c.MinSuccessBps,
+		RestDays:      c.RestDays,
+		RefundPolicy:  c.RefundPolicy,
+	}
+	if r.MinSuccessBps == 0 {
+		r.MinSuccessBps = store.MultiplierOne
+	}
+	if r.RefundPolicy == "" {
+		r.RefundPolicy = store.RefundFull
+	}
+	return r
+}
+
+// ResolveTier returns the tier to charge for joining c at now. The amount always comes
+// from the challenge: requested (what the client sent) only selects among its tiers, and
+// 0 means the default deposit.
+func ResolveTier(c *store.Challenge, requested int64, now time.Time) (store.Tier, error) {
+	if !c.OpenAt(now) {
+		return store.Tier{}, ErrNotOpen
+	}
+	if requested == 0 {
+		requested = c.Deposit
+	}
+	for _, t := range Tiers(c) {
+		if t.Deposit == requested {
+			return t, nil
+		}
+	}
+	return store.Tier{}, ErrDepositNotAllowed
+}
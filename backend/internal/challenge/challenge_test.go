@@ -0,0 +1,228 @@
+package challenge
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"habitcashback/internal/proof"
+	"habitcashback/internal/store"
+)
+
+func validChallenge() store.Challenge {
+	return store.Challenge{ID: "walk-7000", Title: "매일 7,000보 걷기", Days: 3, Deposit: 10000, ProofType: ProofSteps}
+}
+
+func TestValidate(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(-time.Hour)
+
+	tests := []struct {
+		name    string
+		mutate  func(c *store.Challenge)
+		wantErr string
+	}{
+		{"Valid", func(c *store.Challenge) {}, ""},
+		{"Bad id", func(c *store.Challenge) { c.ID = "Walk 7000" }, "id must be"},
+		{"Empty title", func(c *store.Challenge) { c.Title = "  " }, "title must be"},
+		{"Long title", func(c *store.Challenge) { c.Title = strings.Repeat("가", MaxTitleLen+1) }, "title must be"},
+		{"Zero days", func(c *store.Challenge) { c.Days = 0 }, "days must be"},
+		{"Too many days", func(c *store.Challenge) { c.Days = MaxDays + 1 }, "days must be"},
+		{"Deposit too small", func(c *store.Challenge) { c.Deposit = 500 }, "deposit must be"},
+		{"Deposit not whole thousands", func(c *store.Challenge) { c.Deposit = 10500 }, "deposit must be"},
+		{"Deposit too large", func(c *store.Challenge) { c.Deposit = MaxDeposit + DepositUnit }, "deposit must be"},
+		{"Unknown proof type", func(c *store.Challenge) { c.ProofType = "video" }, "proof_type must be"},
+		{"Schedule reversed", func(c *store.Challenge) { c.StartsAt, c.EndsAt = &start, &end }, "endsAt must be after"},
+		{"Flag photos without EXIF", func(c *store.Challenge) { c.MissingExifPolicy = proof.MissingEXIFFlag }, ""},
+		{"Unknown EXIF policy", func(c *store.Challenge) { c.MissingExifPolicy = "review" }, "missingExifPolicy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validChallenge()
+			tt.mutate(&c)
+			err := Validate(c)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("expected valid, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidate_ReportsAllProblems(t *testing.T) {
+	err := Validate(store.Challenge{ID: "x", Days: 0, Deposit: 0, ProofType: ""})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, want := range []string{"id must be", "title must be", "days must be", "deposit must be", "proof_type must be"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in %v", want, err)
+		}
+	}
+}
+
+func TestValidate_Tiers(t *testing.T) {
+	tier := func(deposit int64, required, bps int) store.Tier {
+		return store.Tier{Deposit: deposit, RequiredProofs: required, RewardMultiplierBps: bps}
+	}
+	one := store.MultiplierOne
+
+	tests := []struct {
+		name    string
+		tiers   []store.Tier
+		wantErr string
+	}{
+		{"Valid", []store.Tier{tier(5000, 0, one), tier(10000, 3, one), tier(30000, 3, 10500)}, ""},
+		{"Default deposit missing", []store.Tier{tier(5000, 0, one)}, "must match one of the tiers"},
+		{"Duplicate deposit", []store.Tier{tier(10000, 0, one), tier(10000, 2, one)}, "duplicate deposit"},
+		{"Bad tier deposit", []store.Tier{tier(10000, 0, one), tier(1500, 0, one)}, "tiers[1]: deposit"},
+		{"Required proofs beyond days", []store.Tier{tier(10000, 4, one)}, "requiredProofs"},
+		{"Multiplier below 1x", []store.Tier{tier(10000, 0, 9000)}, "rewardMultiplier"},
+		{"Multiplier above 2x", []store.Tier{tier(10000, 0, 30000)}, "rewardMultiplier"},
+		{"Too many tiers", []store.Tier{tier(1000, 0, one), tier(2000, 0, one), tier(3000, 0, one), tier(4000, 0, one), tier(5000, 0, one), tier(10000, 0, one)}, "at most"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validChallenge()
+			c.Tiers = tt.tiers
+			err := Validate(c)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("expected valid, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestResolveTier(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	later := now.Add(time.Hour)
+	tiered := store.Challenge{Days: 3, Deposit: 10000, IsActive: true, Tiers: []store.Tier{
+		{ID: 1, Deposit: 5000, RewardMultiplierBps: store.MultiplierOne},
+		{ID: 2, Deposit: 10000, RewardMultiplierBps: store.MultiplierOne},
+		{ID: 3, Deposit: 30000, RequiredProofs: 2, RewardMultiplierBps: 10500},
+	}}
+
+	tests := []struct {
+		name      string
+		c         store.Challenge
+		requested int64
+		wantID    int64
+		wantAmt   int64
+		wantErr   error
+	}{
+		{"Default deposit", store.Challenge{Deposit: 10000, IsActive: true}, 0, 0, 10000, nil},
+		{"Matching amount", store.Challenge{Deposit: 10000, IsActive: true}, 10000, 0, 10000, nil},
+		{"Client-chosen amount rejected", store.Challenge{Deposit: 10000, IsActive: true}, 100, 0, 0, ErrDepositNotAllowed},
+		{"Inactive", store.Challenge{Deposit: 10000, IsActive: false}, 0, 0, 0, ErrNotOpen},
+		{"Scheduled for later", store.Challenge{Deposit: 10000, IsActive: true, StartsAt: &later}, 0, 0, 0, ErrNotOpen},
+		{"Tier by amount", tiered, 30000, 3, 30000, nil},
+		{"Tiered default", tiered, 0, 2, 10000, nil},
+		{"Amount between tiers", tiered, 20000, 0, 0, ErrDepositNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveTier(&tt.c, tt.requested, now)
+			if err != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if got.ID != tt.wantID || got.Deposit != tt.wantAmt {
+				t.Errorf("expected tier %d (%d), got %d (%d)", tt.wantID, tt.wantAmt, got.ID, got.Deposit)
+			}
+		})
+	}
+}
+
+func TestRequiredProofs(t *testing.T) {
+	c := &store.Challenge{Days: 7}
+	if got := RequiredProofs(c, store.Tier{}); got != 7 {
+		t.Errorf("expected all days, got %d", got)
+	}
+	if got := RequiredProofs(c, store.Tier{RequiredProofs: 5}); got != 5 {
+		t.Errorf("expected tier rule, got %d", got)
+	}
+}
+
+func TestValidate_SuccessRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		edit    func(c *store.Challenge)
+		wantErr string
+	}{
+		{"Proportional with rest day", func(c *store.Challenge) {
+			c.MinSuccessBps, c.RestDays, c.RefundPolicy = 6000, 1, store.RefundProportional
+		}, ""},
+		{"Ratio too low", func(c *store.Challenge) { c.MinSuccessBps = 4000 }, "minSuccessRatio"},
+		{"Ratio above 1", func(c *store.Challenge) { c.MinSuccessBps = 12000 }, "minSuccessRatio"},
+		{"Rest days cover whole challenge", func(c *store.Challenge) { c.RestDays = c.Days }, "restDays"},
+		{"Negative rest days", func(c *store.Challenge) { c.RestDays = -1 }, "restDays"},
+		{"Unknown policy", func(c *store.Challenge) { c.RefundPolicy = "half" }, "refundPolicy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validChallenge()
+			tt.edit(&c)
+			err := Validate(c)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("expected valid, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestRule(t *testing.T) {
+	r := Rule(&store.Challenge{Days: 30}, store.Tier{RequiredProofs: 20})
+	if r.Required != 20 || r.MinSuccessBps != store.MultiplierOne || r.RefundPolicy != store.RefundFull {
+		t.Errorf("defaults = %+v", r)
+	}
+	c := &store.Challenge{Days: 30, MinSuccessBps: 8000, RestDays: 2, RefundPolicy: store.RefundProportional}
+	if r := Rule(c, store.Tier{}); r.Required != 30 || r.MinSuccessBps != 8000 || r.RestDays != 2 || r.RefundPolicy != store.RefundProportional {
+		t.Errorf("rule = %+v", r)
+	}
+}
+
+func TestValidate_ProofWindow(t *testing.T) {
+	tests := []struct {
+		name       string
+		start, end int
+		wantErr    bool
+	}{
+		{"Any time", 0, 0, false},
+		{"Morning", 300, 420, false},
+		{"Until midnight", 1320, proof.MinutesPerDay, false},
+		{"Reversed", 420, 300, true},
+		{"Empty", 300, 300, true},
+		{"Past midnight", 1320, proof.MinutesPerDay + 60, true},
+		{"Negative", -60, 300, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validChallenge()
+			c.ProofWindowStart, c.ProofWindowEnd = tt.start, tt.end
+			err := Validate(c)
+			if tt.wantErr && (err == nil || !strings.Contains(err.Error(), "proofWindow")) {
+				t.Errorf("expected proofWindow error, got %v", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("expected valid, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+// Package clock abstracts the current time so date-driven logic can be tested by
+// moving time forward instead of waiting for it.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+// System is the real wall clock.
+type System struct{}
+
+// Now returns time.Now().
+func (System) Now() time.Time { return time.Now() }
+
+// OrSystem returns c, or the system clock if c is nil.
+func OrSystem(c Clock) Clock {
+	if c == nil {
+		return System{}
+	}
+	return c
+}
+
+// Fake is a manually advanced clock for tests. It is safe for concurrent use.
+type Fake struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFake returns a fake clock stopped at t.
+func NewFake(t time.Time) *Fake {
+	return &Fake{now: t}
+}
+
+// Now returns the fake time.
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Set moves the clock to t (backwards is allowed).
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = t
+}
+
+// Advance moves the clock forward by d and returns the new time.
+func (f *Fake) Advance(d time.Duration) time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+	return f.now
+}
+
+// AdvanceDays moves the clock forward by n calendar days, keeping the wall-clock
+// time in the clock's location, and returns the new time.
+func (f *Fake) AdvanceDays(n int) time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.AddDate(0, 0, n)
+	return f.now
+}
@@ -0,0 +1,39 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFake(t *testing.T) {
+	seoul, err := time.LoadLocation("Asia/Seoul")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2025, 2, 27, 23, 30, 0, 0, seoul)
+	f := NewFake(start)
+
+	if !f.Now().Equal(start) {
+		t.Fatalf("Now = %s", f.Now())
+	}
+	if got := f.Advance(time.Hour); !got.Equal(start.Add(time.Hour)) || !f.Now().Equal(got) {
+		t.Errorf("Advance = %s", got)
+	}
+	if got := f.AdvanceDays(2); got.Format("2006-01-02 15:04") != "2025-03-02 00:30" {
+		t.Errorf("AdvanceDays = %s", got)
+	}
+	f.Set(start)
+	if !f.Now().Equal(start) {
+		t.Errorf("Set = %s", f.Now())
+	}
+}
+
+func TestOrSystem(t *testing.T) {
+	if _, ok := OrSystem(nil).(System); !ok {
+		t.Error("expected system clock for nil")
+	}
+	f := NewFake(time.Unix(0, 0))
+	if OrSystem(f) != Clock(f) {
+		t.Error("expected the given clock")
+	}
+}
@@ -18,10 +18,11 @@ type MockService struct {
 }
 
 type mockPayment struct {
-	OrderNo   string
-	Amount    int64
-	Status    string
-	CreatedAt time.Time
+	OrderNo        string
+	Amount         int64
+	RefundedAmount int64
+	Status         string
+	CreatedAt      time.Time
 }
 
 // NewMockService creates a new mock payment service.
@@ -155,6 +156,52 @@ func (m *MockService) GetStatus(ctx context.Context, payToken string) (*StatusRe
 	}, nil
 }
 
+// CancelPayment simulates a full or partial refund of an executed payment.
+func (m *MockService) CancelPayment(ctx context.Context, payToken string, amount int64, reason string) (*CancelResponse, error) {
+	// Simulate network delay
+	select {
+	case <-time.After(m.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if payToken == "" {
+		return nil, NewPaymentError(ErrCodeInvalidRequest, "payToken is required", nil)
+	}
+	if amount <= 0 {
+		return nil, NewPaymentError(ErrCodeInvalidRequest, "amount must be positive", nil)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	payment, exists := m.payments[payToken]
+	if !exists {
+		return nil, NewPaymentError(ErrCodePaymentNotFound, "payment not found", nil)
+	}
+	if payment.Status != "SUCCESS" && payment.Status != StatusPartiallyRefunded {
+		return nil, NewPaymentError(ErrCodeInvalidRequest, "payment is not refundable in status "+payment.Status, nil)
+	}
+	remaining := payment.Amount - payment.RefundedAmount
+	if amount > remaining {
+		return nil, NewPaymentError(ErrCodeInvalidRequest, "amount exceeds refundable amount", nil)
+	}
+
+	payment.RefundedAmount += amount
+	payment.Status = StatusPartiallyRefunded
+	if payment.RefundedAmount == payment.Amount {
+		payment.Status = StatusRefunded
+	}
+
+	return &CancelResponse{
+		RefundNo:         "mock_rf_" + generateRandomHex(8),
+		RefundedAmount:   amount,
+		RefundableAmount: payment.Amount - payment.RefundedAmount,
+		ApprovalTime:     time.Now(),
+		Status:           payment.Status,
+	}, nil
+}
+
 // generateRandomHex generates a random hex string of specified length.
 func generateRandomHex(length int) string {
 	bytes := make([]byte, length/2)
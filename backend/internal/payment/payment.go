@@ -3,6 +3,7 @@ package payment
 
 import (
 	"context"
+	"strings"
 	"time"
 )
 
@@ -18,6 +19,9 @@ type Service interface {
 	// GetStatus retrieves the current status of a payment.
 	GetStatus(ctx context.Context, payToken string) (*StatusResponse, error)
 
+	// CancelPayment refunds all or part of an executed payment.
+	CancelPayment(ctx context.Context, payToken string, amount int64, reason string) (*CancelResponse, error)
+
 	// Mode returns the service mode ("mock" or "live").
 	Mode() string
 }
@@ -55,6 +59,46 @@ type StatusResponse struct {
 	Amount   int64  // Payment amount
 }
 
+// Outcomes returned by Classify, normalized across providers.
+const (
+	OutcomePending  = "pending"  // checkout not finished yet
+	OutcomeApproved = "approved" // user approved; the merchant still has to execute
+	OutcomePaid     = "paid"     // money captured
+	OutcomeFailed   = "failed"   // cancelled, failed or refunded; will never be paid
+)
+
+// Classify maps a provider status (StatusResponse.Status) to an outcome.
+// Unknown statuses are treated as pending so callers never give up on a payment
+// that may still complete.
+func Classify(status string) string {
+	switch strings.ToUpper(strings.TrimSpace(status)) {
+	case "SUCCESS", "PAY_COMPLETE":
+		return OutcomePaid
+	case "PAY_APPROVED":
+		return OutcomeApproved
+	case "FAILED", "PAY_CANCEL", "CANCELED", "CANCELLED", "EXPIRED",
+		StatusRefunded, StatusPartiallyRefunded, "REFUND_SUCCESS":
+		return OutcomeFailed
+	default:
+		return OutcomePending
+	}
+}
+
+// Refund statuses reported in CancelResponse.Status.
+const (
+	StatusRefunded          = "REFUNDED"
+	StatusPartiallyRefunded = "PARTIALLY_REFUNDED"
+)
+
+// CancelResponse contains the result of a refund.
+type CancelResponse struct {
+	RefundNo         string    // Refund number from payment provider
+	RefundedAmount   int64     // Amount refunded by this call
+	RefundableAmount int64     // Amount still refundable after this call
+	ApprovalTime     time.Time // Time of refund approval
+	Status           string    // StatusRefunded or StatusPartiallyRefunded
+}
+
 // Error codes for payment operations.
 const (
 	ErrCodeInvalidRequest  = "INVALID_REQUEST"
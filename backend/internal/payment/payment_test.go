@@ -42,6 +42,30 @@ func TestPaymentError(t *testing.T) {
 	})
 }
 
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		status string
+		want   string
+	}{
+		{"SUCCESS", OutcomePaid},
+		{"PAY_COMPLETE", OutcomePaid},
+		{"PAY_APPROVED", OutcomeApproved},
+		{"CREATED", OutcomePending},
+		{"PAY_STANDBY", OutcomePending},
+		{"PAY_CANCEL", OutcomeFailed},
+		{StatusRefunded, OutcomeFailed},
+		{" pay_complete ", OutcomePaid},
+		{"SOMETHING_NEW", OutcomePending},
+		{"", OutcomePending},
+	}
+
+	for _, tt := range tests {
+		if got := Classify(tt.status); got != tt.want {
+			t.Errorf("Classify(%q) = %s, want %s", tt.status, got, tt.want)
+		}
+	}
+}
+
 func TestMockService_Mode(t *testing.T) {
 	svc := NewMockService()
 	if svc.Mode() != "mock" {
@@ -267,6 +291,100 @@ func TestMockService_ExecutePayment(t *testing.T) {
 	})
 }
 
+func TestMockService_CancelPayment(t *testing.T) {
+	svc := NewMockServiceWithDelay(0)
+	ctx := context.Background()
+
+	executed := func(t *testing.T, orderNo string, amount int64) string {
+		t.Helper()
+		createResp, err := svc.CreatePayment(ctx, CreateRequest{OrderNo: orderNo, Amount: amount})
+		if err != nil {
+			t.Fatalf("failed to create payment: %v", err)
+		}
+		if _, err := svc.ExecutePayment(ctx, createResp.PayToken); err != nil {
+			t.Fatalf("failed to execute payment: %v", err)
+		}
+		return createResp.PayToken
+	}
+
+	t.Run("Full Refund", func(t *testing.T) {
+		payToken := executed(t, "ORDER-CANCEL-001", 10000)
+
+		resp, err := svc.CancelPayment(ctx, payToken, 10000, "user request")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resp.Status != StatusRefunded {
+			t.Errorf("expected status %s, got %s", StatusRefunded, resp.Status)
+		}
+		if resp.RefundedAmount != 10000 || resp.RefundableAmount != 0 {
+			t.Errorf("unexpected amounts: refunded=%d refundable=%d", resp.RefundedAmount, resp.RefundableAmount)
+		}
+		if resp.RefundNo == "" {
+			t.Error("expected non-empty refundNo")
+		}
+
+		status, _ := svc.GetStatus(ctx, payToken)
+		if status.Status != StatusRefunded {
+			t.Errorf("expected payment status %s, got %s", StatusRefunded, status.Status)
+		}
+	})
+
+	t.Run("Partial Refunds", func(t *testing.T) {
+		payToken := executed(t, "ORDER-CANCEL-002", 10000)
+
+		resp, err := svc.CancelPayment(ctx, payToken, 3000, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resp.Status != StatusPartiallyRefunded || resp.RefundableAmount != 7000 {
+			t.Errorf("unexpected response: %+v", resp)
+		}
+
+		resp, err = svc.CancelPayment(ctx, payToken, 7000, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resp.Status != StatusRefunded {
+			t.Errorf("expected status %s, got %s", StatusRefunded, resp.Status)
+		}
+	})
+
+	t.Run("Amount Exceeds Refundable", func(t *testing.T) {
+		payToken := executed(t, "ORDER-CANCEL-003", 10000)
+
+		_, err := svc.CancelPayment(ctx, payToken, 10001, "")
+		var payErr *PaymentError
+		if !errors.As(err, &payErr) || payErr.Code != ErrCodeInvalidRequest {
+			t.Fatalf("expected %s PaymentError, got %v", ErrCodeInvalidRequest, err)
+		}
+	})
+
+	t.Run("Not Executed", func(t *testing.T) {
+		createResp, _ := svc.CreatePayment(ctx, CreateRequest{OrderNo: "ORDER-CANCEL-004", Amount: 10000})
+
+		_, err := svc.CancelPayment(ctx, createResp.PayToken, 10000, "")
+		if err == nil {
+			t.Fatal("expected error for payment that was never executed")
+		}
+	})
+
+	t.Run("Invalid Input", func(t *testing.T) {
+		if _, err := svc.CancelPayment(ctx, "", 100, ""); err == nil {
+			t.Error("expected error for empty payToken")
+		}
+		if _, err := svc.CancelPayment(ctx, "mock_pt_whatever", 0, ""); err == nil {
+			t.Error("expected error for zero amount")
+		}
+
+		_, err := svc.CancelPayment(ctx, "mock_pt_nonexistent12345678", 100, "")
+		var payErr *PaymentError
+		if !errors.As(err, &payErr) || payErr.Code != ErrCodePaymentNotFound {
+			t.Errorf("expected %s PaymentError, got %v", ErrCodePaymentNotFound, err)
+		}
+	})
+}
+
 func TestMockService_GetStatus(t *testing.T) {
 	svc := NewMockServiceWithDelay(0)
 
@@ -0,0 +1,211 @@
+// Package payout turns successful settlements into Toss point promotions.
+package payout
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"habitcashback/internal/store"
+	"habitcashback/internal/toss"
+)
+
+// Defaults for Runner.
+const (
+	DefaultBatchSize   = 100           // settlements processed per run
+	DefaultMaxAttempts = 5             // payouts created per settlement before an admin must requeue it
+	DefaultRetryDelay  = 6 * time.Hour // wait after a failed payout before trying again
+)
+
+// Error codes recorded in payout.error_code.
+// Errors reported by Toss are stored with Toss's own errorCode.
+const (
+	ErrCodeInvalidUserKey = "INVALID_USER_KEY"
+	ErrCodeExecuteFailed  = "EXECUTE_FAILED" // Toss reported the grant as FAILED
+)
+
+// Store is the subset of store.Store used by the payout job.
+type Store interface {
+	ListPayoutCandidates(ctx context.Context, limit, maxAttempts int, retryDelay time.Duration) ([]store.PayoutCandidate, error)
+	CreatePayout(ctx context.Context, settlementID, userID int64, promotionCode, promotionKey string, amountPoints int64) (*store.Payout, error)
+	SetPayoutTossKey(ctx context.Context, payoutID int64, tossKey string) error
+	MarkPayoutDone(ctx context.Context, payoutID int64, rawJSON []byte) error
+	MarkPayoutFailed(ctx context.Context, payoutID int64, errorCode, errorMessage string) error
+}
+
+// Promoter grants Toss points. Implemented by toss.Client.
+type Promoter interface {
+	RequestPromotionKey(ctx context.Context, userKey int64) (*toss.PromotionKeySuccess, error)
+	ExecutePromotion(ctx context.Context, userKey int64, promotionCode, key string, amount int64) (*toss.ExecutePromotionSuccess, error)
+	GetPromotionExecutionResult(ctx context.Context, userKey int64, promotionCode, key string) (string, error)
+}
+
+// Runner pays out refundable settlements.
+type Runner struct {
+	Store         Store
+	Promoter      Promoter
+	PromotionCode string
+	BatchSize     int
+	MaxAttempts   int           // 0: DefaultMaxAttempts
+	RetryDelay    time.Duration // 0: DefaultRetryDelay
+}
+
+// PromotionKey returns the deterministic promotion key for a settlement's attempt-th
+// payout (from 1). Reusing the same key while a payout is 'requested' lets Toss reject
+// a double grant; a failed payout is retried under the next attempt's key.
+func PromotionKey(settlementID int64, attempt int) string {
+	if attempt <= 1 {
+		return fmt.Sprintf("hc-settlement-%d", settlementID)
+	}
+	return fmt.Sprintf("hc-settlement-%d-%d", settlementID, attempt)
+}
+
+// Transient reports whether a Toss error may succeed on retry (rate limiting or a server
+// error); the payout then stays 'requested' instead of failing.
+func Transient(apiErr *toss.APIError) bool {
+	return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500
+}
+
+// ParseTossUserKey extracts the numeric Toss userKey from a "toss:<userKey>" subject.
+func ParseTossUserKey(sub string) (int64, error) {
+	raw, ok := strings.CutPrefix(strings.TrimSpace(sub), "toss:")
+	if !ok {
+		return 0, fmt.Errorf("not a toss user: %q", sub)
+	}
+	uk, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || uk <= 0 {
+		return 0, fmt.Errorf("invalid toss userKey: %q", sub)
+	}
+	return uk, nil
+}
+
+// Run processes one batch of payout candidates.
+// Per-settlement failures are recorded in the result; only store listing errors abort the run.
+func (r *Runner) Run(ctx context.Context) (*store.BatchResult, error) {
+	if r.Promoter == nil {
+		return nil, errors.New("promotion client not configured")
+	}
+	if strings.TrimSpace(r.PromotionCode) == "" {
+		return nil, errors.New("promotion code not configured")
+	}
+	limit := r.BatchSize
+	if limit <= 0 {
+		limit = DefaultBatchSize
+	}
+	maxAttempts := r.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	retryDelay := r.RetryDelay
+	if retryDelay <= 0 {
+		retryDelay = DefaultRetryDelay
+	}
+
+	candidates, err := r.Store.ListPayoutCandidates(ctx, limit, maxAttempts, retryDelay)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &store.BatchResult{Errors: []string{}}
+	for _, c := range candidates {
+		if err := r.payOne(ctx, c); err != nil {
+			result.Failed++
+			result.Errors = append(result.Errors, fmt.Sprintf("settlement %d: %v", c.SettlementID, err))
+			continue
+		}
+		result.Processed++
+	}
+	return result, nil
+}
+
+// payOne pays a single settlement.
+// Toss errors (*toss.APIError) other than transient ones mark the payout failed; a later
+// run retries it as a new payout until MaxAttempts. Anything else (network, timeouts,
+// 429/5xx) leaves the payout 'requested' so the next run retries it; the stored Toss key
+// plus a result lookup make that retry safe against double grants.
+func (r *Runner) payOne(ctx context.Context, c store.PayoutCandidate) error {
+	amount := c.RefundAmount + c.RewardAmount
+	if amount <= 0 {
+		return fmt.Errorf("nothing to pay (amount=%d)", amount)
+	}
+
+	attempt := c.Attempts
+	if c.PayoutID == 0 || c.PayoutStatus == "failed" {
+		attempt++
+	}
+	p, err := r.Store.CreatePayout(ctx, c.SettlementID, c.UserID, r.PromotionCode, PromotionKey(c.SettlementID, attempt), amount)
+	if err != nil {
+		return err
+	}
+	if p.Status == "done" {
+		// Granted in an earlier run that crashed before settling; just mark it settled.
+		return r.Store.MarkPayoutDone(ctx, p.ID, nil)
+	}
+
+	userKey, err := ParseTossUserKey(c.TossUserKey)
+	if err != nil {
+		return r.fail(ctx, p.ID, ErrCodeInvalidUserKey, err)
+	}
+
+	if p.TossKey != "" {
+		// An earlier run got a key; ask Toss whether that grant already went through.
+		res, err := r.Promoter.GetPromotionExecutionResult(ctx, userKey, p.PromotionCode, p.TossKey)
+		var apiErr *toss.APIError
+		switch {
+		case err == nil && res == toss.PromotionResultSuccess:
+			return r.Store.MarkPayoutDone(ctx, p.ID, resultJSON(p.TossKey, res))
+		case err == nil && res == toss.PromotionResultPending:
+			return fmt.Errorf("grant pending at toss (key=%s)", p.TossKey)
+		case err == nil:
+			return r.fail(ctx, p.ID, ErrCodeExecuteFailed, fmt.Errorf("toss reported %s for key %s", res, p.TossKey))
+		case errors.As(err, &apiErr) && !Transient(apiErr):
+			// Key was never executed; fall through and execute it.
+		default:
+			return err
+		}
+	} else {
+		key, err := r.Promoter.RequestPromotionKey(ctx, userKey)
+		if err != nil {
+			return r.failOnAPIError(ctx, p.ID, err)
+		}
+		if err := r.Store.SetPayoutTossKey(ctx, p.ID, key.Key); err != nil {
+			return err
+		}
+		p.TossKey = key.Key
+	}
+
+	res, err := r.Promoter.ExecutePromotion(ctx, userKey, p.PromotionCode, p.TossKey, p.AmountPoints)
+	if err != nil {
+		return r.failOnAPIError(ctx, p.ID, err)
+	}
+
+	raw, _ := json.Marshal(res)
+	return r.Store.MarkPayoutDone(ctx, p.ID, raw)
+}
+
+// failOnAPIError marks the payout failed if Toss rejected the call; other errors,
+// including transient Toss errors, are returned as-is.
+func (r *Runner) failOnAPIError(ctx context.Context, payoutID int64, err error) error {
+	var apiErr *toss.APIError
+	if !errors.As(err, &apiErr) || Transient(apiErr) {
+		return err
+	}
+	return r.fail(ctx, payoutID, apiErr.ErrorCode, err)
+}
+
+func (r *Runner) fail(ctx context.Context, payoutID int64, code string, cause error) error {
+	if err := r.Store.MarkPayoutFailed(ctx, payoutID, code, cause.Error()); err != nil {
+		return err
+	}
+	return cause
+}
+
+func resultJSON(key, result string) []byte {
+	raw, _ := json.Marshal(map[string]string{"key": key, "result": result})
+	return raw
+}
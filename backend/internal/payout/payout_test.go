@@ -0,0 +1,356 @@
+package payout
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"habitcashback/internal/store"
+	"habitcashback/internal/toss"
+	"habitcashback/internal/toss/tossfake"
+)
+
+// fakeStore is an in-memory Store keyed by promotion key
+type fakeStore struct {
+	candidates []store.PayoutCandidate
+	payouts    map[string]*store.Payout
+	settled    map[int64]bool
+	nextID     int64
+}
+
+func newFakeStore(candidates ...store.PayoutCandidate) *fakeStore {
+	return &fakeStore{
+		candidates: candidates,
+		payouts:    map[string]*store.Payout{},
+		settled:    map[int64]bool{},
+	}
+}
+
+func (f *fakeStore) ListPayoutCandidates(ctx context.Context, limit, maxAttempts int, retryDelay time.Duration) ([]store.PayoutCandidate, error) {
+	if len(f.candidates) > limit {
+		return f.candidates[:limit], nil
+	}
+	return f.candidates, nil
+}
+
+func (f *fakeStore) CreatePayout(ctx context.Context, settlementID, userID int64, promotionCode, promotionKey string, amountPoints int64) (*store.Payout, error) {
+	if p, ok := f.payouts[promotionKey]; ok {
+		return p, nil
+	}
+	f.nextID++
+	p := &store.Payout{ID: f.nextID, UserID: userID, PromotionCode: promotionCode, PromotionKey: promotionKey, AmountPoints: amountPoints, Status: "requested"}
+	f.payouts[promotionKey] = p
+	return p, nil
+}
+
+func (f *fakeStore) byID(id int64) *store.Payout {
+	for _, p := range f.payouts {
+		if p.ID == id {
+			return p
+		}
+	}
+	return nil
+}
+
+func (f *fakeStore) SetPayoutTossKey(ctx context.Context, payoutID int64, tossKey string) error {
+	f.byID(payoutID).TossKey = tossKey
+	return nil
+}
+
+func (f *fakeStore) MarkPayoutDone(ctx context.Context, payoutID int64, rawJSON []byte) error {
+	p := f.byID(payoutID)
+	p.Status = "done"
+	f.settled[payoutID] = true
+	return nil
+}
+
+func (f *fakeStore) MarkPayoutFailed(ctx context.Context, payoutID int64, errorCode, errorMessage string) error {
+	p := f.byID(payoutID)
+	p.Status = "failed"
+	p.ErrorCode = errorCode
+	p.ErrorMessage = errorMessage
+	return nil
+}
+
+func TestPromotionKey(t *testing.T) {
+	if PromotionKey(42, 1) != PromotionKey(42, 1) {
+		t.Error("expected promotion key to be deterministic")
+	}
+	if PromotionKey(42, 1) == PromotionKey(43, 1) {
+		t.Error("expected different settlements to get different keys")
+	}
+	if PromotionKey(42, 1) != "hc-settlement-42" || PromotionKey(42, 2) == PromotionKey(42, 1) {
+		t.Errorf("expected a new key per retry, got %s and %s", PromotionKey(42, 1), PromotionKey(42, 2))
+	}
+}
+
+func TestParseTossUserKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		sub     string
+		want    int64
+		wantErr bool
+	}{
+		{"Valid", "toss:12345", 12345, false},
+		{"With spaces", " toss:7 ", 7, false},
+		{"Stub user", "stub-user", 0, true},
+		{"Hashed fallback", "toss:a1b2c3", 0, true},
+		{"Zero", "toss:0", 0, true},
+		{"Empty", "", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTossUserKey(tt.sub)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTossUserKey(%q) error = %v, wantErr %v", tt.sub, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseTossUserKey(%q) = %d, want %d", tt.sub, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunner_Run(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Pays deposit plus reward", func(t *testing.T) {
+		srv := tossfake.NewServer()
+		defer srv.Close()
+		fs := newFakeStore(store.PayoutCandidate{SettlementID: 1, UserID: 10, TossUserKey: "toss:100", DepositAmount: 10000, RefundAmount: 10000, RewardAmount: 500})
+		r := &Runner{Store: fs, Promoter: srv.Client(), PromotionCode: "PROMO"}
+
+		result, err := r.Run(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Processed != 1 || result.Failed != 0 {
+			t.Errorf("expected processed=1 failed=0, got processed=%d failed=%d (%v)", result.Processed, result.Failed, result.Errors)
+		}
+		p := fs.payouts[PromotionKey(1, 1)]
+		if p == nil || p.Status != "done" {
+			t.Fatalf("expected done payout, got %+v", p)
+		}
+		if p.TossKey == "" {
+			t.Error("expected toss key to be stored")
+		}
+		if !fs.settled[p.ID] {
+			t.Error("expected settlement to be marked settled")
+		}
+
+		grants := srv.Grants()
+		if len(grants) != 1 {
+			t.Fatalf("expected 1 grant, got %d", len(grants))
+		}
+		if grants[0].UserKey != 100 || grants[0].Amount != 10500 || grants[0].PromotionCode != "PROMO" {
+			t.Errorf("unexpected grant: %+v", grants[0])
+		}
+	})
+
+	t.Run("Invalid user key fails without calling Toss", func(t *testing.T) {
+		srv := tossfake.NewServer()
+		defer srv.Close()
+		fs := newFakeStore(store.PayoutCandidate{SettlementID: 2, UserID: 20, TossUserKey: "stub-user", DepositAmount: 10000, RefundAmount: 10000})
+		r := &Runner{Store: fs, Promoter: srv.Client(), PromotionCode: "PROMO"}
+
+		result, err := r.Run(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Failed != 1 {
+			t.Errorf("expected failed=1, got %d", result.Failed)
+		}
+		if len(srv.Grants()) != 0 {
+			t.Errorf("expected no grants, got %d", len(srv.Grants()))
+		}
+		if got := fs.payouts[PromotionKey(2, 1)].ErrorCode; got != ErrCodeInvalidUserKey {
+			t.Errorf("expected error code %s, got %s", ErrCodeInvalidUserKey, got)
+		}
+	})
+
+	t.Run("Toss error marks payout failed with Toss error code", func(t *testing.T) {
+		srv := tossfake.NewServer()
+		defer srv.Close()
+		srv.FailNextExecute("PROMOTION_BUDGET_EXCEEDED", "budget exhausted")
+		fs := newFakeStore(store.PayoutCandidate{SettlementID: 3, UserID: 30, TossUserKey: "toss:300", DepositAmount: 10000, RefundAmount: 10000})
+		r := &Runner{Store: fs, Promoter: srv.Client(), PromotionCode: "PROMO"}
+
+		result, err := r.Run(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Failed != 1 {
+			t.Errorf("expected failed=1, got %d", result.Failed)
+		}
+		p := fs.payouts[PromotionKey(3, 1)]
+		if p.Status != "failed" || p.ErrorCode != "PROMOTION_BUDGET_EXCEEDED" {
+			t.Errorf("expected failed payout with toss error code, got %+v", p)
+		}
+		if fs.settled[p.ID] {
+			t.Error("expected settlement to stay unsettled")
+		}
+	})
+
+	t.Run("Transient Toss error leaves payout requested", func(t *testing.T) {
+		srv := tossfake.NewServer()
+		defer srv.Close()
+		srv.FailNextExecuteStatus(http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "try again later")
+		fs := newFakeStore(store.PayoutCandidate{SettlementID: 8, UserID: 80, TossUserKey: "toss:800", DepositAmount: 10000, RefundAmount: 10000})
+		r := &Runner{Store: fs, Promoter: srv.Client(), PromotionCode: "PROMO"}
+
+		result, err := r.Run(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Failed != 1 {
+			t.Errorf("expected failed=1, got %d", result.Failed)
+		}
+		p := fs.payouts[PromotionKey(8, 1)]
+		if p.Status != "requested" || p.TossKey == "" {
+			t.Fatalf("expected requested payout with its toss key kept, got %+v", p)
+		}
+
+		// The next run finds the key unexecuted and executes it
+		fs.candidates[0].PayoutID, fs.candidates[0].PayoutStatus, fs.candidates[0].Attempts = p.ID, p.Status, 1
+		if result, _ := r.Run(ctx); result.Processed != 1 || !fs.settled[p.ID] {
+			t.Errorf("expected retry to settle, got processed=%d (%v)", result.Processed, result.Errors)
+		}
+		if len(srv.Grants()) != 1 {
+			t.Errorf("expected exactly 1 grant, got %d", len(srv.Grants()))
+		}
+	})
+
+	t.Run("Failed payout is retried under a new key", func(t *testing.T) {
+		srv := tossfake.NewServer()
+		defer srv.Close()
+		fs := newFakeStore(store.PayoutCandidate{SettlementID: 9, UserID: 90, TossUserKey: "toss:900", DepositAmount: 10000, RefundAmount: 10000,
+			PayoutID: 11, PayoutStatus: "failed", Attempts: 1})
+		fs.payouts[PromotionKey(9, 1)] = &store.Payout{ID: 11, PromotionKey: PromotionKey(9, 1), Status: "failed", ErrorCode: "PROMOTION_BUDGET_EXCEEDED"}
+		fs.nextID = 11
+		r := &Runner{Store: fs, Promoter: srv.Client(), PromotionCode: "PROMO"}
+
+		result, err := r.Run(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Processed != 1 {
+			t.Errorf("expected processed=1, got %d (%v)", result.Processed, result.Errors)
+		}
+		p := fs.payouts[PromotionKey(9, 2)]
+		if p == nil || p.Status != "done" || !fs.settled[p.ID] {
+			t.Fatalf("expected second payout to be done, got %+v", p)
+		}
+		if fs.payouts[PromotionKey(9, 1)].Status != "failed" {
+			t.Error("expected the failed payout to stay on record")
+		}
+	})
+
+	t.Run("Network error leaves payout requested", func(t *testing.T) {
+		srv := tossfake.NewServer()
+		client := srv.Client()
+		srv.Close() // every call now fails at the transport level
+		fs := newFakeStore(store.PayoutCandidate{SettlementID: 4, UserID: 40, TossUserKey: "toss:400", DepositAmount: 10000, RefundAmount: 10000})
+		r := &Runner{Store: fs, Promoter: client, PromotionCode: "PROMO"}
+
+		result, err := r.Run(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Failed != 1 {
+			t.Errorf("expected failed=1, got %d", result.Failed)
+		}
+		if got := fs.payouts[PromotionKey(4, 1)].Status; got != "requested" {
+			t.Errorf("expected payout to stay requested for retry, got %s", got)
+		}
+	})
+
+	t.Run("Retry after executed grant does not double pay", func(t *testing.T) {
+		srv := tossfake.NewServer()
+		defer srv.Close()
+		client := srv.Client()
+		fs := newFakeStore(store.PayoutCandidate{SettlementID: 5, UserID: 50, TossUserKey: "toss:500", DepositAmount: 10000, RefundAmount: 10000})
+
+		// Simulate a run that executed the grant but crashed before recording it.
+		key, err := client.RequestPromotionKey(ctx, 500)
+		if err != nil {
+			t.Fatalf("request key: %v", err)
+		}
+		if _, err := client.ExecutePromotion(ctx, 500, "PROMO", key.Key, 10000); err != nil {
+			t.Fatalf("execute: %v", err)
+		}
+		fs.payouts[PromotionKey(5, 1)] = &store.Payout{ID: 7, PromotionCode: "PROMO", PromotionKey: PromotionKey(5, 1), TossKey: key.Key, AmountPoints: 10000, Status: "requested"}
+
+		r := &Runner{Store: fs, Promoter: client, PromotionCode: "PROMO"}
+		result, err := r.Run(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Processed != 1 {
+			t.Errorf("expected processed=1, got %d (%v)", result.Processed, result.Errors)
+		}
+		if len(srv.Grants()) != 1 {
+			t.Errorf("expected exactly 1 grant, got %d", len(srv.Grants()))
+		}
+		if !fs.settled[7] {
+			t.Error("expected settlement to be marked settled")
+		}
+	})
+
+	t.Run("Pending grant is retried later", func(t *testing.T) {
+		srv := tossfake.NewServer()
+		defer srv.Close()
+		client := srv.Client()
+		srv.SetExecutionResult(toss.PromotionResultPending)
+		key, _ := client.RequestPromotionKey(ctx, 600)
+		client.ExecutePromotion(ctx, 600, "PROMO", key.Key, 10000)
+
+		fs := newFakeStore(store.PayoutCandidate{SettlementID: 6, UserID: 60, TossUserKey: "toss:600", DepositAmount: 10000, RefundAmount: 10000})
+		fs.payouts[PromotionKey(6, 1)] = &store.Payout{ID: 8, PromotionCode: "PROMO", PromotionKey: PromotionKey(6, 1), TossKey: key.Key, AmountPoints: 10000, Status: "requested"}
+
+		r := &Runner{Store: fs, Promoter: client, PromotionCode: "PROMO"}
+		result, err := r.Run(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Failed != 1 {
+			t.Errorf("expected failed=1, got %d", result.Failed)
+		}
+		if got := fs.payouts[PromotionKey(6, 1)].Status; got != "requested" {
+			t.Errorf("expected payout to stay requested, got %s", got)
+		}
+	})
+
+	t.Run("Already granted payout is settled without calling Toss", func(t *testing.T) {
+		srv := tossfake.NewServer()
+		defer srv.Close()
+		fs := newFakeStore(store.PayoutCandidate{SettlementID: 9, UserID: 90, TossUserKey: "toss:900", DepositAmount: 10000, RefundAmount: 10000})
+		fs.payouts[PromotionKey(9, 1)] = &store.Payout{ID: 99, PromotionKey: PromotionKey(9, 1), Status: "done"}
+		r := &Runner{Store: fs, Promoter: srv.Client(), PromotionCode: "PROMO"}
+
+		if _, err := r.Run(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(srv.Grants()) != 0 {
+			t.Errorf("expected no grants, got %d", len(srv.Grants()))
+		}
+		if !fs.settled[99] {
+			t.Error("expected settlement to be marked settled")
+		}
+	})
+
+	t.Run("Missing configuration", func(t *testing.T) {
+		r := &Runner{Store: newFakeStore(), PromotionCode: "PROMO"}
+		if _, err := r.Run(ctx); err == nil {
+			t.Error("expected error without promoter")
+		}
+
+		srv := tossfake.NewServer()
+		defer srv.Close()
+		r = &Runner{Store: newFakeStore(), Promoter: srv.Client()}
+		if _, err := r.Run(ctx); err == nil {
+			t.Error("expected error without promotion code")
+		}
+	})
+}
@@ -0,0 +1,126 @@
+package proof
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+
+	"golang.org/x/image/webp"
+)
+
+// Limits for photo proofs. Phones produce 1~6MB, 12~48MP images; clients are expected
+// to downscale before upload.
+const (
+	MaxImageBytes     = 7 << 20    // encoded size; base64 of it fits the 10MB request body
+	MaxImageDimension = 8192       // longer side in pixels
+	MaxImagePixels    = 40_000_000 // guards against decompression bombs
+	MinImageDimension = 200        // shorter side in pixels
+	// MinImageContrast is the lowest standard deviation (0~255 scale) of any colour
+	// channel; blank, solid-colour and lens-covered shots fall below it
+	MinImageContrast = 4.0
+)
+
+// Image formats reported in ValidationResult.Format. HEIC photos must be converted to
+// JPEG by the client (iOS does this on upload).
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+	FormatWebP = "webp"
+)
+
+type imageCodec struct {
+	decode       func(io.Reader) (image.Image, error)
+	decodeConfig func(io.Reader) (image.Config, error)
+}
+
+var imageCodecs = map[string]imageCodec{
+	FormatJPEG: {jpeg.Decode, jpeg.DecodeConfig},
+	FormatPNG:  {png.Decode, png.DecodeConfig},
+	FormatWebP: {webp.Decode, webp.DecodeConfig},
+}
+
+// sniffFormat identifies the image format from its magic bytes
+func sniffFormat(data []byte) (string, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return FormatJPEG, nil
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return FormatPNG, nil
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return FormatWebP, nil
+	case len(data) >= 12 && string(data[4:8]) == "ftyp":
+		switch string(data[8:12]) {
+		case "heic", "heix", "hevc", "hevx", "heim", "heis", "mif1", "msf1":
+			return "", errors.New("HEIC 사진은 JPEG로 변환해 올려주세요")
+		}
+	}
+	return "", errors.New("지원하지 않는 이미지 형식입니다 (JPEG, PNG, WebP)")
+}
+
+// decodeImage sniffs and decodes an encoded image, refusing oversized files and
+// dimensions before decoding any pixels.
+func decodeImage(data []byte) (image.Image, string, error) {
+	if len(data) > MaxImageBytes {
+		return nil, "", fmt.Errorf("이미지 파일이 너무 큽니다 (최대 %dMB)", MaxImageBytes>>20)
+	}
+	format, err := sniffFormat(data)
+	if err != nil {
+		return nil, "", err
+	}
+	codec := imageCodecs[format]
+	cfg, err := codec.decodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, format, fmt.Errorf("손상된 %s 이미지입니다: %w", format, err)
+	}
+	if cfg.Width > MaxImageDimension || cfg.Height > MaxImageDimension || cfg.Width*cfg.Height > MaxImagePixels {
+		return nil, format, fmt.Errorf("이미지 해상도가 너무 큽니다 (%dx%d, 최대 %d픽셀)", cfg.Width, cfg.Height, MaxImageDimension)
+	}
+	img, err := codec.decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, format, fmt.Errorf("손상된 %s 이미지입니다: %w", format, err)
+	}
+	return img, format, nil
+}
+
+// checkImageContent returns why a decoded image cannot serve as a photo proof, or ""
+func checkImageContent(img image.Image) string {
+	b := img.Bounds()
+	if min(b.Dx(), b.Dy()) < MinImageDimension {
+		return fmt.Sprintf("이미지가 너무 작습니다 (%dx%d, 최소 %d픽셀)", b.Dx(), b.Dy(), MinImageDimension)
+	}
+	if channelContrast(img) < MinImageContrast {
+		return "빈 화면이나 단색 이미지는 인증 사진으로 인정되지 않습니다"
+	}
+	return ""
+}
+
+// channelContrast returns the largest standard deviation of the R, G and B channels
+// (0~255 scale) over a 64x64 sample grid
+func channelContrast(img image.Image) float64 {
+	const n = 64
+	b := img.Bounds()
+	var sum, sumSq [3]float64
+	for sy := 0; sy < n; sy++ {
+		y := b.Min.Y + b.Dy()*(2*sy+1)/(2*n)
+		for sx := 0; sx < n; sx++ {
+			x := b.Min.X + b.Dx()*(2*sx+1)/(2*n)
+			r, g, bl, _ := img.At(x, y).RGBA()
+			for i, v := range [3]uint32{r, g, bl} {
+				f := float64(v >> 8)
+				sum[i] += f
+				sumSq[i] += f * f
+			}
+		}
+	}
+	var most float64
+	for i := range sum {
+		mean := sum[i] / (n * n)
+		most = max(most, math.Sqrt(max(sumSq[i]/(n*n)-mean*mean, 0)))
+	}
+	return most
+}
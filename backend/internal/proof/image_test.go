@@ -0,0 +1,125 @@
+package proof
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func encodePNG(t *testing.T, img image.Image) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func solid(w, h int, c color.Color) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), &image.Uniform{c}, image.Point{}, draw.Src)
+	return img
+}
+
+func TestSniffFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		format string
+		errHas string
+	}{
+		{"JPEG", "\xFF\xD8\xFF\xE0\x00\x10JFIF", FormatJPEG, ""},
+		{"PNG", "\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR", FormatPNG, ""},
+		{"WebP", "RIFF\x24\x00\x00\x00WEBPVP8 ", FormatWebP, ""},
+		{"HEIC", "\x00\x00\x00\x18ftypheic\x00\x00\x00\x00", "", "HEIC"},
+		{"HEIF", "\x00\x00\x00\x18ftypmif1\x00\x00\x00\x00", "", "HEIC"},
+		{"GIF", "GIF89a\x01\x00\x01\x00", "", "지원하지 않는"},
+		{"Random", "definitely not an image", "", "지원하지 않는"},
+	}
+	for _, tt := range tests {
+		format, err := sniffFormat([]byte(tt.data))
+		if format != tt.format {
+			t.Errorf("%s: format %q, want %q", tt.name, format, tt.format)
+		}
+		if tt.errHas == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+		if tt.errHas != "" && (err == nil || !strings.Contains(err.Error(), tt.errHas)) {
+			t.Errorf("%s: error %v, want one containing %q", tt.name, err, tt.errHas)
+		}
+	}
+}
+
+func TestValidatePhotoProof_ImageMetadata(t *testing.T) {
+	tests := []struct {
+		name   string
+		image  string
+		format string
+		w, h   int
+	}{
+		{"JPEG", photoJPEG(t, "2025:03:02 06:30:00"), FormatJPEG, 256, 256},
+		{"PNG", encodePNG(t, scene(3, 640, 480)), FormatPNG, 640, 480},
+	}
+	for _, tt := range tests {
+		result, err := ValidatePhotoProof(tt.image, PhotoRules{})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !result.Valid || result.Format != tt.format || result.Width != tt.w || result.Height != tt.h {
+			t.Errorf("%s: got valid=%v %s %dx%d (%v), want %s %dx%d", tt.name,
+				result.Valid, result.Format, result.Width, result.Height, result.Errors, tt.format, tt.w, tt.h)
+		}
+	}
+}
+
+func TestValidatePhotoProof_RejectsNonPhotos(t *testing.T) {
+	t.Run("Not an image", func(t *testing.T) {
+		for name, data := range map[string]string{
+			"Random bytes": "definitely not an image",
+			"Truncated":    string(mustDecodeBase64(t, photoJPEG(t, ""))[:200]),
+			"HEIC":         "\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic",
+			"Too large":    "\xFF\xD8\xFF" + strings.Repeat("\x00", MaxImageBytes),
+		} {
+			if _, err := ValidatePhotoProof(base64.StdEncoding.EncodeToString([]byte(data)), PhotoRules{}); err == nil {
+				t.Errorf("%s: expected error", name)
+			}
+		}
+	})
+
+	t.Run("Too many pixels", func(t *testing.T) {
+		_, err := ValidatePhotoProof(encodePNG(t, solid(MaxImageDimension+1, 1, color.White)), PhotoRules{})
+		if err == nil || !strings.Contains(err.Error(), "해상도") {
+			t.Errorf("expected resolution error, got %v", err)
+		}
+	})
+
+	t.Run("Content", func(t *testing.T) {
+		for name, img := range map[string]image.Image{
+			"Tiny":         scene(4, 120, 90),
+			"Tiny side":    scene(5, 1000, MinImageDimension-1),
+			"Black":        solid(640, 480, color.Black),
+			"Solid colour": solid(640, 480, color.RGBA{40, 120, 200, 255}),
+			"Near-solid noise": func() image.Image {
+				img := solid(640, 480, color.RGBA{200, 200, 200, 255})
+				img.Set(10, 10, color.Black)
+				return img
+			}(),
+		} {
+			result, err := ValidatePhotoProof(encodePNG(t, img), PhotoRules{})
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if result.Valid || len(result.Errors) == 0 {
+				t.Errorf("%s: expected invalid result", name)
+			}
+			if result.Format != FormatPNG || result.Width != img.Bounds().Dx() {
+				t.Errorf("%s: metadata not reported: %+v", name, result)
+			}
+		}
+	})
+}
@@ -0,0 +1,82 @@
+package proof
+
+import (
+	"image"
+	"math/bits"
+)
+
+// NearDuplicateDistance is the largest Hamming distance between perceptual hashes at
+// which two photos count as the same picture. Re-compression, resizing, stripping
+// EXIF or cropping a few pixels typically stays within 0~4 of 64 bits.
+const NearDuplicateDistance = 5
+
+// dHash grid: 9x8 luminance samples give 8 horizontal gradients per row, 64 bits
+const (
+	dhashW = 9
+	dhashH = 8
+	// dhashSamples bounds the pixels averaged per grid cell along each axis, so hashing
+	// a 12MP photo reads a few thousand pixels instead of all of them
+	dhashSamples = 16
+)
+
+// PerceptualHash returns the 64-bit difference hash (dHash) of an encoded image. Unlike
+// ImageHash it survives re-encoding: near-identical pictures have hashes a small
+// Hamming distance apart (see Distance).
+func PerceptualHash(data []byte) (uint64, error) {
+	img, _, err := decodeImage(data)
+	if err != nil {
+		return 0, err
+	}
+	return DHash(img), nil
+}
+
+// DHash computes the difference hash of img: the image is shrunk to 9x8 grey cells by
+// area averaging and each bit records whether a cell is brighter than its right neighbour.
+func DHash(img image.Image) uint64 {
+	var grid [dhashH][dhashW]float64
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w == 0 || h == 0 {
+		return 0
+	}
+	for gy := 0; gy < dhashH; gy++ {
+		y0, y1 := b.Min.Y+gy*h/dhashH, b.Min.Y+(gy+1)*h/dhashH
+		for gx := 0; gx < dhashW; gx++ {
+			x0, x1 := b.Min.X+gx*w/dhashW, b.Min.X+(gx+1)*w/dhashW
+			grid[gy][gx] = cellLuma(img, x0, y0, x1, y1)
+		}
+	}
+
+	var hash uint64
+	for gy := 0; gy < dhashH; gy++ {
+		for gx := 0; gx < dhashW-1; gx++ {
+			hash <<= 1
+			if grid[gy][gx] > grid[gy][gx+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// cellLuma averages the luminance of up to dhashSamples x dhashSamples evenly spaced
+// pixels in [x0,x1) x [y0,y1). An empty cell (image smaller than the grid) samples x0,y0.
+func cellLuma(img image.Image, x0, y0, x1, y1 int) float64 {
+	nx, ny := min(max(x1-x0, 1), dhashSamples), min(max(y1-y0, 1), dhashSamples)
+	var sum float64
+	for sy := 0; sy < ny; sy++ {
+		y := y0 + (y1-y0)*(2*sy+1)/(2*ny)
+		for sx := 0; sx < nx; sx++ {
+			x := x0 + (x1-x0)*(2*sx+1)/(2*nx)
+			r, g, b, _ := img.At(x, y).RGBA()
+			// ITU-R BT.601 luma on 16-bit channels
+			sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+		}
+	}
+	return sum / float64(nx*ny)
+}
+
+// Distance returns the Hamming distance between two perceptual hashes (0~64)
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
@@ -0,0 +1,130 @@
+package proof
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"testing"
+)
+
+// scene draws overlapping coloured rectangles, a stand-in for a real photo
+func scene(seed int64, w, h int) *image.RGBA {
+	rng := rand.New(rand.NewSource(seed))
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.RGBA{200, 200, 190, 255}}, image.Point{}, draw.Src)
+	for i := 0; i < 12; i++ {
+		x, y := rng.Intn(w), rng.Intn(h)
+		r := image.Rect(x, y, x+w/8+rng.Intn(w/3), y+h/8+rng.Intn(h/3))
+		c := color.RGBA{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), 255}
+		draw.Draw(img, r, &image.Uniform{c}, image.Point{}, draw.Src)
+	}
+	return img
+}
+
+func encodeJPEG(t *testing.T, img image.Image, quality int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// shrink resizes img to w x h by nearest neighbour
+func shrink(img image.Image, w, h int) *image.RGBA {
+	b := img.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			out.Set(x, y, img.At(b.Min.X+x*b.Dx()/w, b.Min.Y+y*b.Dy()/h))
+		}
+	}
+	return out
+}
+
+func mustPHash(t *testing.T, data []byte) uint64 {
+	t.Helper()
+	h, err := PerceptualHash(data)
+	if err != nil {
+		t.Fatalf("PerceptualHash: %v", err)
+	}
+	return h
+}
+
+func TestPerceptualHash_NearDuplicates(t *testing.T) {
+	orig := scene(1, 640, 480)
+	base := mustPHash(t, encodeJPEG(t, orig, 95))
+
+	var pngBuf bytes.Buffer
+	if err := png.Encode(&pngBuf, orig); err != nil {
+		t.Fatal(err)
+	}
+	variants := map[string][]byte{
+		"Re-compressed":    encodeJPEG(t, orig, 40),
+		"PNG":              pngBuf.Bytes(),
+		"Resized":          encodeJPEG(t, shrink(orig, 320, 240), 80),
+		"Cropped 2px":      encodeJPEG(t, orig.SubImage(image.Rect(2, 2, 638, 478)), 90),
+		"EXIF added later": mustDecodeBase64(t, photoJPEGFrom(t, orig, "2025:03:02 06:30:00")),
+	}
+	for name, data := range variants {
+		if d := Distance(base, mustPHash(t, data)); d > NearDuplicateDistance {
+			t.Errorf("%s: distance %d, want <= %d", name, d, NearDuplicateDistance)
+		}
+	}
+
+	for seed := int64(2); seed < 12; seed++ {
+		other := mustPHash(t, encodeJPEG(t, scene(seed, 640, 480), 95))
+		if d := Distance(base, other); d <= NearDuplicateDistance {
+			t.Errorf("scene %d: distance %d to a different picture, want > %d", seed, d, NearDuplicateDistance)
+		}
+	}
+}
+
+func TestPerceptualHash_NotAnImage(t *testing.T) {
+	if _, err := PerceptualHash([]byte("definitely not an image")); err == nil {
+		t.Error("expected error for non-image data")
+	}
+}
+
+func TestDistance(t *testing.T) {
+	if d := Distance(0, ^uint64(0)); d != 64 {
+		t.Errorf("Distance(0, all ones) = %d, want 64", d)
+	}
+	if d := Distance(0b1011, 0b0010); d != 2 {
+		t.Errorf("Distance = %d, want 2", d)
+	}
+}
+
+func TestValidatePhotoProof_PerceptualHash(t *testing.T) {
+	withEXIF, err := ValidatePhotoProof(photoJPEG(t, "2025:03:02 06:30:00"), PhotoRules{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stripped, err := ValidatePhotoProof(photoJPEG(t, ""), PhotoRules{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if withEXIF.PerceptualHash == nil || stripped.PerceptualHash == nil {
+		t.Fatal("expected perceptual hashes for decodable photos")
+	}
+	if withEXIF.ImageHash == stripped.ImageHash {
+		t.Error("expected different SHA-256 once EXIF is stripped")
+	}
+	if *withEXIF.PerceptualHash != *stripped.PerceptualHash {
+		t.Errorf("perceptual hash changed with EXIF: %x vs %x", *withEXIF.PerceptualHash, *stripped.PerceptualHash)
+	}
+}
+
+func mustDecodeBase64(t *testing.T, s string) []byte {
+	t.Helper()
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
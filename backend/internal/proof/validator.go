@@ -15,23 +15,76 @@ import (
 
 // ValidationResult holds the result of proof validation
 type ValidationResult struct {
-	Valid       bool
-	ImageHash   string
-	TakenAt     *time.Time // nil if EXIF not available
-	Errors      []string
-	Warnings    []string
+	Valid          bool
+	ImageHash      string
+	Format         string     // FormatJPEG, FormatPNG or FormatWebP; empty for steps proofs
+	Width, Height  int        // decoded image size in pixels
+	Data           []byte     // the image file, for storage; nil for steps proofs
+	PerceptualHash *uint64    // dHash of the decoded image; nil for steps proofs
+	TakenAt        *time.Time // nil if EXIF not available
+	EXIFStatus     string     // how TakenAt compared to the proof day, see EXIFOnProofDay
+	// ReviewReason is set when the proof may only be accepted after human review
+	ReviewReason string
+	Errors       []string
+	Warnings     []string
+}
+
+// EXIF decisions reported in ValidationResult.EXIFStatus
+const (
+	EXIFOnProofDay    = "on_proof_day"   // taken on the proof day (within tolerance) and window
+	EXIFWrongDay      = "wrong_day"      // taken on another day
+	EXIFOutsideWindow = "outside_window" // taken on the proof day but outside the proof window
+	EXIFMissing       = "missing"        // no readable EXIF timestamp
+)
+
+// Policies for photos whose EXIF capture time cannot be read (screenshots, downloaded
+// or edited images), set per challenge
+const (
+	MissingEXIFAccept = "accept"                    // accept with a warning
+	MissingEXIFFlag   = "accept_flagged_for_review" // hold for human review
+	MissingEXIFReject = "reject"                    // reject the proof
+)
+
+// ValidMissingEXIFPolicy reports whether p is a supported missing-EXIF policy
+func ValidMissingEXIFPolicy(p string) bool {
+	return p == MissingEXIFAccept || p == MissingEXIFFlag || p == MissingEXIFReject
+}
+
+// Review reasons reported in ValidationResult.ReviewReason
+const (
+	ReviewMissingEXIF   = "missing_exif"
+	ReviewNearDuplicate = "near_duplicate" // looks like one of the user's earlier photos
+)
+
+// DefaultDayTolerance is how far outside the proof day a photo may be taken by default,
+// e.g. just before midnight and uploaded just after.
+const DefaultDayTolerance = time.Hour
+
+// PhotoRules are the challenge-specific checks a photo proof must pass
+type PhotoRules struct {
+	ProofDate    time.Time      // challenge date the proof counts for (see calendar.Date); zero skips the day check
+	DayTolerance time.Duration  // how far before or after the proof day the photo may be taken
+	Window       Window         // time of day the photo must be taken and received in
+	Location     *time.Location // challenge time zone; EXIF times without a zone are read in it (UTC if nil)
+	ReceivedAt   time.Time      // server receive time; zero skips the window check on it
+	MissingEXIF  string         // MissingEXIFAccept (default), MissingEXIFFlag or MissingEXIFReject
 }
 
 // ValidatePhotoProof validates a photo proof submission
-// - Decodes base64 image
+// - Decodes base64 image and checks its format, size and content
 // - Extracts EXIF data to verify photo timestamp
-// - Generates SHA256 hash for duplicate detection
-func ValidatePhotoProof(imageBase64 string, challengeStart, challengeEnd time.Time) (*ValidationResult, error) {
+// - Checks the receive time and photo timestamp against the proof window
+// - Generates SHA256 and perceptual hashes for duplicate detection
+func ValidatePhotoProof(imageBase64 string, rules PhotoRules) (*ValidationResult, error) {
 	result := &ValidationResult{
 		Valid:    true,
 		Errors:   []string{},
 		Warnings: []string{},
 	}
+	loc := rules.Location
+	if loc == nil {
+		loc = time.UTC
+	}
 
 	// Remove data URL prefix if present
 	imageData := imageBase64
@@ -49,37 +102,78 @@ func ValidatePhotoProof(imageBase64 string, challengeStart, challengeEnd time.Ti
 		return nil, errors.New("empty image data")
 	}
 
+	// Anything that is not a JPEG, PNG or WebP within the limits is not a photo at all
+	img, format, err := decodeImage(decoded)
+	if err != nil {
+		return nil, err
+	}
+	result.Format = format
+	result.Data = decoded
+	result.Width, result.Height = img.Bounds().Dx(), img.Bounds().Dy()
+	if reason := checkImageContent(img); reason != "" {
+		result.Valid = false
+		result.Errors = append(result.Errors, reason)
+	}
+
 	// Generate SHA256 hash
 	hash := sha256.Sum256(decoded)
 	result.ImageHash = fmt.Sprintf("%x", hash)
+	ph := DHash(img)
+	result.PerceptualHash = &ph
+
+	if !rules.ReceivedAt.IsZero() {
+		if reason := rules.Window.CheckReceived(rules.ReceivedAt, loc); reason != "" {
+			result.Valid = false
+			result.Errors = append(result.Errors, reason)
+		}
+	}
 
 	// Try to extract EXIF data
-	takenAt, exifErr := extractPhotoTime(decoded)
+	takenAt, exifErr := extractPhotoTime(decoded, loc)
 	if exifErr != nil {
-		result.Warnings = append(result.Warnings, "EXIF 데이터를 읽을 수 없습니다")
+		result.EXIFStatus = EXIFMissing
+		switch rules.MissingEXIF {
+		case MissingEXIFReject:
+			result.Valid = false
+			result.Errors = append(result.Errors, "촬영 정보(EXIF)가 없는 사진은 인정되지 않습니다. 카메라로 직접 찍은 사진을 올려주세요")
+		case MissingEXIFFlag:
+			result.ReviewReason = ReviewMissingEXIF
+			result.Warnings = append(result.Warnings, "EXIF 데이터를 읽을 수 없어 검토 후 인정됩니다")
+		default:
+			result.Warnings = append(result.Warnings, "EXIF 데이터를 읽을 수 없습니다")
+		}
 	} else if takenAt != nil {
 		result.TakenAt = takenAt
+		result.EXIFStatus = EXIFOnProofDay
 
-		// Validate photo was taken within challenge period
-		// Allow 1 day buffer before start and after end for timezone issues
-		startWithBuffer := challengeStart.Add(-24 * time.Hour)
-		endWithBuffer := challengeEnd.Add(24 * time.Hour)
-
-		if takenAt.Before(startWithBuffer) {
+		// The photo must be taken on the day it proves, so an older photo cannot be
+		// submitted for a later day
+		if !rules.ProofDate.IsZero() && !onDay(*takenAt, rules.ProofDate, loc, rules.DayTolerance) {
 			result.Valid = false
-			result.Errors = append(result.Errors, fmt.Sprintf("사진이 챌린지 시작 전에 촬영되었습니다 (촬영: %s)", takenAt.Format("2006-01-02")))
-		}
-		if takenAt.After(endWithBuffer) {
+			result.EXIFStatus = EXIFWrongDay
+			result.Errors = append(result.Errors, fmt.Sprintf("사진이 인증일(%s)에 촬영되지 않았습니다 (촬영: %s)",
+				rules.ProofDate.Format("2006-01-02"), takenAt.In(loc).Format("2006-01-02 15:04")))
+		} else if reason := rules.Window.CheckTaken(*takenAt, loc); reason != "" {
 			result.Valid = false
-			result.Errors = append(result.Errors, fmt.Sprintf("사진이 챌린지 종료 후에 촬영되었습니다 (촬영: %s)", takenAt.Format("2006-01-02")))
+			result.EXIFStatus = EXIFOutsideWindow
+			result.Errors = append(result.Errors, reason)
 		}
 	}
 
 	return result, nil
 }
 
-// extractPhotoTime extracts the original photo timestamp from EXIF data
-func extractPhotoTime(imageData []byte) (*time.Time, error) {
+// onDay reports whether t falls on the civil date in loc, widened by tolerance on both sides
+func onDay(t, date time.Time, loc *time.Location, tolerance time.Duration) bool {
+	y, m, d := date.Date()
+	start := time.Date(y, m, d, 0, 0, 0, 0, loc).Add(-tolerance)
+	end := time.Date(y, m, d+1, 0, 0, 0, 0, loc).Add(tolerance)
+	return !t.Before(start) && t.Before(end)
+}
+
+// extractPhotoTime extracts the original photo timestamp from EXIF data.
+// EXIF stores local wall-clock time, usually without a zone; it is read in loc.
+func extractPhotoTime(imageData []byte, loc *time.Location) (*time.Time, error) {
 	reader := bytes.NewReader(imageData)
 	x, err := exif.Decode(reader)
 	if err != nil {
@@ -91,6 +185,10 @@ func extractPhotoTime(imageData []byte) (*time.Time, error) {
 	if err != nil {
 		return nil, fmt.Errorf("no datetime in exif: %w", err)
 	}
+	// goexif falls back to the server's zone when the file has no offset
+	if dt.Location() == time.Local {
+		dt = time.Date(dt.Year(), dt.Month(), dt.Day(), dt.Hour(), dt.Minute(), dt.Second(), 0, loc)
+	}
 
 	return &dt, nil
 }
@@ -0,0 +1,163 @@
+package proof
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"strings"
+	"testing"
+	"time"
+)
+
+var seoul = mustLoadLocation("Asia/Seoul")
+
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+// photoJPEG returns a base64 JPEG whose EXIF DateTimeOriginal is takenAt
+// ("2006:01:02 15:04:05" wall clock, no zone), or no EXIF if takenAt is "".
+func photoJPEG(t *testing.T, takenAt string) string {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 256, 256))
+	for y := 0; y < 256; y++ {
+		for x := 0; x < 256; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), uint8((x * y) % 256), 255})
+		}
+	}
+	return photoJPEGFrom(t, img, takenAt)
+}
+
+// photoJPEGFrom encodes img like photoJPEG
+func photoJPEGFrom(t *testing.T, img image.Image, takenAt string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if takenAt == "" {
+		return base64.StdEncoding.EncodeToString(data)
+	}
+
+	// Little-endian TIFF: IFD0 -> Exif IFD -> DateTimeOriginal
+	le := binary.LittleEndian
+	tiff := []byte("II*\x00")
+	tiff = le.AppendUint32(tiff, 8)
+	tiff = le.AppendUint16(tiff, 1) // IFD0 at 8
+	tiff = le.AppendUint16(tiff, 0x8769)
+	tiff = le.AppendUint16(tiff, 4)
+	tiff = le.AppendUint32(tiff, 1)
+	tiff = le.AppendUint32(tiff, 26)
+	tiff = le.AppendUint32(tiff, 0)
+	tiff = le.AppendUint16(tiff, 1) // Exif IFD at 26
+	tiff = le.AppendUint16(tiff, 0x9003)
+	tiff = le.AppendUint16(tiff, 2)
+	tiff = le.AppendUint32(tiff, 20)
+	tiff = le.AppendUint32(tiff, 44)
+	tiff = le.AppendUint32(tiff, 0)
+	tiff = append(tiff, takenAt+"\x00"...) // value at 44
+
+	app1 := []byte{0xFF, 0xE1}
+	app1 = binary.BigEndian.AppendUint16(app1, uint16(2+6+len(tiff)))
+	app1 = append(app1, "Exif\x00\x00"...)
+	app1 = append(app1, tiff...)
+
+	out := append([]byte{}, data[:2]...) // SOI
+	out = append(out, app1...)
+	out = append(out, data[2:]...)
+	return base64.StdEncoding.EncodeToString(out)
+}
+
+func TestValidatePhotoProof_ProofDay(t *testing.T) {
+	rules := PhotoRules{
+		ProofDate:    time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC),
+		DayTolerance: time.Hour,
+		Location:     seoul,
+	}
+
+	tests := []struct {
+		name       string
+		takenAt    string
+		wantValid  bool
+		wantStatus string
+	}{
+		{"Same day", "2025:03:03 12:00:00", true, EXIFOnProofDay},
+		{"Just before midnight, within tolerance", "2025:03:02 23:30:00", true, EXIFOnProofDay},
+		{"Just after the day, within tolerance", "2025:03:04 00:30:00", true, EXIFOnProofDay},
+		{"Earlier day of the challenge", "2025:03:01 08:00:00", false, EXIFWrongDay},
+		{"Evening before, beyond tolerance", "2025:03:02 22:00:00", false, EXIFWrongDay},
+		{"No EXIF", "", true, EXIFMissing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ValidatePhotoProof(photoJPEG(t, tt.takenAt), rules)
+			if err != nil {
+				t.Fatalf("ValidatePhotoProof: %v", err)
+			}
+			if result.Valid != tt.wantValid || result.EXIFStatus != tt.wantStatus {
+				t.Errorf("valid=%v status=%s, want valid=%v status=%s (%v)", result.Valid, result.EXIFStatus, tt.wantValid, tt.wantStatus, result.Errors)
+			}
+		})
+	}
+
+	result, err := ValidatePhotoProof(photoJPEG(t, "2025:03:01 08:00:00"), rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "사진이 인증일(2025-03-03)에 촬영되지 않았습니다 (촬영: 2025-03-01 08:00)"; strings.Join(result.Errors, "") != want {
+		t.Errorf("errors = %v, want %q", result.Errors, want)
+	}
+}
+
+func TestValidatePhotoProof_MissingEXIFPolicy(t *testing.T) {
+	tests := []struct {
+		policy       string
+		wantValid    bool
+		wantReview   string
+		wantWarnings int
+	}{
+		{"", true, "", 1},
+		{MissingEXIFAccept, true, "", 1},
+		{MissingEXIFFlag, true, ReviewMissingEXIF, 1},
+		{MissingEXIFReject, false, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			result, err := ValidatePhotoProof(photoJPEG(t, ""), PhotoRules{MissingEXIF: tt.policy})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Valid != tt.wantValid || result.ReviewReason != tt.wantReview || len(result.Warnings) != tt.wantWarnings {
+				t.Errorf("valid=%v review=%q warnings=%v errors=%v", result.Valid, result.ReviewReason, result.Warnings, result.Errors)
+			}
+		})
+	}
+
+	// The policy only applies when EXIF is missing
+	result, err := ValidatePhotoProof(photoJPEG(t, "2025:03:03 12:00:00"), PhotoRules{MissingEXIF: MissingEXIFReject})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Valid || result.ReviewReason != "" {
+		t.Errorf("expected photo with EXIF to pass, got %+v", result)
+	}
+}
+
+func TestValidatePhotoProof_EXIFReadInChallengeZone(t *testing.T) {
+	result, err := ValidatePhotoProof(photoJPEG(t, "2025:03:02 06:30:00"), PhotoRules{Location: seoul})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2025, 3, 2, 6, 30, 0, 0, seoul)
+	if result.TakenAt == nil || !result.TakenAt.Equal(want) {
+		t.Errorf("TakenAt = %v, want %v", result.TakenAt, want)
+	}
+}
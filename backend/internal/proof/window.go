@@ -0,0 +1,85 @@
+package proof
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UploadGrace is how long after a window closes a proof may still arrive, so a photo
+// taken at the last minute is not rejected for upload latency. The photo itself
+// (EXIF TakenAt) must still be taken inside the window.
+const UploadGrace = 10 * time.Minute
+
+// MinutesPerDay bounds Window.Start and Window.End
+const MinutesPerDay = 24 * 60
+
+// Window is the local time of day a challenge accepts proofs in, as minutes after
+// midnight in the challenge time zone. Start == End means any time of day; windows
+// do not wrap past midnight.
+type Window struct {
+	Start int
+	End   int
+}
+
+// AnyTime reports whether the window accepts proofs all day
+func (w Window) AnyTime() bool {
+	return w.Start == w.End
+}
+
+// String formats the window as "05:00~07:00"
+func (w Window) String() string {
+	return FormatClock(w.Start) + "~" + FormatClock(w.End)
+}
+
+// FormatClock formats minutes after midnight as "HH:MM"
+func FormatClock(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// ParseClock parses "HH:MM" (00:00~24:00) into minutes after midnight
+func ParseClock(s string) (int, error) {
+	hh, mm, ok := strings.Cut(strings.TrimSpace(s), ":")
+	h, errH := strconv.Atoi(hh)
+	m, errM := strconv.Atoi(mm)
+	if !ok || len(hh) != 2 || len(mm) != 2 || errH != nil || errM != nil || h < 0 || m < 0 || m > 59 {
+		return 0, fmt.Errorf("invalid time %q (want HH:MM)", s)
+	}
+	minutes := h*60 + m
+	if minutes > MinutesPerDay {
+		return 0, fmt.Errorf("invalid time %q (want HH:MM)", s)
+	}
+	return minutes, nil
+}
+
+// contains reports whether t falls in the window on its local day in loc, with grace
+// added after End.
+func (w Window) contains(t time.Time, loc *time.Location, grace time.Duration) bool {
+	if w.AnyTime() {
+		return true
+	}
+	local := t.In(loc)
+	y, m, d := local.Date()
+	start := time.Date(y, m, d, 0, w.Start, 0, 0, loc)
+	end := time.Date(y, m, d, 0, w.End, 0, 0, loc).Add(grace)
+	return !local.Before(start) && local.Before(end)
+}
+
+// CheckReceived returns the rejection reason if a proof received at receivedAt is
+// outside the window (plus UploadGrace), or "" if it is in time.
+func (w Window) CheckReceived(receivedAt time.Time, loc *time.Location) string {
+	if w.contains(receivedAt, loc, UploadGrace) {
+		return ""
+	}
+	return fmt.Sprintf("인증 가능 시간(%s)이 아닙니다 (접수: %s)", w, receivedAt.In(loc).Format("15:04"))
+}
+
+// CheckTaken returns the rejection reason if a photo taken at takenAt is outside the
+// window, or "" if it was taken in time.
+func (w Window) CheckTaken(takenAt time.Time, loc *time.Location) string {
+	if w.contains(takenAt, loc, 0) {
+		return ""
+	}
+	return fmt.Sprintf("사진이 인증 가능 시간(%s) 밖에 촬영되었습니다 (촬영: %s)", w, takenAt.In(loc).Format("15:04"))
+}
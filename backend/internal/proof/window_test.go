@@ -0,0 +1,110 @@
+package proof
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int
+		wantErr bool
+	}{
+		{"00:00", 0, false},
+		{"05:00", 300, false},
+		{"07:30", 450, false},
+		{"24:00", MinutesPerDay, false},
+		{"7:00", 0, true},
+		{"07:60", 0, true},
+		{"24:01", 0, true},
+		{"0700", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseClock(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseClock(%q) = %d, %v; want %d, err=%v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestWindow(t *testing.T) {
+	w := Window{Start: 300, End: 420} // 05:00~07:00 KST
+	at := func(h, m int) time.Time { return time.Date(2025, 3, 1, h, m, 0, 0, seoul) }
+
+	if w.String() != "05:00~07:00" {
+		t.Errorf("String = %s", w.String())
+	}
+	tests := []struct {
+		name         string
+		t            time.Time
+		wantTaken    bool
+		wantReceived bool
+	}{
+		{"Before start", at(4, 59), false, false},
+		{"At start", at(5, 0), true, true},
+		{"Inside", at(6, 30), true, true},
+		{"At end", at(7, 0), false, true},
+		{"Within upload grace", at(7, 9), false, true},
+		{"After grace", at(7, 10), false, false},
+		{"Evening", at(19, 0), false, false},
+		{"Same instant in UTC", at(6, 0).UTC(), true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := w.CheckTaken(tt.t, seoul) == ""; got != tt.wantTaken {
+				t.Errorf("taken ok = %v, want %v", got, tt.wantTaken)
+			}
+			if got := w.CheckReceived(tt.t, seoul) == ""; got != tt.wantReceived {
+				t.Errorf("received ok = %v, want %v", got, tt.wantReceived)
+			}
+		})
+	}
+
+	if reason := (Window{}).CheckReceived(at(23, 59), seoul); reason != "" {
+		t.Errorf("zero window should accept any time, got %q", reason)
+	}
+}
+
+func TestValidatePhotoProof_Window(t *testing.T) {
+	rules := func(received time.Time) PhotoRules {
+		return PhotoRules{
+			ProofDate:  time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC),
+			Window:     Window{Start: 300, End: 420},
+			Location:   seoul,
+			ReceivedAt: received,
+		}
+	}
+	morning := time.Date(2025, 3, 2, 6, 40, 0, 0, seoul)
+
+	tests := []struct {
+		name     string
+		image    string
+		received time.Time
+		wantErr  string
+	}{
+		{"Taken and received in window", photoJPEG(t, "2025:03:02 06:30:00"), morning, ""},
+		{"No EXIF, received in window", photoJPEG(t, ""), morning, ""},
+		{"Received late", photoJPEG(t, "2025:03:02 06:30:00"), morning.Add(time.Hour), "인증 가능 시간(05:00~07:00)이 아닙니다"},
+		{"Taken outside window", photoJPEG(t, "2025:03:02 04:10:00"), morning, "밖에 촬영되었습니다 (촬영: 04:10)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ValidatePhotoProof(tt.image, rules(tt.received))
+			if err != nil {
+				t.Fatalf("ValidatePhotoProof: %v", err)
+			}
+			if tt.wantErr == "" {
+				if !result.Valid {
+					t.Fatalf("expected valid, got %v", result.Errors)
+				}
+				return
+			}
+			if result.Valid || !strings.Contains(strings.Join(result.Errors, "; "), tt.wantErr) {
+				t.Errorf("expected error containing %q, got valid=%v %v", tt.wantErr, result.Valid, result.Errors)
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+// Package reconcile brings local payment records in line with the payment provider.
+package reconcile
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"habitcashback/internal/clock"
+	"habitcashback/internal/payment"
+	"habitcashback/internal/store"
+)
+
+// Defaults for Run.
+const (
+	DefaultBatchSize   = 100
+	DefaultStaleAfter  = 10 * time.Minute // leave fresh checkouts to the client and callback
+	DefaultExpireAfter = 24 * time.Hour   // give up on checkouts that never completed
+)
+
+// ErrAmountMismatch is returned when the provider reports a different amount than we charged.
+var ErrAmountMismatch = errors.New("provider amount does not match payment amount")
+
+// OutcomeRefunded is returned by Sync for a paid payment that could not start a
+// participation (the user already joined the challenge) and was refunded instead.
+const OutcomeRefunded = "refunded"
+
+// DuplicateRefundReason is sent to the payment provider with those refunds.
+const DuplicateRefundReason = "이미 참여 중인 챌린지 중복 결제"
+
+// InterruptedCancelReason is recorded for refunds finished by Run after the cancel request
+// that claimed the payment was interrupted.
+const InterruptedCancelReason = "중단된 취소 요청 복구"
+
+// CancelStore is the subset of store.Store used to settle a claimed ('cancelling') payment.
+type CancelStore interface {
+	ReleasePaymentCancel(ctx context.Context, paymentID int64) error
+	RefundPayment(ctx context.Context, paymentID int64, refundNo string, refundedAmount int64, fullyRefunded bool, reason string) (*store.Payment, error)
+}
+
+// Store is the subset of store.Store used for reconciliation.
+type Store interface {
+	CancelStore
+	GetPaymentByID(ctx context.Context, paymentID int64) (*store.Payment, error)
+	UpdatePaymentTossPayResponse(ctx context.Context, paymentID int64, pgTxID string, rawJSON []byte) error
+	ExecutePaymentByID(ctx context.Context, paymentID int64) (*store.Payment, error)
+	ListStalePayments(ctx context.Context, createdBefore time.Time, limit int) ([]store.Payment, error)
+	ClosePayment(ctx context.Context, paymentID int64, status, reason string) error
+	RefundUnfulfilledPayment(ctx context.Context, paymentID int64, refundNo, reason string) error
+	ListStaleCancellations(ctx context.Context, claimedBefore time.Time, limit int) ([]store.Payment, error)
+}
+
+// Reconciler completes payments that the provider reports as paid and closes the ones
+// that will never be paid.
+type Reconciler struct {
+	Store    Store
+	Payments payment.Service
+
+	BatchSize   int
+	StaleAfter  time.Duration
+	ExpireAfter time.Duration
+	Clock       clock.Clock // nil: system clock
+}
+
+// Run reconciles one batch of stale 'created' payments against the provider.
+// Paid payments are completed, failed ones are marked 'failed' and checkouts still pending
+// after ExpireAfter are marked 'expired'. Payments left 'cancelling' for StaleAfter by an
+// interrupted cancel are settled with CompleteCancel. Per-payment errors are recorded in
+// the result; only store listing errors abort the run.
+func (r *Reconciler) Run(ctx context.Context) (*store.BatchResult, error) {
+	if r.Payments == nil {
+		return nil, errors.New("payment service not configured")
+	}
+	limit := r.BatchSize
+	if limit <= 0 {
+		limit = DefaultBatchSize
+	}
+	staleAfter := r.StaleAfter
+	if staleAfter <= 0 {
+		staleAfter = DefaultStaleAfter
+	}
+
+	now := clock.OrSystem(r.Clock).Now()
+	payments, err := r.Store.ListStalePayments(ctx, now.Add(-staleAfter), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &store.BatchResult{Errors: []string{}}
+	for i := range payments {
+		p := &payments[i]
+		if err := r.reconcileOne(ctx, p, now); err != nil {
+			result.Failed++
+			result.Errors = append(result.Errors, fmt.Sprintf("payment %d (%s): %v", p.ID, p.OrderNo, err))
+			continue
+		}
+		result.Processed++
+	}
+
+	cancelling, err := r.Store.ListStaleCancellations(ctx, now.Add(-staleAfter), limit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range cancelling {
+		p := &cancelling[i]
+		if _, err := CompleteCancel(ctx, r.Store, r.Payments, p, InterruptedCancelReason); err != nil {
+			result.Failed++
+			result.Errors = append(result.Errors, fmt.Sprintf("cancelling payment %d (%s): %v", p.ID, p.OrderNo, err))
+			continue
+		}
+		result.Processed++
+	}
+	return result, nil
+}
+
+// CompleteCancel settles a 'cancelling' payment whose provider refund failed, timed out or
+// was never recorded. The provider status decides: a refunded payment is recorded as
+// refunded (returned), a payment that is still paid is released back to 'done' (nil). Any
+// other status, or a failed status lookup, returns an error and leaves the claim for Run.
+func CompleteCancel(ctx context.Context, st CancelStore, payments payment.Service, p *store.Payment, reason string) (*store.Payment, error) {
+	if p.PayToken != "" {
+		status, err := payments.GetStatus(ctx, p.PayToken)
+		if err != nil {
+			return nil, fmt.Errorf("payment %d status: %w", p.ID, err)
+		}
+		switch {
+		case status.Status == payment.StatusRefunded:
+		case payment.Classify(status.Status) == payment.OutcomePaid:
+			return nil, st.ReleasePaymentCancel(ctx, p.ID)
+		default:
+			return nil, fmt.Errorf("payment %d is %s at the provider", p.ID, status.Status)
+		}
+	}
+	return st.RefundPayment(ctx, p.ID, "", p.Amount, true, reason)
+}
+
+func (r *Reconciler) reconcileOne(ctx context.Context, p *store.Payment, now time.Time) error {
+	outcome, err := r.Sync(ctx, p)
+	var payErr *payment.PaymentError
+	if errors.As(err, &payErr) && payErr.Code == payment.ErrCodePaymentNotFound {
+		// Unknown to the provider: the checkout was never started. Let it expire.
+		outcome, err = payment.OutcomePending, nil
+	}
+	if err != nil {
+		return err
+	}
+
+	switch outcome {
+	case payment.OutcomePaid, OutcomeRefunded:
+		return nil
+	case payment.OutcomeFailed:
+		return r.Store.ClosePayment(ctx, p.ID, "failed", "provider reported the payment as cancelled or failed")
+	}
+
+	expireAfter := r.ExpireAfter
+	if expireAfter <= 0 {
+		expireAfter = DefaultExpireAfter
+	}
+	if now.Sub(p.CreatedAt) < expireAfter {
+		return nil // still pending; try again next run
+	}
+	return r.Store.ClosePayment(ctx, p.ID, "expired", fmt.Sprintf("checkout not completed within %s", expireAfter))
+}
+
+// Sync asks the provider for the payment's status and completes it locally once paid,
+// returning the provider outcome (payment.Outcome*). An approved but unexecuted payment
+// is executed first. A payment that is already 'done' is a no-op, so the result callback,
+// /v1/payments/execute and the worker can race on the same payment safely.
+// A paid payment that cannot start a participation is refunded (OutcomeRefunded).
+func (r *Reconciler) Sync(ctx context.Context, p *store.Payment) (string, error) {
+	switch p.Status {
+	case "done":
+		return payment.OutcomePaid, nil
+	case "created":
+	default:
+		return "", fmt.Errorf("payment %d is %s", p.ID, p.Status)
+	}
+	if p.PayToken == "" {
+		return "", fmt.Errorf("payment %d has no pay token", p.ID)
+	}
+
+	st, err := r.Payments.GetStatus(ctx, p.PayToken)
+	if err != nil {
+		return "", err
+	}
+	outcome := payment.Classify(st.Status)
+	if outcome != payment.OutcomePaid && outcome != payment.OutcomeApproved {
+		return outcome, nil
+	}
+	if st.Amount != 0 && st.Amount != p.Amount {
+		return outcome, fmt.Errorf("%w: payment %d charged %d, provider reports %d", ErrAmountMismatch, p.ID, p.Amount, st.Amount)
+	}
+
+	if outcome == payment.OutcomeApproved {
+		exec, err := r.Payments.ExecutePayment(ctx, p.PayToken)
+		if err != nil {
+			return outcome, err
+		}
+		if exec.TxID != "" {
+			raw, _ := json.Marshal(exec)
+			if err := r.Store.UpdatePaymentTossPayResponse(ctx, p.ID, exec.TxID, raw); err != nil {
+				return outcome, err
+			}
+		}
+	}
+
+	if _, err := r.Store.ExecutePaymentByID(ctx, p.ID); err != nil {
+		if errors.Is(err, store.ErrActiveParticipation) || errors.Is(err, store.ErrParticipationToday) {
+			if err := r.RefundUnfulfilled(ctx, p); err != nil {
+				return outcome, err
+			}
+			return OutcomeRefunded, nil
+		}
+		// Someone else may have completed it between our read and update.
+		if cur, gerr := r.Store.GetPaymentByID(ctx, p.ID); gerr == nil && cur != nil && cur.Status == "done" {
+			return payment.OutcomePaid, nil
+		}
+		return outcome, err
+	}
+	return payment.OutcomePaid, nil
+}
+
+// RefundUnfulfilled refunds a captured 'created' payment that could not start a
+// participation, so the user is not charged for nothing. If the refund fails the payment
+// stays 'created' and the next Sync tries again.
+func (r *Reconciler) RefundUnfulfilled(ctx context.Context, p *store.Payment) error {
+	refundNo := ""
+	if p.PayToken != "" {
+		res, err := r.Payments.CancelPayment(ctx, p.PayToken, p.Amount, DuplicateRefundReason)
+		if err != nil {
+			// An earlier attempt may have refunded at the provider but failed to record it.
+			st, serr := r.Payments.GetStatus(ctx, p.PayToken)
+			if serr != nil || st.Status != payment.StatusRefunded {
+				return fmt.Errorf("refund payment %d: %w", p.ID, err)
+			}
+		} else {
+			refundNo = res.RefundNo
+		}
+	}
+	return r.Store.RefundUnfulfilledPayment(ctx, p.ID, refundNo, DuplicateRefundReason)
+}
@@ -0,0 +1,389 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"habitcashback/internal/payment"
+	"habitcashback/internal/store"
+)
+
+// fakeStore is an in-memory Store keyed by payment ID
+type fakeStore struct {
+	payments map[int64]*store.Payment
+	txIDs    map[int64]string
+	reasons  map[int64]string
+	executed int
+	joined   bool // the user already participates: execution fails with ErrActiveParticipation
+
+	claimedAt map[int64]time.Time // when a 'cancelling' payment was claimed
+}
+
+func newFakeStore(payments ...*store.Payment) *fakeStore {
+	f := &fakeStore{payments: map[int64]*store.Payment{}, txIDs: map[int64]string{}, reasons: map[int64]string{}, claimedAt: map[int64]time.Time{}}
+	for _, p := range payments {
+		f.payments[p.ID] = p
+	}
+	return f
+}
+
+func (f *fakeStore) ListStalePayments(ctx context.Context, createdBefore time.Time, limit int) ([]store.Payment, error) {
+	var list []store.Payment
+	for id := int64(1); id <= int64(len(f.payments)) && len(list) < limit; id++ {
+		p := f.payments[id]
+		if p != nil && p.Status == "created" && p.PayToken != "" && p.CreatedAt.Before(createdBefore) {
+			list = append(list, *p)
+		}
+	}
+	return list, nil
+}
+
+func (f *fakeStore) ClosePayment(ctx context.Context, paymentID int64, status, reason string) error {
+	if p := f.payments[paymentID]; p != nil && p.Status == "created" {
+		p.Status = status
+		f.reasons[paymentID] = reason
+	}
+	return nil
+}
+
+func (f *fakeStore) GetPaymentByID(ctx context.Context, paymentID int64) (*store.Payment, error) {
+	return f.payments[paymentID], nil
+}
+
+func (f *fakeStore) UpdatePaymentTossPayResponse(ctx context.Context, paymentID int64, pgTxID string, rawJSON []byte) error {
+	f.txIDs[paymentID] = pgTxID
+	return nil
+}
+
+func (f *fakeStore) ExecutePaymentByID(ctx context.Context, paymentID int64) (*store.Payment, error) {
+	p := f.payments[paymentID]
+	if p == nil || p.Status != "created" {
+		return nil, errors.New("payment not found or already executed")
+	}
+	if f.joined {
+		return nil, store.ErrActiveParticipation
+	}
+	p.Status = "done"
+	f.executed++
+	return p, nil
+}
+
+func (f *fakeStore) RefundUnfulfilledPayment(ctx context.Context, paymentID int64, refundNo, reason string) error {
+	p := f.payments[paymentID]
+	if p == nil || p.Status != "created" {
+		return errors.New("payment is not awaiting execution")
+	}
+	p.Status = "refunded"
+	f.reasons[paymentID] = reason
+	return nil
+}
+
+func (f *fakeStore) ListStaleCancellations(ctx context.Context, claimedBefore time.Time, limit int) ([]store.Payment, error) {
+	var list []store.Payment
+	for id := int64(1); id <= int64(len(f.payments)) && len(list) < limit; id++ {
+		p := f.payments[id]
+		if p != nil && p.Status == "cancelling" && f.claimedAt[id].Before(claimedBefore) {
+			list = append(list, *p)
+		}
+	}
+	return list, nil
+}
+
+func (f *fakeStore) ReleasePaymentCancel(ctx context.Context, paymentID int64) error {
+	if p := f.payments[paymentID]; p != nil && p.Status == "cancelling" {
+		p.Status = "done"
+	}
+	return nil
+}
+
+func (f *fakeStore) RefundPayment(ctx context.Context, paymentID int64, refundNo string, refundedAmount int64, fullyRefunded bool, reason string) (*store.Payment, error) {
+	p := f.payments[paymentID]
+	if p == nil || (p.Status != "done" && p.Status != "cancelling") {
+		return nil, errors.New("payment not found or not refundable")
+	}
+	p.Status = "refunded"
+	f.reasons[paymentID] = reason
+	return p, nil
+}
+
+// statusService overrides the status reported by the mock payment service.
+type statusService struct {
+	*payment.MockService
+	status string
+	amount int64
+	err    error
+}
+
+func (s *statusService) GetStatus(ctx context.Context, payToken string) (*payment.StatusResponse, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &payment.StatusResponse{PayToken: payToken, Status: s.status, Amount: s.amount}, nil
+}
+
+// newPaidPayment creates and executes a payment on the mock service.
+func newPaidPayment(t *testing.T, svc *payment.MockService, id, amount int64) *store.Payment {
+	t.Helper()
+	ctx := context.Background()
+	created, err := svc.CreatePayment(ctx, payment.CreateRequest{OrderNo: "ORDER", Amount: amount})
+	if err != nil {
+		t.Fatalf("create payment: %v", err)
+	}
+	if _, err := svc.ExecutePayment(ctx, created.PayToken); err != nil {
+		t.Fatalf("execute payment: %v", err)
+	}
+	return &store.Payment{ID: id, PayToken: created.PayToken, Amount: amount, Status: "created"}
+}
+
+func TestReconciler_Sync(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Paid at provider completes payment", func(t *testing.T) {
+		svc := payment.NewMockServiceWithDelay(0)
+		p := newPaidPayment(t, svc, 1, 10000)
+		fs := newFakeStore(p)
+		r := &Reconciler{Store: fs, Payments: svc}
+
+		outcome, err := r.Sync(ctx, p)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if outcome != payment.OutcomePaid || fs.payments[1].Status != "done" {
+			t.Errorf("expected paid/done, got %s/%s", outcome, fs.payments[1].Status)
+		}
+	})
+
+	t.Run("Repeated sync is idempotent", func(t *testing.T) {
+		svc := payment.NewMockServiceWithDelay(0)
+		p := newPaidPayment(t, svc, 1, 10000)
+		fs := newFakeStore(p)
+		r := &Reconciler{Store: fs, Payments: svc}
+
+		stale := *p // a second caller that read the payment before the first finished
+		if _, err := r.Sync(ctx, p); err != nil {
+			t.Fatalf("first sync: %v", err)
+		}
+		outcome, err := r.Sync(ctx, &stale)
+		if err != nil {
+			t.Fatalf("second sync: %v", err)
+		}
+		if outcome != payment.OutcomePaid {
+			t.Errorf("expected paid, got %s", outcome)
+		}
+		if fs.executed != 1 {
+			t.Errorf("expected exactly one execution, got %d", fs.executed)
+		}
+	})
+
+	t.Run("Payment that cannot start a participation is refunded", func(t *testing.T) {
+		svc := payment.NewMockServiceWithDelay(0)
+		p := newPaidPayment(t, svc, 1, 10000)
+		fs := newFakeStore(p)
+		fs.joined = true
+		r := &Reconciler{Store: fs, Payments: svc}
+
+		outcome, err := r.Sync(ctx, p)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if outcome != OutcomeRefunded || fs.payments[1].Status != "refunded" {
+			t.Errorf("expected refunded/refunded, got %s/%s", outcome, fs.payments[1].Status)
+		}
+		if st, _ := svc.GetStatus(ctx, p.PayToken); st.Status != payment.StatusRefunded {
+			t.Errorf("expected provider refund, got %s", st.Status)
+		}
+	})
+
+	t.Run("Pending checkout is left alone", func(t *testing.T) {
+		svc := payment.NewMockServiceWithDelay(0)
+		created, _ := svc.CreatePayment(ctx, payment.CreateRequest{OrderNo: "ORDER", Amount: 10000})
+		p := &store.Payment{ID: 2, PayToken: created.PayToken, Amount: 10000, Status: "created"}
+		fs := newFakeStore(p)
+		r := &Reconciler{Store: fs, Payments: svc}
+
+		outcome, err := r.Sync(ctx, p)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if outcome != payment.OutcomePending || fs.payments[2].Status != "created" {
+			t.Errorf("expected pending/created, got %s/%s", outcome, fs.payments[2].Status)
+		}
+	})
+
+	t.Run("Approved payment is executed first", func(t *testing.T) {
+		mock := payment.NewMockServiceWithDelay(0)
+		created, _ := mock.CreatePayment(ctx, payment.CreateRequest{OrderNo: "ORDER", Amount: 10000})
+		p := &store.Payment{ID: 3, PayToken: created.PayToken, Amount: 10000, Status: "created"}
+		fs := newFakeStore(p)
+		r := &Reconciler{Store: fs, Payments: &statusService{MockService: mock, status: "PAY_APPROVED", amount: 10000}}
+
+		outcome, err := r.Sync(ctx, p)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if outcome != payment.OutcomePaid || fs.txIDs[3] == "" {
+			t.Errorf("expected payment executed at provider, got outcome=%s txID=%q", outcome, fs.txIDs[3])
+		}
+	})
+
+	t.Run("Amount mismatch is not completed", func(t *testing.T) {
+		p := &store.Payment{ID: 4, PayToken: "tok", Amount: 10000, Status: "created"}
+		fs := newFakeStore(p)
+		r := &Reconciler{Store: fs, Payments: &statusService{MockService: payment.NewMockServiceWithDelay(0), status: "PAY_COMPLETE", amount: 100}}
+
+		_, err := r.Sync(ctx, p)
+		if !errors.Is(err, ErrAmountMismatch) {
+			t.Fatalf("expected ErrAmountMismatch, got %v", err)
+		}
+		if fs.payments[4].Status != "created" {
+			t.Errorf("expected payment to stay created, got %s", fs.payments[4].Status)
+		}
+	})
+
+	t.Run("Already done and closed payments", func(t *testing.T) {
+		r := &Reconciler{Store: newFakeStore(), Payments: payment.NewMockServiceWithDelay(0)}
+
+		if outcome, err := r.Sync(ctx, &store.Payment{ID: 5, Status: "done"}); err != nil || outcome != payment.OutcomePaid {
+			t.Errorf("expected done payment to be paid, got %s (%v)", outcome, err)
+		}
+		if _, err := r.Sync(ctx, &store.Payment{ID: 6, Status: "refunded", PayToken: "tok"}); err == nil {
+			t.Error("expected error for refunded payment")
+		}
+		if _, err := r.Sync(ctx, &store.Payment{ID: 7, Status: "created"}); err == nil {
+			t.Error("expected error for payment without pay token")
+		}
+	})
+}
+
+func TestReconciler_Run(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	svc := payment.NewMockServiceWithDelay(0)
+	paid := newPaidPayment(t, svc, 1, 10000)
+	paid.CreatedAt = now.Add(-time.Hour)
+
+	pendingToken, _ := svc.CreatePayment(ctx, payment.CreateRequest{OrderNo: "ORDER-2", Amount: 10000})
+	pending := &store.Payment{ID: 2, PayToken: pendingToken.PayToken, Amount: 10000, Status: "created", CreatedAt: now.Add(-time.Hour)}
+
+	abandonedToken, _ := svc.CreatePayment(ctx, payment.CreateRequest{OrderNo: "ORDER-3", Amount: 10000})
+	abandoned := &store.Payment{ID: 3, PayToken: abandonedToken.PayToken, Amount: 10000, Status: "created", CreatedAt: now.Add(-48 * time.Hour)}
+
+	refundedPaid := newPaidPayment(t, svc, 4, 10000)
+	if _, err := svc.CancelPayment(ctx, refundedPaid.PayToken, 10000, ""); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	refundedPaid.CreatedAt = now.Add(-time.Hour)
+
+	unknown := &store.Payment{ID: 5, PayToken: "mock_pt_unknown", Amount: 10000, Status: "created", CreatedAt: now.Add(-48 * time.Hour)}
+	fresh := newPaidPayment(t, svc, 6, 10000)
+	fresh.CreatedAt = now
+
+	// Cancel requests interrupted after claiming the payment
+	cancelledAtPG := newPaidPayment(t, svc, 7, 10000)
+	if _, err := svc.CancelPayment(ctx, cancelledAtPG.PayToken, 10000, ""); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	cancelledAtPG.Status = "cancelling"
+	stillPaid := newPaidPayment(t, svc, 8, 10000)
+	stillPaid.Status = "cancelling"
+	inFlight := newPaidPayment(t, svc, 9, 10000)
+	inFlight.Status = "cancelling"
+
+	fs := newFakeStore(paid, pending, abandoned, refundedPaid, unknown, fresh, cancelledAtPG, stillPaid, inFlight)
+	fs.claimedAt[7], fs.claimedAt[8], fs.claimedAt[9] = now.Add(-time.Hour), now.Add(-time.Hour), now
+	r := &Reconciler{Store: fs, Payments: svc}
+
+	result, err := r.Run(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Processed != 7 || result.Failed != 0 {
+		t.Errorf("expected processed=7 failed=0, got processed=%d failed=%d (%v)", result.Processed, result.Failed, result.Errors)
+	}
+
+	want := map[int64]string{1: "done", 2: "created", 3: "expired", 4: "failed", 5: "expired", 6: "created",
+		7: "refunded", 8: "done", 9: "cancelling"}
+	for id, status := range want {
+		if got := fs.payments[id].Status; got != status {
+			t.Errorf("payment %d: expected %s, got %s", id, status, got)
+		}
+	}
+	if fs.reasons[3] == "" {
+		t.Error("expected a close reason for the expired payment")
+	}
+}
+
+func TestReconciler_RunReportsErrors(t *testing.T) {
+	ctx := context.Background()
+	p := &store.Payment{ID: 1, PayToken: "tok", Amount: 10000, Status: "created", CreatedAt: time.Now().Add(-time.Hour)}
+	fs := newFakeStore(p)
+	r := &Reconciler{Store: fs, Payments: &statusService{MockService: payment.NewMockServiceWithDelay(0), status: "PAY_COMPLETE", amount: 5000}}
+
+	result, err := r.Run(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Failed != 1 || len(result.Errors) != 1 {
+		t.Errorf("expected one failure, got failed=%d errors=%v", result.Failed, result.Errors)
+	}
+	if fs.payments[1].Status != "created" {
+		t.Errorf("expected mismatched payment to stay created, got %s", fs.payments[1].Status)
+	}
+
+	if _, err := (&Reconciler{Store: fs}).Run(ctx); err == nil {
+		t.Error("expected error without payment service")
+	}
+}
+
+func TestCompleteCancel(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Refunded at provider is recorded", func(t *testing.T) {
+		svc := payment.NewMockServiceWithDelay(0)
+		p := newPaidPayment(t, svc, 1, 10000)
+		p.Status = "cancelling"
+		if _, err := svc.CancelPayment(ctx, p.PayToken, 10000, ""); err != nil {
+			t.Fatalf("cancel: %v", err)
+		}
+		fs := newFakeStore(p)
+
+		refunded, err := CompleteCancel(ctx, fs, svc, p, "사용자 요청")
+		if err != nil || refunded == nil || refunded.Status != "refunded" {
+			t.Fatalf("expected refund to be recorded, got %+v (%v)", refunded, err)
+		}
+		if fs.reasons[1] != "사용자 요청" {
+			t.Errorf("expected refund reason to be kept, got %q", fs.reasons[1])
+		}
+	})
+
+	t.Run("Still paid at provider is released", func(t *testing.T) {
+		svc := payment.NewMockServiceWithDelay(0)
+		p := newPaidPayment(t, svc, 1, 10000)
+		p.Status = "cancelling"
+		fs := newFakeStore(p)
+
+		refunded, err := CompleteCancel(ctx, fs, svc, p, "사용자 요청")
+		if err != nil || refunded != nil {
+			t.Fatalf("expected release, got %+v (%v)", refunded, err)
+		}
+		if fs.payments[1].Status != "done" {
+			t.Errorf("expected payment back to done, got %s", fs.payments[1].Status)
+		}
+	})
+
+	t.Run("Unknown provider status keeps the claim", func(t *testing.T) {
+		p := &store.Payment{ID: 1, PayToken: "tok", Amount: 10000, Status: "cancelling"}
+		fs := newFakeStore(p)
+		svc := &statusService{MockService: payment.NewMockServiceWithDelay(0), err: errors.New("timeout")}
+
+		if _, err := CompleteCancel(ctx, fs, svc, p, "사용자 요청"); err == nil {
+			t.Fatal("expected error when the provider status is unknown")
+		}
+		if fs.payments[1].Status != "cancelling" {
+			t.Errorf("expected payment to stay cancelling, got %s", fs.payments[1].Status)
+		}
+	})
+}
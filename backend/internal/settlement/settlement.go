@@ -0,0 +1,161 @@
+// Package settlement distributes the bonus pool of each finished challenge cohort.
+//
+// A cohort is every participation of the same challenge with the same start_date.
+// Deposits forfeited by failed participants (and the unrefunded part of partial
+// successes), minus the platform fee, are split among the successful participants
+// pro-rata to their refund weighted by the tier's reward multiplier, and stored as
+// reward_amount on top of the refund.
+package settlement
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"habitcashback/internal/store"
+)
+
+// Defaults for Run.
+const (
+	DefaultBatchSize = 50
+	DefaultFeeBps    = 1000 // 10% of forfeited deposits
+	MaxFeeBps        = store.MultiplierOne
+)
+
+// Store is the subset of store.Store used for reward distribution.
+type Store interface {
+	ListPendingCohorts(ctx context.Context, limit int) ([]store.CohortKey, error)
+	ListCohortMembers(ctx context.Context, key store.CohortKey) ([]store.CohortMember, error)
+	ApplyCohortRewards(ctx context.Context, key store.CohortKey, pool store.CohortPool, members []store.CohortMember, rewards map[int64]int64) error
+}
+
+// Distribute computes the cohort pool and each successful member's reward.
+//
+// The platform fee is rounded down, so any fraction stays in the pool. Shares are
+// rounded down too and the remaining won are handed out one at a time by largest remainder
+// (ties to the lower settlement id), so the rewards always sum to exactly
+// forfeited - fee and never more. Without successful members nothing is distributed.
+func Distribute(members []store.CohortMember, feeBps int) (store.CohortPool, map[int64]int64) {
+	if feeBps < 0 {
+		feeBps = 0
+	}
+	if feeBps > MaxFeeBps {
+		feeBps = MaxFeeBps
+	}
+
+	pool := store.CohortPool{FeeBps: feeBps}
+	var winners []store.CohortMember
+	for _, m := range members {
+		switch m.Status {
+		case "success":
+			pool.SuccessCount++
+			pool.Forfeited += max(m.DepositAmount-m.RefundAmount, 0)
+			if m.RefundAmount > 0 {
+				winners = append(winners, m)
+			}
+		case "failed":
+			pool.FailedCount++
+			pool.Forfeited += m.DepositAmount
+		}
+	}
+	pool.FeeAmount = pool.Forfeited * int64(feeBps) / store.MultiplierOne
+
+	rewards := make(map[int64]int64, len(winners))
+	for _, w := range winners {
+		rewards[w.SettlementID] = 0
+	}
+	distributable := pool.Forfeited - pool.FeeAmount
+	if distributable <= 0 || len(winners) == 0 {
+		return pool, rewards
+	}
+
+	// weight = refund * multiplier, so a partial success gets a partial share; products can exceed int64 for large cohorts, so use big.Int
+	weights := make([]*big.Int, len(winners))
+	total := new(big.Int)
+	for i, w := range winners {
+		bps := w.RewardMultiplierBps
+		if bps <= 0 {
+			bps = store.MultiplierOne
+		}
+		weights[i] = new(big.Int).Mul(big.NewInt(w.RefundAmount), big.NewInt(int64(bps)))
+		total.Add(total, weights[i])
+	}
+	if total.Sign() <= 0 {
+		return pool, rewards
+	}
+
+	type share struct {
+		id  int64
+		rem *big.Int
+	}
+	shares := make([]share, len(winners))
+	d := big.NewInt(distributable)
+	var assigned int64
+	for i, w := range winners {
+		q, r := new(big.Int).QuoRem(new(big.Int).Mul(d, weights[i]), total, new(big.Int))
+		rewards[w.SettlementID] = q.Int64()
+		assigned += q.Int64()
+		shares[i] = share{id: w.SettlementID, rem: r}
+	}
+	sort.Slice(shares, func(i, j int) bool {
+		if c := shares[i].rem.Cmp(shares[j].rem); c != 0 {
+			return c > 0
+		}
+		return shares[i].id < shares[j].id
+	})
+	for i := 0; assigned < distributable; i++ {
+		rewards[shares[i%len(shares)].id]++
+		assigned++
+	}
+	pool.Distributed = assigned
+	return pool, rewards
+}
+
+// Engine computes rewards for cohorts whose settlements are all decided.
+type Engine struct {
+	Store     Store
+	FeeBps    int
+	BatchSize int
+}
+
+// Run distributes the pool of up to BatchSize pending cohorts. Per-cohort errors are
+// recorded in the result and the cohort is retried next run; only listing errors abort.
+func (e *Engine) Run(ctx context.Context) (*store.BatchResult, error) {
+	if e.FeeBps < 0 || e.FeeBps > MaxFeeBps {
+		return nil, fmt.Errorf("invalid fee %d bps", e.FeeBps)
+	}
+	limit := e.BatchSize
+	if limit <= 0 {
+		limit = DefaultBatchSize
+	}
+
+	cohorts, err := e.Store.ListPendingCohorts(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &store.BatchResult{Errors: []string{}}
+	for _, key := range cohorts {
+		if err := e.distributeOne(ctx, key); err != nil {
+			result.Failed++
+			result.Errors = append(result.Errors, fmt.Sprintf("cohort %s/%s: %v", key.ChallengeID, key.StartDate.Format("2006-01-02"), err))
+			continue
+		}
+		result.Processed++
+	}
+	return result, nil
+}
+
+func (e *Engine) distributeOne(ctx context.Context, key store.CohortKey) error {
+	members, err := e.Store.ListCohortMembers(ctx, key)
+	if err != nil {
+		return err
+	}
+	if len(members) == 0 {
+		return errors.New("no pending members")
+	}
+	pool, rewards := Distribute(members, e.FeeBps)
+	return e.Store.ApplyCohortRewards(ctx, key, pool, members, rewards)
+}
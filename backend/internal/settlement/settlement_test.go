@@ -0,0 +1,213 @@
+package settlement
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"habitcashback/internal/store"
+)
+
+func member(id int64, status string, deposit int64, bps int) store.CohortMember {
+	m := store.CohortMember{SettlementID: id, Status: status, DepositAmount: deposit, RewardMultiplierBps: bps}
+	if status == "success" {
+		m.RefundAmount = deposit
+	}
+	return m
+}
+
+func sum(rewards map[int64]int64) int64 {
+	var n int64
+	for _, v := range rewards {
+		n += v
+	}
+	return n
+}
+
+func TestDistribute_ProRata(t *testing.T) {
+	members := []store.CohortMember{
+		member(1, "success", 10000, 10000),
+		member(2, "success", 30000, 10000),
+		member(3, "failed", 10000, 10000),
+		member(4, "failed", 30000, 10000),
+	}
+	pool, rewards := Distribute(members, 1000)
+
+	if pool.Forfeited != 40000 || pool.FeeAmount != 4000 || pool.Distributed != 36000 {
+		t.Fatalf("pool = %+v", pool)
+	}
+	if pool.SuccessCount != 2 || pool.FailedCount != 2 {
+		t.Errorf("counts = %d/%d", pool.SuccessCount, pool.FailedCount)
+	}
+	if rewards[1] != 9000 || rewards[2] != 27000 {
+		t.Errorf("rewards = %v", rewards)
+	}
+	if _, ok := rewards[3]; ok {
+		t.Error("failed member must not get a reward")
+	}
+}
+
+func TestDistribute_MultiplierWeight(t *testing.T) {
+	members := []store.CohortMember{
+		member(1, "success", 10000, 10000),
+		member(2, "success", 10000, 20000),
+		member(3, "failed", 30000, 10000),
+	}
+	_, rewards := Distribute(members, 0)
+	if rewards[1] != 10000 || rewards[2] != 20000 {
+		t.Errorf("rewards = %v", rewards)
+	}
+}
+
+func TestDistribute_PartialSuccess(t *testing.T) {
+	partial := member(2, "success", 30000, 10000)
+	partial.RefundAmount = 20000 // 2 of 3 days
+	members := []store.CohortMember{
+		member(1, "success", 10000, 10000),
+		partial,
+		member(3, "failed", 20000, 10000),
+	}
+	pool, rewards := Distribute(members, 0)
+	if pool.Forfeited != 30000 || pool.SuccessCount != 2 || pool.FailedCount != 1 {
+		t.Fatalf("pool = %+v", pool)
+	}
+	// weights are the refunds: 10000 and 20000
+	if rewards[1] != 10000 || rewards[2] != 20000 {
+		t.Errorf("rewards = %v", rewards)
+	}
+}
+
+func TestDistribute_RoundingNeverExceedsPool(t *testing.T) {
+	members := []store.CohortMember{
+		member(5, "success", 10000, 10000),
+		member(2, "success", 10000, 10000),
+		member(9, "success", 10000, 10000),
+		member(1, "failed", 1000, 10000),
+	}
+	pool, rewards := Distribute(members, 333) // fee 33.3 -> 33, pool 967 over three
+	if pool.FeeAmount != 33 || pool.Distributed != 967 {
+		t.Fatalf("pool = %+v", pool)
+	}
+	if sum(rewards) != pool.Distributed {
+		t.Errorf("sum = %d, want %d", sum(rewards), pool.Distributed)
+	}
+	// 967 = 322*3 + 1: the extra won goes to the lowest settlement id on a tie
+	if rewards[2] != 323 || rewards[5] != 322 || rewards[9] != 322 {
+		t.Errorf("rewards = %v", rewards)
+	}
+
+	for fee := 0; fee <= MaxFeeBps; fee += 777 {
+		members := []store.CohortMember{
+			member(1, "success", 7000, 13333),
+			member(2, "success", 3000, 10000),
+			member(3, "success", 11000, 19999),
+			member(4, "failed", 9000, 10000),
+			member(5, "failed", 4000, 15000),
+		}
+		pool, rewards := Distribute(members, fee)
+		if got := sum(rewards); got != pool.Distributed || got > pool.Forfeited-pool.FeeAmount {
+			t.Errorf("fee %d: distributed %d of %d (fee %d)", fee, got, pool.Forfeited, pool.FeeAmount)
+		}
+	}
+}
+
+func TestDistribute_NoWinnersOrLosers(t *testing.T) {
+	pool, rewards := Distribute([]store.CohortMember{member(1, "failed", 10000, 10000)}, 1000)
+	if pool.Distributed != 0 || len(rewards) != 0 || pool.Forfeited != 10000 {
+		t.Errorf("all failed: pool = %+v rewards = %v", pool, rewards)
+	}
+
+	pool, rewards = Distribute([]store.CohortMember{member(1, "success", 10000, 10000)}, 1000)
+	if pool.Distributed != 0 || rewards[1] != 0 {
+		t.Errorf("all success: pool = %+v rewards = %v", pool, rewards)
+	}
+}
+
+func TestDistribute_LargeCohortNoOverflow(t *testing.T) {
+	var members []store.CohortMember
+	for i := int64(1); i <= 20000; i++ {
+		status := "success"
+		if i%2 == 0 {
+			status = "failed"
+		}
+		members = append(members, member(i, status, 100000, 20000))
+	}
+	pool, rewards := Distribute(members, 1000)
+	if pool.Forfeited != 10000*100000 || sum(rewards) != pool.Distributed || pool.Distributed != 900000000 {
+		t.Fatalf("pool = %+v sum = %d", pool, sum(rewards))
+	}
+	if rewards[1] != 90000 {
+		t.Errorf("reward = %d, want 90000", rewards[1])
+	}
+}
+
+// fakeStore is an in-memory Store keyed by cohort
+type fakeStore struct {
+	cohorts map[store.CohortKey][]store.CohortMember
+	pools   map[store.CohortKey]store.CohortPool
+	rewards map[int64]int64
+	failFor string
+}
+
+func (f *fakeStore) ListPendingCohorts(ctx context.Context, limit int) ([]store.CohortKey, error) {
+	var list []store.CohortKey
+	for k := range f.cohorts {
+		if _, done := f.pools[k]; !done && len(list) < limit {
+			list = append(list, k)
+		}
+	}
+	return list, nil
+}
+
+func (f *fakeStore) ListCohortMembers(ctx context.Context, key store.CohortKey) ([]store.CohortMember, error) {
+	return f.cohorts[key], nil
+}
+
+func (f *fakeStore) ApplyCohortRewards(ctx context.Context, key store.CohortKey, pool store.CohortPool, members []store.CohortMember, rewards map[int64]int64) error {
+	if key.ChallengeID == f.failFor {
+		return errors.New("boom")
+	}
+	f.pools[key] = pool
+	for id, r := range rewards {
+		f.rewards[id] = r
+	}
+	return nil
+}
+
+func TestEngineRun(t *testing.T) {
+	start := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	a := store.CohortKey{ChallengeID: "walk", StartDate: start}
+	b := store.CohortKey{ChallengeID: "walk", StartDate: start.AddDate(0, 0, 1)}
+	c := store.CohortKey{ChallengeID: "broken", StartDate: start}
+	f := &fakeStore{
+		cohorts: map[store.CohortKey][]store.CohortMember{
+			a: {member(1, "success", 10000, 10000), member(2, "failed", 10000, 10000)},
+			b: {member(3, "success", 10000, 10000)},
+			c: {member(4, "failed", 10000, 10000)},
+		},
+		pools:   map[store.CohortKey]store.CohortPool{},
+		rewards: map[int64]int64{},
+		failFor: "broken",
+	}
+
+	e := &Engine{Store: f, FeeBps: 2000}
+	result, err := e.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Processed != 2 || result.Failed != 1 {
+		t.Errorf("result = %+v", result)
+	}
+	if f.rewards[1] != 8000 || f.rewards[3] != 0 {
+		t.Errorf("rewards = %v", f.rewards)
+	}
+	// cohorts are not recomputed once stored
+	if result, _ := e.Run(context.Background()); result.Processed != 0 {
+		t.Errorf("second run processed %d", result.Processed)
+	}
+
+	if _, err := (&Engine{Store: f, FeeBps: -1}).Run(context.Background()); err == nil {
+		t.Error("expected error for negative fee")
+	}
+}
@@ -0,0 +1,422 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ============ Proof Appeal Operations ============
+
+// Appeal statuses
+const (
+	AppealPending  = "pending"
+	AppealAccepted = "accepted"
+	AppealRejected = "rejected"
+)
+
+// AppealWindowDays is how long after a participation ends its days can still be appealed
+const AppealWindowDays = 7
+
+var (
+	ErrAppealNoParticipation = errors.New("no participation covers the appealed day")
+	ErrAppealDayCounted      = errors.New("appealed day is already counted or waiting for review")
+	ErrAppealDayOpen         = errors.New("appealed day can still be proven")
+	ErrAppealExpired         = errors.New("appeal window has passed")
+	ErrAppealExists          = errors.New("day has already been appealed")
+	ErrAppealNotPending      = errors.New("appeal is not pending review")
+)
+
+// Settlement outcomes of an accepted appeal (AppealDecision.Settlement)
+const (
+	SettlementOpen       = "open"             // participation still running; closing will count the day
+	SettlementPending    = "pending"          // settlement not decided yet; update-settlements applies the new outcome
+	SettlementRecompute  = "cohort_recompute" // settlement re-decided and the cohort's rewards recomputed
+	SettlementCohortPaid = "cohort_paid_out"  // the cohort's pool was already paid out; the settlement needs manual adjustment
+	SettlementPaidOut    = "payout_issued"    // already paid out; the settlement needs manual adjustment
+)
+
+type Appeal struct {
+	ID              int64
+	ParticipationID int64
+	UserID          int64
+	ChallengeID     string
+	ProofDate       time.Time
+	ProofID         int64 // rejected proof being contested; 0 for a day without a proof
+	Note            string
+	ImageHash       string // extra image submitted with the appeal
+	ImageURL        string // stored extra image; empty if none, not stored or purged
+	Status          string
+	DecisionReason  string
+	ReviewedBy      string
+	DecidedAt       *time.Time
+	CreatedAt       time.Time
+}
+
+const appealColumns = `a.id, a.participation_id, a.user_id, a.challenge_id, a.proof_date, COALESCE(a.proof_id, 0), a.note, COALESCE(a.image_hash, ''),
+	COALESCE(a.image_url, ''), a.status, COALESCE(a.decision_reason, ''), COALESCE(a.reviewed_by, ''), a.decided_at, a.created_at`
+
+func scanAppeal(row pgx.Row, a *Appeal) error {
+	return row.Scan(appealDest(a)...)
+}
+
+// appealDest returns the scan destinations for appealColumns
+func appealDest(a *Appeal) []any {
+	return []any{&a.ID, &a.ParticipationID, &a.UserID, &a.ChallengeID, &a.ProofDate, &a.ProofID, &a.Note, &a.ImageHash,
+		&a.ImageURL, &a.Status, &a.DecisionReason, &a.ReviewedBy, &a.DecidedAt, &a.CreatedAt}
+}
+
+// AppealSubmission is a user's request to count a rejected or missed day
+type AppealSubmission struct {
+	UserID      int64
+	ChallengeID string
+	ProofDate   time.Time
+	Note        string
+	ImageHash   string // optional extra image
+	ImageURL    string // stored extra image
+}
+
+// CreateAppeal records an appeal for a day of the user's participation covering
+// sub.ProofDate. The day must have a rejected proof, or no proof and be over; each day
+// can be appealed once, up to AppealWindowDays after the participation ends.
+func (s *Store) CreateAppeal(ctx context.Context, sub AppealSubmission) (*Appeal, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	const partQ = `
+		SELECT id, end_date FROM participation
+		WHERE user_id = $1 AND challenge_id = $2 AND status IN ('active', 'success', 'failed')
+		AND start_date <= $3 AND end_date >= $3
+		ORDER BY id DESC
+		LIMIT 1
+	`
+	var partID int64
+	var endDate time.Time
+	err = tx.QueryRow(ctx, partQ, sub.UserID, sub.ChallengeID, sub.ProofDate).Scan(&partID, &endDate)
+	if err == pgx.ErrNoRows {
+		return nil, ErrAppealNoParticipation
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find participation: %w", err)
+	}
+	today := s.today()
+	if today.After(endDate.AddDate(0, 0, AppealWindowDays)) {
+		return nil, ErrAppealExpired
+	}
+
+	var proofID int64
+	var proofStatus string
+	err = tx.QueryRow(ctx, `SELECT id, status FROM proof WHERE participation_id = $1 AND proof_date = $2`, partID, sub.ProofDate).
+		Scan(&proofID, &proofStatus)
+	switch {
+	case err == pgx.ErrNoRows:
+		if !sub.ProofDate.Before(today) {
+			return nil, ErrAppealDayOpen
+		}
+	case err != nil:
+		return nil, fmt.Errorf("get proof: %w", err)
+	case proofStatus != ProofRejected:
+		return nil, ErrAppealDayCounted
+	}
+
+	const q = `
+		INSERT INTO proof_appeal AS a (participation_id, user_id, challenge_id, proof_date, proof_id, note, image_hash, image_url)
+		VALUES ($1, $2, $3, $4, NULLIF($5, 0), $6, NULLIF($7, ''), NULLIF($8, ''))
+		ON CONFLICT (participation_id, proof_date) DO NOTHING
+		RETURNING ` + appealColumns
+	var a Appeal
+	err = scanAppeal(tx.QueryRow(ctx, q, partID, sub.UserID, sub.ChallengeID, sub.ProofDate, proofID, sub.Note, sub.ImageHash, sub.ImageURL), &a)
+	if err == pgx.ErrNoRows {
+		return nil, ErrAppealExists
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create appeal: %w", err)
+	}
+	details := map[string]any{
+		"appealId":        a.ID,
+		"participationId": partID,
+		"challengeId":     a.ChallengeID,
+		"proofDate":       a.ProofDate.Format("2006-01-02"),
+		"proofId":         a.ProofID,
+	}
+	if err := insertAudit(ctx, tx, ActorUser, "appeal.create", a.UserID, details); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return &a, nil
+}
+
+// ListAppealsByUser returns a user's appeals, newest first
+func (s *Store) ListAppealsByUser(ctx context.Context, userID int64, limit int) ([]Appeal, error) {
+	const q = `SELECT ` + appealColumns + ` FROM proof_appeal a WHERE a.user_id = $1 ORDER BY a.created_at DESC, a.id DESC LIMIT $2`
+	rows, err := s.pool.Query(ctx, q, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list appeals: %w", err)
+	}
+	defer rows.Close()
+
+	var list []Appeal
+	for rows.Next() {
+		var a Appeal
+		if err := scanAppeal(rows, &a); err != nil {
+			return nil, fmt.Errorf("scan appeal: %w", err)
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
+
+// PendingAppeal is an appeal in the review queue with the context a reviewer needs
+type PendingAppeal struct {
+	Appeal
+	RejectReason        string // why the contested proof was rejected; empty for a missed day
+	ProofImageURL       string // the contested proof's stored photo
+	ChallengeTitle      string
+	ParticipationStatus string
+	StartDate           time.Time
+	EndDate             time.Time
+	ProofCount          int
+	RequiredProofs      int
+}
+
+// ListPendingAppeals returns appeals waiting for review, oldest first, after the given appeal id
+func (s *Store) ListPendingAppeals(ctx context.Context, afterID int64, limit int) ([]PendingAppeal, error) {
+	const q = `
+		SELECT ` + appealColumns + `, COALESCE(pr.reject_reason, ''), COALESCE(pr.image_url, ''),
+		       c.title, p.status, p.start_date, p.end_date, p.proof_count, COALESCE(NULLIF(p.required_proofs, 0), c.days)
+		FROM proof_appeal a
+		JOIN participation p ON p.id = a.participation_id
+		JOIN challenge c ON c.id = a.challenge_id
+		LEFT JOIN proof pr ON pr.id = a.proof_id
+		WHERE a.status = 'pending' AND a.id > $1
+		ORDER BY a.id
+		LIMIT $2
+	`
+	rows, err := s.pool.Query(ctx, q, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list pending appeals: %w", err)
+	}
+	defer rows.Close()
+
+	var list []PendingAppeal
+	for rows.Next() {
+		var pa PendingAppeal
+		dest := append(appealDest(&pa.Appeal), &pa.RejectReason, &pa.ProofImageURL,
+			&pa.ChallengeTitle, &pa.ParticipationStatus, &pa.StartDate, &pa.EndDate, &pa.ProofCount, &pa.RequiredProofs)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("scan pending appeal: %w", err)
+		}
+		list = append(list, pa)
+	}
+	return list, rows.Err()
+}
+
+// AppealDecision is the result of reviewing an appeal
+type AppealDecision struct {
+	Appeal              Appeal
+	ParticipationStatus string // after the decision
+	Settlement          string // SettlementXxx outcome of an accepted appeal
+}
+
+// ReviewAppeal accepts or rejects a pending appeal and records the decision in the audit log.
+// Accepting counts the day as an accepted proof and, if the participation has already
+// closed, re-decides it and its settlement (see redecideParticipation).
+// Returns nil if the appeal does not exist and ErrAppealNotPending if it was already decided.
+func (s *Store) ReviewAppeal(ctx context.Context, appealID int64, accept bool, reason, actor string) (*AppealDecision, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var a Appeal
+	err = scanAppeal(tx.QueryRow(ctx, `SELECT `+appealColumns+` FROM proof_appeal a WHERE a.id = $1 FOR UPDATE`, appealID), &a)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get appeal: %w", err)
+	}
+	if a.Status != AppealPending {
+		return nil, ErrAppealNotPending
+	}
+
+	now := s.now()
+	out := &AppealDecision{}
+	status, action := AppealRejected, "appeal.reject"
+	proofID := a.ProofID
+	if accept {
+		status, action = AppealAccepted, "appeal.accept"
+		// Count the day: the contested proof becomes accepted, or a missed day gets one
+		const proofQ = `
+			INSERT INTO proof (participation_id, user_id, challenge_id, proof_date, proof_type, image_hash, image_url, status, reviewed_by, verified_at)
+			SELECT $1, $2, $3, $4, c.proof_type, NULLIF($5, ''), NULLIF($8, ''), 'accepted', $6, $7
+			FROM challenge c WHERE c.id = $3
+			ON CONFLICT (participation_id, proof_date) DO UPDATE SET
+				status = 'accepted',
+				reject_reason = NULL,
+				reviewed_by = EXCLUDED.reviewed_by,
+				verified_at = EXCLUDED.verified_at,
+				image_hash = COALESCE(proof.image_hash, EXCLUDED.image_hash),
+				image_url = COALESCE(proof.image_url, EXCLUDED.image_url)
+			RETURNING id
+		`
+		if err := tx.QueryRow(ctx, proofQ, a.ParticipationID, a.UserID, a.ChallengeID, a.ProofDate, a.ImageHash, actor, now, a.ImageURL).Scan(&proofID); err != nil {
+			return nil, fmt.Errorf("accept appealed day: %w", err)
+		}
+		if err := updateProofCount(ctx, tx, a.ParticipationID); err != nil {
+			return nil, err
+		}
+		if out.ParticipationStatus, out.Settlement, err = redecideParticipation(ctx, tx, a.ParticipationID); err != nil {
+			return nil, err
+		}
+	}
+
+	const q = `
+		UPDATE proof_appeal AS a SET status = $2, proof_id = NULLIF($3, 0), decision_reason = NULLIF($4, ''), reviewed_by = $5, decided_at = $6
+		WHERE a.id = $1
+		RETURNING ` + appealColumns
+	if err := scanAppeal(tx.QueryRow(ctx, q, appealID, status, proofID, reason, actor, now), &out.Appeal); err != nil {
+		return nil, fmt.Errorf("review appeal: %w", err)
+	}
+	details := map[string]any{
+		"appealId":        a.ID,
+		"participationId": a.ParticipationID,
+		"challengeId":     a.ChallengeID,
+		"proofDate":       a.ProofDate.Format("2006-01-02"),
+		"proofId":         proofID,
+		"reason":          reason,
+	}
+	if accept {
+		details["participationStatus"] = out.ParticipationStatus
+		details["settlement"] = out.Settlement
+	}
+	if err := insertAudit(ctx, tx, actor, action, a.UserID, details); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return out, nil
+}
+
+// redecideParticipation re-applies the success rule to a closed participation after its
+// proof count changed, and brings the settlement in line:
+//   - still running, or settlement not decided yet: nothing else to do (SettlementOpen/SettlementPending)
+//   - already paid out: left for manual adjustment (SettlementPaidOut)
+//   - someone else in the cohort already paid out: also left for manual adjustment
+//     (SettlementCohortPaid), since the deposit was counted as forfeited and distributed,
+//     and refunding it now would pay out more than the pool collected
+//   - otherwise the settlement takes the new outcome and the whole cohort's rewards are
+//     recomputed by distribute-rewards (SettlementRecompute).
+//
+// The cohort's settlements are locked first, so CreatePayout cannot pay a reward that is
+// being reset.
+func redecideParticipation(ctx context.Context, tx pgx.Tx, participationID int64) (string, string, error) {
+	const partQ = `
+		SELECT p.status, p.challenge_id, p.start_date, p.proof_count, COALESCE(NULLIF(p.required_proofs, 0), c.days),
+		       p.min_success_bps, p.rest_days, p.refund_policy
+		FROM participation p
+		JOIN challenge c ON p.challenge_id = c.id
+		WHERE p.id = $1
+		FOR UPDATE OF p
+	`
+	var status, challengeID string
+	var startDate time.Time
+	var proofCount int
+	var rule SuccessRule
+	err := tx.QueryRow(ctx, partQ, participationID).Scan(&status, &challengeID, &startDate, &proofCount, &rule.Required,
+		&rule.MinSuccessBps, &rule.RestDays, &rule.RefundPolicy)
+	if err != nil {
+		return "", "", fmt.Errorf("get participation: %w", err)
+	}
+	if status != "success" && status != "failed" {
+		return status, SettlementOpen, nil
+	}
+
+	ok, refundBps := rule.Evaluate(proofCount)
+	status = "failed"
+	if ok {
+		status = "success"
+	}
+	const updateQ = `UPDATE participation SET status = $1, refund_bps = $2, updated_at = NOW() WHERE id = $3`
+	if _, err := tx.Exec(ctx, updateQ, status, refundBps, participationID); err != nil {
+		return "", "", fmt.Errorf("update participation: %w", err)
+	}
+
+	var settlementID int64
+	var settlementStatus string
+	var paid bool
+	err = tx.QueryRow(ctx, `SELECT id, status, payout_id IS NOT NULL FROM settlement WHERE participation_id = $1 FOR UPDATE`, participationID).
+		Scan(&settlementID, &settlementStatus, &paid)
+	if err == pgx.ErrNoRows || (err == nil && settlementStatus == "running") {
+		return status, SettlementPending, nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("get settlement: %w", err)
+	}
+	if paid {
+		return status, SettlementPaidOut, nil
+	}
+
+	const cohortQ = `
+		SELECT s.payout_id IS NOT NULL
+		FROM settlement s
+		JOIN participation p ON p.id = s.participation_id
+		WHERE p.challenge_id = $1 AND p.start_date = $2
+		ORDER BY s.id
+		FOR UPDATE OF s
+	`
+	rows, err := tx.Query(ctx, cohortQ, challengeID, startDate)
+	if err != nil {
+		return "", "", fmt.Errorf("lock cohort settlements: %w", err)
+	}
+	var cohortPaid bool
+	for rows.Next() {
+		var memberPaid bool
+		if err := rows.Scan(&memberPaid); err != nil {
+			rows.Close()
+			return "", "", fmt.Errorf("scan cohort settlement: %w", err)
+		}
+		cohortPaid = cohortPaid || memberPaid
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", "", fmt.Errorf("lock cohort settlements: %w", err)
+	}
+	if cohortPaid {
+		return status, SettlementCohortPaid, nil
+	}
+
+	const settleQ = `
+		UPDATE settlement SET
+			status = $2,
+			refundable = ($2 = 'success'),
+			refund_amount = deposit_amount * $3 / $4,
+			updated_at = NOW()
+		WHERE id = $1 AND status IN ('success', 'failed')
+	`
+	if _, err := tx.Exec(ctx, settleQ, settlementID, status, refundBps, MultiplierOne); err != nil {
+		return "", "", fmt.Errorf("update settlement: %w", err)
+	}
+
+	// Nobody has been paid: forget the cohort's rewards so the pool is split again
+	const resetQ = `
+		UPDATE settlement s SET reward_amount = 0, reward_computed_at = NULL, updated_at = NOW()
+		FROM participation p
+		WHERE s.participation_id = p.id AND p.challenge_id = $1 AND p.start_date = $2
+		AND s.status IN ('success', 'failed') AND s.reward_computed_at IS NOT NULL
+	`
+	if _, err := tx.Exec(ctx, resetQ, challengeID, startDate); err != nil {
+		return "", "", fmt.Errorf("reset cohort rewards: %w", err)
+	}
+	return status, SettlementRecompute, nil
+}
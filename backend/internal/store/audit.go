@@ -0,0 +1,83 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ============ Audit Log Operations ============
+
+// Audit actors
+const (
+	ActorSystem = "system"
+	ActorToss   = "toss"
+	ActorUser   = "user" // the user the entry is about, acting on their own data
+)
+
+type AuditEntry struct {
+	ID        int64
+	Actor     string
+	Action    string
+	UserID    *int64
+	Details   json.RawMessage
+	CreatedAt time.Time
+}
+
+// execer is satisfied by both the pool and a transaction
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// RecordAudit appends an entry to the audit log. userID may be 0 for entries not tied to a user.
+func (s *Store) RecordAudit(ctx context.Context, actor, action string, userID int64, details any) error {
+	return insertAudit(ctx, s.pool, actor, action, userID, details)
+}
+
+func insertAudit(ctx context.Context, db execer, actor, action string, userID int64, details any) error {
+	raw := []byte("{}")
+	if details != nil {
+		b, err := json.Marshal(details)
+		if err != nil {
+			return fmt.Errorf("marshal audit details: %w", err)
+		}
+		raw = b
+	}
+	var uid *int64
+	if userID > 0 {
+		uid = &userID
+	}
+	const q = `INSERT INTO audit_log (actor, action, user_id, details) VALUES ($1, $2, $3, $4)`
+	if _, err := db.Exec(ctx, q, actor, action, uid, raw); err != nil {
+		return fmt.Errorf("insert audit: %w", err)
+	}
+	return nil
+}
+
+// ListAuditByUser returns the most recent audit entries for a user
+func (s *Store) ListAuditByUser(ctx context.Context, userID int64, limit int) ([]AuditEntry, error) {
+	const q = `
+		SELECT id, actor, action, user_id, details, created_at
+		FROM audit_log WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2
+	`
+	rows, err := s.pool.Query(ctx, q, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list audit: %w", err)
+	}
+	defer rows.Close()
+
+	var list []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.ID, &e.Actor, &e.Action, &e.UserID, &e.Details, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan audit: %w", err)
+		}
+		list = append(list, e)
+	}
+	return list, rows.Err()
+}
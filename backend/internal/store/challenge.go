@@ -0,0 +1,168 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ============ Challenge Admin Operations ============
+
+// ErrChallengeExists is returned when creating a challenge whose id is taken
+var ErrChallengeExists = errors.New("challenge already exists")
+
+// ListAllChallenges returns every challenge, including inactive and scheduled ones (admin)
+func (s *Store) ListAllChallenges(ctx context.Context) ([]Challenge, error) {
+	const q = `SELECT ` + challengeColumns + ` FROM challenge ORDER BY is_active DESC, id`
+	rows, err := s.pool.Query(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("list all challenges: %w", err)
+	}
+	defer rows.Close()
+
+	var list []Challenge
+	for rows.Next() {
+		var c Challenge
+		if err := scanChallenge(rows, &c); err != nil {
+			return nil, fmt.Errorf("scan challenge: %w", err)
+		}
+		list = append(list, c)
+	}
+	rows.Close()
+	if err := loadTiers(ctx, s.pool, list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// CreateChallenge inserts a new challenge with its tiers and records it in the audit log
+func (s *Store) CreateChallenge(ctx context.Context, c Challenge, actor string) (*Challenge, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	const q = `
+		INSERT INTO challenge (id, title, description, days, deposit, proof_type, is_active, starts_at, ends_at, updated_by,
+		                       min_success_bps, rest_days, refund_policy, proof_window_start, proof_window_end, missing_exif_policy)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		ON CONFLICT (id) DO NOTHING
+		RETURNING ` + challengeColumns
+	var out Challenge
+	err = scanChallenge(tx.QueryRow(ctx, q, c.ID, c.Title, c.Description, c.Days, c.Deposit, c.ProofType, c.IsActive, c.StartsAt, c.EndsAt, actor,
+		c.MinSuccessBps, c.RestDays, c.RefundPolicy, c.ProofWindowStart, c.ProofWindowEnd, c.MissingExifPolicy), &out)
+	if err == pgx.ErrNoRows {
+		return nil, ErrChallengeExists
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create challenge: %w", err)
+	}
+	if err := replaceTiers(ctx, tx, out.ID, c.Tiers); err != nil {
+		return nil, err
+	}
+	if err := loadChallengeTiers(ctx, tx, &out); err != nil {
+		return nil, err
+	}
+	if err := insertAudit(ctx, tx, actor, "challenge.create", 0, out); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return &out, nil
+}
+
+// UpdateChallenge replaces the editable fields of a challenge (including its schedule and tiers).
+// Returns nil if the challenge does not exist.
+func (s *Store) UpdateChallenge(ctx context.Context, c Challenge, actor string) (*Challenge, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var before Challenge
+	err = scanChallenge(tx.QueryRow(ctx, `SELECT `+challengeColumns+` FROM challenge WHERE id = $1 FOR UPDATE`, c.ID), &before)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get challenge: %w", err)
+	}
+	if err := loadChallengeTiers(ctx, tx, &before); err != nil {
+		return nil, err
+	}
+
+	const q = `
+		UPDATE challenge
+		SET title = $2, description = NULLIF($3, ''), days = $4, deposit = $5, proof_type = $6,
+		    starts_at = $7, ends_at = $8, updated_by = $9, updated_at = NOW(),
+		    min_success_bps = $10, rest_days = $11, refund_policy = $12,
+		    proof_window_start = $13, proof_window_end = $14, missing_exif_policy = $15
+		WHERE id = $1
+		RETURNING ` + challengeColumns
+	var out Challenge
+	err = scanChallenge(tx.QueryRow(ctx, q, c.ID, c.Title, c.Description, c.Days, c.Deposit, c.ProofType, c.StartsAt, c.EndsAt, actor,
+		c.MinSuccessBps, c.RestDays, c.RefundPolicy, c.ProofWindowStart, c.ProofWindowEnd, c.MissingExifPolicy), &out)
+	if err != nil {
+		return nil, fmt.Errorf("update challenge: %w", err)
+	}
+	if err := replaceTiers(ctx, tx, out.ID, c.Tiers); err != nil {
+		return nil, err
+	}
+	if err := loadChallengeTiers(ctx, tx, &out); err != nil {
+		return nil, err
+	}
+	if err := insertAudit(ctx, tx, actor, "challenge.update", 0, map[string]any{"before": before, "after": out}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return &out, nil
+}
+
+// SetChallengeActive activates or deactivates a challenge. Existing participations are
+// unaffected; a deactivated challenge just stops accepting new ones.
+// Returns nil if the challenge does not exist.
+func (s *Store) SetChallengeActive(ctx context.Context, id string, active bool, actor string) (*Challenge, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	const q = `
+		UPDATE challenge
+		SET is_active = $2,
+		    deactivated_at = CASE WHEN $2 THEN NULL ELSE COALESCE(deactivated_at, NOW()) END,
+		    updated_by = $3, updated_at = NOW()
+		WHERE id = $1
+		RETURNING ` + challengeColumns
+	var out Challenge
+	err = scanChallenge(tx.QueryRow(ctx, q, id, active, actor), &out)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("set challenge active: %w", err)
+	}
+	if err := loadChallengeTiers(ctx, tx, &out); err != nil {
+		return nil, err
+	}
+
+	action := "challenge.deactivate"
+	if active {
+		action = "challenge.activate"
+	}
+	if err := insertAudit(ctx, tx, actor, action, 0, map[string]any{"challengeId": id}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return &out, nil
+}
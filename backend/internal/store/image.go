@@ -0,0 +1,96 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ============ Proof Image Operations ============
+
+// ProofImage is a proof or appeal photo kept in the blob store
+type ProofImage struct {
+	Key        string // blob store key
+	URL        string // recorded in proof.image_url and proof_appeal.image_url
+	SizeBytes  int64
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+}
+
+// RecordProofImage registers an image uploaded under key, or marks an already stored one
+// as used again. It returns the image's URL as first recorded, which proofs and appeals
+// must reference so DeleteProofImage finds them.
+func (s *Store) RecordProofImage(ctx context.Context, key, url string, size int64) (string, error) {
+	const q = `
+		INSERT INTO proof_image (key, url, size_bytes, created_at, last_used_at)
+		VALUES ($1, $2, $3, $4, $4)
+		ON CONFLICT (key) DO UPDATE SET last_used_at = EXCLUDED.last_used_at
+		RETURNING url
+	`
+	var recorded string
+	if err := s.pool.QueryRow(ctx, q, key, url, size, s.now()).Scan(&recorded); err != nil {
+		return "", fmt.Errorf("record proof image: %w", err)
+	}
+	return recorded, nil
+}
+
+// ListExpiredProofImages returns images due for deletion, least recently used first:
+// those not submitted again since usedBefore, and those no proof or appeal references
+// any more (replaced by a resubmission or purged on unlink) once unused since
+// orphanedBefore. Images a pending proof or appeal still needs stay until it is decided.
+func (s *Store) ListExpiredProofImages(ctx context.Context, usedBefore, orphanedBefore time.Time, limit int) ([]ProofImage, error) {
+	const q = `
+		SELECT i.key, i.url, i.size_bytes, i.created_at, i.last_used_at
+		FROM proof_image i
+		WHERE (
+			i.last_used_at < $1
+			OR (i.last_used_at < $2
+				AND NOT EXISTS (SELECT 1 FROM proof p WHERE p.image_url = i.url)
+				AND NOT EXISTS (SELECT 1 FROM proof_appeal a WHERE a.image_url = i.url))
+		)
+		AND NOT EXISTS (SELECT 1 FROM proof p WHERE p.image_url = i.url AND p.status = 'pending')
+		AND NOT EXISTS (SELECT 1 FROM proof_appeal a WHERE a.image_url = i.url AND a.status = 'pending')
+		AND NOT EXISTS (
+			SELECT 1 FROM proof_appeal a JOIN proof p ON p.id = a.proof_id
+			WHERE p.image_url = i.url AND a.status = 'pending'
+		)
+		ORDER BY i.last_used_at
+		LIMIT $3
+	`
+	rows, err := s.pool.Query(ctx, q, usedBefore, orphanedBefore, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list expired proof images: %w", err)
+	}
+	defer rows.Close()
+
+	var list []ProofImage
+	for rows.Next() {
+		var img ProofImage
+		if err := rows.Scan(&img.Key, &img.URL, &img.SizeBytes, &img.CreatedAt, &img.LastUsedAt); err != nil {
+			return nil, fmt.Errorf("scan proof image: %w", err)
+		}
+		list = append(list, img)
+	}
+	return list, rows.Err()
+}
+
+// DeleteProofImage forgets an image removed from the blob store and clears the proofs and
+// appeals that referenced it
+func (s *Store) DeleteProofImage(ctx context.Context, img ProofImage) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `UPDATE proof SET image_url = NULL WHERE image_url = $1`, img.URL); err != nil {
+		return fmt.Errorf("clear proof image: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `UPDATE proof_appeal SET image_url = NULL WHERE image_url = $1`, img.URL); err != nil {
+		return fmt.Errorf("clear appeal image: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM proof_image WHERE key = $1`, img.Key); err != nil {
+		return fmt.Errorf("delete proof image: %w", err)
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,234 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ============ Payout Operations ============
+
+type Payout struct {
+	ID            int64
+	UserID        int64
+	PromotionCode string
+	PromotionKey  string // our deterministic key (unique per settlement)
+	TossKey       string // one-time key issued by Toss for the grant; "" until requested
+	AmountPoints  int64
+	Status        string
+	ErrorCode     string
+	ErrorMessage  string
+	ExecutedAt    *time.Time
+	CreatedAt     time.Time
+}
+
+// PayoutCandidate is a successful settlement that has not been paid out yet
+type PayoutCandidate struct {
+	SettlementID  int64
+	UserID        int64
+	TossUserKey   string
+	ChallengeID   string
+	DepositAmount int64
+	RefundAmount  int64 // part of the deposit to pay back (all of it unless partially successful)
+	RewardAmount  int64
+	PayoutID      int64  // 0 if no payout row exists yet
+	PayoutStatus  string // "" if no payout row exists yet
+	Attempts      int    // payouts created for the settlement so far
+}
+
+// ListPayoutCandidates returns refundable settlements without a finished payout, once
+// their cohort's bonus pool reward has been computed.
+// Settlements whose payout is still 'requested' (e.g. the worker crashed mid-run) are
+// included so they can be retried with the same promotion key. 'failed' payouts are
+// included once retryDelay has passed since the failure, while fewer than maxAttempts
+// payouts were created since the last RequeuePayout; each retry is a new payout.
+func (s *Store) ListPayoutCandidates(ctx context.Context, limit, maxAttempts int, retryDelay time.Duration) ([]PayoutCandidate, error) {
+	const q = `
+		SELECT s.id, s.user_id, u.toss_user_key, s.challenge_id, s.deposit_amount, s.refund_amount, s.reward_amount,
+		       COALESCE(po.id, 0), COALESCE(po.status, ''), s.payout_attempts
+		FROM settlement s
+		JOIN app_user u ON s.user_id = u.id
+		LEFT JOIN payout po ON s.payout_id = po.id
+		WHERE s.status = 'success' AND s.refundable = true AND s.settled_at IS NULL
+		AND s.reward_computed_at IS NOT NULL
+		AND (s.payout_id IS NULL OR po.status = 'requested'
+			OR (po.status = 'failed' AND s.payout_attempts - s.payout_requeued_attempts < $2 AND po.updated_at < $3))
+		ORDER BY s.id
+		LIMIT $1
+	`
+	rows, err := s.pool.Query(ctx, q, limit, maxAttempts, s.now().Add(-retryDelay))
+	if err != nil {
+		return nil, fmt.Errorf("list payout candidates: %w", err)
+	}
+	defer rows.Close()
+
+	var list []PayoutCandidate
+	for rows.Next() {
+		var c PayoutCandidate
+		if err := rows.Scan(&c.SettlementID, &c.UserID, &c.TossUserKey, &c.ChallengeID,
+			&c.DepositAmount, &c.RefundAmount, &c.RewardAmount, &c.PayoutID, &c.PayoutStatus, &c.Attempts); err != nil {
+			return nil, fmt.Errorf("scan payout candidate: %w", err)
+		}
+		list = append(list, c)
+	}
+	return list, rows.Err()
+}
+
+// CreatePayout inserts a payout for a settlement and links it via settlement.payout_id,
+// replacing a failed one and counting the attempt.
+// The promotion key is unique, so calling this again with the same key returns the
+// existing payout instead of creating a second one.
+// The settlement is locked and must still be refundable with its reward computed and
+// amountPoints due, so an appeal that reset the cohort's rewards meanwhile is not paid stale.
+func (s *Store) CreatePayout(ctx context.Context, settlementID, userID int64, promotionCode, promotionKey string, amountPoints int64) (*Payout, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	const dueQ = `
+		SELECT refund_amount + reward_amount FROM settlement
+		WHERE id = $1 AND status = 'success' AND refundable = true AND reward_computed_at IS NOT NULL
+		FOR UPDATE
+	`
+	var due int64
+	err = tx.QueryRow(ctx, dueQ, settlementID).Scan(&due)
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("settlement %d is not ready for payout", settlementID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lock settlement: %w", err)
+	}
+	if due != amountPoints {
+		return nil, fmt.Errorf("settlement %d is due %d points, not %d", settlementID, due, amountPoints)
+	}
+
+	const insertQ = `
+		INSERT INTO payout (user_id, promotion_code, promotion_key, amount_points, status)
+		VALUES ($1, $2, $3, $4, 'requested')
+		ON CONFLICT (promotion_key) DO UPDATE SET updated_at = NOW()
+		RETURNING id, user_id, promotion_code, promotion_key, COALESCE(toss_key, ''), amount_points, status,
+		          COALESCE(error_code, ''), COALESCE(error_message, ''), executed_at, created_at
+	`
+	var p Payout
+	err = tx.QueryRow(ctx, insertQ, userID, promotionCode, promotionKey, amountPoints).
+		Scan(&p.ID, &p.UserID, &p.PromotionCode, &p.PromotionKey, &p.TossKey, &p.AmountPoints, &p.Status,
+			&p.ErrorCode, &p.ErrorMessage, &p.ExecutedAt, &p.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("create payout: %w", err)
+	}
+
+	const linkQ = `
+		UPDATE settlement SET payout_id = $1, updated_at = NOW(),
+			payout_attempts = payout_attempts + CASE WHEN payout_id IS DISTINCT FROM $1 THEN 1 ELSE 0 END
+		WHERE id = $2 AND (payout_id IS NULL OR payout_id = $1
+			OR payout_id IN (SELECT id FROM payout WHERE status = 'failed'))
+	`
+	tag, err := tx.Exec(ctx, linkQ, p.ID, settlementID)
+	if err != nil {
+		return nil, fmt.Errorf("link payout: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, fmt.Errorf("settlement %d already linked to another payout", settlementID)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return &p, nil
+}
+
+// SetPayoutTossKey stores the Toss-issued promotion key before the grant is executed
+func (s *Store) SetPayoutTossKey(ctx context.Context, payoutID int64, tossKey string) error {
+	const q = `UPDATE payout SET toss_key = $2, updated_at = NOW() WHERE id = $1 AND toss_key IS NULL`
+	tag, err := s.pool.Exec(ctx, q, payoutID, tossKey)
+	if err != nil {
+		return fmt.Errorf("set payout toss key: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("payout %d already has a toss key", payoutID)
+	}
+	return nil
+}
+
+// MarkPayoutDone records a successful point grant and marks the settlement as settled
+func (s *Store) MarkPayoutDone(ctx context.Context, payoutID int64, rawJSON []byte) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	const payoutQ = `
+		UPDATE payout SET status = 'done', raw_json = $2, error_code = NULL, error_message = NULL,
+			executed_at = NOW(), updated_at = NOW()
+		WHERE id = $1
+	`
+	if _, err := tx.Exec(ctx, payoutQ, payoutID, rawJSON); err != nil {
+		return fmt.Errorf("update payout: %w", err)
+	}
+
+	const settQ = `UPDATE settlement SET settled_at = NOW(), updated_at = NOW() WHERE payout_id = $1 AND settled_at IS NULL`
+	if _, err := tx.Exec(ctx, settQ, payoutID); err != nil {
+		return fmt.Errorf("update settlement: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+// MarkPayoutFailed records a failed point grant; the settlement stays unsettled
+func (s *Store) MarkPayoutFailed(ctx context.Context, payoutID int64, errorCode, errorMessage string) error {
+	const q = `
+		UPDATE payout SET status = 'failed', error_code = $2, error_message = $3, updated_at = NOW()
+		WHERE id = $1 AND status != 'done'
+	`
+	_, err := s.pool.Exec(ctx, q, payoutID, errorCode, errorMessage)
+	if err != nil {
+		return fmt.Errorf("mark payout failed: %w", err)
+	}
+	return nil
+}
+
+// RequeuePayout lets the payout job retry a settlement whose payouts failed maxAttempts
+// times, starting a new round of attempts, and records an audit entry. Attempts keep
+// counting (only the round restarts), so the retry uses a new promotion key instead of
+// returning to a failed payout's.
+// It returns false if the settlement is not waiting on a failed payout.
+func (s *Store) RequeuePayout(ctx context.Context, settlementID int64, actor string) (bool, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	const q = `
+		UPDATE settlement s SET payout_requeued_attempts = s.payout_attempts, updated_at = NOW()
+		FROM payout po
+		WHERE s.id = $1 AND po.id = s.payout_id AND po.status = 'failed'
+		AND s.status = 'success' AND s.refundable = true AND s.settled_at IS NULL
+		RETURNING s.user_id, po.id, COALESCE(po.error_code, '')
+	`
+	var userID, payoutID int64
+	var errorCode string
+	err = tx.QueryRow(ctx, q, settlementID).Scan(&userID, &payoutID, &errorCode)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("requeue payout: %w", err)
+	}
+	details := map[string]any{"settlementId": settlementID, "failedPayoutId": payoutID, "errorCode": errorCode}
+	if err := insertAudit(ctx, tx, actor, "payout.requeue", userID, details); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("commit: %w", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,148 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ============ Settlement Pool Operations ============
+
+// CohortKey identifies participants who ran the same challenge over the same dates
+type CohortKey struct {
+	ChallengeID string
+	StartDate   time.Time
+}
+
+// CohortMember is a finished settlement in a cohort
+type CohortMember struct {
+	SettlementID        int64
+	Status              string // "success" or "failed"
+	DepositAmount       int64
+	RefundAmount        int64 // deposit paid back; the rest is forfeited to the pool
+	RewardMultiplierBps int
+}
+
+// CohortPool is the bonus pool computed for a cohort
+type CohortPool struct {
+	SuccessCount int
+	FailedCount  int
+	Forfeited    int64 // unrefunded deposits of failed and partially successful members
+	FeeBps       int
+	FeeAmount    int64
+	Distributed  int64
+}
+
+// ListPendingCohorts returns cohorts whose settlements are all decided (none 'running')
+// but whose rewards have not been computed yet. Cohorts with a pending appeal wait for
+// its decision, since an accepted appeal can move a member from failed to success.
+func (s *Store) ListPendingCohorts(ctx context.Context, limit int) ([]CohortKey, error) {
+	const q = `
+		SELECT p.challenge_id, p.start_date
+		FROM settlement s
+		JOIN participation p ON p.id = s.participation_id
+		WHERE s.reward_computed_at IS NULL AND s.status IN ('success', 'failed')
+		GROUP BY p.challenge_id, p.start_date
+		HAVING NOT EXISTS (
+			SELECT 1 FROM settlement s2
+			JOIN participation p2 ON p2.id = s2.participation_id
+			WHERE p2.challenge_id = p.challenge_id AND p2.start_date = p.start_date
+			AND s2.status = 'running'
+		)
+		AND NOT EXISTS (
+			SELECT 1 FROM proof_appeal a
+			JOIN participation p3 ON p3.id = a.participation_id
+			WHERE p3.challenge_id = p.challenge_id AND p3.start_date = p.start_date
+			AND a.status = 'pending'
+		)
+		ORDER BY p.start_date, p.challenge_id
+		LIMIT $1
+	`
+	rows, err := s.pool.Query(ctx, q, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list pending cohorts: %w", err)
+	}
+	defer rows.Close()
+
+	var list []CohortKey
+	for rows.Next() {
+		var k CohortKey
+		if err := rows.Scan(&k.ChallengeID, &k.StartDate); err != nil {
+			return nil, fmt.Errorf("scan cohort: %w", err)
+		}
+		list = append(list, k)
+	}
+	return list, rows.Err()
+}
+
+// ListCohortMembers returns the decided settlements of a cohort that still need a reward
+func (s *Store) ListCohortMembers(ctx context.Context, key CohortKey) ([]CohortMember, error) {
+	const q = `
+		SELECT s.id, s.status, s.deposit_amount, s.refund_amount, p.reward_multiplier_bps
+		FROM settlement s
+		JOIN participation p ON p.id = s.participation_id
+		WHERE p.challenge_id = $1 AND p.start_date = $2
+		AND s.status IN ('success', 'failed') AND s.reward_computed_at IS NULL
+		ORDER BY s.id
+	`
+	rows, err := s.pool.Query(ctx, q, key.ChallengeID, key.StartDate)
+	if err != nil {
+		return nil, fmt.Errorf("list cohort members: %w", err)
+	}
+	defer rows.Close()
+
+	var list []CohortMember
+	for rows.Next() {
+		var m CohortMember
+		if err := rows.Scan(&m.SettlementID, &m.Status, &m.DepositAmount, &m.RefundAmount, &m.RewardMultiplierBps); err != nil {
+			return nil, fmt.Errorf("scan cohort member: %w", err)
+		}
+		list = append(list, m)
+	}
+	return list, rows.Err()
+}
+
+// ApplyCohortRewards stores the pool summary and each member's reward in one transaction.
+// members must be the list returned by ListCohortMembers; if any of them changed status
+// or was computed concurrently, nothing is written and an error is returned.
+func (s *Store) ApplyCohortRewards(ctx context.Context, key CohortKey, pool CohortPool, members []CohortMember, rewards map[int64]int64) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	const updateQ = `
+		UPDATE settlement
+		SET reward_amount = $2, reward_computed_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND status = $3 AND reward_computed_at IS NULL
+	`
+	for _, m := range members {
+		tag, err := tx.Exec(ctx, updateQ, m.SettlementID, rewards[m.SettlementID], m.Status)
+		if err != nil {
+			return fmt.Errorf("update settlement %d reward: %w", m.SettlementID, err)
+		}
+		if tag.RowsAffected() != 1 {
+			return fmt.Errorf("settlement %d changed while computing rewards", m.SettlementID)
+		}
+	}
+
+	const poolQ = `
+		INSERT INTO settlement_pool (challenge_id, start_date, success_count, failed_count, forfeited, fee_bps, fee_amount, distributed)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (challenge_id, start_date) DO UPDATE
+		SET success_count = EXCLUDED.success_count, failed_count = EXCLUDED.failed_count,
+		    forfeited = EXCLUDED.forfeited, fee_bps = EXCLUDED.fee_bps, fee_amount = EXCLUDED.fee_amount,
+		    distributed = EXCLUDED.distributed, computed_at = NOW()
+	`
+	_, err = tx.Exec(ctx, poolQ, key.ChallengeID, key.StartDate, pool.SuccessCount, pool.FailedCount,
+		pool.Forfeited, pool.FeeBps, pool.FeeAmount, pool.Distributed)
+	if err != nil {
+		return fmt.Errorf("upsert settlement pool: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ============ Payment Reconciliation Operations ============
+
+// ListStalePayments returns 'created' payments with a pay token that were created before
+// the given time, oldest first.
+func (s *Store) ListStalePayments(ctx context.Context, createdBefore time.Time, limit int) ([]Payment, error) {
+	const q = `
+		SELECT id, user_id, challenge_id, order_no, pay_token, amount, status, created_at
+		FROM payment
+		WHERE status = 'created' AND pay_token IS NOT NULL AND created_at < $1
+		ORDER BY created_at
+		LIMIT $2
+	`
+	rows, err := s.pool.Query(ctx, q, createdBefore, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list stale payments: %w", err)
+	}
+	defer rows.Close()
+
+	var list []Payment
+	for rows.Next() {
+		var p Payment
+		if err := rows.Scan(&p.ID, &p.UserID, &p.ChallengeID, &p.OrderNo, &p.PayToken, &p.Amount, &p.Status, &p.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan payment: %w", err)
+		}
+		list = append(list, p)
+	}
+	return list, rows.Err()
+}
+
+// ListStaleCancellations returns 'cancelling' payments claimed before claimedBefore, oldest
+// first: cancel requests that were interrupted before the refund was recorded.
+func (s *Store) ListStaleCancellations(ctx context.Context, claimedBefore time.Time, limit int) ([]Payment, error) {
+	const q = `
+		SELECT id, user_id, challenge_id, order_no, COALESCE(pay_token, ''), amount, status, created_at
+		FROM payment
+		WHERE status = 'cancelling' AND updated_at < $1
+		ORDER BY updated_at
+		LIMIT $2
+	`
+	rows, err := s.pool.Query(ctx, q, claimedBefore, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list stale cancellations: %w", err)
+	}
+	defer rows.Close()
+
+	var list []Payment
+	for rows.Next() {
+		var p Payment
+		if err := rows.Scan(&p.ID, &p.UserID, &p.ChallengeID, &p.OrderNo, &p.PayToken, &p.Amount, &p.Status, &p.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan payment: %w", err)
+		}
+		list = append(list, p)
+	}
+	return list, rows.Err()
+}
+
+// ClosePayment moves a 'created' payment to a terminal status ('expired' or 'failed').
+// A payment that was completed in the meantime is left untouched.
+func (s *Store) ClosePayment(ctx context.Context, paymentID int64, status, reason string) error {
+	const q = `
+		UPDATE payment SET status = $2, closed_reason = $3, updated_at = NOW()
+		WHERE id = $1 AND status = 'created'
+	`
+	if _, err := s.pool.Exec(ctx, q, paymentID, status, reason); err != nil {
+		return fmt.Errorf("close payment: %w", err)
+	}
+	return nil
+}
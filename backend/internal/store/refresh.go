@@ -0,0 +1,142 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ============ Refresh Token Operations ============
+
+// Refresh token errors
+var (
+	ErrRefreshTokenInvalid = errors.New("refresh token invalid or expired")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+)
+
+type RefreshToken struct {
+	ID        int64
+	FamilyID  string
+	UserSub   string
+	DeviceID  string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+// CreateRefreshToken stores the hash of a new refresh token starting a new family
+func (s *Store) CreateRefreshToken(ctx context.Context, tokenHash, familyID, userSub, deviceID string, expiresAt time.Time) (*RefreshToken, error) {
+	const q = `
+		INSERT INTO refresh_token (token_hash, family_id, user_sub, device_id, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, family_id, user_sub, device_id, expires_at, created_at
+	`
+	var t RefreshToken
+	err := s.pool.QueryRow(ctx, q, tokenHash, familyID, userSub, deviceID, expiresAt).
+		Scan(&t.ID, &t.FamilyID, &t.UserSub, &t.DeviceID, &t.ExpiresAt, &t.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("create refresh token: %w", err)
+	}
+	return &t, nil
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one in the same family.
+// Presenting a token that was already rotated means it leaked (or a client replayed it):
+// the whole family is revoked and ErrRefreshTokenReused is returned.
+func (s *Store) RotateRefreshToken(ctx context.Context, oldHash, newHash string, expiresAt time.Time) (*RefreshToken, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	const getQ = `
+		SELECT id, family_id, user_sub, device_id, expires_at, used_at, revoked_at
+		FROM refresh_token WHERE token_hash = $1
+		FOR UPDATE
+	`
+	var old RefreshToken
+	var usedAt, revokedAt *time.Time
+	err = tx.QueryRow(ctx, getQ, oldHash).
+		Scan(&old.ID, &old.FamilyID, &old.UserSub, &old.DeviceID, &old.ExpiresAt, &usedAt, &revokedAt)
+	if err == pgx.ErrNoRows {
+		return nil, ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get refresh token: %w", err)
+	}
+	if revokedAt != nil || s.now().After(old.ExpiresAt) {
+		return nil, ErrRefreshTokenInvalid
+	}
+	if usedAt != nil {
+		if _, err := revokeFamily(ctx, tx, old.FamilyID, "reuse detected"); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return nil, fmt.Errorf("commit: %w", err)
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE refresh_token SET used_at = NOW() WHERE id = $1`, old.ID); err != nil {
+		return nil, fmt.Errorf("mark refresh token used: %w", err)
+	}
+
+	const insertQ = `
+		INSERT INTO refresh_token (token_hash, family_id, parent_id, user_sub, device_id, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, family_id, user_sub, device_id, expires_at, created_at
+	`
+	var t RefreshToken
+	err = tx.QueryRow(ctx, insertQ, newHash, old.FamilyID, old.ID, old.UserSub, old.DeviceID, expiresAt).
+		Scan(&t.ID, &t.FamilyID, &t.UserSub, &t.DeviceID, &t.ExpiresAt, &t.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("insert refresh token: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return &t, nil
+}
+
+func revokeFamily(ctx context.Context, db execer, familyID, reason string) (int64, error) {
+	tag, err := db.Exec(ctx, `
+		UPDATE refresh_token SET revoked_at = NOW(), revoke_reason = $2
+		WHERE family_id = $1 AND revoked_at IS NULL
+	`, familyID, reason)
+	if err != nil {
+		return 0, fmt.Errorf("revoke refresh family: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// RevokeRefreshTokens revokes a user's refresh tokens on one device, or on all devices
+// if deviceID is empty. It returns the number of tokens revoked.
+func (s *Store) RevokeRefreshTokens(ctx context.Context, userSub, deviceID, reason string) (int64, error) {
+	const q = `
+		UPDATE refresh_token SET revoked_at = NOW(), revoke_reason = $3
+		WHERE user_sub = $1 AND ($2 = '' OR device_id = $2) AND revoked_at IS NULL
+	`
+	tag, err := s.pool.Exec(ctx, q, userSub, deviceID, reason)
+	if err != nil {
+		return 0, fmt.Errorf("revoke refresh tokens: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// CleanupExpiredRefreshTokens deletes refresh tokens that expired more than a day ago
+func (s *Store) CleanupExpiredRefreshTokens(ctx context.Context) (*BatchResult, error) {
+	result := &BatchResult{Errors: []string{}}
+
+	// Keep recently expired rows a little longer so reuse of a just-expired token is still traceable
+	cutoff := s.now().Add(-24 * time.Hour)
+	tag, err := s.pool.Exec(ctx, `DELETE FROM refresh_token WHERE expires_at < $1`, cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("cleanup refresh tokens: %w", err)
+	}
+	result.Processed = int(tag.RowsAffected())
+	return result, nil
+}
@@ -0,0 +1,135 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ============ Refund Operations ============
+
+// GetParticipationByPaymentID returns the participation created by a payment, or nil.
+func (s *Store) GetParticipationByPaymentID(ctx context.Context, paymentID int64) (*Participation, error) {
+	const q = `
+		SELECT id, user_id, challenge_id, payment_id, status, start_date, end_date, proof_count, created_at
+		FROM participation
+		WHERE payment_id = $1
+		LIMIT 1
+	`
+	var p Participation
+	err := s.pool.QueryRow(ctx, q, paymentID).
+		Scan(&p.ID, &p.UserID, &p.ChallengeID, &p.PaymentID, &p.Status, &p.StartDate, &p.EndDate, &p.ProofCount, &p.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get participation by payment: %w", err)
+	}
+	return &p, nil
+}
+
+// ClaimPaymentCancel moves a 'done' payment to 'cancelling' before the provider is asked to
+// refund it, so only one caller refunds a payment. It returns the claimed payment, or nil if
+// the payment is not 'done' (already refunded, or another cancellation holds it).
+func (s *Store) ClaimPaymentCancel(ctx context.Context, paymentID int64) (*Payment, error) {
+	const q = `
+		UPDATE payment SET status = 'cancelling', updated_at = NOW()
+		WHERE id = $1 AND status = 'done'
+		RETURNING id, user_id, challenge_id, order_no, COALESCE(pay_token, ''), amount, status, created_at
+	`
+	var p Payment
+	err := s.pool.QueryRow(ctx, q, paymentID).
+		Scan(&p.ID, &p.UserID, &p.ChallengeID, &p.OrderNo, &p.PayToken, &p.Amount, &p.Status, &p.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("claim payment cancel: %w", err)
+	}
+	return &p, nil
+}
+
+// ReleasePaymentCancel returns a 'cancelling' payment to 'done' after the provider refused
+// the refund.
+func (s *Store) ReleasePaymentCancel(ctx context.Context, paymentID int64) error {
+	const q = `UPDATE payment SET status = 'done', updated_at = NOW() WHERE id = $1 AND status = 'cancelling'`
+	if _, err := s.pool.Exec(ctx, q, paymentID); err != nil {
+		return fmt.Errorf("release payment cancel: %w", err)
+	}
+	return nil
+}
+
+// RefundPayment records a refund on a 'done' (or claimed 'cancelling') payment and cancels
+// the participation and settlement it created. A partial refund leaves the payment
+// 'partially_refunded'.
+func (s *Store) RefundPayment(ctx context.Context, paymentID int64, refundNo string, refundedAmount int64, fullyRefunded bool, reason string) (*Payment, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	status := "partially_refunded"
+	if fullyRefunded {
+		status = "refunded"
+	}
+
+	const payQ = `
+		UPDATE payment
+		SET status = $2, refunded_amount = refunded_amount + $3, refund_no = $4, refund_reason = $5,
+		    refunded_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND status IN ('done', 'cancelling', 'partially_refunded')
+		RETURNING id, user_id, challenge_id, order_no, COALESCE(pay_token, ''), amount, status, created_at
+	`
+	var p Payment
+	err = tx.QueryRow(ctx, payQ, paymentID, status, refundedAmount, refundNo, reason).
+		Scan(&p.ID, &p.UserID, &p.ChallengeID, &p.OrderNo, &p.PayToken, &p.Amount, &p.Status, &p.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("payment not found or not refundable")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("update payment: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE participation SET status = 'cancelled', updated_at = NOW()
+		WHERE payment_id = $1 AND status = 'active'
+	`, paymentID)
+	if err != nil {
+		return nil, fmt.Errorf("cancel participation: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE settlement SET status = 'cancelled', refundable = false, updated_at = NOW()
+		WHERE payment_id = $1 AND status = 'running'
+	`, paymentID)
+	if err != nil {
+		return nil, fmt.Errorf("cancel settlement: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return &p, nil
+}
+
+// RefundUnfulfilledPayment records the full refund of a 'created' payment that the provider
+// captured but that could not start a participation (ErrActiveParticipation or
+// ErrParticipationToday on execution).
+func (s *Store) RefundUnfulfilledPayment(ctx context.Context, paymentID int64, refundNo, reason string) error {
+	const q = `
+		UPDATE payment
+		SET status = 'refunded', refunded_amount = amount, refund_no = NULLIF($2, ''), refund_reason = $3,
+		    refunded_at = NOW(), closed_reason = $3, updated_at = NOW()
+		WHERE id = $1 AND status = 'created'
+	`
+	tag, err := s.pool.Exec(ctx, q, paymentID, refundNo, reason)
+	if err != nil {
+		return fmt.Errorf("refund unfulfilled payment: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("payment %d is not awaiting execution", paymentID)
+	}
+	return nil
+}
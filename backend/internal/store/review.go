@@ -0,0 +1,115 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ============ Proof Review Operations ============
+
+// ErrProofNotPending is returned when deciding a proof that is not waiting for review
+var ErrProofNotPending = errors.New("proof is not pending review")
+
+// PendingProof is a proof in the review queue with the context a reviewer needs
+type PendingProof struct {
+	Proof
+	ChallengeTitle      string
+	ParticipationStatus string
+	StartDate           time.Time
+	EndDate             time.Time
+	ProofCount          int // accepted proofs so far
+	RequiredProofs      int
+}
+
+// ListPendingProofs returns proofs waiting for review, oldest first, after the given proof id
+func (s *Store) ListPendingProofs(ctx context.Context, afterID int64, limit int) ([]PendingProof, error) {
+	const q = `
+		SELECT ` + proofColumnsAs + `,
+		       c.title, p.status, p.start_date, p.end_date, p.proof_count, COALESCE(NULLIF(p.required_proofs, 0), c.days)
+		FROM proof pr
+		JOIN participation p ON p.id = pr.participation_id
+		JOIN challenge c ON c.id = pr.challenge_id
+		WHERE pr.status = 'pending' AND pr.id > $1 AND pr.anonymized_at IS NULL
+		ORDER BY pr.id
+		LIMIT $2
+	`
+	rows, err := s.pool.Query(ctx, q, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list pending proofs: %w", err)
+	}
+	defer rows.Close()
+
+	var list []PendingProof
+	for rows.Next() {
+		var pp PendingProof
+		dest := append(proofDest(&pp.Proof), &pp.ChallengeTitle, &pp.ParticipationStatus, &pp.StartDate, &pp.EndDate, &pp.ProofCount, &pp.RequiredProofs)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("scan pending proof: %w", err)
+		}
+		list = append(list, pp)
+	}
+	return list, rows.Err()
+}
+
+// proofColumnsAs is proofColumns qualified with the "pr" alias for joins
+const proofColumnsAs = `pr.id, pr.participation_id, pr.user_id, pr.challenge_id, pr.proof_date, pr.proof_type, COALESCE(pr.image_hash, ''),
+	COALESCE(pr.image_url, ''), pr.exif_timestamp, pr.status, COALESCE(pr.review_reason, ''), COALESCE(pr.reject_reason, ''), COALESCE(pr.reviewed_by, ''),
+	pr.verified_at, pr.created_at`
+
+// ReviewProof accepts or rejects a pending proof, recomputes the participation's proof
+// count and records the decision in the audit log. reason is required to reject.
+// Returns nil if the proof does not exist and ErrProofNotPending if it was already decided.
+func (s *Store) ReviewProof(ctx context.Context, proofID int64, accept bool, reason, actor string) (*Proof, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var before Proof
+	err = scanProof(tx.QueryRow(ctx, `SELECT `+proofColumns+` FROM proof WHERE id = $1 FOR UPDATE`, proofID), &before)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get proof: %w", err)
+	}
+	if before.Status != ProofPending {
+		return nil, ErrProofNotPending
+	}
+
+	status, rejectReason, action := ProofAccepted, "", "proof.accept"
+	if !accept {
+		status, rejectReason, action = ProofRejected, reason, "proof.reject"
+	}
+	const q = `
+		UPDATE proof SET status = $2, reject_reason = NULLIF($3, ''), reviewed_by = $4, verified_at = $5
+		WHERE id = $1
+		RETURNING ` + proofColumns
+	var out Proof
+	if err := scanProof(tx.QueryRow(ctx, q, proofID, status, rejectReason, actor, s.now()), &out); err != nil {
+		return nil, fmt.Errorf("review proof: %w", err)
+	}
+	if err := updateProofCount(ctx, tx, out.ParticipationID); err != nil {
+		return nil, err
+	}
+	details := map[string]any{
+		"proofId":         out.ID,
+		"participationId": out.ParticipationID,
+		"challengeId":     out.ChallengeID,
+		"proofDate":       out.ProofDate.Format("2006-01-02"),
+		"reviewReason":    before.ReviewReason,
+		"reason":          reason,
+	}
+	if err := insertAudit(ctx, tx, actor, action, out.UserID, details); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return &out, nil
+}
@@ -0,0 +1,44 @@
+package store
+
+// Refund policies for partially completed challenges
+const (
+	RefundFull         = "full"         // meeting the minimum refunds the whole deposit
+	RefundProportional = "proportional" // refund in proportion to the days credited
+)
+
+// SuccessRule decides the outcome of a finished participation.
+// The zero value (apart from Required) is all-or-nothing: every required day must be proven.
+type SuccessRule struct {
+	Required      int    // proofs for a full result: the tier's required proofs, or the challenge days
+	MinSuccessBps int    // minimum share of Required to succeed at all (0 means 100%)
+	RestDays      int    // missed days credited as if proven
+	RefundPolicy  string // RefundFull or RefundProportional
+}
+
+// Evaluate returns whether a participation with proofCount proofs succeeded, and the
+// share of the deposit refunded in basis points. Proportional refunds round down, so
+// 2 of 3 days refunds 6666 bps.
+func (r SuccessRule) Evaluate(proofCount int) (bool, int) {
+	required := r.Required
+	if required <= 0 {
+		required = 1
+	}
+	minBps := r.MinSuccessBps
+	if minBps <= 0 || minBps > MultiplierOne {
+		minBps = MultiplierOne
+	}
+
+	credited := proofCount + max(r.RestDays, 0)
+	if credited > required {
+		credited = required
+	}
+	// ceil(required * minBps / 10000): a 90% minimum of 30 days needs 27
+	threshold := (required*minBps + MultiplierOne - 1) / MultiplierOne
+	if credited < threshold || credited <= 0 {
+		return false, 0
+	}
+	if r.RefundPolicy == RefundProportional {
+		return true, credited * MultiplierOne / required
+	}
+	return true, MultiplierOne
+}
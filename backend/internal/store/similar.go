@@ -0,0 +1,88 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ============ Similar Image Operations ============
+
+// MaxSimilarDistance is the largest Hamming distance CheckSimilarProofHash can search for.
+// The 64-bit perceptual hash is indexed in six bands (migration 017); two hashes at most
+// this far apart agree exactly on at least one band, so band lookups find every match.
+const MaxSimilarDistance = 5
+
+// SimilarProof is an earlier proof whose image looks like the one being checked
+type SimilarProof struct {
+	Proof
+	Distance int // Hamming distance between the perceptual hashes
+}
+
+// phashBands splits a perceptual hash into the 11,11,11,11,10,10-bit bands the
+// idx_proof_phash_b* indexes are built on
+func phashBands(h uint64) []any {
+	return []any{
+		int64(h & 2047),
+		int64(h >> 11 & 2047),
+		int64(h >> 22 & 2047),
+		int64(h >> 33 & 2047),
+		int64(h >> 44 & 1023),
+		int64(h >> 54 & 1023),
+	}
+}
+
+func scanSimilarProof(row pgx.Row) (*SimilarProof, error) {
+	var sp SimilarProof
+	err := row.Scan(append(proofDest(&sp.Proof), &sp.Distance)...)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sp, nil
+}
+
+// CheckSimilarProofHash finds another user's accepted or pending proof whose perceptual
+// hash is within maxDistance (capped at MaxSimilarDistance) of phash, closest first.
+// Returns nil if there is none.
+func (s *Store) CheckSimilarProofHash(ctx context.Context, phash uint64, excludeUserID int64, maxDistance int) (*SimilarProof, error) {
+	const q = `
+		SELECT ` + proofColumns + `, bit_count((phash # $1)::bit(64)) AS distance
+		FROM proof
+		WHERE phash IS NOT NULL AND user_id != $2 AND status IN ('accepted', 'pending')
+		AND ((phash & 2047) = $3 OR ((phash >> 11) & 2047) = $4 OR ((phash >> 22) & 2047) = $5
+		     OR ((phash >> 33) & 2047) = $6 OR ((phash >> 44) & 1023) = $7 OR ((phash >> 54) & 1023) = $8)
+		AND bit_count((phash # $1)::bit(64)) <= $9
+		ORDER BY distance, id
+		LIMIT 1
+	`
+	args := append([]any{int64(phash), excludeUserID}, phashBands(phash)...)
+	args = append(args, min(maxDistance, MaxSimilarDistance))
+	sp, err := scanSimilarProof(s.pool.QueryRow(ctx, q, args...))
+	if err != nil {
+		return nil, fmt.Errorf("check similar hash: %w", err)
+	}
+	return sp, nil
+}
+
+// CheckSameUserSimilarHash finds one of the user's own accepted or pending proofs whose
+// perceptual hash is within maxDistance of phash, closest first. A user's history is
+// small enough to compare in full, so any distance may be used. Returns nil if there is none.
+func (s *Store) CheckSameUserSimilarHash(ctx context.Context, phash uint64, userID int64, maxDistance int) (*SimilarProof, error) {
+	const q = `
+		SELECT ` + proofColumns + `, bit_count((phash # $1)::bit(64)) AS distance
+		FROM proof
+		WHERE user_id = $2 AND phash IS NOT NULL AND status IN ('accepted', 'pending')
+		AND bit_count((phash # $1)::bit(64)) <= $3
+		ORDER BY distance, id
+		LIMIT 1
+	`
+	sp, err := scanSimilarProof(s.pool.QueryRow(ctx, q, int64(phash), userID, maxDistance))
+	if err != nil {
+		return nil, fmt.Errorf("check same user similar hash: %w", err)
+	}
+	return sp, nil
+}
@@ -2,6 +2,7 @@ package store
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -9,11 +10,16 @@ import (
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"habitcashback/internal/calendar"
+	"habitcashback/internal/clock"
 )
 
 // Store provides database operations
 type Store struct {
-	pool *pgxpool.Pool
+	pool  *pgxpool.Pool
+	cal   *calendar.Calendar
+	clock clock.Clock
 }
 
 // New creates a new Store with connection pool
@@ -22,6 +28,10 @@ func New(ctx context.Context) (*Store, error) {
 	if dsn == "" {
 		return nil, fmt.Errorf("DATABASE_URL not set")
 	}
+	cal, err := calendar.FromEnv()
+	if err != nil {
+		return nil, err
+	}
 
 	cfg, err := pgxpool.ParseConfig(dsn)
 	if err != nil {
@@ -43,7 +53,32 @@ func New(ctx context.Context) (*Store, error) {
 		return nil, fmt.Errorf("ping: %w", err)
 	}
 
-	return &Store{pool: pool}, nil
+	return &Store{pool: pool, cal: cal, clock: clock.System{}}, nil
+}
+
+// Calendar returns the calendar challenge days are counted in (CHALLENGE_TIMEZONE)
+func (s *Store) Calendar() *calendar.Calendar {
+	return s.cal
+}
+
+// Clock returns the clock the store reads the current time from
+func (s *Store) Clock() clock.Clock {
+	return s.clock
+}
+
+// SetClock replaces the store's clock. Meant for tests that move time forward; set it
+// before the store is shared, as it is not synchronized.
+func (s *Store) SetClock(c clock.Clock) {
+	s.clock = clock.OrSystem(c)
+}
+
+func (s *Store) now() time.Time {
+	return s.clock.Now()
+}
+
+// today returns the current challenge date
+func (s *Store) today() time.Time {
+	return s.cal.Date(s.now())
 }
 
 // Close closes the connection pool
@@ -62,12 +97,16 @@ type User struct {
 	CreatedAt   time.Time
 }
 
-// GetOrCreateUser finds or creates a user by toss_user_key
+// GetOrCreateUser finds or creates a user by toss_user_key.
+// A user who unlinked and logged in again is reactivated once the unlink job has handled
+// their data; until then they stay unlinked so ListPendingUnlinks still picks them up.
 func (s *Store) GetOrCreateUser(ctx context.Context, tossUserKey string) (*User, error) {
 	const q = `
 		INSERT INTO app_user (toss_user_key)
 		VALUES ($1)
-		ON CONFLICT (toss_user_key) DO UPDATE SET updated_at = NOW()
+		ON CONFLICT (toss_user_key) DO UPDATE SET updated_at = NOW(),
+			status = CASE WHEN app_user.status = 'unlinked' AND app_user.unlink_processed_at IS NOT NULL
+				THEN 'active' ELSE app_user.status END
 		RETURNING id, toss_user_key, status, created_at
 	`
 	var u User
@@ -95,18 +134,62 @@ func (s *Store) GetUserByTossKey(ctx context.Context, tossUserKey string) (*User
 // ============ Challenge Operations ============
 
 type Challenge struct {
-	ID        string
-	Title     string
-	Days      int
-	Deposit   int64
-	ProofType string
-	IsActive  bool
+	ID          string
+	Title       string
+	Description string
+	Days        int
+	Deposit     int64
+	ProofType   string
+	IsActive    bool
+	StartsAt    *time.Time // enrollment opens; nil means immediately
+	EndsAt      *time.Time // enrollment closes; nil means never
+	UpdatedAt   time.Time
+	Tiers       []Tier // optional stake levels; empty means Deposit is the only option
+
+	// Partial success rules, see SuccessRule
+	MinSuccessBps int
+	RestDays      int
+	RefundPolicy  string
+
+	// Local time of day proofs are accepted in, in minutes after midnight (challenge time zone).
+	// Equal values mean any time of day.
+	ProofWindowStart int
+	ProofWindowEnd   int
+
+	// What happens to photos without a readable EXIF capture time (proof.MissingEXIFAccept etc.)
+	MissingExifPolicy string
 }
 
-// ListChallenges returns all active challenges
+// OpenAt reports whether users can join the challenge at t
+func (c *Challenge) OpenAt(t time.Time) bool {
+	if !c.IsActive {
+		return false
+	}
+	if c.StartsAt != nil && t.Before(*c.StartsAt) {
+		return false
+	}
+	if c.EndsAt != nil && !t.Before(*c.EndsAt) {
+		return false
+	}
+	return true
+}
+
+const challengeColumns = `id, title, COALESCE(description, ''), days, deposit, proof_type, is_active, starts_at, ends_at, updated_at,
+	min_success_bps, rest_days, refund_policy, proof_window_start, proof_window_end, missing_exif_policy`
+
+func scanChallenge(row pgx.Row, c *Challenge) error {
+	return row.Scan(&c.ID, &c.Title, &c.Description, &c.Days, &c.Deposit, &c.ProofType, &c.IsActive, &c.StartsAt, &c.EndsAt, &c.UpdatedAt,
+		&c.MinSuccessBps, &c.RestDays, &c.RefundPolicy, &c.ProofWindowStart, &c.ProofWindowEnd, &c.MissingExifPolicy)
+}
+
+// ListChallenges returns active challenges whose enrollment window is open
 func (s *Store) ListChallenges(ctx context.Context) ([]Challenge, error) {
-	const q = `SELECT id, title, days, deposit, proof_type, is_active FROM challenge WHERE is_active = true ORDER BY id`
-	rows, err := s.pool.Query(ctx, q)
+	const q = `SELECT ` + challengeColumns + ` FROM challenge
+		WHERE is_active = true
+		  AND (starts_at IS NULL OR starts_at <= $1)
+		  AND (ends_at IS NULL OR ends_at > $1)
+		ORDER BY id`
+	rows, err := s.pool.Query(ctx, q, s.now())
 	if err != nil {
 		return nil, fmt.Errorf("list challenges: %w", err)
 	}
@@ -115,25 +198,32 @@ func (s *Store) ListChallenges(ctx context.Context) ([]Challenge, error) {
 	var list []Challenge
 	for rows.Next() {
 		var c Challenge
-		if err := rows.Scan(&c.ID, &c.Title, &c.Days, &c.Deposit, &c.ProofType, &c.IsActive); err != nil {
+		if err := scanChallenge(rows, &c); err != nil {
 			return nil, fmt.Errorf("scan challenge: %w", err)
 		}
 		list = append(list, c)
 	}
+	rows.Close()
+	if err := loadTiers(ctx, s.pool, list); err != nil {
+		return nil, err
+	}
 	return list, nil
 }
 
 // GetChallenge returns a challenge by ID
 func (s *Store) GetChallenge(ctx context.Context, id string) (*Challenge, error) {
-	const q = `SELECT id, title, days, deposit, proof_type, is_active FROM challenge WHERE id = $1`
+	const q = `SELECT ` + challengeColumns + ` FROM challenge WHERE id = $1`
 	var c Challenge
-	err := s.pool.QueryRow(ctx, q, id).Scan(&c.ID, &c.Title, &c.Days, &c.Deposit, &c.ProofType, &c.IsActive)
+	err := scanChallenge(s.pool.QueryRow(ctx, q, id), &c)
 	if err == pgx.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, fmt.Errorf("get challenge: %w", err)
 	}
+	if err := loadChallengeTiers(ctx, s.pool, &c); err != nil {
+		return nil, err
+	}
 	return &c, nil
 }
 
@@ -153,7 +243,7 @@ type Participation struct {
 
 // GetActiveParticipation returns the active participation for a user and challenge
 func (s *Store) GetActiveParticipation(ctx context.Context, userID int64, challengeID string) (*Participation, error) {
-	today := time.Now().Truncate(24 * time.Hour)
+	today := s.today()
 	const q = `
 		SELECT id, user_id, challenge_id, payment_id, status, start_date, end_date, proof_count, created_at
 		FROM participation
@@ -186,22 +276,112 @@ type Payment struct {
 	CreatedAt   time.Time
 }
 
-// CreatePayment creates a new payment record
-func (s *Store) CreatePayment(ctx context.Context, userID int64, challengeID, orderNo string, amount int64) (*Payment, error) {
+// CheckoutHold is how long an unfinished checkout blocks a new payment for the same
+// challenge. An abandoned checkout that is paid after this is refunded on execution.
+const CheckoutHold = 15 * time.Minute
+
+var (
+	// ErrActiveParticipation is returned when a user already has an active participation in the challenge
+	ErrActiveParticipation = errors.New("active participation exists")
+	// ErrParticipationToday is returned when the user's participation in the challenge that
+	// started today was already cancelled or forfeited; a new one can start tomorrow
+	ErrParticipationToday = errors.New("participation already started today")
+	// ErrCheckoutInProgress is returned while another checkout for the challenge is unfinished
+	ErrCheckoutInProgress = errors.New("checkout in progress")
+)
+
+// CreatePayment creates a new payment record for the chosen tier (tierID 0 when the
+// challenge has no tiers). It fails with ErrActiveParticipation while the user has an active participation in the
+// same challenge, ErrParticipationToday if one already started today, and ErrCheckoutInProgress
+// while a payment created within CheckoutHold is unfinished; the user row is locked so
+// concurrent requests are checked one at a time.
+func (s *Store) CreatePayment(ctx context.Context, userID int64, challengeID, orderNo string, amount, tierID int64) (*Payment, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT id FROM app_user WHERE id = $1 FOR UPDATE`, userID); err != nil {
+		return nil, fmt.Errorf("lock user: %w", err)
+	}
+	if err := checkNoParticipation(ctx, tx, userID, challengeID, s.today()); err != nil {
+		return nil, err
+	}
+	var inProgress bool
+	err = tx.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM payment
+			WHERE user_id = $1 AND challenge_id = $2 AND status = 'created' AND created_at > $3
+		)
+	`, userID, challengeID, s.now().Add(-CheckoutHold)).Scan(&inProgress)
+	if err != nil {
+		return nil, fmt.Errorf("check checkout in progress: %w", err)
+	}
+	if inProgress {
+		return nil, ErrCheckoutInProgress
+	}
+
 	const q = `
-		INSERT INTO payment (user_id, challenge_id, order_no, amount, status)
-		VALUES ($1, $2, $3, $4, 'created')
+		INSERT INTO payment (user_id, challenge_id, order_no, amount, status, tier_id)
+		VALUES ($1, $2, $3, $4, 'created', NULLIF($5, 0))
 		RETURNING id, user_id, challenge_id, order_no, amount, status, created_at
 	`
 	var p Payment
-	err := s.pool.QueryRow(ctx, q, userID, challengeID, orderNo, amount).
+	err = tx.QueryRow(ctx, q, userID, challengeID, orderNo, amount, tierID).
 		Scan(&p.ID, &p.UserID, &p.ChallengeID, &p.OrderNo, &p.Amount, &p.Status, &p.CreatedAt)
 	if err != nil {
 		return nil, fmt.Errorf("create payment: %w", err)
 	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
 	return &p, nil
 }
 
+// GetPendingCheckout returns the user's newest unfinished payment for the challenge created
+// within CheckoutHold (the checkout behind ErrCheckoutInProgress), or nil.
+func (s *Store) GetPendingCheckout(ctx context.Context, userID int64, challengeID string) (*Payment, error) {
+	const q = `
+		SELECT id, user_id, challenge_id, order_no, COALESCE(pay_token, ''), amount, status, created_at
+		FROM payment
+		WHERE user_id = $1 AND challenge_id = $2 AND status = 'created' AND created_at > $3
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+	var p Payment
+	err := s.pool.QueryRow(ctx, q, userID, challengeID, s.now().Add(-CheckoutHold)).
+		Scan(&p.ID, &p.UserID, &p.ChallengeID, &p.OrderNo, &p.PayToken, &p.Amount, &p.Status, &p.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get pending checkout: %w", err)
+	}
+	return &p, nil
+}
+
+// checkNoParticipation returns ErrActiveParticipation or ErrParticipationToday if a payment
+// for the challenge could not start a participation today
+func checkNoParticipation(ctx context.Context, tx pgx.Tx, userID int64, challengeID string, today time.Time) error {
+	var active, startedToday bool
+	err := tx.QueryRow(ctx, `
+		SELECT COALESCE(bool_or(status = 'active'), false), COALESCE(bool_or(start_date = $3), false)
+		FROM participation
+		WHERE user_id = $1 AND challenge_id = $2 AND (status = 'active' OR start_date = $3)
+	`, userID, challengeID, today).Scan(&active, &startedToday)
+	if err != nil {
+		return fmt.Errorf("check participation: %w", err)
+	}
+	switch {
+	case active:
+		return ErrActiveParticipation
+	case startedToday:
+		return ErrParticipationToday
+	}
+	return nil
+}
+
 // UpdatePaymentPayToken updates the pay_token for a payment
 func (s *Store) UpdatePaymentPayToken(ctx context.Context, paymentID int64, payToken string) error {
 	const q = `UPDATE payment SET pay_token = $1, updated_at = NOW() WHERE id = $2`
@@ -247,7 +427,10 @@ func (s *Store) ExecutePaymentByID(ctx context.Context, paymentID int64) (*Payme
 	return s.executePaymentInternal(ctx, "id", paymentID)
 }
 
-// executePaymentInternal is the shared implementation for ExecutePayment and ExecutePaymentByID
+// executePaymentInternal is the shared implementation for ExecutePayment and ExecutePaymentByID.
+// If the user already has an active participation in the challenge, or one that started
+// today, nothing is changed and ErrActiveParticipation or ErrParticipationToday is
+// returned: the payment stays 'created' and the caller must refund it.
 func (s *Store) executePaymentInternal(ctx context.Context, field string, value interface{}) (*Payment, error) {
 	tx, err := s.pool.Begin(ctx)
 	if err != nil {
@@ -255,6 +438,16 @@ func (s *Store) executePaymentInternal(ctx context.Context, field string, value
 	}
 	defer tx.Rollback(ctx)
 
+	// Lock the user like CreatePayment so concurrent executions are checked one at a time
+	lockQ := fmt.Sprintf(`
+		SELECT u.id FROM app_user u JOIN payment p ON p.user_id = u.id
+		WHERE p.%s = $1
+		FOR UPDATE OF u
+	`, field)
+	if _, err := tx.Exec(ctx, lockQ, value); err != nil {
+		return nil, fmt.Errorf("lock user: %w", err)
+	}
+
 	// Update payment status
 	updateQ := fmt.Sprintf(`
 		UPDATE payment SET status = 'done', updated_at = NOW()
@@ -271,39 +464,53 @@ func (s *Store) executePaymentInternal(ctx context.Context, field string, value
 		return nil, fmt.Errorf("update payment: %w", err)
 	}
 
-	// Get challenge days
-	var days int
-	err = tx.QueryRow(ctx, `SELECT days FROM challenge WHERE id = $1`, p.ChallengeID).Scan(&days)
+	startDate := s.today()
+	if err := checkNoParticipation(ctx, tx, p.UserID, p.ChallengeID, startDate); err != nil {
+		return nil, err
+	}
+
+	// Get challenge days and the chosen tier's and challenge's rules (snapshotted onto the participation)
+	var days, requiredProofs, multiplierBps, minSuccessBps, restDays int
+	var refundPolicy string
+	var tierID *int64
+	const rulesQ = `
+		SELECT c.days, t.id, COALESCE(t.required_proofs, 0), COALESCE(t.reward_multiplier_bps, $2),
+		       c.min_success_bps, c.rest_days, c.refund_policy
+		FROM payment p
+		JOIN challenge c ON c.id = p.challenge_id
+		LEFT JOIN challenge_tier t ON t.id = p.tier_id
+		WHERE p.id = $1
+	`
+	err = tx.QueryRow(ctx, rulesQ, p.ID, MultiplierOne).Scan(&days, &tierID, &requiredProofs, &multiplierBps,
+		&minSuccessBps, &restDays, &refundPolicy)
 	if err != nil {
-		return nil, fmt.Errorf("get challenge days: %w", err)
+		return nil, fmt.Errorf("get challenge rules: %w", err)
 	}
 
 	// Create participation
-	startDate := time.Now().Truncate(24 * time.Hour)
-	endDate := startDate.AddDate(0, 0, days-1)
+	endDate := s.cal.AddDays(startDate, days-1)
 	const partQ = `
-		INSERT INTO participation (user_id, challenge_id, payment_id, status, start_date, end_date)
-		VALUES ($1, $2, $3, 'active', $4, $5)
-		ON CONFLICT (user_id, challenge_id, start_date) DO NOTHING
+		INSERT INTO participation (user_id, challenge_id, payment_id, status, start_date, end_date, tier_id, required_proofs, reward_multiplier_bps,
+		                           min_success_bps, rest_days, refund_policy)
+		VALUES ($1, $2, $3, 'active', $4, $5, $6, $7, $8, $9, $10, $11)
 		RETURNING id
 	`
 	var partID int64
-	err = tx.QueryRow(ctx, partQ, p.UserID, p.ChallengeID, p.ID, startDate, endDate).Scan(&partID)
-	if err != nil && err != pgx.ErrNoRows {
+	err = tx.QueryRow(ctx, partQ, p.UserID, p.ChallengeID, p.ID, startDate, endDate, tierID, requiredProofs, multiplierBps,
+		minSuccessBps, restDays, refundPolicy).Scan(&partID)
+	if err != nil {
 		return nil, fmt.Errorf("create participation: %w", err)
 	}
 
 	// Create settlement record
-	if partID > 0 {
-		const settQ = `
-			INSERT INTO settlement (participation_id, user_id, challenge_id, payment_id, status, deposit_amount)
-			VALUES ($1, $2, $3, $4, 'running', $5)
-			ON CONFLICT (participation_id) DO NOTHING
-		`
-		_, err = tx.Exec(ctx, settQ, partID, p.UserID, p.ChallengeID, p.ID, p.Amount)
-		if err != nil {
-			return nil, fmt.Errorf("create settlement: %w", err)
-		}
+	const settQ = `
+		INSERT INTO settlement (participation_id, user_id, challenge_id, payment_id, status, deposit_amount)
+		VALUES ($1, $2, $3, $4, 'running', $5)
+		ON CONFLICT (participation_id) DO NOTHING
+	`
+	_, err = tx.Exec(ctx, settQ, partID, p.UserID, p.ChallengeID, p.ID, p.Amount)
+	if err != nil {
+		return nil, fmt.Errorf("create settlement: %w", err)
 	}
 
 	if err := tx.Commit(ctx); err != nil {
@@ -315,10 +522,10 @@ func (s *Store) executePaymentInternal(ctx context.Context, field string, value
 
 // GetPaymentByOrderNo returns a payment by order number
 func (s *Store) GetPaymentByOrderNo(ctx context.Context, orderNo string) (*Payment, error) {
-	const q = `SELECT id, user_id, challenge_id, order_no, amount, status, created_at FROM payment WHERE order_no = $1`
+	const q = `SELECT id, user_id, challenge_id, order_no, COALESCE(pay_token, ''), amount, status, created_at FROM payment WHERE order_no = $1`
 	var p Payment
 	err := s.pool.QueryRow(ctx, q, orderNo).
-		Scan(&p.ID, &p.UserID, &p.ChallengeID, &p.OrderNo, &p.Amount, &p.Status, &p.CreatedAt)
+		Scan(&p.ID, &p.UserID, &p.ChallengeID, &p.OrderNo, &p.PayToken, &p.Amount, &p.Status, &p.CreatedAt)
 	if err == pgx.ErrNoRows {
 		return nil, nil
 	}
@@ -330,6 +537,16 @@ func (s *Store) GetPaymentByOrderNo(ctx context.Context, orderNo string) (*Payme
 
 // ============ Proof Operations ============
 
+// Proof statuses. Only accepted proofs count towards participation.proof_count.
+const (
+	ProofAccepted = "accepted"
+	ProofPending  = "pending" // held for human review
+	ProofRejected = "rejected"
+)
+
+// ErrProofAlreadyAccepted is returned when a proof needing review would replace the day's accepted proof
+var ErrProofAlreadyAccepted = errors.New("proof already accepted for this day")
+
 type Proof struct {
 	ID              int64
 	ParticipationID int64
@@ -338,22 +555,40 @@ type Proof struct {
 	ProofDate       time.Time
 	ProofType       string
 	ImageHash       string
+	ImageURL        string     // stored photo (see RecordProofImage); empty if not stored or purged
+	ExifTimestamp   *time.Time // photo capture time from EXIF; nil if unavailable
 	Status          string
+	ReviewReason    string     // why a pending proof needs review
+	RejectReason    string     // reviewer's reason for a rejected proof
+	ReviewedBy      string     // reviewer who decided a pending proof; empty if accepted automatically
+	VerifiedAt      *time.Time // when the proof was accepted or rejected
 	CreatedAt       time.Time
 }
 
+const proofColumns = `id, participation_id, user_id, challenge_id, proof_date, proof_type, COALESCE(image_hash, ''), COALESCE(image_url, ''), exif_timestamp, status,
+	COALESCE(review_reason, ''), COALESCE(reject_reason, ''), COALESCE(reviewed_by, ''), verified_at, created_at`
+
+func scanProof(row pgx.Row, p *Proof) error {
+	return row.Scan(proofDest(p)...)
+}
+
+// proofDest returns the scan destinations for proofColumns
+func proofDest(p *Proof) []any {
+	return []any{&p.ID, &p.ParticipationID, &p.UserID, &p.ChallengeID, &p.ProofDate, &p.ProofType, &p.ImageHash, &p.ImageURL, &p.ExifTimestamp, &p.Status,
+		&p.ReviewReason, &p.RejectReason, &p.ReviewedBy, &p.VerifiedAt, &p.CreatedAt}
+}
+
 // CheckDuplicateProofHash checks if an image hash has been used before by any user
 // Returns the userID and challengeID of the existing proof if found
 func (s *Store) CheckDuplicateProofHash(ctx context.Context, imageHash string, excludeUserID int64) (*Proof, error) {
 	const q = `
-		SELECT id, participation_id, user_id, challenge_id, proof_date, proof_type, image_hash, status, created_at
+		SELECT ` + proofColumns + `
 		FROM proof
-		WHERE image_hash = $1 AND user_id != $2 AND status = 'accepted'
+		WHERE image_hash = $1 AND user_id != $2 AND status IN ('accepted', 'pending')
 		LIMIT 1
 	`
 	var p Proof
-	err := s.pool.QueryRow(ctx, q, imageHash, excludeUserID).
-		Scan(&p.ID, &p.ParticipationID, &p.UserID, &p.ChallengeID, &p.ProofDate, &p.ProofType, &p.ImageHash, &p.Status, &p.CreatedAt)
+	err := scanProof(s.pool.QueryRow(ctx, q, imageHash, excludeUserID), &p)
 	if err == pgx.ErrNoRows {
 		return nil, nil // No duplicate found
 	}
@@ -366,14 +601,13 @@ func (s *Store) CheckDuplicateProofHash(ctx context.Context, imageHash string, e
 // CheckSameUserDuplicateHash checks if the same user has already used this image hash
 func (s *Store) CheckSameUserDuplicateHash(ctx context.Context, imageHash string, userID int64) (*Proof, error) {
 	const q = `
-		SELECT id, participation_id, user_id, challenge_id, proof_date, proof_type, image_hash, status, created_at
+		SELECT ` + proofColumns + `
 		FROM proof
-		WHERE image_hash = $1 AND user_id = $2 AND status = 'accepted'
+		WHERE image_hash = $1 AND user_id = $2 AND status IN ('accepted', 'pending')
 		LIMIT 1
 	`
 	var p Proof
-	err := s.pool.QueryRow(ctx, q, imageHash, userID).
-		Scan(&p.ID, &p.ParticipationID, &p.UserID, &p.ChallengeID, &p.ProofDate, &p.ProofType, &p.ImageHash, &p.Status, &p.CreatedAt)
+	err := scanProof(s.pool.QueryRow(ctx, q, imageHash, userID), &p)
 	if err == pgx.ErrNoRows {
 		return nil, nil // No duplicate found
 	}
@@ -383,10 +617,29 @@ func (s *Store) CheckSameUserDuplicateHash(ctx context.Context, imageHash string
 	return &p, nil
 }
 
-// SubmitProof creates a new proof record
-func (s *Store) SubmitProof(ctx context.Context, userID int64, challengeID, proofType, imageHash string) (*Proof, error) {
+// ProofSubmission is a validated proof to record
+type ProofSubmission struct {
+	UserID        int64
+	ChallengeID   string
+	ProofType     string
+	ImageHash     string
+	ImageURL      string     // stored photo; empty if image storage is not configured
+	ProofDate     time.Time  // challenge date the proof counts for; zero means today
+	ExifTimestamp *time.Time // photo capture time the proof was validated against
+	// PerceptualHash is the image's dHash for near-duplicate lookups; nil for steps proofs
+	PerceptualHash *uint64
+	ReviewReason   string // non-empty holds the proof as pending for human review instead of accepting it
+}
+
+// SubmitProof records a proof for the participation covering its proof date. A resubmission
+// replaces the day's proof, except that a proof needing review never replaces an accepted
+// one (ErrProofAlreadyAccepted).
+func (s *Store) SubmitProof(ctx context.Context, sub ProofSubmission) (*Proof, error) {
 	// Find active participation
-	today := time.Now().Truncate(24 * time.Hour)
+	proofDate := sub.ProofDate
+	if proofDate.IsZero() {
+		proofDate = s.today()
+	}
 	const partQ = `
 		SELECT id FROM participation
 		WHERE user_id = $1 AND challenge_id = $2 AND status = 'active'
@@ -394,7 +647,7 @@ func (s *Store) SubmitProof(ctx context.Context, userID int64, challengeID, proo
 		LIMIT 1
 	`
 	var partID int64
-	err := s.pool.QueryRow(ctx, partQ, userID, challengeID, today).Scan(&partID)
+	err := s.pool.QueryRow(ctx, partQ, sub.UserID, sub.ChallengeID, proofDate).Scan(&partID)
 	if err == pgx.ErrNoRows {
 		return nil, fmt.Errorf("no active participation found")
 	}
@@ -402,36 +655,66 @@ func (s *Store) SubmitProof(ctx context.Context, userID int64, challengeID, proo
 		return nil, fmt.Errorf("find participation: %w", err)
 	}
 
-	// Create proof
+	// Create proof: accepted right away, or pending until reviewed
+	status := ProofAccepted
+	var verifiedAt *time.Time
+	if sub.ReviewReason != "" {
+		status = ProofPending
+	} else {
+		now := s.now()
+		verifiedAt = &now
+	}
 	const proofQ = `
-		INSERT INTO proof (participation_id, user_id, challenge_id, proof_date, proof_type, image_hash, status)
-		VALUES ($1, $2, $3, $4, $5, $6, 'accepted')
+		INSERT INTO proof (participation_id, user_id, challenge_id, proof_date, proof_type, image_hash, exif_timestamp, status, review_reason, verified_at, phash, image_url)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), $10, $11, NULLIF($12, ''))
 		ON CONFLICT (participation_id, proof_date) DO UPDATE SET
 			image_hash = EXCLUDED.image_hash,
-			status = 'accepted',
+			image_url = EXCLUDED.image_url,
+			phash = EXCLUDED.phash,
+			exif_timestamp = EXCLUDED.exif_timestamp,
+			status = EXCLUDED.status,
+			review_reason = EXCLUDED.review_reason,
+			reject_reason = NULL,
+			reviewed_by = NULL,
+			verified_at = EXCLUDED.verified_at,
 			created_at = NOW()
-		RETURNING id, participation_id, user_id, challenge_id, proof_date, proof_type, image_hash, status, created_at
+		WHERE proof.status <> 'accepted' OR EXCLUDED.status = 'accepted'
+		RETURNING ` + proofColumns + `
 	`
+	var phash *int64 // stored as the signed BIGINT with the same bits
+	if sub.PerceptualHash != nil {
+		v := int64(*sub.PerceptualHash)
+		phash = &v
+	}
 	var p Proof
-	err = s.pool.QueryRow(ctx, proofQ, partID, userID, challengeID, today, proofType, imageHash).
-		Scan(&p.ID, &p.ParticipationID, &p.UserID, &p.ChallengeID, &p.ProofDate, &p.ProofType, &p.ImageHash, &p.Status, &p.CreatedAt)
+	err = scanProof(s.pool.QueryRow(ctx, proofQ, partID, sub.UserID, sub.ChallengeID, proofDate, sub.ProofType, sub.ImageHash, sub.ExifTimestamp,
+		status, sub.ReviewReason, verifiedAt, phash, sub.ImageURL), &p)
+	if err == pgx.ErrNoRows {
+		return nil, ErrProofAlreadyAccepted
+	}
 	if err != nil {
 		return nil, fmt.Errorf("create proof: %w", err)
 	}
 
-	// Update participation proof count
-	const updateQ = `
+	if err := updateProofCount(ctx, s.pool, partID); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// updateProofCount recomputes a participation's proof_count from its accepted proofs
+func updateProofCount(ctx context.Context, db execer, participationID int64) error {
+	const q = `
 		UPDATE participation SET
 			proof_count = (SELECT COUNT(*) FROM proof WHERE participation_id = $1 AND status = 'accepted'),
 			updated_at = NOW()
 		WHERE id = $1
 	`
-	_, err = s.pool.Exec(ctx, updateQ, partID)
-	if err != nil {
-		return nil, fmt.Errorf("update proof count: %w", err)
+	if _, err := db.Exec(ctx, q, participationID); err != nil {
+		return fmt.Errorf("update proof count: %w", err)
 	}
-
-	return &p, nil
+	return nil
 }
 
 // ============ Settlement Operations ============
@@ -443,7 +726,9 @@ type Settlement struct {
 	Status        string
 	Refundable    bool
 	DepositAmount int64
+	RefundAmount  int64 // part of the deposit paid back; less than DepositAmount on partial success
 	RewardAmount  int64
+	SettledAt     *time.Time // set once the payout has been granted
 	Message       string
 	CreatedAt     time.Time
 }
@@ -451,8 +736,8 @@ type Settlement struct {
 // ListSettlementsByUser returns all settlements for a user
 func (s *Store) ListSettlementsByUser(ctx context.Context, userID int64) ([]Settlement, error) {
 	const q = `
-		SELECT s.id, s.user_id, s.challenge_id, s.status, s.refundable, s.deposit_amount, s.reward_amount, s.created_at,
-		       p.proof_count, c.days
+		SELECT s.id, s.user_id, s.challenge_id, s.status, s.refundable, s.deposit_amount, s.refund_amount, s.reward_amount, s.settled_at, s.created_at,
+		       p.proof_count, COALESCE(NULLIF(p.required_proofs, 0), c.days)
 		FROM settlement s
 		JOIN participation p ON s.participation_id = p.id
 		JOIN challenge c ON s.challenge_id = c.id
@@ -470,7 +755,7 @@ func (s *Store) ListSettlementsByUser(ctx context.Context, userID int64) ([]Sett
 		var sett Settlement
 		var proofCount, days int
 		if err := rows.Scan(&sett.ID, &sett.UserID, &sett.ChallengeID, &sett.Status, &sett.Refundable,
-			&sett.DepositAmount, &sett.RewardAmount, &sett.CreatedAt, &proofCount, &days); err != nil {
+			&sett.DepositAmount, &sett.RefundAmount, &sett.RewardAmount, &sett.SettledAt, &sett.CreatedAt, &proofCount, &days); err != nil {
 			return nil, fmt.Errorf("scan settlement: %w", err)
 		}
 
@@ -480,8 +765,20 @@ func (s *Store) ListSettlementsByUser(ctx context.Context, userID int64) ([]Sett
 			sett.Message = fmt.Sprintf("진행중 (%d/%d일 완료)", proofCount, days)
 		case "success":
 			sett.Message = "성공! 환급 예정"
+			if sett.SettledAt != nil {
+				sett.Message = "성공! 환급 완료"
+			}
+			if sett.RefundAmount < sett.DepositAmount {
+				pct := sett.RefundAmount * 100 / max(sett.DepositAmount, 1)
+				sett.Message = fmt.Sprintf("부분 성공 (%d%% 환급 예정)", pct)
+				if sett.SettledAt != nil {
+					sett.Message = fmt.Sprintf("부분 성공 (%d%% 환급 완료)", pct)
+				}
+			}
 		case "failed":
 			sett.Message = "미완료"
+		case "cancelled":
+			sett.Message = "참가 취소 (환불 완료)"
 		}
 
 		list = append(list, sett)
@@ -491,30 +788,82 @@ func (s *Store) ListSettlementsByUser(ctx context.Context, userID int64) ([]Sett
 
 // ============ Idempotency Operations ============
 
-// CheckIdempotency checks if an idempotency key exists
-func (s *Store) CheckIdempotency(ctx context.Context, scope, key string) (bool, error) {
-	const q = `SELECT 1 FROM idempotency WHERE scope = $1 AND idem_key = $2 AND expires_at > NOW()`
-	var exists int
-	err := s.pool.QueryRow(ctx, q, scope, key).Scan(&exists)
+// IdempotencyRecord is the stored state of an idempotent request
+type IdempotencyRecord struct {
+	RequestHash string
+	StatusCode  int    // 0 while the first request is still in flight
+	Response    []byte // JSON response body, nil while in flight
+}
+
+// Completed reports whether the first request finished and its response can be replayed
+func (r *IdempotencyRecord) Completed() bool {
+	return r.StatusCode != 0
+}
+
+// IdempotencyLease is how long an in-flight reservation blocks retries before
+// another request may take it over (e.g. the first one crashed mid-request)
+const IdempotencyLease = 2 * time.Minute
+
+// ReserveIdempotency claims (scope, key, userSub) for a new request.
+// It returns reserved=true if the caller should process the request, or the existing
+// record (in flight or completed) otherwise. Expired records and stale in-flight
+// reservations are taken over.
+func (s *Store) ReserveIdempotency(ctx context.Context, scope, key, userSub, requestHash string, ttl time.Duration) (*IdempotencyRecord, bool, error) {
+	const reserveQ = `
+		INSERT INTO idempotency (scope, idem_key, user_sub, request_hash, response_json, status_code, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, NULL, NULL, $7, $5)
+		ON CONFLICT (scope, idem_key, user_sub) DO UPDATE
+		SET request_hash = EXCLUDED.request_hash, response_json = NULL, status_code = NULL,
+		    created_at = $7, expires_at = EXCLUDED.expires_at
+		WHERE idempotency.expires_at <= $7
+		   OR (idempotency.status_code IS NULL AND idempotency.created_at < $6)
+		RETURNING 1
+	`
+	var one int
+	now := s.now()
+	err := s.pool.QueryRow(ctx, reserveQ, scope, key, userSub, requestHash, now.Add(ttl), now.Add(-IdempotencyLease), now).Scan(&one)
+	if err == nil {
+		return nil, true, nil
+	}
+	if err != pgx.ErrNoRows {
+		return nil, false, fmt.Errorf("reserve idempotency: %w", err)
+	}
+
+	const getQ = `
+		SELECT request_hash, COALESCE(status_code, 0), response_json
+		FROM idempotency WHERE scope = $1 AND idem_key = $2 AND user_sub = $3
+	`
+	var rec IdempotencyRecord
+	err = s.pool.QueryRow(ctx, getQ, scope, key, userSub).Scan(&rec.RequestHash, &rec.StatusCode, &rec.Response)
 	if err == pgx.ErrNoRows {
-		return false, nil
+		// Released between our insert and read; let the caller retry.
+		return nil, false, fmt.Errorf("reserve idempotency: record vanished")
 	}
 	if err != nil {
-		return false, fmt.Errorf("check idempotency: %w", err)
+		return nil, false, fmt.Errorf("get idempotency: %w", err)
 	}
-	return true, nil
+	return &rec, false, nil
 }
 
-// SetIdempotency stores an idempotency key
-func (s *Store) SetIdempotency(ctx context.Context, scope, key string, ttl time.Duration) error {
+// CompleteIdempotency stores the response of a reserved request for replay
+func (s *Store) CompleteIdempotency(ctx context.Context, scope, key, userSub string, statusCode int, responseJSON []byte) error {
 	const q = `
-		INSERT INTO idempotency (scope, idem_key, response_json, expires_at)
-		VALUES ($1, $2, '{}', $3)
-		ON CONFLICT (scope, idem_key) DO NOTHING
+		UPDATE idempotency SET status_code = $4, response_json = $5
+		WHERE scope = $1 AND idem_key = $2 AND user_sub = $3
 	`
-	_, err := s.pool.Exec(ctx, q, scope, key, time.Now().Add(ttl))
+	_, err := s.pool.Exec(ctx, q, scope, key, userSub, statusCode, responseJSON)
+	if err != nil {
+		return fmt.Errorf("complete idempotency: %w", err)
+	}
+	return nil
+}
+
+// ReleaseIdempotency drops an in-flight reservation so the request can be retried
+func (s *Store) ReleaseIdempotency(ctx context.Context, scope, key, userSub string) error {
+	const q = `DELETE FROM idempotency WHERE scope = $1 AND idem_key = $2 AND user_sub = $3 AND status_code IS NULL`
+	_, err := s.pool.Exec(ctx, q, scope, key, userSub)
 	if err != nil {
-		return fmt.Errorf("set idempotency: %w", err)
+		return fmt.Errorf("release idempotency: %w", err)
 	}
 	return nil
 }
@@ -549,6 +898,20 @@ func (s *Store) IsSessionRevoked(ctx context.Context, userSub string) (bool, err
 	return true, nil
 }
 
+// GetSessionRevokedAt returns when a user's sessions were last revoked, or nil if never
+func (s *Store) GetSessionRevokedAt(ctx context.Context, userSub string) (*time.Time, error) {
+	const q = `SELECT revoked_at FROM revoked_session WHERE user_sub = $1`
+	var at time.Time
+	err := s.pool.QueryRow(ctx, q, userSub).Scan(&at)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get revoked_at: %w", err)
+	}
+	return &at, nil
+}
+
 // ============ Batch Job Operations ============
 
 // BatchResult holds the result of a batch operation
@@ -558,18 +921,23 @@ type BatchResult struct {
 	Errors    []string
 }
 
-// CloseExpiredParticipations marks participations as completed or failed based on end_date
+// CloseExpiredParticipations marks participations as success or failed based on end_date,
+// applying the rules snapshotted at enrollment (see SuccessRule) and fixing the refund share.
+// Participations with proofs or appeals still pending review are held until every one is decided.
 // Returns the number of participations processed
 func (s *Store) CloseExpiredParticipations(ctx context.Context) (*BatchResult, error) {
-	today := time.Now().Truncate(24 * time.Hour)
+	today := s.today()
 	result := &BatchResult{Errors: []string{}}
 
 	// Find all active participations that have ended
 	const findQ = `
-		SELECT p.id, p.user_id, p.challenge_id, p.proof_count, c.days
+		SELECT p.id, p.user_id, p.challenge_id, p.proof_count, COALESCE(NULLIF(p.required_proofs, 0), c.days),
+		       p.min_success_bps, p.rest_days, p.refund_policy
 		FROM participation p
 		JOIN challenge c ON p.challenge_id = c.id
 		WHERE p.status = 'active' AND p.end_date < $1
+		AND NOT EXISTS (SELECT 1 FROM proof pr WHERE pr.participation_id = p.id AND pr.status = 'pending')
+		AND NOT EXISTS (SELECT 1 FROM proof_appeal a WHERE a.participation_id = p.id AND a.status = 'pending')
 	`
 	rows, err := s.pool.Query(ctx, findQ, today)
 	if err != nil {
@@ -582,12 +950,13 @@ func (s *Store) CloseExpiredParticipations(ctx context.Context) (*BatchResult, e
 		UserID      int64
 		ChallengeID string
 		ProofCount  int
-		Days        int
+		Rule        SuccessRule
 	}
 	var expired []expiredPart
 	for rows.Next() {
 		var ep expiredPart
-		if err := rows.Scan(&ep.ID, &ep.UserID, &ep.ChallengeID, &ep.ProofCount, &ep.Days); err != nil {
+		if err := rows.Scan(&ep.ID, &ep.UserID, &ep.ChallengeID, &ep.ProofCount, &ep.Rule.Required,
+			&ep.Rule.MinSuccessBps, &ep.Rule.RestDays, &ep.Rule.RefundPolicy); err != nil {
 			result.Failed++
 			result.Errors = append(result.Errors, fmt.Sprintf("scan: %v", err))
 			continue
@@ -598,12 +967,13 @@ func (s *Store) CloseExpiredParticipations(ctx context.Context) (*BatchResult, e
 	// Update each participation
 	for _, ep := range expired {
 		newStatus := "failed"
-		if ep.ProofCount >= ep.Days {
+		ok, refundBps := ep.Rule.Evaluate(ep.ProofCount)
+		if ok {
 			newStatus = "success"
 		}
 
-		const updateQ = `UPDATE participation SET status = $1, updated_at = NOW() WHERE id = $2`
-		_, err := s.pool.Exec(ctx, updateQ, newStatus, ep.ID)
+		const updateQ = `UPDATE participation SET status = $1, refund_bps = $2, updated_at = NOW() WHERE id = $3`
+		_, err := s.pool.Exec(ctx, updateQ, newStatus, refundBps, ep.ID)
 		if err != nil {
 			result.Failed++
 			result.Errors = append(result.Errors, fmt.Sprintf("update participation %d: %v", ep.ID, err))
@@ -615,7 +985,8 @@ func (s *Store) CloseExpiredParticipations(ctx context.Context) (*BatchResult, e
 	return result, nil
 }
 
-// UpdateSettlementStatuses updates settlement records based on participation status
+// UpdateSettlementStatuses updates settlement records based on participation status.
+// Rewards are computed afterwards per cohort (see ListPendingCohorts).
 func (s *Store) UpdateSettlementStatuses(ctx context.Context) (*BatchResult, error) {
 	result := &BatchResult{Errors: []string{}}
 
@@ -625,13 +996,14 @@ func (s *Store) UpdateSettlementStatuses(ctx context.Context) (*BatchResult, err
 		SET
 			status = p.status,
 			refundable = (p.status = 'success'),
+			refund_amount = s.deposit_amount * p.refund_bps / $1,
 			updated_at = NOW()
 		FROM participation p
 		WHERE s.participation_id = p.id
 		AND s.status = 'running'
 		AND p.status IN ('success', 'failed')
 	`
-	tag, err := s.pool.Exec(ctx, updateQ)
+	tag, err := s.pool.Exec(ctx, updateQ, MultiplierOne)
 	if err != nil {
 		return nil, fmt.Errorf("update settlements: %w", err)
 	}
@@ -644,8 +1016,8 @@ func (s *Store) UpdateSettlementStatuses(ctx context.Context) (*BatchResult, err
 func (s *Store) CleanupExpiredIdempotencyKeys(ctx context.Context) (*BatchResult, error) {
 	result := &BatchResult{Errors: []string{}}
 
-	const deleteQ = `DELETE FROM idempotency WHERE expires_at < NOW()`
-	tag, err := s.pool.Exec(ctx, deleteQ)
+	const deleteQ = `DELETE FROM idempotency WHERE expires_at < $1`
+	tag, err := s.pool.Exec(ctx, deleteQ, s.now())
 	if err != nil {
 		return nil, fmt.Errorf("cleanup idempotency: %w", err)
 	}
@@ -658,7 +1030,7 @@ func (s *Store) CleanupExpiredIdempotencyKeys(ctx context.Context) (*BatchResult
 func (s *Store) CleanupOldRevokedSessions(ctx context.Context) (*BatchResult, error) {
 	result := &BatchResult{Errors: []string{}}
 
-	cutoff := time.Now().Add(-30 * 24 * time.Hour)
+	cutoff := s.now().Add(-30 * 24 * time.Hour)
 	const deleteQ = `DELETE FROM revoked_session WHERE revoked_at < $1`
 	tag, err := s.pool.Exec(ctx, deleteQ, cutoff)
 	if err != nil {
@@ -675,6 +1047,8 @@ type BatchStats struct {
 	RunningSettlements     int
 	PendingIdempotencyKeys int
 	RevokedSessions        int
+	PendingProofs          int // waiting for human review
+	PendingAppeals         int
 }
 
 func (s *Store) GetBatchStats(ctx context.Context) (*BatchStats, error) {
@@ -693,7 +1067,7 @@ func (s *Store) GetBatchStats(ctx context.Context) (*BatchStats, error) {
 	}
 
 	// Pending idempotency keys
-	err = s.pool.QueryRow(ctx, `SELECT COUNT(*) FROM idempotency WHERE expires_at > NOW()`).Scan(&stats.PendingIdempotencyKeys)
+	err = s.pool.QueryRow(ctx, `SELECT COUNT(*) FROM idempotency WHERE expires_at > $1`, s.now()).Scan(&stats.PendingIdempotencyKeys)
 	if err != nil {
 		return nil, fmt.Errorf("count idempotency keys: %w", err)
 	}
@@ -704,5 +1078,17 @@ func (s *Store) GetBatchStats(ctx context.Context) (*BatchStats, error) {
 		return nil, fmt.Errorf("count revoked sessions: %w", err)
 	}
 
+	// Proofs waiting for review
+	err = s.pool.QueryRow(ctx, `SELECT COUNT(*) FROM proof WHERE status = 'pending'`).Scan(&stats.PendingProofs)
+	if err != nil {
+		return nil, fmt.Errorf("count pending proofs: %w", err)
+	}
+
+	// Appeals waiting for review
+	err = s.pool.QueryRow(ctx, `SELECT COUNT(*) FROM proof_appeal WHERE status = 'pending'`).Scan(&stats.PendingAppeals)
+	if err != nil {
+		return nil, fmt.Errorf("count pending appeals: %w", err)
+	}
+
 	return stats, nil
 }
@@ -2,9 +2,12 @@ package store
 
 import (
 	"context"
+	"math/rand"
 	"os"
 	"testing"
 	"time"
+
+	"habitcashback/internal/clock"
 )
 
 // TestNew_MissingDatabaseURL tests that New returns an error when DATABASE_URL is not set
@@ -86,7 +89,96 @@ func TestChallenge_Fields(t *testing.T) {
 	}
 }
 
+func TestChallenge_OpenAt(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	before, after := now.Add(-time.Hour), now.Add(time.Hour)
+
+	tests := []struct {
+		name string
+		c    Challenge
+		want bool
+	}{
+		{"Active without schedule", Challenge{IsActive: true}, true},
+		{"Inactive", Challenge{IsActive: false}, false},
+		{"Not started yet", Challenge{IsActive: true, StartsAt: &after}, false},
+		{"Started", Challenge{IsActive: true, StartsAt: &before}, true},
+		{"Ended", Challenge{IsActive: true, EndsAt: &before}, false},
+		{"Ends exactly now", Challenge{IsActive: true, EndsAt: &now}, false},
+		{"Within window", Challenge{IsActive: true, StartsAt: &before, EndsAt: &after}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.c.OpenAt(now); got != tt.want {
+				t.Errorf("OpenAt = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 // TestPayment struct validation
+func TestSuccessRule_Evaluate(t *testing.T) {
+	tests := []struct {
+		name       string
+		rule       SuccessRule
+		proofs     int
+		wantOK     bool
+		wantRefund int
+	}{
+		{"All or nothing, complete", SuccessRule{Required: 30}, 30, true, 10000},
+		{"All or nothing, one day missed", SuccessRule{Required: 30}, 29, false, 0},
+		{"Rest day covers a miss", SuccessRule{Required: 30, RestDays: 1}, 29, true, 10000},
+		{"Rest days do not exceed required", SuccessRule{Required: 3, RestDays: 2, RefundPolicy: RefundProportional}, 3, true, 10000},
+		{"Ratio met, full refund", SuccessRule{Required: 30, MinSuccessBps: 9000}, 27, true, 10000},
+		{"Ratio rounds up", SuccessRule{Required: 30, MinSuccessBps: 9000}, 26, false, 0},
+		{"Proportional 2 of 3", SuccessRule{Required: 3, MinSuccessBps: 5000, RefundPolicy: RefundProportional}, 2, true, 6666},
+		{"Proportional below minimum", SuccessRule{Required: 3, MinSuccessBps: 5000, RefundPolicy: RefundProportional}, 1, false, 0},
+		{"Proportional with rest day", SuccessRule{Required: 30, MinSuccessBps: 5000, RestDays: 2, RefundPolicy: RefundProportional}, 25, true, 9000},
+		{"No proofs", SuccessRule{Required: 3, MinSuccessBps: 5000}, 0, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, refund := tt.rule.Evaluate(tt.proofs)
+			if ok != tt.wantOK || refund != tt.wantRefund {
+				t.Errorf("Evaluate(%d) = %t, %d; want %t, %d", tt.proofs, ok, refund, tt.wantOK, tt.wantRefund)
+			}
+		})
+	}
+}
+
+func TestPhashBands(t *testing.T) {
+	// Every bit belongs to exactly one band
+	for bit := 0; bit < 64; bit++ {
+		a, b := phashBands(0), phashBands(1<<bit)
+		changed := 0
+		for i := range a {
+			if a[i] != b[i] {
+				changed++
+			}
+		}
+		if changed != 1 {
+			t.Fatalf("bit %d changes %d bands, want 1", bit, changed)
+		}
+	}
+
+	// Hashes within MaxSimilarDistance always share a band
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		h := rng.Uint64()
+		other := h
+		for _, bit := range rng.Perm(64)[:MaxSimilarDistance] {
+			other ^= 1 << bit
+		}
+		a, b := phashBands(h), phashBands(other)
+		shared := false
+		for j := range a {
+			shared = shared || a[j] == b[j]
+		}
+		if !shared {
+			t.Fatalf("%x and %x are %d bits apart but share no band", h, other, MaxSimilarDistance)
+		}
+	}
+}
+
 func TestPayment_Fields(t *testing.T) {
 	p := Payment{
 		ID:          1,
@@ -268,6 +360,53 @@ func TestIntegration_GetOrCreateUser(t *testing.T) {
 	}
 }
 
+func TestIntegration_UnlinkSurvivesRelogin(t *testing.T) {
+	store := skipIfNoDatabase(t)
+	defer store.Close()
+
+	ctx := context.Background()
+	testKey := "test-unlink-" + time.Now().Format("20060102150405.000")
+	user, err := store.GetOrCreateUser(ctx, testKey)
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if _, err := store.UnlinkUser(ctx, testKey, "test"); err != nil {
+		t.Fatalf("failed to unlink: %v", err)
+	}
+
+	pending := func() bool {
+		list, err := store.ListPendingUnlinks(ctx, 1000)
+		if err != nil {
+			t.Fatalf("failed to list pending unlinks: %v", err)
+		}
+		for _, u := range list {
+			if u.ID == user.ID {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Logging in again before the unlink job runs must not drop the unlink
+	if u, err := store.GetOrCreateUser(ctx, testKey); err != nil || u.Status != "unlinked" {
+		t.Fatalf("expected user to stay unlinked, got %+v, %v", u, err)
+	}
+	if !pending() {
+		t.Fatal("expected unlink to stay pending after relogin")
+	}
+
+	// Once handled, the next login reactivates the user
+	if err := store.CompleteUnlink(ctx, user.ID, map[string]string{}); err != nil {
+		t.Fatalf("failed to complete unlink: %v", err)
+	}
+	if u, err := store.GetOrCreateUser(ctx, testKey); err != nil || u.Status != "active" {
+		t.Fatalf("expected user to be reactivated, got %+v, %v", u, err)
+	}
+	if pending() {
+		t.Error("expected no pending unlink after reactivation")
+	}
+}
+
 func TestIntegration_ListChallenges(t *testing.T) {
 	store := skipIfNoDatabase(t)
 	defer store.Close()
@@ -306,28 +445,39 @@ func TestIntegration_Idempotency(t *testing.T) {
 	scope := "test"
 	key := "idem-" + time.Now().Format("20060102150405.000")
 
-	// First check should return false
-	exists, err := store.CheckIdempotency(ctx, scope, key)
+	// First request reserves the key
+	_, reserved, err := store.ReserveIdempotency(ctx, scope, key, "user-a", "hash", time.Hour)
 	if err != nil {
-		t.Fatalf("failed to check idempotency: %v", err)
+		t.Fatalf("failed to reserve idempotency: %v", err)
 	}
-	if exists {
-		t.Error("expected idempotency key to not exist initially")
+	if !reserved {
+		t.Fatal("expected first request to reserve the key")
 	}
 
-	// Set the key
-	err = store.SetIdempotency(ctx, scope, key, 1*time.Hour)
+	// A retry while in flight sees an incomplete record
+	rec, reserved, err := store.ReserveIdempotency(ctx, scope, key, "user-a", "hash", time.Hour)
 	if err != nil {
-		t.Fatalf("failed to set idempotency: %v", err)
+		t.Fatalf("failed to reserve idempotency: %v", err)
+	}
+	if reserved || rec.Completed() {
+		t.Fatalf("expected in-flight record, got reserved=%v rec=%+v", reserved, rec)
+	}
+
+	// Another user may use the same key
+	if _, reserved, _ := store.ReserveIdempotency(ctx, scope, key, "user-b", "hash", time.Hour); !reserved {
+		t.Error("expected keys to be scoped per user")
 	}
 
-	// Second check should return true
-	exists, err = store.CheckIdempotency(ctx, scope, key)
+	// Completed responses are replayed
+	if err := store.CompleteIdempotency(ctx, scope, key, "user-a", 200, []byte(`{"paymentId":1}`)); err != nil {
+		t.Fatalf("failed to complete idempotency: %v", err)
+	}
+	rec, reserved, err = store.ReserveIdempotency(ctx, scope, key, "user-a", "hash", time.Hour)
 	if err != nil {
-		t.Fatalf("failed to check idempotency: %v", err)
+		t.Fatalf("failed to reserve idempotency: %v", err)
 	}
-	if !exists {
-		t.Error("expected idempotency key to exist after setting")
+	if reserved || !rec.Completed() || rec.StatusCode != 200 {
+		t.Errorf("expected completed record, got reserved=%v rec=%+v", reserved, rec)
 	}
 }
 
@@ -362,3 +512,215 @@ func TestIntegration_RevokedSessions(t *testing.T) {
 		t.Error("expected session to be revoked after revoking")
 	}
 }
+
+func TestIntegration_RefreshTokenRotation(t *testing.T) {
+	store := skipIfNoDatabase(t)
+	defer store.Close()
+
+	ctx := context.Background()
+	suffix := time.Now().Format("20060102150405.000000")
+	userSub := "test-refresh-" + suffix
+	expires := time.Now().Add(time.Hour)
+
+	if _, err := store.CreateRefreshToken(ctx, "h1-"+suffix, "fam-"+suffix, userSub, "device-a", expires); err != nil {
+		t.Fatalf("failed to create refresh token: %v", err)
+	}
+
+	// First rotation succeeds and keeps the family
+	next, err := store.RotateRefreshToken(ctx, "h1-"+suffix, "h2-"+suffix, expires)
+	if err != nil {
+		t.Fatalf("failed to rotate: %v", err)
+	}
+	if next.FamilyID != "fam-"+suffix || next.UserSub != userSub || next.DeviceID != "device-a" {
+		t.Errorf("unexpected rotated token: %+v", next)
+	}
+
+	// Replaying the old token revokes the family
+	if _, err := store.RotateRefreshToken(ctx, "h1-"+suffix, "h3-"+suffix, expires); err != ErrRefreshTokenReused {
+		t.Fatalf("expected ErrRefreshTokenReused, got %v", err)
+	}
+	if _, err := store.RotateRefreshToken(ctx, "h2-"+suffix, "h4-"+suffix, expires); err != ErrRefreshTokenInvalid {
+		t.Fatalf("expected family to be revoked, got %v", err)
+	}
+}
+
+func TestIntegration_CreatePaymentBlocksActiveParticipation(t *testing.T) {
+	store := skipIfNoDatabase(t)
+	defer store.Close()
+	clk := clock.NewFake(time.Now())
+	store.SetClock(clk)
+
+	ctx := context.Background()
+	suffix := time.Now().Format("20060102150405.000000")
+	user, err := store.GetOrCreateUser(ctx, "test-pay-"+suffix)
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	p, err := store.CreatePayment(ctx, user.ID, "walk-7000", "ord-a-"+suffix, 10000, 0)
+	if err != nil {
+		t.Fatalf("failed to create payment: %v", err)
+	}
+	// A fresh checkout blocks a second one
+	if _, err := store.CreatePayment(ctx, user.ID, "walk-7000", "ord-b-"+suffix, 10000, 0); err != ErrCheckoutInProgress {
+		t.Fatalf("expected ErrCheckoutInProgress, got %v", err)
+	}
+	if pending, err := store.GetPendingCheckout(ctx, user.ID, "walk-7000"); err != nil || pending == nil || pending.ID != p.ID {
+		t.Fatalf("expected the pending checkout to be returned for resuming, got %+v (%v)", pending, err)
+	}
+	// An abandoned checkout does not block a retry
+	clk.Advance(CheckoutHold + time.Minute)
+	q, err := store.CreatePayment(ctx, user.ID, "walk-7000", "ord-b-"+suffix, 10000, 0)
+	if err != nil {
+		t.Fatalf("expected retry after the checkout hold to be allowed: %v", err)
+	}
+	if _, err := store.ExecutePaymentByID(ctx, p.ID); err != nil {
+		t.Fatalf("failed to execute payment: %v", err)
+	}
+	// The abandoned checkout paid late: executing it must not succeed silently
+	if _, err := store.ExecutePaymentByID(ctx, q.ID); err != ErrActiveParticipation {
+		t.Errorf("expected ErrActiveParticipation executing the second payment, got %v", err)
+	}
+	if cur, err := store.GetPaymentByID(ctx, q.ID); err != nil || cur.Status != "created" {
+		t.Errorf("expected the second payment to stay created, got %+v (%v)", cur, err)
+	}
+	if err := store.RefundUnfulfilledPayment(ctx, q.ID, "refund-"+suffix, "duplicate"); err != nil {
+		t.Fatalf("failed to record refund: %v", err)
+	}
+	if _, err := store.CreatePayment(ctx, user.ID, "walk-7000", "ord-c-"+suffix, 10000, 0); err != ErrActiveParticipation {
+		t.Errorf("expected ErrActiveParticipation, got %v", err)
+	}
+}
+
+func TestIntegration_FailedCheckoutDoesNotBlock(t *testing.T) {
+	store := skipIfNoDatabase(t)
+	defer store.Close()
+
+	ctx := context.Background()
+	suffix := time.Now().Format("20060102150405.000000")
+	user, err := store.GetOrCreateUser(ctx, "test-checkout-"+suffix)
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	p, err := store.CreatePayment(ctx, user.ID, "walk-7000", "ord-fail-"+suffix, 10000, 0)
+	if err != nil {
+		t.Fatalf("failed to create payment: %v", err)
+	}
+	// The payment provider refused to create the checkout
+	if err := store.ClosePayment(ctx, p.ID, "failed", "payment provider create failed"); err != nil {
+		t.Fatalf("failed to close payment: %v", err)
+	}
+	if pending, err := store.GetPendingCheckout(ctx, user.ID, "walk-7000"); err != nil || pending != nil {
+		t.Errorf("expected no pending checkout, got %+v (%v)", pending, err)
+	}
+	if _, err := store.CreatePayment(ctx, user.ID, "walk-7000", "ord-retry-"+suffix, 10000, 0); err != nil {
+		t.Errorf("expected a retry right after a failed checkout, got %v", err)
+	}
+}
+
+func TestIntegration_ClaimPaymentCancel(t *testing.T) {
+	store := skipIfNoDatabase(t)
+	defer store.Close()
+
+	ctx := context.Background()
+	suffix := time.Now().Format("20060102150405.000000")
+	user, err := store.GetOrCreateUser(ctx, "test-cancel-"+suffix)
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	p, err := store.CreatePayment(ctx, user.ID, "walk-7000", "ord-cancel-"+suffix, 10000, 0)
+	if err != nil {
+		t.Fatalf("failed to create payment: %v", err)
+	}
+	if _, err := store.ExecutePaymentByID(ctx, p.ID); err != nil {
+		t.Fatalf("failed to execute payment: %v", err)
+	}
+
+	claimed, err := store.ClaimPaymentCancel(ctx, p.ID)
+	if err != nil || claimed == nil || claimed.Status != "cancelling" {
+		t.Fatalf("expected first claim to succeed, got %+v (%v)", claimed, err)
+	}
+	if again, err := store.ClaimPaymentCancel(ctx, p.ID); err != nil || again != nil {
+		t.Fatalf("expected concurrent claim to be refused, got %+v (%v)", again, err)
+	}
+	// A failed provider refund releases the claim
+	if err := store.ReleasePaymentCancel(ctx, p.ID); err != nil {
+		t.Fatalf("failed to release claim: %v", err)
+	}
+	if _, err := store.ClaimPaymentCancel(ctx, p.ID); err != nil {
+		t.Fatalf("failed to claim again: %v", err)
+	}
+	refunded, err := store.RefundPayment(ctx, p.ID, "refund-"+suffix, p.Amount, true, "test")
+	if err != nil || refunded.Status != "refunded" {
+		t.Fatalf("expected claimed payment to be refunded, got %+v (%v)", refunded, err)
+	}
+	if again, err := store.ClaimPaymentCancel(ctx, p.ID); err != nil || again != nil {
+		t.Errorf("expected refunded payment not to be claimable, got %+v (%v)", again, err)
+	}
+}
+
+func TestIntegration_PendingCohorts(t *testing.T) {
+	store := skipIfNoDatabase(t)
+	defer store.Close()
+
+	ctx := context.Background()
+	cohorts, err := store.ListPendingCohorts(ctx, 10)
+	if err != nil {
+		t.Fatalf("failed to list pending cohorts: %v", err)
+	}
+	for _, k := range cohorts {
+		members, err := store.ListCohortMembers(ctx, k)
+		if err != nil {
+			t.Fatalf("failed to list cohort members: %v", err)
+		}
+		for _, m := range members {
+			if m.Status != "success" && m.Status != "failed" {
+				t.Errorf("unexpected member status %q", m.Status)
+			}
+		}
+	}
+}
+
+func TestIntegration_ProofImageRetention(t *testing.T) {
+	store := skipIfNoDatabase(t)
+	defer store.Close()
+
+	ctx := context.Background()
+	suffix := time.Now().Format("20060102150405.000000000")
+	oldKey, newKey := "proofs/test/old-"+suffix+".jpg", "proofs/test/new-"+suffix+".jpg"
+	for _, key := range []string{oldKey, newKey} {
+		url, err := store.RecordProofImage(ctx, key, "/admin/v1/images/"+key, 100)
+		if err != nil {
+			t.Fatalf("record image: %v", err)
+		}
+		if again, err := store.RecordProofImage(ctx, key, "https://cdn.example.com/"+key, 100); err != nil || again != url {
+			t.Errorf("expected the first URL %q on re-record, got %q (%v)", url, again, err)
+		}
+	}
+	if _, err := store.pool.Exec(ctx, `UPDATE proof_image SET last_used_at = NOW() - INTERVAL '100 days' WHERE key = $1`, oldKey); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	list, err := store.ListExpiredProofImages(ctx, now.AddDate(0, 0, -90), now.Add(-24*time.Hour), 1000)
+	if err != nil {
+		t.Fatalf("list expired images: %v", err)
+	}
+	found := map[string]ProofImage{}
+	for _, img := range list {
+		found[img.Key] = img
+	}
+	if _, ok := found[oldKey]; !ok {
+		t.Errorf("expected %s to be expired", oldKey)
+	}
+	if _, ok := found[newKey]; ok {
+		t.Errorf("recently uploaded %s should wait for the orphan grace period", newKey)
+	}
+
+	if err := store.DeleteProofImage(ctx, found[oldKey]); err != nil {
+		t.Fatalf("delete image: %v", err)
+	}
+	if _, err := store.pool.Exec(ctx, `DELETE FROM proof_image WHERE key = $1`, newKey); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,97 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ============ Challenge Tier Operations ============
+
+// MultiplierOne is the reward multiplier (in basis points) that pays back exactly the deposit
+const MultiplierOne = 10000
+
+// Tier is a stake level a user can choose when joining a challenge
+type Tier struct {
+	ID                  int64
+	ChallengeID         string
+	Deposit             int64
+	RequiredProofs      int // proofs needed to succeed; 0 means every day of the challenge
+	RewardMultiplierBps int // 10000 = 1.00x
+}
+
+// querier is satisfied by both the pool and a transaction
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// loadTiers fills Tiers for each challenge, ordered by sort order then deposit
+func loadTiers(ctx context.Context, db querier, challenges []Challenge) error {
+	if len(challenges) == 0 {
+		return nil
+	}
+	ids := make([]string, len(challenges))
+	index := make(map[string]int, len(challenges))
+	for i, c := range challenges {
+		ids[i] = c.ID
+		index[c.ID] = i
+	}
+
+	const q = `
+		SELECT id, challenge_id, deposit, required_proofs, reward_multiplier_bps
+		FROM challenge_tier
+		WHERE challenge_id = ANY($1)
+		ORDER BY challenge_id, sort_order, deposit
+	`
+	rows, err := db.Query(ctx, q, ids)
+	if err != nil {
+		return fmt.Errorf("list tiers: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t Tier
+		if err := rows.Scan(&t.ID, &t.ChallengeID, &t.Deposit, &t.RequiredProofs, &t.RewardMultiplierBps); err != nil {
+			return fmt.Errorf("scan tier: %w", err)
+		}
+		c := &challenges[index[t.ChallengeID]]
+		c.Tiers = append(c.Tiers, t)
+	}
+	return rows.Err()
+}
+
+// loadChallengeTiers fills Tiers for a single challenge
+func loadChallengeTiers(ctx context.Context, db querier, c *Challenge) error {
+	list := []Challenge{*c}
+	if err := loadTiers(ctx, db, list); err != nil {
+		return err
+	}
+	c.Tiers = list[0].Tiers
+	return nil
+}
+
+// replaceTiers makes the challenge's tiers exactly tiers, keyed by deposit.
+// Existing rows are updated in place so payments already referencing a tier keep it.
+func replaceTiers(ctx context.Context, tx pgx.Tx, challengeID string, tiers []Tier) error {
+	deposits := make([]int64, len(tiers))
+	for i, t := range tiers {
+		deposits[i] = t.Deposit
+		const upsertQ = `
+			INSERT INTO challenge_tier (challenge_id, deposit, required_proofs, reward_multiplier_bps, sort_order)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (challenge_id, deposit) DO UPDATE
+			SET required_proofs = EXCLUDED.required_proofs,
+			    reward_multiplier_bps = EXCLUDED.reward_multiplier_bps,
+			    sort_order = EXCLUDED.sort_order,
+			    updated_at = NOW()
+		`
+		if _, err := tx.Exec(ctx, upsertQ, challengeID, t.Deposit, t.RequiredProofs, t.RewardMultiplierBps, i); err != nil {
+			return fmt.Errorf("upsert tier: %w", err)
+		}
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM challenge_tier WHERE challenge_id = $1 AND NOT (deposit = ANY($2))`, challengeID, deposits); err != nil {
+		return fmt.Errorf("delete tiers: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ============ Unlink Operations ============
+
+// UnlinkUser marks the user with the given toss_user_key as unlinked and records an audit entry.
+// It returns nil if the user never used the service (no app_user row).
+func (s *Store) UnlinkUser(ctx context.Context, tossUserKey, referrer string) (*User, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	const q = `
+		UPDATE app_user
+		SET status = 'unlinked', unlinked_at = NOW(), unlink_processed_at = NULL, updated_at = NOW()
+		WHERE toss_user_key = $1
+		RETURNING id, toss_user_key, status, created_at
+	`
+	var u User
+	err = tx.QueryRow(ctx, q, tossUserKey).Scan(&u.ID, &u.TossUserKey, &u.Status, &u.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unlink user: %w", err)
+	}
+
+	if err := insertAudit(ctx, tx, ActorToss, "user.unlink", u.ID, map[string]string{"referrer": referrer}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return &u, nil
+}
+
+// ListPendingUnlinks returns unlinked users whose data has not been handled yet
+func (s *Store) ListPendingUnlinks(ctx context.Context, limit int) ([]User, error) {
+	const q = `
+		SELECT id, toss_user_key, status, created_at
+		FROM app_user
+		WHERE status = 'unlinked' AND unlink_processed_at IS NULL
+		ORDER BY unlinked_at
+		LIMIT $1
+	`
+	rows, err := s.pool.Query(ctx, q, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list pending unlinks: %w", err)
+	}
+	defer rows.Close()
+
+	var list []User
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.TossUserKey, &u.Status, &u.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan user: %w", err)
+		}
+		list = append(list, u)
+	}
+	return list, rows.Err()
+}
+
+// ListActiveParticipationsByUser returns all active participations of a user
+func (s *Store) ListActiveParticipationsByUser(ctx context.Context, userID int64) ([]Participation, error) {
+	const q = `
+		SELECT id, user_id, challenge_id, COALESCE(payment_id, 0), status, start_date, end_date, proof_count, created_at
+		FROM participation
+		WHERE user_id = $1 AND status = 'active'
+		ORDER BY id
+	`
+	rows, err := s.pool.Query(ctx, q, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list active participations: %w", err)
+	}
+	defer rows.Close()
+
+	var list []Participation
+	for rows.Next() {
+		var p Participation
+		if err := rows.Scan(&p.ID, &p.UserID, &p.ChallengeID, &p.PaymentID, &p.Status, &p.StartDate, &p.EndDate, &p.ProofCount, &p.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan participation: %w", err)
+		}
+		list = append(list, p)
+	}
+	return list, rows.Err()
+}
+
+// ForfeitParticipation ends an active participation without refund: the participation
+// becomes 'forfeited' and its running settlement 'failed'.
+func (s *Store) ForfeitParticipation(ctx context.Context, participationID int64) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		UPDATE participation SET status = 'forfeited', updated_at = NOW()
+		WHERE id = $1 AND status = 'active'
+	`, participationID)
+	if err != nil {
+		return fmt.Errorf("forfeit participation: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE settlement SET status = 'failed', refundable = false, updated_at = NOW()
+		WHERE participation_id = $1 AND status = 'running'
+	`, participationID)
+	if err != nil {
+		return fmt.Errorf("forfeit settlement: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+// ScheduleProofPurge marks all of a user's proofs and appeals for anonymization after purgeAfter.
+// Returns the number of proofs scheduled
+func (s *Store) ScheduleProofPurge(ctx context.Context, userID int64, purgeAfter time.Time) (int64, error) {
+	const q = `
+		UPDATE proof SET purge_after = $2
+		WHERE user_id = $1 AND anonymized_at IS NULL AND (purge_after IS NULL OR purge_after > $2)
+	`
+	tag, err := s.pool.Exec(ctx, q, userID, purgeAfter)
+	if err != nil {
+		return 0, fmt.Errorf("schedule proof purge: %w", err)
+	}
+	const appealQ = `
+		UPDATE proof_appeal SET purge_after = $2
+		WHERE user_id = $1 AND (purge_after IS NULL OR purge_after > $2)
+	`
+	if _, err := s.pool.Exec(ctx, appealQ, userID, purgeAfter); err != nil {
+		return 0, fmt.Errorf("schedule appeal purge: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// CompleteUnlink marks an unlinked user's data as handled and records the outcome in the audit log
+func (s *Store) CompleteUnlink(ctx context.Context, userID int64, details any) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `UPDATE app_user SET unlink_processed_at = NOW(), updated_at = NOW() WHERE id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("complete unlink: %w", err)
+	}
+	if err := insertAudit(ctx, tx, ActorSystem, "user.unlink.processed", userID, details); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// PurgeExpiredProofs anonymizes proofs whose retention period has passed: image hashes,
+// URL and EXIF data are cleared while the row is kept for settlement history. Appeals
+// scheduled with them lose their note and extra image. Stored photos left without a
+// reference are deleted by the image retention job (see ListExpiredProofImages).
+func (s *Store) PurgeExpiredProofs(ctx context.Context) (*BatchResult, error) {
+	result := &BatchResult{Errors: []string{}}
+
+	const q = `
+		UPDATE proof
+		SET image_hash = NULL, image_url = NULL, exif_timestamp = NULL, phash = NULL, anonymized_at = NOW()
+		WHERE purge_after IS NOT NULL AND purge_after <= $1 AND anonymized_at IS NULL
+	`
+	tag, err := s.pool.Exec(ctx, q, s.now())
+	if err != nil {
+		return nil, fmt.Errorf("purge proofs: %w", err)
+	}
+	result.Processed = int(tag.RowsAffected())
+
+	// Appeal notes and extra images follow the same schedule
+	const appealQ = `
+		UPDATE proof_appeal SET note = '', image_hash = NULL, image_url = NULL, purge_after = NULL
+		WHERE purge_after IS NOT NULL AND purge_after <= $1
+	`
+	if _, err := s.pool.Exec(ctx, appealQ, s.now()); err != nil {
+		return nil, fmt.Errorf("purge appeals: %w", err)
+	}
+	return result, nil
+}
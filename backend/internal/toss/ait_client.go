@@ -57,6 +57,18 @@ func New(certFile, keyFile, baseURL string) (*Client, error) {
 	}, nil
 }
 
+// NewWithHTTPClient creates a client on a caller-provided http.Client.
+// Used with httptest servers (see package tossfake), where no mTLS certificate is needed.
+func NewWithHTTPClient(baseURL string, hc *http.Client) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		hc:      hc,
+	}
+}
+
 // NewFromEnv creates a client from env vars.
 // Required (staging/prod):
 //   - AIT_MTLS_CERT_FILE
@@ -90,8 +102,13 @@ type GenerateTokenSuccess struct {
 }
 
 type APIError struct {
-	ErrorCode string `json:"errorCode"`
-	Reason    string `json:"reason"`
+	ErrorCode  string `json:"errorCode"`
+	Reason     string `json:"reason"`
+	StatusCode int    `json:"-"` // HTTP status of the response that carried the error
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("apps-in-toss api error: status=%d code=%s reason=%s", e.StatusCode, e.ErrorCode, e.Reason)
 }
 
 type GenerateTokenResponse struct {
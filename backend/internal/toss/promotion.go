@@ -0,0 +1,205 @@
+package toss
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Promotion (Toss point grant) API.
+// Flow: RequestPromotionKey -> ExecutePromotion -> GetPromotionExecutionResult.
+// Every call is made on behalf of a user identified by the x-toss-user-key header.
+
+// Promotion execution results returned by GetPromotionExecutionResult.
+const (
+	PromotionResultSuccess = "SUCCESS"
+	PromotionResultPending = "PENDING"
+	PromotionResultFailed  = "FAILED"
+)
+
+type PromotionKeySuccess struct {
+	Key string `json:"key"`
+}
+
+type PromotionKeyResponse struct {
+	ResultType string               `json:"resultType"`
+	Success    *PromotionKeySuccess `json:"success"`
+	Error      *APIError            `json:"error"`
+}
+
+type ExecutePromotionRequest struct {
+	PromotionCode string `json:"promotionCode"`
+	Key           string `json:"key"`
+	Amount        int64  `json:"amount"`
+}
+
+type ExecutePromotionSuccess struct {
+	Key string `json:"key"`
+}
+
+type ExecutePromotionResponse struct {
+	ResultType string                   `json:"resultType"`
+	Success    *ExecutePromotionSuccess `json:"success"`
+	Error      *APIError                `json:"error"`
+}
+
+type PromotionResultRequest struct {
+	PromotionCode string `json:"promotionCode"`
+	Key           string `json:"key"`
+}
+
+type PromotionResultResponse struct {
+	ResultType string    `json:"resultType"`
+	Success    string    `json:"success"` // SUCCESS | PENDING | FAILED
+	Error      *APIError `json:"error"`
+}
+
+// RequestPromotionKey issues a one-time key for a point grant.
+// Content-type: application/json
+// Method: POST
+// URL: /api-partner/v1/apps-in-toss/promotion/execute-promotion/get-key
+func (c *Client) RequestPromotionKey(ctx context.Context, userKey int64) (*PromotionKeySuccess, error) {
+	if userKey <= 0 {
+		return nil, errors.New("userKey is required")
+	}
+	var out PromotionKeyResponse
+	if err := c.postPromotion(ctx, "/api-partner/v1/apps-in-toss/promotion/execute-promotion/get-key", userKey, nil, &out); err != nil {
+		return nil, err
+	}
+	if err := checkResult(out.ResultType, out.Error); err != nil {
+		return nil, err
+	}
+	if out.Success == nil || out.Success.Key == "" {
+		return nil, errors.New("apps-in-toss api returned no promotion key")
+	}
+	return out.Success, nil
+}
+
+// ExecutePromotion grants Toss points to a user with a key from RequestPromotionKey.
+// Toss rejects a second execution with the same key, so retries never double-grant.
+// Content-type: application/json
+// Method: POST
+// URL: /api-partner/v1/apps-in-toss/promotion/execute-promotion
+func (c *Client) ExecutePromotion(ctx context.Context, userKey int64, promotionCode, key string, amount int64) (*ExecutePromotionSuccess, error) {
+	payload := ExecutePromotionRequest{
+		PromotionCode: strings.TrimSpace(promotionCode),
+		Key:           strings.TrimSpace(key),
+		Amount:        amount,
+	}
+	if userKey <= 0 {
+		return nil, errors.New("userKey is required")
+	}
+	if payload.PromotionCode == "" || payload.Key == "" {
+		return nil, errors.New("promotionCode and key are required")
+	}
+	if payload.Amount <= 0 {
+		return nil, errors.New("amount must be positive")
+	}
+
+	var out ExecutePromotionResponse
+	if err := c.postPromotion(ctx, "/api-partner/v1/apps-in-toss/promotion/execute-promotion", userKey, payload, &out); err != nil {
+		return nil, err
+	}
+	if err := checkResult(out.ResultType, out.Error); err != nil {
+		return nil, err
+	}
+	if out.Success == nil {
+		return nil, errors.New("apps-in-toss api returned no execution result")
+	}
+	return out.Success, nil
+}
+
+// GetPromotionExecutionResult looks up the outcome of an executed point grant.
+// Returns one of PromotionResultSuccess, PromotionResultPending or PromotionResultFailed.
+// Content-type: application/json
+// Method: POST
+// URL: /api-partner/v1/apps-in-toss/promotion/execution-result
+func (c *Client) GetPromotionExecutionResult(ctx context.Context, userKey int64, promotionCode, key string) (string, error) {
+	payload := PromotionResultRequest{
+		PromotionCode: strings.TrimSpace(promotionCode),
+		Key:           strings.TrimSpace(key),
+	}
+	if userKey <= 0 {
+		return "", errors.New("userKey is required")
+	}
+	if payload.PromotionCode == "" || payload.Key == "" {
+		return "", errors.New("promotionCode and key are required")
+	}
+
+	var out PromotionResultResponse
+	if err := c.postPromotion(ctx, "/api-partner/v1/apps-in-toss/promotion/execution-result", userKey, payload, &out); err != nil {
+		return "", err
+	}
+	if err := checkResult(out.ResultType, out.Error); err != nil {
+		return "", err
+	}
+	switch res := strings.ToUpper(out.Success); res {
+	case PromotionResultSuccess, PromotionResultPending, PromotionResultFailed:
+		return res, nil
+	default:
+		return "", fmt.Errorf("apps-in-toss api unknown execution result: %q", out.Success)
+	}
+}
+
+// postPromotion sends a promotion API request and decodes the envelope into out.
+// Error envelopes are decoded even on non-2xx responses so callers get an *APIError.
+func (c *Client) postPromotion(ctx context.Context, path string, userKey int64, payload, out any) error {
+	var body io.Reader = http.NoBody
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("marshal request: %w", err)
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-toss-user-key", strconv.FormatInt(userKey, 10))
+
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+
+	var env struct {
+		Error *APIError `json:"error"`
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		if json.Unmarshal(raw, &env) == nil && env.Error != nil && env.Error.ErrorCode != "" {
+			env.Error.StatusCode = resp.StatusCode
+			return env.Error
+		}
+		return fmt.Errorf("apps-in-toss api status=%d body=%s", resp.StatusCode, string(raw))
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return fmt.Errorf("decode response: %w body=%s", err, string(raw))
+	}
+	return nil
+}
+
+// checkResult maps a non-SUCCESS envelope to an error, preferring the typed *APIError.
+func checkResult(resultType string, apiErr *APIError) error {
+	if strings.ToUpper(resultType) == "SUCCESS" {
+		return nil
+	}
+	if apiErr != nil {
+		apiErr.StatusCode = http.StatusOK
+		return apiErr
+	}
+	return fmt.Errorf("apps-in-toss api not success: resultType=%s", resultType)
+}
@@ -0,0 +1,161 @@
+package toss_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"habitcashback/internal/toss"
+	"habitcashback/internal/toss/tossfake"
+)
+
+func TestPromotion_FullFlow(t *testing.T) {
+	srv := tossfake.NewServer()
+	defer srv.Close()
+	client := srv.Client()
+	ctx := context.Background()
+
+	key, err := client.RequestPromotionKey(ctx, 12345)
+	if err != nil {
+		t.Fatalf("RequestPromotionKey: %v", err)
+	}
+	if key.Key == "" {
+		t.Fatal("expected non-empty promotion key")
+	}
+
+	res, err := client.ExecutePromotion(ctx, 12345, "PROMO", key.Key, 10000)
+	if err != nil {
+		t.Fatalf("ExecutePromotion: %v", err)
+	}
+	if res.Key != key.Key {
+		t.Errorf("expected key %s, got %s", key.Key, res.Key)
+	}
+
+	status, err := client.GetPromotionExecutionResult(ctx, 12345, "PROMO", key.Key)
+	if err != nil {
+		t.Fatalf("GetPromotionExecutionResult: %v", err)
+	}
+	if status != toss.PromotionResultSuccess {
+		t.Errorf("expected %s, got %s", toss.PromotionResultSuccess, status)
+	}
+
+	grants := srv.Grants()
+	if len(grants) != 1 || grants[0].Amount != 10000 || grants[0].UserKey != 12345 {
+		t.Errorf("unexpected grants: %+v", grants)
+	}
+}
+
+func TestPromotion_DuplicateExecuteReturnsAPIError(t *testing.T) {
+	srv := tossfake.NewServer()
+	defer srv.Close()
+	client := srv.Client()
+	ctx := context.Background()
+
+	key, _ := client.RequestPromotionKey(ctx, 1)
+	if _, err := client.ExecutePromotion(ctx, 1, "PROMO", key.Key, 100); err != nil {
+		t.Fatalf("first execute: %v", err)
+	}
+
+	_, err := client.ExecutePromotion(ctx, 1, "PROMO", key.Key, 100)
+	var apiErr *toss.APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected *toss.APIError, got %T (%v)", err, err)
+	}
+	if apiErr.ErrorCode != tossfake.ErrCodeDuplicateExecute {
+		t.Errorf("expected code %s, got %s", tossfake.ErrCodeDuplicateExecute, apiErr.ErrorCode)
+	}
+	if len(srv.Grants()) != 1 {
+		t.Errorf("expected 1 grant, got %d", len(srv.Grants()))
+	}
+}
+
+func TestPromotion_ResultBeforeExecute(t *testing.T) {
+	srv := tossfake.NewServer()
+	defer srv.Close()
+	client := srv.Client()
+	ctx := context.Background()
+
+	key, _ := client.RequestPromotionKey(ctx, 1)
+	_, err := client.GetPromotionExecutionResult(ctx, 1, "PROMO", key.Key)
+	var apiErr *toss.APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected *toss.APIError, got %T (%v)", err, err)
+	}
+}
+
+func TestPromotion_Validation(t *testing.T) {
+	client := toss.NewWithHTTPClient("http://127.0.0.1:0", http.DefaultClient)
+	ctx := context.Background()
+
+	if _, err := client.RequestPromotionKey(ctx, 0); err == nil {
+		t.Error("expected error for zero userKey")
+	}
+	if _, err := client.ExecutePromotion(ctx, 1, "", "key", 100); err == nil {
+		t.Error("expected error for empty promotionCode")
+	}
+	if _, err := client.ExecutePromotion(ctx, 1, "PROMO", "key", 0); err == nil {
+		t.Error("expected error for zero amount")
+	}
+	if _, err := client.GetPromotionExecutionResult(ctx, 1, "PROMO", ""); err == nil {
+		t.Error("expected error for empty key")
+	}
+}
+
+func TestPromotion_HTTPErrorMapping(t *testing.T) {
+	t.Run("Error envelope on 4xx", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"resultType":"FAIL","error":{"errorCode":"FORBIDDEN_PROMOTION","reason":"not allowed"}}`))
+		}))
+		defer server.Close()
+
+		client := toss.NewWithHTTPClient(server.URL, server.Client())
+		_, err := client.RequestPromotionKey(context.Background(), 1)
+		var apiErr *toss.APIError
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("expected *toss.APIError, got %T (%v)", err, err)
+		}
+		if apiErr.StatusCode != http.StatusForbidden || apiErr.ErrorCode != "FORBIDDEN_PROMOTION" {
+			t.Errorf("unexpected api error: %+v", apiErr)
+		}
+	})
+
+	t.Run("Plain 5xx is not an APIError", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte("bad gateway"))
+		}))
+		defer server.Close()
+
+		client := toss.NewWithHTTPClient(server.URL, server.Client())
+		_, err := client.RequestPromotionKey(context.Background(), 1)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		var apiErr *toss.APIError
+		if errors.As(err, &apiErr) {
+			t.Errorf("expected transport-level error, got APIError %+v", apiErr)
+		}
+	})
+}
+
+func TestFakeServer_Login(t *testing.T) {
+	srv := tossfake.NewServer()
+	defer srv.Close()
+	client := srv.Client()
+	ctx := context.Background()
+
+	tok, err := client.GenerateUserToken(ctx, "777", "")
+	if err != nil {
+		t.Fatalf("GenerateUserToken: %v", err)
+	}
+	me, err := client.LoginMe(ctx, tok.AccessToken)
+	if err != nil {
+		t.Fatalf("LoginMe: %v", err)
+	}
+	if me.UserKey != 777 {
+		t.Errorf("expected userKey 777, got %d", me.UserKey)
+	}
+}
@@ -0,0 +1,244 @@
+// Package tossfake provides an in-process fake of the Apps-in-Toss partner API.
+// It serves the login and promotion endpoints used by toss.Client so payouts can be
+// exercised offline, in tests or from a local worker, without mTLS credentials.
+package tossfake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+
+	"habitcashback/internal/toss"
+)
+
+// Error codes returned by the fake promotion endpoints.
+const (
+	ErrCodeInvalidUser      = "INVALID_USER"
+	ErrCodeInvalidKey       = "INVALID_PROMOTION_KEY"
+	ErrCodeDuplicateExecute = "ALREADY_EXECUTED"
+	ErrCodeKeyNotExecuted   = "NOT_EXECUTED"
+)
+
+// Grant is a point grant recorded by the fake server.
+type Grant struct {
+	UserKey       int64
+	PromotionCode string
+	Key           string
+	Amount        int64
+}
+
+type promotionKey struct {
+	userKey  int64
+	executed bool
+	result   string
+}
+
+// Server is a fake Apps-in-Toss API backed by httptest.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	keys     map[string]*promotionKey
+	grants   []Grant
+	failNext *toss.APIError
+	failCode int // HTTP status for failNext
+	result   string
+	seq      int
+}
+
+// NewServer starts a fake server. Call Close when done.
+func NewServer() *Server {
+	s := &Server{
+		keys:   map[string]*promotionKey{},
+		result: toss.PromotionResultSuccess,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api-partner/v1/apps-in-toss/user/oauth2/generate-token", s.handleGenerateToken)
+	mux.HandleFunc("/api-partner/v1/apps-in-toss/user/oauth2/login-me", s.handleLoginMe)
+	mux.HandleFunc("/api-partner/v1/apps-in-toss/promotion/execute-promotion/get-key", s.handleGetKey)
+	mux.HandleFunc("/api-partner/v1/apps-in-toss/promotion/execute-promotion", s.handleExecute)
+	mux.HandleFunc("/api-partner/v1/apps-in-toss/promotion/execution-result", s.handleResult)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Client returns a toss.Client pointed at the fake server.
+func (s *Server) Client() *toss.Client {
+	return toss.NewWithHTTPClient(s.URL, s.Server.Client())
+}
+
+// Grants returns the point grants executed so far.
+func (s *Server) Grants() []Grant {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Grant(nil), s.grants...)
+}
+
+// FailNextExecute makes the next ExecutePromotion call fail with the given error.
+func (s *Server) FailNextExecute(errorCode, reason string) {
+	s.FailNextExecuteStatus(http.StatusOK, errorCode, reason)
+}
+
+// FailNextExecuteStatus is FailNextExecute with the error sent under an HTTP status,
+// such as 503 for an outage.
+func (s *Server) FailNextExecuteStatus(status int, errorCode, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failNext = &toss.APIError{ErrorCode: errorCode, Reason: reason}
+	s.failCode = status
+}
+
+// SetExecutionResult sets the result reported for executed keys (default SUCCESS).
+func (s *Server) SetExecutionResult(result string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.result = result
+}
+
+// ---- OAuth
+
+func (s *Server) handleGenerateToken(w http.ResponseWriter, r *http.Request) {
+	var body toss.GenerateTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.AuthorizationCode == "" {
+		writeFail(w, http.StatusBadRequest, &toss.APIError{ErrorCode: "invalid_grant", Reason: "authorizationCode is required"})
+		return
+	}
+	// The access token encodes the user key so LoginMe can hand it back.
+	userKey := fakeUserKey(body.AuthorizationCode)
+	writeSuccess(w, toss.GenerateTokenSuccess{
+		AccessToken: fmt.Sprintf("fake-at-%d", userKey),
+		TokenType:   "Bearer",
+		ExpiresIn:   3600,
+	})
+}
+
+func (s *Server) handleLoginMe(w http.ResponseWriter, r *http.Request) {
+	at := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	userKey, err := strconv.ParseInt(strings.TrimPrefix(at, "fake-at-"), 10, 64)
+	if err != nil || userKey <= 0 {
+		writeFail(w, http.StatusUnauthorized, &toss.APIError{ErrorCode: "invalid_token", Reason: "unknown access token"})
+		return
+	}
+	writeSuccess(w, toss.LoginMeSuccess{UserKey: userKey})
+}
+
+// fakeUserKey derives a stable positive user key from an authorization code.
+// A numeric code is used as-is so tests can pick the user.
+func fakeUserKey(code string) int64 {
+	if n, err := strconv.ParseInt(code, 10, 64); err == nil && n > 0 {
+		return n
+	}
+	var h int64 = 1
+	for _, c := range code {
+		h = (h*31 + int64(c)) % 1_000_000_007
+	}
+	return h + 1
+}
+
+// ---- Promotion
+
+func (s *Server) handleGetKey(w http.ResponseWriter, r *http.Request) {
+	userKey, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	s.seq++
+	key := fmt.Sprintf("fake-promo-key-%d", s.seq)
+	s.keys[key] = &promotionKey{userKey: userKey}
+	s.mu.Unlock()
+
+	writeSuccess(w, toss.PromotionKeySuccess{Key: key})
+}
+
+func (s *Server) handleExecute(w http.ResponseWriter, r *http.Request) {
+	userKey, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+	var body toss.ExecutePromotionRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeFail(w, http.StatusBadRequest, &toss.APIError{ErrorCode: "INVALID_REQUEST", Reason: "invalid json"})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failNext != nil {
+		apiErr := s.failNext
+		s.failNext = nil
+		writeFail(w, s.failCode, apiErr)
+		return
+	}
+	pk, exists := s.keys[body.Key]
+	if !exists || pk.userKey != userKey {
+		writeFail(w, http.StatusOK, &toss.APIError{ErrorCode: ErrCodeInvalidKey, Reason: "unknown promotion key"})
+		return
+	}
+	if pk.executed {
+		writeFail(w, http.StatusOK, &toss.APIError{ErrorCode: ErrCodeDuplicateExecute, Reason: "promotion key already executed"})
+		return
+	}
+	pk.executed = true
+	pk.result = s.result
+	s.grants = append(s.grants, Grant{UserKey: userKey, PromotionCode: body.PromotionCode, Key: body.Key, Amount: body.Amount})
+
+	writeSuccess(w, toss.ExecutePromotionSuccess{Key: body.Key})
+}
+
+func (s *Server) handleResult(w http.ResponseWriter, r *http.Request) {
+	userKey, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+	var body toss.PromotionResultRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeFail(w, http.StatusBadRequest, &toss.APIError{ErrorCode: "INVALID_REQUEST", Reason: "invalid json"})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pk, exists := s.keys[body.Key]
+	if !exists || pk.userKey != userKey {
+		writeFail(w, http.StatusOK, &toss.APIError{ErrorCode: ErrCodeInvalidKey, Reason: "unknown promotion key"})
+		return
+	}
+	if !pk.executed {
+		writeFail(w, http.StatusOK, &toss.APIError{ErrorCode: ErrCodeKeyNotExecuted, Reason: "promotion key not executed"})
+		return
+	}
+	writeSuccess(w, pk.result)
+}
+
+// ---- helpers
+
+func requireUser(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return 0, false
+	}
+	userKey, err := strconv.ParseInt(r.Header.Get("x-toss-user-key"), 10, 64)
+	if err != nil || userKey <= 0 {
+		writeFail(w, http.StatusBadRequest, &toss.APIError{ErrorCode: ErrCodeInvalidUser, Reason: "x-toss-user-key is required"})
+		return 0, false
+	}
+	return userKey, true
+}
+
+func writeSuccess(w http.ResponseWriter, success any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"resultType": "SUCCESS", "success": success})
+}
+
+func writeFail(w http.ResponseWriter, status int, apiErr *toss.APIError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{"resultType": "FAIL", "error": apiErr})
+}
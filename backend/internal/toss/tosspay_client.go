@@ -130,6 +130,21 @@ type tossPayStatusResponse struct {
 	Amount    int64  `json:"amount,omitempty"`
 }
 
+type tossPayRefundRequest struct {
+	PayToken string `json:"payToken"`
+	Amount   int64  `json:"amount"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+type tossPayRefundResponse struct {
+	Code             int    `json:"code"`
+	Msg              string `json:"msg,omitempty"`
+	RefundNo         string `json:"refundNo,omitempty"`
+	ApprovalTime     string `json:"approvalTime,omitempty"`
+	RefundedAmount   int64  `json:"refundedAmount,omitempty"`
+	RefundableAmount int64  `json:"refundableAmount"`
+}
+
 // CreatePayment creates a new payment on TossPay and returns a payToken.
 func (c *TossPayClient) CreatePayment(ctx context.Context, req payment.CreateRequest) (*payment.CreateResponse, error) {
 	if req.OrderNo == "" {
@@ -278,3 +293,68 @@ func (c *TossPayClient) GetStatus(ctx context.Context, payToken string) (*paymen
 		Amount:   out.Amount,
 	}, nil
 }
+
+// CancelPayment refunds all or part of an executed payment.
+func (c *TossPayClient) CancelPayment(ctx context.Context, payToken string, amount int64, reason string) (*payment.CancelResponse, error) {
+	if payToken == "" {
+		return nil, payment.NewPaymentError(payment.ErrCodeInvalidRequest, "payToken is required", nil)
+	}
+	if amount <= 0 {
+		return nil, payment.NewPaymentError(payment.ErrCodeInvalidRequest, "amount must be positive", nil)
+	}
+
+	payload := tossPayRefundRequest{PayToken: payToken, Amount: amount, Reason: reason}
+	body, _ := json.Marshal(payload)
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/v3/refunds", bytes.NewReader(body))
+	if err != nil {
+		return nil, payment.NewPaymentError(payment.ErrCodeInternalError, "failed to create request", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Basic "+c.apiKey)
+
+	resp, err := c.hc.Do(httpReq)
+	if err != nil {
+		return nil, payment.NewPaymentError(payment.ErrCodeNetworkError, "failed to call TossPay API", err)
+	}
+	defer resp.Body.Close()
+
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, payment.NewPaymentError(payment.ErrCodePaymentFailed, fmt.Sprintf("TossPay API error: status=%d body=%s", resp.StatusCode, string(raw)), nil)
+	}
+
+	var out tossPayRefundResponse
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, payment.NewPaymentError(payment.ErrCodeInternalError, "failed to parse TossPay response", err)
+	}
+
+	if out.Code != 0 {
+		return nil, payment.NewPaymentError(payment.ErrCodePaymentFailed, fmt.Sprintf("TossPay error: code=%d msg=%s", out.Code, out.Msg), nil)
+	}
+
+	var approvalTime time.Time
+	if out.ApprovalTime != "" {
+		approvalTime, _ = time.Parse(time.RFC3339, out.ApprovalTime)
+	}
+	if approvalTime.IsZero() {
+		approvalTime = time.Now()
+	}
+
+	refunded := out.RefundedAmount
+	if refunded == 0 {
+		refunded = amount
+	}
+	status := payment.StatusPartiallyRefunded
+	if out.RefundableAmount == 0 {
+		status = payment.StatusRefunded
+	}
+
+	return &payment.CancelResponse{
+		RefundNo:         out.RefundNo,
+		RefundedAmount:   refunded,
+		RefundableAmount: out.RefundableAmount,
+		ApprovalTime:     approvalTime,
+		Status:           status,
+	}, nil
+}
@@ -339,6 +339,105 @@ func TestTossPayClient_GetStatus(t *testing.T) {
 	})
 }
 
+func TestTossPayClient_CancelPayment(t *testing.T) {
+	t.Run("Full Refund", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/api/v3/refunds" {
+				t.Errorf("unexpected path: %s", r.URL.Path)
+			}
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			if body["payToken"] != "test_pay_token" || body["amount"] != float64(10000) {
+				t.Errorf("unexpected body: %v", body)
+			}
+
+			resp := map[string]interface{}{
+				"code":             0,
+				"refundNo":         "RF-001",
+				"approvalTime":     time.Now().Format(time.RFC3339),
+				"refundedAmount":   10000,
+				"refundableAmount": 0,
+			}
+			json.NewEncoder(w).Encode(resp)
+		}))
+		defer server.Close()
+
+		client := &TossPayClient{
+			baseURL: server.URL,
+			apiKey:  "test-api-key",
+			hc:      server.Client(),
+		}
+
+		resp, err := client.CancelPayment(context.Background(), "test_pay_token", 10000, "user request")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resp.RefundNo != "RF-001" {
+			t.Errorf("expected refundNo 'RF-001', got '%s'", resp.RefundNo)
+		}
+		if resp.Status != payment.StatusRefunded {
+			t.Errorf("expected status %s, got %s", payment.StatusRefunded, resp.Status)
+		}
+	})
+
+	t.Run("Partial Refund", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"code":             0,
+				"refundNo":         "RF-002",
+				"refundedAmount":   3000,
+				"refundableAmount": 7000,
+			})
+		}))
+		defer server.Close()
+
+		client := &TossPayClient{
+			baseURL: server.URL,
+			apiKey:  "test-api-key",
+			hc:      server.Client(),
+		}
+
+		resp, err := client.CancelPayment(context.Background(), "test_pay_token", 3000, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resp.Status != payment.StatusPartiallyRefunded || resp.RefundableAmount != 7000 {
+			t.Errorf("unexpected response: %+v", resp)
+		}
+	})
+
+	t.Run("TossPay Error Code", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(map[string]interface{}{"code": -1, "msg": "already refunded"})
+		}))
+		defer server.Close()
+
+		client := &TossPayClient{
+			baseURL: server.URL,
+			apiKey:  "test-api-key",
+			hc:      server.Client(),
+		}
+
+		_, err := client.CancelPayment(context.Background(), "test_pay_token", 10000, "")
+		var payErr *payment.PaymentError
+		if !containsPaymentError(err, &payErr) || payErr.Code != payment.ErrCodePaymentFailed {
+			t.Errorf("expected %s PaymentError, got %v", payment.ErrCodePaymentFailed, err)
+		}
+	})
+
+	t.Run("Empty PayToken", func(t *testing.T) {
+		client := &TossPayClient{
+			baseURL: "https://pay.toss.im",
+			apiKey:  "test-api-key",
+			hc:      http.DefaultClient,
+		}
+
+		if _, err := client.CancelPayment(context.Background(), "", 10000, ""); err == nil {
+			t.Fatal("expected error for empty payToken")
+		}
+	})
+}
+
 // Helper to check if error contains PaymentError
 func containsPaymentError(err error, target **payment.PaymentError) bool {
 	if pe, ok := err.(*payment.PaymentError); ok {
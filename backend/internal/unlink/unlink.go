@@ -0,0 +1,181 @@
+// Package unlink handles what happens to a user's data after they unlink the app in Toss.
+//
+// For every active participation the deposit is refunded through payment cancellation if
+// no proof was submitted yet, and forfeited otherwise (the settlement fails, as if the
+// challenge was abandoned). All proofs are scheduled for anonymization after the
+// retention period, and the outcome is written to the audit log.
+package unlink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"habitcashback/internal/clock"
+	"habitcashback/internal/payment"
+	"habitcashback/internal/reconcile"
+	"habitcashback/internal/store"
+)
+
+// Defaults for Processor.
+const (
+	DefaultBatchSize = 50
+	DefaultRetention = 30 * 24 * time.Hour
+)
+
+// Actions taken for an active participation.
+const (
+	ActionRefund  = "refund"
+	ActionForfeit = "forfeit"
+)
+
+// RefundReason is sent to the payment provider with unlink refunds.
+const RefundReason = "토스 연결 해제"
+
+// Store is the subset of store.Store used by the unlink job.
+type Store interface {
+	ListPendingUnlinks(ctx context.Context, limit int) ([]store.User, error)
+	ListActiveParticipationsByUser(ctx context.Context, userID int64) ([]store.Participation, error)
+	GetPaymentByID(ctx context.Context, paymentID int64) (*store.Payment, error)
+	ClaimPaymentCancel(ctx context.Context, paymentID int64) (*store.Payment, error)
+	ReleasePaymentCancel(ctx context.Context, paymentID int64) error
+	RefundPayment(ctx context.Context, paymentID int64, refundNo string, refundedAmount int64, fullyRefunded bool, reason string) (*store.Payment, error)
+	ForfeitParticipation(ctx context.Context, participationID int64) error
+	ScheduleProofPurge(ctx context.Context, userID int64, purgeAfter time.Time) (int64, error)
+	CompleteUnlink(ctx context.Context, userID int64, details any) error
+}
+
+// Processor handles unlinked users.
+type Processor struct {
+	Store     Store
+	Payments  payment.Service
+	Retention time.Duration
+	BatchSize int
+	Clock     clock.Clock // nil: system clock
+}
+
+// Outcome is recorded in the audit log when a user's unlink has been handled.
+type Outcome struct {
+	Refunded        []int64   `json:"refundedParticipations"`
+	Forfeited       []int64   `json:"forfeitedParticipations"`
+	ProofsScheduled int64     `json:"proofsScheduled"`
+	PurgeAfter      time.Time `json:"purgeAfter"`
+}
+
+// Decide returns the action for an active participation of an unlinked user.
+// Deposits are only refunded while the challenge has not really started.
+func Decide(p store.Participation) string {
+	if p.ProofCount == 0 && p.PaymentID > 0 {
+		return ActionRefund
+	}
+	return ActionForfeit
+}
+
+// Run processes one batch of unlinked users. Per-user failures are recorded in the result
+// and retried on the next run; only store listing errors abort the run.
+func (p *Processor) Run(ctx context.Context) (*store.BatchResult, error) {
+	if p.Payments == nil {
+		return nil, errors.New("payment service not configured")
+	}
+	limit := p.BatchSize
+	if limit <= 0 {
+		limit = DefaultBatchSize
+	}
+
+	users, err := p.Store.ListPendingUnlinks(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &store.BatchResult{Errors: []string{}}
+	for _, u := range users {
+		if err := p.processUser(ctx, u, clock.OrSystem(p.Clock).Now()); err != nil {
+			result.Failed++
+			result.Errors = append(result.Errors, fmt.Sprintf("user %d: %v", u.ID, err))
+			continue
+		}
+		result.Processed++
+	}
+	return result, nil
+}
+
+func (p *Processor) processUser(ctx context.Context, u store.User, now time.Time) error {
+	parts, err := p.Store.ListActiveParticipationsByUser(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+
+	out := Outcome{Refunded: []int64{}, Forfeited: []int64{}}
+	for _, part := range parts {
+		if Decide(part) == ActionRefund {
+			if err := p.refund(ctx, part); err != nil {
+				return fmt.Errorf("refund participation %d: %w", part.ID, err)
+			}
+			out.Refunded = append(out.Refunded, part.ID)
+			continue
+		}
+		if err := p.Store.ForfeitParticipation(ctx, part.ID); err != nil {
+			return err
+		}
+		out.Forfeited = append(out.Forfeited, part.ID)
+	}
+
+	retention := p.Retention
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+	out.PurgeAfter = now.Add(retention)
+	n, err := p.Store.ScheduleProofPurge(ctx, u.ID, out.PurgeAfter)
+	if err != nil {
+		return err
+	}
+	out.ProofsScheduled = n
+
+	return p.Store.CompleteUnlink(ctx, u.ID, out)
+}
+
+// refund cancels the participation's payment at the provider and records it.
+func (p *Processor) refund(ctx context.Context, part store.Participation) error {
+	pay, err := p.Store.GetPaymentByID(ctx, part.PaymentID)
+	if err != nil {
+		return err
+	}
+	if pay == nil {
+		return fmt.Errorf("payment %d not found", part.PaymentID)
+	}
+	switch pay.Status {
+	case "done":
+		claimed, err := p.Store.ClaimPaymentCancel(ctx, pay.ID)
+		if err != nil {
+			return err
+		}
+		if claimed == nil {
+			return fmt.Errorf("payment %d is being cancelled", pay.ID)
+		}
+	case "cancelling":
+		// Left by an interrupted refund; the unlinked user can no longer cancel it.
+	default:
+		return fmt.Errorf("payment %d is %s", pay.ID, pay.Status)
+	}
+
+	refundNo, fully := "", true
+	if pay.PayToken != "" {
+		res, err := p.Payments.CancelPayment(ctx, pay.PayToken, pay.Amount, RefundReason)
+		if err != nil {
+			// This or an earlier run may have refunded at the provider (e.g. a timeout, or
+			// the refund was never recorded): settle the claim from the provider status.
+			refunded, cerr := reconcile.CompleteCancel(ctx, p.Store, p.Payments, pay, RefundReason)
+			if cerr != nil {
+				return fmt.Errorf("%w (settle: %v)", err, cerr)
+			}
+			if refunded == nil {
+				return err
+			}
+			return nil
+		}
+		refundNo, fully = res.RefundNo, res.Status == payment.StatusRefunded
+	}
+	_, err = p.Store.RefundPayment(ctx, pay.ID, refundNo, pay.Amount, fully, RefundReason)
+	return err
+}
@@ -0,0 +1,211 @@
+package unlink
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"habitcashback/internal/payment"
+	"habitcashback/internal/store"
+)
+
+// fakeStore is an in-memory Store for a handful of users
+type fakeStore struct {
+	users      []store.User
+	parts      map[int64]*store.Participation
+	payments   map[int64]*store.Payment
+	purge      map[int64]time.Time
+	completed  map[int64]any
+	failRefund bool
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		parts:     map[int64]*store.Participation{},
+		payments:  map[int64]*store.Payment{},
+		purge:     map[int64]time.Time{},
+		completed: map[int64]any{},
+	}
+}
+
+func (f *fakeStore) ListPendingUnlinks(ctx context.Context, limit int) ([]store.User, error) {
+	var list []store.User
+	for _, u := range f.users {
+		if _, done := f.completed[u.ID]; !done {
+			list = append(list, u)
+		}
+	}
+	return list, nil
+}
+
+func (f *fakeStore) ListActiveParticipationsByUser(ctx context.Context, userID int64) ([]store.Participation, error) {
+	var list []store.Participation
+	for id := int64(1); id <= int64(len(f.parts)); id++ {
+		if p := f.parts[id]; p != nil && p.UserID == userID && p.Status == "active" {
+			list = append(list, *p)
+		}
+	}
+	return list, nil
+}
+
+func (f *fakeStore) GetPaymentByID(ctx context.Context, paymentID int64) (*store.Payment, error) {
+	return f.payments[paymentID], nil
+}
+
+func (f *fakeStore) ClaimPaymentCancel(ctx context.Context, paymentID int64) (*store.Payment, error) {
+	pay := f.payments[paymentID]
+	if pay == nil || pay.Status != "done" {
+		return nil, nil
+	}
+	pay.Status = "cancelling"
+	return pay, nil
+}
+
+func (f *fakeStore) ReleasePaymentCancel(ctx context.Context, paymentID int64) error {
+	if pay := f.payments[paymentID]; pay != nil && pay.Status == "cancelling" {
+		pay.Status = "done"
+	}
+	return nil
+}
+
+func (f *fakeStore) RefundPayment(ctx context.Context, paymentID int64, refundNo string, refundedAmount int64, fullyRefunded bool, reason string) (*store.Payment, error) {
+	if f.failRefund {
+		f.failRefund = false
+		return nil, errors.New("db down")
+	}
+	pay := f.payments[paymentID]
+	pay.Status = "refunded"
+	for _, p := range f.parts {
+		if p.PaymentID == paymentID && p.Status == "active" {
+			p.Status = "cancelled"
+		}
+	}
+	return pay, nil
+}
+
+func (f *fakeStore) ForfeitParticipation(ctx context.Context, participationID int64) error {
+	f.parts[participationID].Status = "forfeited"
+	return nil
+}
+
+func (f *fakeStore) ScheduleProofPurge(ctx context.Context, userID int64, purgeAfter time.Time) (int64, error) {
+	f.purge[userID] = purgeAfter
+	return 2, nil
+}
+
+func (f *fakeStore) CompleteUnlink(ctx context.Context, userID int64, details any) error {
+	f.completed[userID] = details
+	return nil
+}
+
+// addPaid adds an active participation paid through svc
+func (f *fakeStore) addPaid(t *testing.T, svc *payment.MockService, id, userID int64, proofCount int) {
+	t.Helper()
+	ctx := context.Background()
+	created, err := svc.CreatePayment(ctx, payment.CreateRequest{OrderNo: "ORDER", Amount: 10000})
+	if err != nil {
+		t.Fatalf("create payment: %v", err)
+	}
+	if _, err := svc.ExecutePayment(ctx, created.PayToken); err != nil {
+		t.Fatalf("execute payment: %v", err)
+	}
+	f.payments[id] = &store.Payment{ID: id, UserID: userID, PayToken: created.PayToken, Amount: 10000, Status: "done"}
+	f.parts[id] = &store.Participation{ID: id, UserID: userID, PaymentID: id, Status: "active", ProofCount: proofCount}
+}
+
+func TestDecide(t *testing.T) {
+	tests := []struct {
+		name string
+		p    store.Participation
+		want string
+	}{
+		{"No proofs yet", store.Participation{PaymentID: 1}, ActionRefund},
+		{"Proof submitted", store.Participation{PaymentID: 1, ProofCount: 1}, ActionForfeit},
+		{"No payment", store.Participation{}, ActionForfeit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Decide(tt.p); got != tt.want {
+				t.Errorf("Decide() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessor_Run(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Refunds unstarted and forfeits started participations", func(t *testing.T) {
+		svc := payment.NewMockServiceWithDelay(0)
+		fs := newFakeStore()
+		fs.users = []store.User{{ID: 10, Status: "unlinked"}}
+		fs.addPaid(t, svc, 1, 10, 0)
+		fs.addPaid(t, svc, 2, 10, 2)
+
+		p := &Processor{Store: fs, Payments: svc, Retention: time.Hour}
+		result, err := p.Run(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Processed != 1 || result.Failed != 0 {
+			t.Fatalf("expected processed=1 failed=0, got %d/%d (%v)", result.Processed, result.Failed, result.Errors)
+		}
+
+		if fs.parts[1].Status != "cancelled" || fs.payments[1].Status != "refunded" {
+			t.Errorf("expected participation 1 refunded, got %s/%s", fs.parts[1].Status, fs.payments[1].Status)
+		}
+		if st, _ := svc.GetStatus(ctx, fs.payments[1].PayToken); st.Status != payment.StatusRefunded {
+			t.Errorf("expected provider refund, got %s", st.Status)
+		}
+		if fs.parts[2].Status != "forfeited" {
+			t.Errorf("expected participation 2 forfeited, got %s", fs.parts[2].Status)
+		}
+		if _, ok := fs.purge[10]; !ok {
+			t.Error("expected proofs to be scheduled for purge")
+		}
+
+		out, ok := fs.completed[10].(Outcome)
+		if !ok {
+			t.Fatalf("expected Outcome audit details, got %T", fs.completed[10])
+		}
+		if len(out.Refunded) != 1 || len(out.Forfeited) != 1 {
+			t.Errorf("unexpected outcome: %+v", out)
+		}
+	})
+
+	t.Run("Refund recorded after a failed run is not charged twice", func(t *testing.T) {
+		svc := payment.NewMockServiceWithDelay(0)
+		fs := newFakeStore()
+		fs.users = []store.User{{ID: 20, Status: "unlinked"}}
+		fs.addPaid(t, svc, 1, 20, 0)
+		fs.failRefund = true
+
+		p := &Processor{Store: fs, Payments: svc}
+		result, _ := p.Run(ctx)
+		if result.Failed != 1 {
+			t.Fatalf("expected first run to fail, got %+v", result)
+		}
+		if fs.payments[1].Status != "cancelling" {
+			t.Fatalf("expected payment to stay claimed, got %s", fs.payments[1].Status)
+		}
+
+		result, err := p.Run(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Processed != 1 {
+			t.Errorf("expected second run to finish, got %+v", result)
+		}
+		if fs.payments[1].Status != "refunded" {
+			t.Errorf("expected payment recorded as refunded, got %s", fs.payments[1].Status)
+		}
+	})
+
+	t.Run("Missing payment service", func(t *testing.T) {
+		if _, err := (&Processor{Store: newFakeStore()}).Run(ctx); err == nil {
+			t.Error("expected error without payment service")
+		}
+	})
+}
@@ -0,0 +1,7 @@
+-- 습관환급 (Habit Cashback) DB 마이그레이션 002
+-- 성공 정산 → 토스 포인트 지급(payout) 처리
+
+-- 지급 대기 정산 조회 (worker payout-settlements)
+CREATE INDEX IF NOT EXISTS idx_settlement_unsettled ON settlement(id)
+  WHERE status = 'success' AND settled_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_settlement_payout ON settlement(payout_id) WHERE payout_id IS NOT NULL;
@@ -0,0 +1,5 @@
+-- 습관환급 (Habit Cashback) DB 마이그레이션 003
+-- 토스 프로모션 지급 키 (execute-promotion/get-key 로 발급받은 1회용 키)
+
+ALTER TABLE payout ADD COLUMN IF NOT EXISTS toss_key TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payout_toss_key ON payout(toss_key) WHERE toss_key IS NOT NULL;
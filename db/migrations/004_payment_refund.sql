@@ -0,0 +1,7 @@
+-- 습관환급 (Habit Cashback) DB 마이그레이션 004
+-- 결제 취소/환불 (payment.status: refunded, partially_refunded)
+
+ALTER TABLE payment ADD COLUMN IF NOT EXISTS refunded_amount BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE payment ADD COLUMN IF NOT EXISTS refund_no TEXT;
+ALTER TABLE payment ADD COLUMN IF NOT EXISTS refund_reason TEXT;
+ALTER TABLE payment ADD COLUMN IF NOT EXISTS refunded_at TIMESTAMPTZ;
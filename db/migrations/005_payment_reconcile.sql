@@ -0,0 +1,6 @@
+-- 습관환급 (Habit Cashback) DB 마이그레이션 005
+-- 결제 대사(reconcile-payments): 오래된 created 결제 → done / expired / failed
+
+ALTER TABLE payment ADD COLUMN IF NOT EXISTS closed_reason TEXT;
+CREATE INDEX IF NOT EXISTS idx_payment_stale ON payment(created_at)
+  WHERE status = 'created' AND pay_token IS NOT NULL;
@@ -0,0 +1,10 @@
+-- 습관환급 (Habit Cashback) DB 마이그레이션 006
+-- 멱등성: (scope, Idempotency-Key, user) 단위로 첫 응답을 저장하고 재시도 시 재생
+
+ALTER TABLE idempotency ADD COLUMN IF NOT EXISTS user_sub TEXT NOT NULL DEFAULT '';
+ALTER TABLE idempotency ADD COLUMN IF NOT EXISTS request_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE idempotency ADD COLUMN IF NOT EXISTS status_code INT; -- NULL while the first request is in flight
+ALTER TABLE idempotency ALTER COLUMN response_json DROP NOT NULL;
+
+ALTER TABLE idempotency DROP CONSTRAINT IF EXISTS idempotency_pkey;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_idempotency_scope_key_user ON idempotency(scope, idem_key, user_sub);
@@ -0,0 +1,25 @@
+-- 습관환급 (Habit Cashback) DB 마이그레이션 007
+-- 토스 연결 해제(unlink) 처리: 사용자 상태, 인증 사진 파기 예약, 감사 로그
+
+ALTER TABLE app_user ADD COLUMN IF NOT EXISTS unlinked_at TIMESTAMPTZ;
+ALTER TABLE app_user ADD COLUMN IF NOT EXISTS unlink_processed_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS idx_app_user_unlink_pending ON app_user(unlinked_at)
+  WHERE status = 'unlinked' AND unlink_processed_at IS NULL;
+
+-- 보관 기간이 지나면 worker(purge-proofs)가 이미지 관련 정보를 지우고 익명화
+ALTER TABLE proof ADD COLUMN IF NOT EXISTS purge_after TIMESTAMPTZ;
+ALTER TABLE proof ADD COLUMN IF NOT EXISTS anonymized_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS idx_proof_purge ON proof(purge_after)
+  WHERE purge_after IS NOT NULL AND anonymized_at IS NULL;
+
+-- 감사 로그 (사용자가 삭제되어도 남김)
+CREATE TABLE IF NOT EXISTS audit_log (
+  id          BIGSERIAL PRIMARY KEY,
+  actor       TEXT NOT NULL,           -- 'system', 'toss', 'user:<id>', 'admin:<name>'
+  action      TEXT NOT NULL,           -- e.g. 'user.unlink', 'user.unlink.processed'
+  user_id     BIGINT REFERENCES app_user(id) ON DELETE SET NULL,
+  details     JSONB NOT NULL DEFAULT '{}',
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_audit_log_user ON audit_log(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_log_action ON audit_log(action, created_at DESC);
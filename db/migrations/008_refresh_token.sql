@@ -0,0 +1,19 @@
+-- 습관환급 (Habit Cashback) DB 마이그레이션 008
+-- 리프레시 토큰 (해시만 저장, 사용 시 회전, 재사용 감지 시 family 전체 폐기)
+
+CREATE TABLE IF NOT EXISTS refresh_token (
+  id            BIGSERIAL PRIMARY KEY,
+  token_hash    TEXT NOT NULL UNIQUE,      -- sha256(token) hex
+  family_id     TEXT NOT NULL,             -- 같은 로그인에서 회전된 토큰 묶음
+  parent_id     BIGINT REFERENCES refresh_token(id) ON DELETE SET NULL,
+  user_sub      TEXT NOT NULL,
+  device_id     TEXT NOT NULL DEFAULT '',
+  expires_at    TIMESTAMPTZ NOT NULL,
+  used_at       TIMESTAMPTZ,               -- 회전되어 더 이상 쓸 수 없음
+  revoked_at    TIMESTAMPTZ,
+  revoke_reason TEXT,
+  created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_refresh_token_family ON refresh_token(family_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_token_user_device ON refresh_token(user_sub, device_id) WHERE revoked_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_refresh_token_expires ON refresh_token(expires_at);
@@ -0,0 +1,7 @@
+-- 습관환급 (Habit Cashback) DB 마이그레이션 009
+-- 챌린지 관리자 API: 모집 기간 예약, 변경 이력
+
+ALTER TABLE challenge ADD COLUMN IF NOT EXISTS starts_at TIMESTAMPTZ;      -- NULL: 즉시 노출
+ALTER TABLE challenge ADD COLUMN IF NOT EXISTS ends_at TIMESTAMPTZ;        -- NULL: 종료 없음
+ALTER TABLE challenge ADD COLUMN IF NOT EXISTS deactivated_at TIMESTAMPTZ;
+ALTER TABLE challenge ADD COLUMN IF NOT EXISTS updated_by TEXT;
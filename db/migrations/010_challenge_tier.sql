@@ -0,0 +1,22 @@
+-- 습관환급 (Habit Cashback) DB 마이그레이션 010
+-- 챌린지 예치금 단계 (티어별 성공 조건 / 보상 배수)
+
+CREATE TABLE IF NOT EXISTS challenge_tier (
+  id                    BIGSERIAL PRIMARY KEY,
+  challenge_id          TEXT NOT NULL REFERENCES challenge(id) ON DELETE CASCADE,
+  deposit               BIGINT NOT NULL,
+  required_proofs       INT NOT NULL DEFAULT 0,        -- 성공에 필요한 인증 수 (0: 챌린지 기간 전체)
+  reward_multiplier_bps INT NOT NULL DEFAULT 10000,    -- 성공 시 보상 배수 (10000 = 1.00배)
+  sort_order            INT NOT NULL DEFAULT 0,
+  created_at            TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at            TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  UNIQUE(challenge_id, deposit)
+);
+
+-- 결제 시 선택한 티어
+ALTER TABLE payment ADD COLUMN IF NOT EXISTS tier_id BIGINT REFERENCES challenge_tier(id) ON DELETE SET NULL;
+
+-- 참여 시점의 티어 규칙 스냅샷 (이후 티어가 수정되어도 진행 중인 참여에는 영향 없음)
+ALTER TABLE participation ADD COLUMN IF NOT EXISTS tier_id BIGINT REFERENCES challenge_tier(id) ON DELETE SET NULL;
+ALTER TABLE participation ADD COLUMN IF NOT EXISTS required_proofs INT NOT NULL DEFAULT 0;
+ALTER TABLE participation ADD COLUMN IF NOT EXISTS reward_multiplier_bps INT NOT NULL DEFAULT 10000;
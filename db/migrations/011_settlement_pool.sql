@@ -0,0 +1,23 @@
+-- 습관환급 (Habit Cashback) DB 마이그레이션 011
+-- 보너스 풀: 같은 코호트(챌린지 + 시작일)의 실패자 예치금을 수수료 제외 후 성공자에게 분배
+
+CREATE TABLE IF NOT EXISTS settlement_pool (
+  challenge_id   TEXT NOT NULL REFERENCES challenge(id) ON DELETE RESTRICT,
+  start_date     DATE NOT NULL,
+  success_count  INT NOT NULL DEFAULT 0,
+  failed_count   INT NOT NULL DEFAULT 0,
+  forfeited      BIGINT NOT NULL DEFAULT 0,   -- 실패자 예치금 합계
+  fee_bps        INT NOT NULL DEFAULT 0,      -- 적용된 플랫폼 수수료율 (10000 = 100%)
+  fee_amount     BIGINT NOT NULL DEFAULT 0,
+  distributed    BIGINT NOT NULL DEFAULT 0,   -- 성공자에게 분배된 합계 (<= forfeited - fee_amount)
+  computed_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (challenge_id, start_date)
+);
+
+-- 보상 계산이 끝난 정산만 지급 대상
+ALTER TABLE settlement ADD COLUMN IF NOT EXISTS reward_computed_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS idx_settlement_reward_pending ON settlement(status) WHERE reward_computed_at IS NULL;
+
+-- 기존 종료 정산은 보너스 풀 없이 확정
+UPDATE settlement SET reward_computed_at = updated_at
+WHERE status IN ('success', 'failed') AND reward_computed_at IS NULL;
@@ -0,0 +1,20 @@
+-- 습관환급 (Habit Cashback) DB 마이그레이션 012
+-- 부분 성공 규칙: 최소 성공 비율, 휴식일(인증 없이 인정되는 날), 비례 환급
+
+-- 챌린지 규칙 (기본값은 기존과 같은 전부/전무)
+ALTER TABLE challenge ADD COLUMN IF NOT EXISTS min_success_bps INT NOT NULL DEFAULT 10000;  -- 성공 최소 비율 (10000 = 100%)
+ALTER TABLE challenge ADD COLUMN IF NOT EXISTS rest_days INT NOT NULL DEFAULT 0;             -- 인증 없이 인정되는 날 수
+ALTER TABLE challenge ADD COLUMN IF NOT EXISTS refund_policy TEXT NOT NULL DEFAULT 'full';   -- full | proportional
+
+-- 참여 시점의 규칙 스냅샷과 종료 시 확정된 환급 비율
+ALTER TABLE participation ADD COLUMN IF NOT EXISTS min_success_bps INT NOT NULL DEFAULT 10000;
+ALTER TABLE participation ADD COLUMN IF NOT EXISTS rest_days INT NOT NULL DEFAULT 0;
+ALTER TABLE participation ADD COLUMN IF NOT EXISTS refund_policy TEXT NOT NULL DEFAULT 'full';
+ALTER TABLE participation ADD COLUMN IF NOT EXISTS refund_bps INT NOT NULL DEFAULT 0;
+
+-- 정산 시 실제 환급할 예치금 (나머지는 보너스 풀로)
+ALTER TABLE settlement ADD COLUMN IF NOT EXISTS refund_amount BIGINT NOT NULL DEFAULT 0;
+
+-- 기존 데이터: 성공은 전액 환급
+UPDATE participation SET refund_bps = 10000 WHERE status = 'success' AND refund_bps = 0;
+UPDATE settlement SET refund_amount = deposit_amount WHERE status = 'success' AND refund_amount = 0;
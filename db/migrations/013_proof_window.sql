@@ -0,0 +1,9 @@
+-- 습관환급 (Habit Cashback) DB 마이그레이션 013
+-- 챌린지별 인증 가능 시간대 (챌린지 타임존 기준, 자정부터의 분). 시작 = 종료 = 0 이면 하루 종일
+
+ALTER TABLE challenge ADD COLUMN IF NOT EXISTS proof_window_start INT NOT NULL DEFAULT 0;
+ALTER TABLE challenge ADD COLUMN IF NOT EXISTS proof_window_end INT NOT NULL DEFAULT 0;
+
+-- 아침 7시 이불 개기: 05:00 ~ 07:00
+UPDATE challenge SET proof_window_start = 300, proof_window_end = 420
+WHERE id = 'bed-0700' AND proof_window_start = 0 AND proof_window_end = 0;
@@ -0,0 +1,10 @@
+-- 습관환급 (Habit Cashback) DB 마이그레이션 014
+-- EXIF 없는 사진 처리 정책: accept(인정) | accept_flagged_for_review(검토 후 인정) | reject(거절)
+
+ALTER TABLE challenge ADD COLUMN IF NOT EXISTS missing_exif_policy TEXT NOT NULL DEFAULT 'accept';
+
+-- 검토 대기(pending)로 보낸 이유 (예: missing_exif)
+ALTER TABLE proof ADD COLUMN IF NOT EXISTS review_reason TEXT;
+
+-- 지금까지는 제출 즉시 인정되었으므로 인정 시각을 제출 시각으로 채움
+UPDATE proof SET verified_at = created_at WHERE status = 'accepted' AND verified_at IS NULL;
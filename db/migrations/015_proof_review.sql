@@ -0,0 +1,8 @@
+-- 습관환급 (Habit Cashback) DB 마이그레이션 015
+-- 인증 검토 큐: 검토 대기(pending) 인증을 관리자가 인정/거부
+
+-- 결정한 검토자 (admin:<name>). 상세 내역은 audit_log (proof.accept / proof.reject)
+ALTER TABLE proof ADD COLUMN IF NOT EXISTS reviewed_by TEXT;
+
+-- 검토 대기 목록 조회 (오래된 순)
+CREATE INDEX IF NOT EXISTS idx_proof_pending ON proof(id) WHERE status = 'pending';
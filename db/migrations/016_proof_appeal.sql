@@ -0,0 +1,24 @@
+-- 습관환급 (Habit Cashback) DB 마이그레이션 016
+-- 인증 이의신청: 거부되었거나 인증하지 못한 날에 대해 사용자가 재검토 요청
+
+CREATE TABLE IF NOT EXISTS proof_appeal (
+  id               BIGSERIAL PRIMARY KEY,
+  participation_id BIGINT NOT NULL REFERENCES participation(id) ON DELETE CASCADE,
+  user_id          BIGINT NOT NULL REFERENCES app_user(id) ON DELETE CASCADE,
+  challenge_id     TEXT NOT NULL REFERENCES challenge(id) ON DELETE RESTRICT,
+  proof_date       DATE NOT NULL,               -- 이의신청 대상 인증일
+  proof_id         BIGINT REFERENCES proof(id) ON DELETE SET NULL, -- 거부된 인증 (미인증일이면 NULL)
+  note             TEXT NOT NULL,               -- 사용자 소명
+  image_hash       TEXT,                        -- 추가 제출 이미지 해시
+  status           TEXT NOT NULL DEFAULT 'pending', -- pending | accepted | rejected
+  decision_reason  TEXT,                        -- 검토자 사유
+  reviewed_by      TEXT,                        -- 검토자 (admin:<name>)
+  decided_at       TIMESTAMPTZ,
+  purge_after      TIMESTAMPTZ,                 -- 연결 해제 시 소명/이미지 파기 예정 시각
+  created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  UNIQUE(participation_id, proof_date)          -- 인증일당 1회
+);
+
+CREATE INDEX IF NOT EXISTS idx_proof_appeal_user ON proof_appeal(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_proof_appeal_pending ON proof_appeal(id) WHERE status = 'pending';
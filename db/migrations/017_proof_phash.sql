@@ -0,0 +1,15 @@
+-- 습관환급 (Habit Cashback) DB 마이그레이션 017
+-- 유사 이미지 탐지: 인증 사진의 지각 해시(dHash, 64비트)와 해밍 거리 검색용 인덱스
+
+-- 원본 이미지가 없어 기존 인증은 채우지 않음 (NULL)
+ALTER TABLE proof ADD COLUMN IF NOT EXISTS phash BIGINT;
+
+-- 64비트를 6개 구간(11,11,11,11,10,10비트)으로 나눈 표현식 인덱스.
+-- 해밍 거리 5 이하인 두 해시는 적어도 한 구간이 정확히 같으므로(비둘기집 원리)
+-- 구간 일치로 후보를 좁힌 뒤 거리를 계산합니다. 검색 쿼리의 표현식과 동일해야 합니다.
+CREATE INDEX IF NOT EXISTS idx_proof_phash_b0 ON proof ((phash & 2047)) WHERE phash IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_proof_phash_b1 ON proof (((phash >> 11) & 2047)) WHERE phash IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_proof_phash_b2 ON proof (((phash >> 22) & 2047)) WHERE phash IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_proof_phash_b3 ON proof (((phash >> 33) & 2047)) WHERE phash IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_proof_phash_b4 ON proof (((phash >> 44) & 1023)) WHERE phash IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_proof_phash_b5 ON proof (((phash >> 54) & 1023)) WHERE phash IS NOT NULL;
@@ -0,0 +1,21 @@
+-- 습관환급 (Habit Cashback) DB 마이그레이션 018
+-- 인증 사진 원본 저장: 객체 저장소(디스크/S3 호환)에 올린 이미지 목록과 보관 기간 관리
+
+-- 저장소에 올린 이미지. 키는 내용의 SHA-256 (proofs/ab/<sha256>.jpg)이라 같은 사진은 한 번만 저장됩니다.
+-- 참조하는 인증/이의신청이 없어지거나 보관 기간(PROOF_IMAGE_RETENTION_DAYS)이 지나면 purge-images 작업이 삭제합니다.
+CREATE TABLE IF NOT EXISTS proof_image (
+  key          TEXT PRIMARY KEY,                   -- 객체 키
+  url          TEXT NOT NULL,                      -- proof.image_url / proof_appeal.image_url 에 기록되는 URL
+  size_bytes   BIGINT NOT NULL,
+  created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  last_used_at TIMESTAMPTZ NOT NULL DEFAULT NOW()  -- 같은 사진이 다시 제출된 마지막 시각
+);
+
+CREATE INDEX IF NOT EXISTS idx_proof_image_last_used ON proof_image(last_used_at);
+
+-- 이의신청 추가 이미지
+ALTER TABLE proof_appeal ADD COLUMN IF NOT EXISTS image_url TEXT;
+
+-- 이미지 삭제 시 참조를 찾기 위한 인덱스
+CREATE INDEX IF NOT EXISTS idx_proof_image_url ON proof(image_url) WHERE image_url IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_proof_appeal_image_url ON proof_appeal(image_url) WHERE image_url IS NOT NULL;
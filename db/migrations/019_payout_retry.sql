@@ -0,0 +1,9 @@
+-- 습관환급 (Habit Cashback) DB 마이그레이션 019
+-- 실패한 지급 재시도: 정산별 지급 시도 횟수 (시도마다 새 promotion_key로 payout 생성)
+
+ALTER TABLE settlement ADD COLUMN IF NOT EXISTS payout_attempts INT NOT NULL DEFAULT 0;
+-- 관리자가 다시 대기열에 넣은 시점의 시도 횟수: 시도 한도는 이후 시도만 세고, 키 번호는 이어서 증가
+ALTER TABLE settlement ADD COLUMN IF NOT EXISTS payout_requeued_attempts INT NOT NULL DEFAULT 0;
+
+-- 이미 지급을 시도한 정산은 첫 시도(hc-settlement-<id>)로 기록
+UPDATE settlement SET payout_attempts = 1 WHERE payout_id IS NOT NULL AND payout_attempts = 0;